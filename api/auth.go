@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"connectrpc.com/connect"
-	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/golang-jwt/jwt"
+	ghapi "github.com/google/go-github/v69/github"
 	"github.com/safedep/dry/log"
 	"github.com/safedep/ghcp/pkg/adapters/github"
 	"github.com/safedep/ghcp/pkg/gh"
@@ -16,27 +18,69 @@ import (
 
 type AuthenticationInterceptorConfig struct {
 	MockAuthentication bool
+
+	// Audiences accepted in the GitHub Workload Identity Token. Tokens
+	// issued for any other audience are rejected.
+	Audiences []string
+
+	// Trusted issuers of GitHub Workload Identity Token. Defaults to github.com
+	Issuers []gh.IssuerConfig
 }
 
 type authenticationInterceptor struct {
-	config   AuthenticationInterceptorConfig
-	provider *oidc.Provider
+	// Replaced when the configuration is updated. Requests use
+	// the authenticator current when they were received.
+	authenticator atomic.Pointer[authenticator]
+}
+
+// authenticator authenticates requests with a configuration
+type authenticator struct {
+	config  AuthenticationInterceptorConfig
+	issuers *gh.IssuerRegistry
 }
 
+var _ connect.Interceptor = &authenticationInterceptor{}
+
 // AuthInterceptor is a Connect interceptor that authenticates requests
 // using GitHub Workload Identity Token.
-func NewAuthenticationInterceptor(config AuthenticationInterceptorConfig) (connect.Interceptor, error) {
-	provider, err := oidc.NewProvider(context.Background(), "https://token.actions.githubusercontent.com")
+func NewAuthenticationInterceptor(config AuthenticationInterceptorConfig) (*authenticationInterceptor, error) {
+	i := &authenticationInterceptor{}
+	if err := i.UpdateConfig(config); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// UpdateConfig replaces the configuration used to authenticate requests. The
+// configuration is left unchanged on error. In-flight requests are not affected.
+func (i *authenticationInterceptor) UpdateConfig(config AuthenticationInterceptorConfig) error {
+	a, err := newAuthenticator(config)
+	if err != nil {
+		return err
+	}
+
+	i.authenticator.Store(a)
+	return nil
+}
+
+func newAuthenticator(config AuthenticationInterceptorConfig) (*authenticator, error) {
+	if len(config.Issuers) == 0 {
+		config.Issuers = []gh.IssuerConfig{gh.GitHubIssuer()}
+	}
+
+	issuers, err := gh.NewIssuerRegistry(config.Issuers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create OIDC provider for GitHub Workload Identity: %w", err)
+		return nil, fmt.Errorf("failed to create issuer registry for GitHub Workload Identity: %w", err)
 	}
 
-	return &authenticationInterceptor{config: config, provider: provider}, nil
+	return &authenticator{config: config, issuers: issuers}, nil
 }
 
 func (i *authenticationInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
 	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
-		if i.config.MockAuthentication {
+		a := i.authenticator.Load()
+		if a.config.MockAuthentication {
 			return next(ctx, req)
 		}
 
@@ -53,10 +97,10 @@ func (i *authenticationInterceptor) WrapUnary(next connect.UnaryFunc) connect.Un
 		var tokenContext gh.GitHubTokenContext
 		var err error
 
-		if i.isPAT(authHeader) {
-			tokenContext, err = i.authenticateUsingPAT(ctx, authHeader)
+		if a.isPAT(authHeader) {
+			tokenContext, err = a.authenticateUsingPAT(ctx, authHeader)
 		} else {
-			tokenContext, err = i.authenticateUsingJWT(ctx, authHeader)
+			tokenContext, err = a.authenticateUsingJWT(ctx, authHeader)
 		}
 
 		if err != nil {
@@ -68,7 +112,7 @@ func (i *authenticationInterceptor) WrapUnary(next connect.UnaryFunc) connect.Un
 	}
 }
 
-func (i *authenticationInterceptor) isPAT(token string) bool {
+func (a *authenticator) isPAT(token string) bool {
 	// https://github.blog/changelog/2021-03-31-authentication-token-format-updates-are-generally-available/
 	var validPatPrefixes = []string{
 		"ghp_",
@@ -87,7 +131,7 @@ func (i *authenticationInterceptor) isPAT(token string) bool {
 }
 
 // authenticateUsingPAT authenticates the PAT token and returns the internal GitHub token context
-func (i *authenticationInterceptor) authenticateUsingPAT(ctx context.Context, token string) (gh.GitHubTokenContext, error) {
+func (a *authenticator) authenticateUsingPAT(ctx context.Context, token string) (gh.GitHubTokenContext, error) {
 	log.Debugf("Authenticating using GITHUB_TOKEN")
 
 	adapter, err := github.NewGitHubAdapter(github.GitHubAdapterConfig{
@@ -115,34 +159,74 @@ func (i *authenticationInterceptor) authenticateUsingPAT(ctx context.Context, to
 		return tokenContext, nil
 	}
 
-	// Fallback to just validating the token by making a request to the GitHub API
-	// This is the case for GITHUB_TOKEN injected by GitHub Actions
-	_, err = adapter.GetRateLimits(ctx)
+	// Fallback to introspecting the installation the token was issued for.
+	// This is the case for GITHUB_TOKEN injected by GitHub Actions. The token
+	// is scoped to the repository running the workflow, which lets the service
+	// bind the request to the repositories the token can actually access.
+	repositories, err := adapter.ListInstallationRepositories(ctx)
 	if err != nil {
 		return gh.GitHubTokenContext{}, fmt.Errorf("failed to validate token: %w", err)
 	}
 
-	// We can't really do meaningful authorization with a GHA token without
-	// having access to the request. So we just create a token and mark it as
-	// action token for the service to do its own authorization.
+	if len(repositories) == 0 {
+		return gh.GitHubTokenContext{}, fmt.Errorf("token does not have access to any repository")
+	}
+
+	tokenContext = actionTokenContext(repositories)
+
+	log.Debugf("Token context: %+v", tokenContext)
 
-	tokenContext.TokenType = gh.TokenTypeAction
 	return tokenContext, nil
 }
 
+// actionTokenContext builds the token context for a GITHUB_TOKEN from the
+// repositories accessible to its installation
+func actionTokenContext(repositories []*ghapi.Repository) gh.GitHubTokenContext {
+	tokenContext := gh.GitHubTokenContext{
+		TokenType: gh.TokenTypeAction,
+	}
+
+	for _, repository := range repositories {
+		tokenContext.Repositories = append(tokenContext.Repositories, gh.GitHubTokenRepository{
+			ID:       strconv.FormatInt(repository.GetID(), 10),
+			FullName: repository.GetFullName(),
+		})
+	}
+
+	// A GITHUB_TOKEN is issued for a single repository. We expose it
+	// using the same fields as the workload identity token claims.
+	if len(repositories) == 1 {
+		repository := repositories[0]
+
+		tokenContext.Repository = repository.GetFullName()
+		tokenContext.RepositoryID = strconv.FormatInt(repository.GetID(), 10)
+		tokenContext.RepositoryOwner = repository.GetOwner().GetLogin()
+		tokenContext.RepositoryOwnerID = strconv.FormatInt(repository.GetOwner().GetID(), 10)
+		tokenContext.RepositoryVisibility = repository.GetVisibility()
+	}
+
+	return tokenContext
+}
+
 // authenticateUsingJWT authenticates the OIDC token and returns the internal GitHub token context
-func (i *authenticationInterceptor) authenticateUsingJWT(ctx context.Context, authHeader string) (gh.GitHubTokenContext, error) {
+func (a *authenticator) authenticateUsingJWT(ctx context.Context, authHeader string) (gh.GitHubTokenContext, error) {
 	log.Debugf("Authenticating using Workload Identity Token (JWT)")
 
 	var tokenContext gh.GitHubTokenContext
 
-	// Authenticate the OIDC token
-	verifier := i.provider.Verifier(&oidc.Config{SkipClientIDCheck: true})
-	_, err := verifier.Verify(ctx, authHeader)
+	// Authenticate the OIDC token using the issuer of the token. The
+	// audience is verified against the accepted audiences
+	idToken, err := a.issuers.Verify(ctx, authHeader)
 	if err != nil {
+		log.Debugf("Token verification failed: %s", err)
 		return tokenContext, connect.NewError(connect.CodeUnauthenticated, errors.New("token verification failed"))
 	}
 
+	if !a.isAcceptedAudience(idToken.Audience) {
+		return tokenContext, connect.NewError(connect.CodeUnauthenticated,
+			fmt.Errorf("token audience is not accepted: %v", idToken.Audience))
+	}
+
 	// We need to re-parse the token to get the GitHub specific claims
 	// We don't need to validate the token, we just need to parse it
 	parser := &jwt.Parser{}
@@ -162,6 +246,8 @@ func (i *authenticationInterceptor) authenticateUsingJWT(ctx context.Context, au
 		tokenContext.Subject = s
 	}
 
+	tokenContext.Audience = audienceClaim(claims["aud"])
+
 	if s, ok := claims["environment"].(string); ok {
 		tokenContext.Environment = s
 	}
@@ -218,12 +304,72 @@ func (i *authenticationInterceptor) authenticateUsingJWT(ctx context.Context, au
 		tokenContext.WorkflowRef = s
 	}
 
+	if s, ok := claims["workflow_sha"].(string); ok {
+		tokenContext.WorkflowSHA = s
+	}
+
+	if s, ok := claims["job_workflow_ref"].(string); ok {
+		tokenContext.JobWorkflowRef = s
+	}
+
+	if s, ok := claims["head_ref"].(string); ok {
+		tokenContext.HeadRef = s
+	}
+
+	if s, ok := claims["base_ref"].(string); ok {
+		tokenContext.BaseRef = s
+	}
+
+	if s, ok := claims["ref_type"].(string); ok {
+		tokenContext.RefType = s
+	}
+
+	if s, ok := claims["event_name"].(string); ok {
+		tokenContext.EventName = s
+	}
+
 	log.Debugf("Token context: %+v", tokenContext)
 
 	tokenContext.TokenType = gh.TokenTypeWorkloadIdentity
 	return tokenContext, nil
 }
 
+// isAcceptedAudience returns true if any of the audiences is accepted
+func (a *authenticator) isAcceptedAudience(audiences []string) bool {
+	for _, audience := range audiences {
+		for _, accepted := range a.config.Audiences {
+			if strings.EqualFold(audience, accepted) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// audienceClaim returns the audiences from the aud claim which
+// can be either a string or an array of strings
+// https://datatracker.ietf.org/doc/html/rfc7519#section-4.1.3
+func audienceClaim(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		var audiences []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+
+		return audiences
+	default:
+		return nil
+	}
+}
+
 func (i *authenticationInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
 	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
 		return nil
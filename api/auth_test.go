@@ -3,11 +3,13 @@ package api
 import (
 	"testing"
 
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/gh"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestIsPAT(t *testing.T) {
-	s := &authenticationInterceptor{}
+	s := &authenticator{}
 
 	t.Run("should return true if the token starts with a valid PAT prefix", func(t *testing.T) {
 		assert.True(t, s.isPAT("ghp_1234567890"))
@@ -20,3 +22,68 @@ func TestIsPAT(t *testing.T) {
 		assert.False(t, s.isPAT("1234567890"))
 	})
 }
+
+func TestActionTokenContext(t *testing.T) {
+	t.Run("should bind token context to the installation repository", func(t *testing.T) {
+		tokenContext := actionTokenContext([]*ghapi.Repository{
+			{
+				ID:         ghapi.Ptr(int64(100)),
+				FullName:   ghapi.Ptr("safedep/ghcp"),
+				Visibility: ghapi.Ptr("public"),
+				Owner:      &ghapi.User{ID: ghapi.Ptr(int64(10)), Login: ghapi.Ptr("safedep")},
+			},
+		})
+
+		assert.True(t, tokenContext.IsActionToken())
+		assert.Equal(t, "safedep/ghcp", tokenContext.Repository)
+		assert.Equal(t, "100", tokenContext.RepositoryID)
+		assert.Equal(t, "safedep", tokenContext.RepositoryOwner)
+		assert.Equal(t, "10", tokenContext.RepositoryOwnerID)
+		assert.Equal(t, "public", tokenContext.RepositoryVisibility)
+		assert.Equal(t, []gh.GitHubTokenRepository{{ID: "100", FullName: "safedep/ghcp"}}, tokenContext.Repositories)
+	})
+
+	t.Run("should not set a single repository when token has access to multiple repositories", func(t *testing.T) {
+		tokenContext := actionTokenContext([]*ghapi.Repository{
+			{ID: ghapi.Ptr(int64(100)), FullName: ghapi.Ptr("safedep/ghcp")},
+			{ID: ghapi.Ptr(int64(200)), FullName: ghapi.Ptr("safedep/vet")},
+		})
+
+		assert.Empty(t, tokenContext.Repository)
+		assert.Len(t, tokenContext.Repositories, 2)
+
+		repository, ok := tokenContext.FindRepository("SafeDep/Vet")
+		assert.True(t, ok)
+		assert.Equal(t, "200", repository.ID)
+	})
+}
+
+func TestAudienceClaim(t *testing.T) {
+	cases := []struct {
+		name     string
+		claim    interface{}
+		expected []string
+	}{
+		{"string", "safedep-ghcp", []string{"safedep-ghcp"}},
+		{"array", []interface{}{"safedep-ghcp", "other"}, []string{"safedep-ghcp", "other"}},
+		{"array with non string", []interface{}{"safedep-ghcp", 1}, []string{"safedep-ghcp"}},
+		{"missing", nil, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, audienceClaim(c.claim))
+		})
+	}
+}
+
+func TestIsAcceptedAudience(t *testing.T) {
+	s := &authenticator{config: AuthenticationInterceptorConfig{
+		Audiences: []string{"safedep-ghcp", "safedep-other"},
+	}}
+
+	assert.True(t, s.isAcceptedAudience([]string{"safedep-ghcp"}))
+	assert.True(t, s.isAcceptedAudience([]string{"unknown", "safedep-other"}))
+	assert.False(t, s.isAcceptedAudience([]string{"unknown"}))
+	assert.False(t, s.isAcceptedAudience(nil))
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonCodec is a Connect codec for request and response messages that are
+// not generated from the API schema. These are served alongside the generated
+// service until the API schema has the messages.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	return nil
+}
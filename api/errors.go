@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"connectrpc.com/connect"
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/ratelimit"
+	"github.com/safedep/ghcp/services/ghcp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Response header with the number of seconds to wait before retrying
+const retryAfterHeader = "Retry-After"
+
+// Domain of the reasons in the error details
+const errorDomain = "ghcp.safedep.io"
+
+var errorCodes = map[ghcp.ErrorCode]connect.Code{
+	ghcp.ErrorCodePermissionDenied:   connect.CodePermissionDenied,
+	ghcp.ErrorCodeFailedPrecondition: connect.CodeFailedPrecondition,
+	ghcp.ErrorCodeResourceExhausted:  connect.CodeResourceExhausted,
+	ghcp.ErrorCodeNotFound:           connect.CodeNotFound,
+	ghcp.ErrorCodeUnavailable:        connect.CodeUnavailable,
+	ghcp.ErrorCodeInvalidArgument:    connect.CodeInvalidArgument,
+	ghcp.ErrorCodeAborted:            connect.CodeAborted,
+}
+
+// serviceError converts an error of the service into the error returned to the
+// client. Errors the client can act on are returned with their code along with
+// the reason, and when to retry, in the details.
+func serviceError(err error) error {
+	var serviceErr *ghcp.Error
+	if !errors.As(err, &serviceErr) {
+		return fmt.Errorf("failed to execute GHCP service: %w", err)
+	}
+
+	code, ok := errorCodes[serviceErr.Code]
+	if !ok {
+		code = connect.CodeUnknown
+	}
+
+	connectErr := connect.NewError(code, err)
+	addErrorDetail(connectErr, &errdetails.ErrorInfo{
+		Reason: serviceErr.Reason,
+		Domain: errorDomain,
+	})
+
+	var limitErr *ratelimit.LimitExceededError
+	if errors.As(err, &limitErr) {
+		addErrorDetail(connectErr, &errdetails.RetryInfo{
+			RetryDelay: durationpb.New(limitErr.RetryAfter),
+		})
+
+		connectErr.Meta().Set(retryAfterHeader,
+			strconv.FormatInt(int64(math.Ceil(limitErr.RetryAfter.Seconds())), 10))
+	}
+
+	return connectErr
+}
+
+func addErrorDetail(connectErr *connect.Error, msg proto.Message) {
+	detail, err := connect.NewErrorDetail(msg)
+	if err != nil {
+		log.Errorf("failed to create error detail: %s", err)
+		return
+	}
+
+	connectErr.AddDetail(detail)
+}
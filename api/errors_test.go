@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/ratelimit"
+	"github.com/safedep/ghcp/services/ghcp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+func TestServiceError(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		code   connect.Code
+		reason string
+	}{
+		{
+			name: "authorization failure",
+			err: fmt.Errorf("failed: %w", &ghcp.Error{Code: ghcp.ErrorCodePermissionDenied,
+				Reason: ghcp.ErrorReasonUnauthorized, Err: errors.New("repository is not public")}),
+			code:   connect.CodePermissionDenied,
+			reason: ghcp.ErrorReasonUnauthorized,
+		},
+		{
+			name: "closed pull request",
+			err: &ghcp.Error{Code: ghcp.ErrorCodeFailedPrecondition,
+				Reason: ghcp.ErrorReasonPullRequestClosed, Err: errors.New("pull request is not open: closed")},
+			code:   connect.CodeFailedPrecondition,
+			reason: ghcp.ErrorReasonPullRequestClosed,
+		},
+		{
+			name: "comment limit",
+			err: &ghcp.Error{Code: ghcp.ErrorCodeResourceExhausted,
+				Reason: ghcp.ErrorReasonCommentLimitReached, Err: errors.New("maximum number of comments (3) reached for PR")},
+			code:   connect.CodeResourceExhausted,
+			reason: ghcp.ErrorReasonCommentLimitReached,
+		},
+		{
+			name: "missing tag",
+			err: &ghcp.Error{Code: ghcp.ErrorCodeNotFound,
+				Reason: ghcp.ErrorReasonTagNotFound, Err: errors.New("no comment found with Tag: test-tag")},
+			code:   connect.CodeNotFound,
+			reason: ghcp.ErrorReasonTagNotFound,
+		},
+		{
+			name: "github unavailable",
+			err: &ghcp.Error{Code: ghcp.ErrorCodeUnavailable,
+				Reason: ghcp.ErrorReasonGitHubUnavailable, Err: &ghapi.ErrorResponse{Response: &http.Response{StatusCode: 502}}},
+			code:   connect.CodeUnavailable,
+			reason: ghcp.ErrorReasonGitHubUnavailable,
+		},
+		{
+			name: "unclassified error",
+			err:  errors.New("failed to convert pr number to int"),
+			code: connect.CodeUnknown,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := serviceError(c.err)
+			assert.Equal(t, c.code, connect.CodeOf(err))
+			assert.ErrorContains(t, err, c.err.Error())
+
+			var connectErr *connect.Error
+			if c.reason == "" {
+				assert.False(t, errors.As(err, &connectErr))
+				return
+			}
+
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Len(t, connectErr.Details(), 1)
+
+			detail, err := connectErr.Details()[0].Value()
+			assert.NoError(t, err)
+
+			errorInfo, ok := detail.(*errdetails.ErrorInfo)
+			assert.True(t, ok)
+			assert.Equal(t, c.reason, errorInfo.GetReason())
+			assert.Equal(t, "ghcp.safedep.io", errorInfo.GetDomain())
+		})
+	}
+
+	t.Run("rate limit exceeded", func(t *testing.T) {
+		err := serviceError(&ghcp.Error{
+			Code:   ghcp.ErrorCodeResourceExhausted,
+			Reason: ghcp.ErrorReasonRateLimited,
+			Err: &ratelimit.LimitExceededError{
+				Scope:      ratelimit.ScopeRepository,
+				Key:        "safedep/ghcp",
+				RetryAfter: 1500 * time.Millisecond,
+			},
+		})
+
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connect.CodeResourceExhausted, connectErr.Code())
+		assert.Equal(t, "2", connectErr.Meta().Get("Retry-After"))
+		assert.Len(t, connectErr.Details(), 2)
+
+		detail, err := connectErr.Details()[1].Value()
+		assert.NoError(t, err)
+
+		retryInfo, ok := detail.(*errdetails.RetryInfo)
+		assert.True(t, ok)
+		assert.Equal(t, 1500*time.Millisecond, retryInfo.GetRetryDelay().AsDuration())
+	})
+}
@@ -3,28 +3,96 @@ package api
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
+	"strings"
 
 	"buf.build/gen/go/safedep/api/connectrpc/go/safedep/services/ghcp/v1/ghcpv1connect"
 	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
 	"connectrpc.com/connect"
 	"github.com/safedep/dry/log"
 	"github.com/safedep/ghcp/services"
+	"github.com/safedep/ghcp/services/ghcp"
+)
+
+// Response header with the action performed on the comment
+// (created or updated). The API response does not carry it.
+const CommentActionHeader = "Ghcp-Comment-Action"
+
+// Request header with the idempotency key of a comment request. A retried
+// request with the same key returns the result of the original request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Response header set to true when the result is of an earlier
+// request with the same idempotency key
+const IdempotentReplayedHeader = "Ghcp-Idempotent-Replayed"
+
+// Response header with the signed receipt of the comment, when receipts are enabled
+const ReceiptHeader = "Ghcp-Receipt"
+
+// Request header with the preferences of the client (RFC 7240). With
+// respond-async, the comment is queued and the response has the job ID.
+const PreferHeader = "Prefer"
+
+// Response header with the preferences applied to the request
+const PreferenceAppliedHeader = "Preference-Applied"
+
+// Preference requesting asynchronous delivery of the comment
+const respondAsyncPreference = "respond-async"
+
+// Response header with the ID of the job delivering a queued comment
+const JobIDHeader = "Ghcp-Job-Id"
+
+// Procedures served alongside the generated service. The messages are
+// not in the API schema, they are served using the JSON codec.
+const (
+	GitHubCommentsProxyServiceDeletePullRequestCommentProcedure = "/" +
+		ghcpv1connect.GitHubCommentsProxyServiceName + "/DeletePullRequestComment"
+	GitHubCommentsProxyServiceCreatePullRequestReviewProcedure = "/" +
+		ghcpv1connect.GitHubCommentsProxyServiceName + "/CreatePullRequestReview"
+	GitHubCommentsProxyServiceCreateCheckRunProcedure = "/" +
+		ghcpv1connect.GitHubCommentsProxyServiceName + "/CreateCheckRun"
+	GitHubCommentsProxyServiceCreateCommitStatusProcedure = "/" +
+		ghcpv1connect.GitHubCommentsProxyServiceName + "/CreateCommitStatus"
+	GitHubCommentsProxyServiceGetDeliveryJobProcedure = "/" +
+		ghcpv1connect.GitHubCommentsProxyServiceName + "/GetDeliveryJob"
 )
 
 type serviceSignature = services.Service[*ghcpv1.CreatePullRequestCommentRequest,
 	*ghcpv1.CreatePullRequestCommentResponse]
 
+// pullRequestCommentService is the service signature along with
+// the details of the result not available in the API response
+type pullRequestCommentService interface {
+	serviceSignature
+
+	CreatePullRequestComment(context.Context,
+		*ghcpv1.CreatePullRequestCommentRequest) (*ghcp.PullRequestCommentResult, error)
+
+	DeletePullRequestComment(context.Context,
+		*ghcp.DeletePullRequestCommentRequest) (*ghcp.DeletePullRequestCommentResponse, error)
+
+	CreatePullRequestReview(context.Context,
+		*ghcp.CreatePullRequestReviewRequest) (*ghcp.CreatePullRequestReviewResponse, error)
+
+	CreateCheckRun(context.Context,
+		*ghcp.CreateCheckRunRequest) (*ghcp.CreateCheckRunResponse, error)
+
+	CreateCommitStatus(context.Context,
+		*ghcp.CreateCommitStatusRequest) (*ghcp.CreateCommitStatusResponse, error)
+
+	GetDeliveryJob(context.Context,
+		*ghcp.GetDeliveryJobRequest) (*ghcp.GetDeliveryJobResponse, error)
+}
+
 type ghcpServiceHandler struct {
 	ghcpv1connect.UnimplementedGitHubCommentsProxyServiceHandler
 
-	ghcpService serviceSignature
+	ghcpService pullRequestCommentService
 }
 
 var _ Handler = &ghcpServiceHandler{}
 
-func NewGhcpServiceHandler(ghcpService serviceSignature) (*ghcpServiceHandler, error) {
+func NewGhcpServiceHandler(ghcpService pullRequestCommentService) (*ghcpServiceHandler, error) {
 	return &ghcpServiceHandler{
 		ghcpService: ghcpService,
 	}, nil
@@ -36,7 +104,31 @@ func (h *ghcpServiceHandler) Name() string {
 
 func (h *ghcpServiceHandler) Build(opts ...connect.HandlerOption) (string, http.Handler, error) {
 	path, handler := ghcpv1connect.NewGitHubCommentsProxyServiceHandler(h, opts...)
-	return path, handler, nil
+
+	jsonOpts := append([]connect.HandlerOption{}, opts...)
+	jsonOpts = append(jsonOpts, connect.WithCodec(jsonCodec{}))
+
+	// The generated handler serves all procedures under the service path,
+	// procedures not in the API schema are routed before it
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	mux.Handle(GitHubCommentsProxyServiceDeletePullRequestCommentProcedure,
+		connect.NewUnaryHandler(GitHubCommentsProxyServiceDeletePullRequestCommentProcedure,
+			h.DeletePullRequestComment, jsonOpts...))
+	mux.Handle(GitHubCommentsProxyServiceCreatePullRequestReviewProcedure,
+		connect.NewUnaryHandler(GitHubCommentsProxyServiceCreatePullRequestReviewProcedure,
+			h.CreatePullRequestReview, jsonOpts...))
+	mux.Handle(GitHubCommentsProxyServiceCreateCheckRunProcedure,
+		connect.NewUnaryHandler(GitHubCommentsProxyServiceCreateCheckRunProcedure,
+			h.CreateCheckRun, jsonOpts...))
+	mux.Handle(GitHubCommentsProxyServiceCreateCommitStatusProcedure,
+		connect.NewUnaryHandler(GitHubCommentsProxyServiceCreateCommitStatusProcedure,
+			h.CreateCommitStatus, jsonOpts...))
+	mux.Handle(GitHubCommentsProxyServiceGetDeliveryJobProcedure,
+		connect.NewUnaryHandler(GitHubCommentsProxyServiceGetDeliveryJobProcedure,
+			h.GetDeliveryJob, jsonOpts...))
+
+	return path, mux, nil
 }
 
 func (h *ghcpServiceHandler) CreatePullRequestComment(ctx context.Context,
@@ -47,9 +139,132 @@ func (h *ghcpServiceHandler) CreatePullRequestComment(ctx context.Context,
 			errors.New("request message is nil"))
 	}
 
-	res, err := h.ghcpService.Execute(ctx, req.Msg)
+	if key := req.Header().Get(IdempotencyKeyHeader); key != "" {
+		ctx = ghcp.InjectIdempotencyKey(ctx, key)
+	}
+
+	if prefersRespondAsync(req.Header().Values(PreferHeader)) {
+		ctx = ghcp.InjectAsyncDelivery(ctx)
+	}
+
+	res, err := h.ghcpService.CreatePullRequestComment(ctx, req.Msg)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	response := connect.NewResponse(res.Response)
+	response.Header().Set(CommentActionHeader, string(res.Action))
+
+	if res.Replayed {
+		response.Header().Set(IdempotentReplayedHeader, "true")
+	}
+
+	if res.Receipt != "" {
+		response.Header().Set(ReceiptHeader, res.Receipt)
+	}
+
+	// The comment is delivered synchronously when the
+	// server does not have asynchronous delivery enabled
+	if res.JobID != "" {
+		response.Header().Set(PreferenceAppliedHeader, respondAsyncPreference)
+		response.Header().Set(JobIDHeader, res.JobID)
+	}
+
+	return response, nil
+}
+
+// prefersRespondAsync returns true when the preferences of
+// the client in the Prefer headers include respond-async
+func prefersRespondAsync(values []string) bool {
+	for _, value := range values {
+		for _, preference := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(preference, ";")
+			name, _, _ = strings.Cut(name, "=")
+
+			if strings.EqualFold(strings.TrimSpace(name), respondAsyncPreference) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (h *ghcpServiceHandler) DeletePullRequestComment(ctx context.Context,
+	req *connect.Request[ghcp.DeletePullRequestCommentRequest]) (*connect.Response[ghcp.DeletePullRequestCommentResponse], error) {
+	log.Debugf("DeletePullRequestComment request received: %v", req.Msg)
+	if req.Msg == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			errors.New("request message is nil"))
+	}
+
+	res, err := h.ghcpService.DeletePullRequestComment(ctx, req.Msg)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+func (h *ghcpServiceHandler) CreatePullRequestReview(ctx context.Context,
+	req *connect.Request[ghcp.CreatePullRequestReviewRequest]) (*connect.Response[ghcp.CreatePullRequestReviewResponse], error) {
+	log.Debugf("CreatePullRequestReview request received: %v", req.Msg)
+	if req.Msg == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			errors.New("request message is nil"))
+	}
+
+	res, err := h.ghcpService.CreatePullRequestReview(ctx, req.Msg)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+func (h *ghcpServiceHandler) CreateCheckRun(ctx context.Context,
+	req *connect.Request[ghcp.CreateCheckRunRequest]) (*connect.Response[ghcp.CreateCheckRunResponse], error) {
+	log.Debugf("CreateCheckRun request received: %v", req.Msg)
+	if req.Msg == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			errors.New("request message is nil"))
+	}
+
+	res, err := h.ghcpService.CreateCheckRun(ctx, req.Msg)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+func (h *ghcpServiceHandler) CreateCommitStatus(ctx context.Context,
+	req *connect.Request[ghcp.CreateCommitStatusRequest]) (*connect.Response[ghcp.CreateCommitStatusResponse], error) {
+	log.Debugf("CreateCommitStatus request received: %v", req.Msg)
+	if req.Msg == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			errors.New("request message is nil"))
+	}
+
+	res, err := h.ghcpService.CreateCommitStatus(ctx, req.Msg)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+func (h *ghcpServiceHandler) GetDeliveryJob(ctx context.Context,
+	req *connect.Request[ghcp.GetDeliveryJobRequest]) (*connect.Response[ghcp.GetDeliveryJobResponse], error) {
+	log.Debugf("GetDeliveryJob request received: %v", req.Msg)
+	if req.Msg == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			errors.New("request message is nil"))
+	}
+
+	res, err := h.ghcpService.GetDeliveryJob(ctx, req.Msg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute GHCP service: %w", err)
+		return nil, serviceError(err)
 	}
 
 	return connect.NewResponse(res), nil
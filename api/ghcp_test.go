@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"buf.build/gen/go/safedep/api/connectrpc/go/safedep/services/ghcp/v1/ghcpv1connect"
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	"connectrpc.com/connect"
+	"github.com/safedep/ghcp/services"
+	"github.com/safedep/ghcp/services/ghcp"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPullRequestCommentService struct {
+	idempotencyKey string
+	deleteRequest  *ghcp.DeletePullRequestCommentRequest
+	reviewRequest  *ghcp.CreatePullRequestReviewRequest
+	checkRequest   *ghcp.CreateCheckRunRequest
+	statusRequest  *ghcp.CreateCommitStatusRequest
+	jobRequest     *ghcp.GetDeliveryJobRequest
+}
+
+func (s *testPullRequestCommentService) Name() string {
+	return "test"
+}
+
+func (s *testPullRequestCommentService) Config() services.ServiceConfiguration {
+	return services.ServiceConfiguration{}
+}
+
+func (s *testPullRequestCommentService) Execute(ctx context.Context,
+	req *ghcpv1.CreatePullRequestCommentRequest) (*ghcpv1.CreatePullRequestCommentResponse, error) {
+	res, err := s.CreatePullRequestComment(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Response, nil
+}
+
+func (s *testPullRequestCommentService) CreatePullRequestComment(ctx context.Context,
+	req *ghcpv1.CreatePullRequestCommentRequest) (*ghcp.PullRequestCommentResult, error) {
+	s.idempotencyKey = ghcp.ExtractIdempotencyKey(ctx)
+	if ghcp.AsyncDeliveryRequested(ctx) {
+		return &ghcp.PullRequestCommentResult{
+			Response: &ghcpv1.CreatePullRequestCommentResponse{},
+			Action:   ghcp.CommentActionQueued,
+			JobID:    "0123456789abcdef0123456789abcdef",
+		}, nil
+	}
+
+	return &ghcp.PullRequestCommentResult{
+		Response: &ghcpv1.CreatePullRequestCommentResponse{CommentId: "1"},
+		Action:   ghcp.CommentActionCreated,
+		Replayed: s.idempotencyKey != "",
+		Receipt:  "test-receipt",
+	}, nil
+}
+
+func (s *testPullRequestCommentService) DeletePullRequestComment(ctx context.Context,
+	req *ghcp.DeletePullRequestCommentRequest) (*ghcp.DeletePullRequestCommentResponse, error) {
+	s.deleteRequest = req
+	return &ghcp.DeletePullRequestCommentResponse{CommentId: "2"}, nil
+}
+
+func (s *testPullRequestCommentService) CreatePullRequestReview(ctx context.Context,
+	req *ghcp.CreatePullRequestReviewRequest) (*ghcp.CreatePullRequestReviewResponse, error) {
+	s.reviewRequest = req
+	return &ghcp.CreatePullRequestReviewResponse{ReviewId: "3"}, nil
+}
+
+func (s *testPullRequestCommentService) CreateCheckRun(ctx context.Context,
+	req *ghcp.CreateCheckRunRequest) (*ghcp.CreateCheckRunResponse, error) {
+	s.checkRequest = req
+	return &ghcp.CreateCheckRunResponse{CheckRunId: "4", Sha: "head"}, nil
+}
+
+func (s *testPullRequestCommentService) CreateCommitStatus(ctx context.Context,
+	req *ghcp.CreateCommitStatusRequest) (*ghcp.CreateCommitStatusResponse, error) {
+	s.statusRequest = req
+	return &ghcp.CreateCommitStatusResponse{StatusId: "5", Sha: "head"}, nil
+}
+
+func (s *testPullRequestCommentService) GetDeliveryJob(ctx context.Context,
+	req *ghcp.GetDeliveryJobRequest) (*ghcp.GetDeliveryJobResponse, error) {
+	s.jobRequest = req
+	return &ghcp.GetDeliveryJobResponse{JobId: req.JobId, State: "delivered", Attempts: 1, CommentId: "1"}, nil
+}
+
+func TestGhcpServiceHandler(t *testing.T) {
+	service := &testPullRequestCommentService{}
+
+	handler, err := NewGhcpServiceHandler(service)
+	assert.NoError(t, err)
+
+	validator, err := NewValidatorInterceptor()
+	assert.NoError(t, err)
+
+	path, h, err := handler.Build(connect.WithInterceptors(validator))
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle(path, h)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	post := func(t *testing.T, procedure, body string) (int, string) {
+		res, err := http.Post(server.URL+procedure, "application/json", strings.NewReader(body))
+		assert.NoError(t, err)
+
+		defer res.Body.Close()
+		data, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+
+		return res.StatusCode, string(data)
+	}
+
+	t.Run("should serve the generated procedures", func(t *testing.T) {
+		status, body := post(t, ghcpv1connect.GitHubCommentsProxyServiceCreatePullRequestCommentProcedure,
+			`{"owner":"safedep","repo":"ghcp","prNumber":"1","body":"test comment"}`)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"commentId":"1"}`, body)
+	})
+
+	t.Run("should pass the idempotency key", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost,
+			server.URL+ghcpv1connect.GitHubCommentsProxyServiceCreatePullRequestCommentProcedure,
+			strings.NewReader(`{"owner":"safedep","repo":"ghcp","prNumber":"1","body":"test comment"}`))
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, "retry-1")
+
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "retry-1", service.idempotencyKey)
+		assert.Equal(t, "true", res.Header.Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("should return the receipt", func(t *testing.T) {
+		res, err := http.Post(server.URL+ghcpv1connect.GitHubCommentsProxyServiceCreatePullRequestCommentProcedure,
+			"application/json", strings.NewReader(`{"owner":"safedep","repo":"ghcp","prNumber":"1","body":"test comment"}`))
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "test-receipt", res.Header.Get(ReceiptHeader))
+	})
+
+	t.Run("should queue the comment when preferred", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost,
+			server.URL+ghcpv1connect.GitHubCommentsProxyServiceCreatePullRequestCommentProcedure,
+			strings.NewReader(`{"owner":"safedep","repo":"ghcp","prNumber":"1","body":"test comment"}`))
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(PreferHeader, "wait=10, respond-async")
+
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "respond-async", res.Header.Get(PreferenceAppliedHeader))
+		assert.Equal(t, "0123456789abcdef0123456789abcdef", res.Header.Get(JobIDHeader))
+		assert.Equal(t, "queued", res.Header.Get(CommentActionHeader))
+	})
+
+	t.Run("should get delivery job", func(t *testing.T) {
+		status, body := post(t, GitHubCommentsProxyServiceGetDeliveryJobProcedure,
+			`{"jobId":"0123456789abcdef0123456789abcdef"}`)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"jobId":"0123456789abcdef0123456789abcdef","state":"delivered","attempts":1,
+			"commentId":"1","createdAt":"0001-01-01T00:00:00Z","updatedAt":"0001-01-01T00:00:00Z"}`, body)
+		assert.Equal(t, "0123456789abcdef0123456789abcdef", service.jobRequest.GetJobId())
+	})
+
+	t.Run("should validate delivery job request", func(t *testing.T) {
+		status, body := post(t, GitHubCommentsProxyServiceGetDeliveryJobProcedure, `{"jobId":"../1"}`)
+
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Contains(t, body, "job_id is invalid")
+	})
+
+	t.Run("should delete comment", func(t *testing.T) {
+		status, body := post(t, GitHubCommentsProxyServiceDeletePullRequestCommentProcedure,
+			`{"owner":"safedep","repo":"ghcp","prNumber":"1","tag":"test-tag"}`)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"commentId":"2"}`, body)
+		assert.Equal(t, &ghcp.DeletePullRequestCommentRequest{
+			Owner:    "safedep",
+			Repo:     "ghcp",
+			PrNumber: "1",
+			Tag:      "test-tag",
+		}, service.deleteRequest)
+	})
+
+	t.Run("should validate delete comment request", func(t *testing.T) {
+		status, body := post(t, GitHubCommentsProxyServiceDeletePullRequestCommentProcedure,
+			`{"owner":"safedep","repo":"ghcp","prNumber":"1","tag":"test-tag","commentId":"1"}`)
+
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Contains(t, body, "exactly one of tag or comment_id is required")
+	})
+
+	t.Run("should create review", func(t *testing.T) {
+		status, body := post(t, GitHubCommentsProxyServiceCreatePullRequestReviewProcedure,
+			`{"owner":"safedep","repo":"ghcp","prNumber":"1","comments":[{"path":"go.mod","line":3,"suggestion":""}]}`)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"reviewId":"3"}`, body)
+		assert.Len(t, service.reviewRequest.GetComments(), 1)
+		assert.Equal(t, "go.mod", service.reviewRequest.GetComments()[0].Path)
+		assert.NotNil(t, service.reviewRequest.GetComments()[0].Suggestion)
+	})
+
+	t.Run("should create check run", func(t *testing.T) {
+		status, body := post(t, GitHubCommentsProxyServiceCreateCheckRunProcedure,
+			`{"owner":"safedep","repo":"ghcp","prNumber":"1","name":"lint","status":"completed","conclusion":"success"}`)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"checkRunId":"4","sha":"head"}`, body)
+		assert.Equal(t, "lint", service.checkRequest.GetName())
+	})
+
+	t.Run("should validate check run request", func(t *testing.T) {
+		status, body := post(t, GitHubCommentsProxyServiceCreateCheckRunProcedure,
+			`{"owner":"safedep","repo":"ghcp","prNumber":"1","name":"lint","status":"completed"}`)
+
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Contains(t, body, "conclusion is required")
+	})
+
+	t.Run("should create commit status", func(t *testing.T) {
+		status, body := post(t, GitHubCommentsProxyServiceCreateCommitStatusProcedure,
+			`{"owner":"safedep","repo":"ghcp","prNumber":"1","state":"success","context":"ghcp/lint"}`)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"statusId":"5","sha":"head"}`, body)
+		assert.Equal(t, "ghcp/lint", service.statusRequest.Context)
+	})
+}
+
+func TestPrefersRespondAsync(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []string
+		async  bool
+	}{
+		{"no preference", nil, false},
+		{"respond-async", []string{"respond-async"}, true},
+		{"case insensitive", []string{"Respond-Async"}, true},
+		{"among preferences", []string{"return=minimal, respond-async; foo=bar"}, true},
+		{"in another header", []string{"return=minimal", "respond-async"}, true},
+		{"other preference", []string{"wait=10"}, false},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.async, prefersRespondAsync(test.values))
+		})
+	}
+}
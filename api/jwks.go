@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/safedep/dry/log"
+)
+
+// Path of the key set verifying the receipts issued by the server
+const JWKSPath = "/.well-known/jwks.json"
+
+// NewJWKSHandler creates a handler publishing the key set. The handler is
+// not authenticated, the keys are public.
+func NewJWKSHandler(jwks jose.JSONWebKeySet) (http.Handler, error) {
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+
+		if _, err := w.Write(data); err != nil {
+			log.Errorf("failed to write JWKS response: %s", err)
+		}
+	}), nil
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/safedep/ghcp/pkg/receipt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	signer, err := receipt.NewSigner("https://ghcp.example.com", key)
+	assert.NoError(t, err)
+
+	handler, err := NewJWKSHandler(signer.JWKS())
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, JWKSPath, nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var jwks jose.JSONWebKeySet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jwks))
+	assert.Len(t, jwks.Keys, 1)
+	assert.True(t, jwks.Keys[0].IsPublic())
+
+	token, err := signer.Sign(receipt.Claims{CommentID: "10"})
+	assert.NoError(t, err)
+
+	claims, err := receipt.Verify(token, jwks)
+	assert.NoError(t, err)
+	assert.Equal(t, "10", claims.CommentID)
+}
@@ -11,6 +11,10 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+type validatable interface {
+	Validate() error
+}
+
 type validatorInterceptor struct {
 	validator protovalidate.Validator
 }
@@ -27,6 +31,16 @@ func NewValidatorInterceptor() (connect.Interceptor, error) {
 func (v *validatorInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
 	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
 		log.Debugf("Validator Interceptor: Validating request: %s", req.Spec().Procedure)
+
+		// Messages served with the JSON codec validate themselves
+		if msg, ok := req.Any().(validatable); ok {
+			if err := msg.Validate(); err != nil {
+				return nil, connect.NewError(connect.CodeInvalidArgument, err)
+			}
+
+			return next(ctx, req)
+		}
+
 		msg, ok := req.Any().(proto.Message)
 		if !ok {
 			return nil, connect.NewError(connect.CodeInvalidArgument,
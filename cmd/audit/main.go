@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	ghcpconfig "github.com/safedep/ghcp/config"
+	"github.com/safedep/ghcp/pkg/audit"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditConfigFile    string
+	auditQueryOwner    string
+	auditQueryRepo     string
+	auditQueryPR       string
+	auditQueryActor    string
+	auditQueryRunID    string
+	auditQueryDecision string
+	auditQuerySince    time.Duration
+	auditQueryLimit    int
+	auditPublicKey     string
+)
+
+func NewAuditCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log of the server",
+	}
+
+	cmd.PersistentFlags().StringVar(&auditConfigFile, "config", "", "path to the config file")
+
+	cmd.AddCommand(newQueryCommand())
+	cmd.AddCommand(newVerifyCommand())
+	return cmd
+}
+
+func newQueryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "query",
+		Short:         "Print the audit records matching the filters, one JSON record per line",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sink, err := openSink()
+			if err != nil {
+				return err
+			}
+
+			defer sink.Close()
+
+			filter := audit.Filter{
+				Owner:    auditQueryOwner,
+				Repo:     auditQueryRepo,
+				PrNumber: auditQueryPR,
+				Actor:    auditQueryActor,
+				RunID:    auditQueryRunID,
+				Decision: audit.Decision(auditQueryDecision),
+				Limit:    auditQueryLimit,
+			}
+
+			if auditQuerySince > 0 {
+				filter.Since = time.Now().Add(-auditQuerySince)
+			}
+
+			records, err := sink.Query(cmd.Context(), filter)
+			if err != nil {
+				return err
+			}
+
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			for _, record := range records {
+				if err := encoder.Encode(record); err != nil {
+					return fmt.Errorf("failed to write audit record: %w", err)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&auditQueryOwner, "owner", "", "owner of the repository")
+	cmd.Flags().StringVar(&auditQueryRepo, "repo", "", "name of the repository")
+	cmd.Flags().StringVar(&auditQueryPR, "pr", "", "number of the pull request")
+	cmd.Flags().StringVar(&auditQueryActor, "actor", "", "actor of the workflow run")
+	cmd.Flags().StringVar(&auditQueryRunID, "run-id", "", "ID of the workflow run")
+	cmd.Flags().StringVar(&auditQueryDecision, "decision", "", "decision on the request: allowed, denied or failed")
+	cmd.Flags().DurationVar(&auditQuerySince, "since", 0, "only records more recent than the duration, e.g. 24h")
+	cmd.Flags().IntVar(&auditQueryLimit, "limit", 100, "maximum number of records, the most recent ones, 0 for all")
+	return cmd
+}
+
+func newVerifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "verify",
+		Short:         "Verify that the audit log has no gaps or edits and that its checkpoints are signed",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sink, err := openSink()
+			if err != nil {
+				return err
+			}
+
+			defer sink.Close()
+
+			key, err := verificationKey()
+			if err != nil {
+				return err
+			}
+
+			records, err := sink.Query(cmd.Context(), audit.Filter{})
+			if err != nil {
+				return err
+			}
+
+			report := audit.Verify(records, key)
+			out := cmd.OutOrStdout()
+
+			fmt.Fprintf(out, "Records: %d, checkpoints: %d, sequence: %d to %d\n",
+				report.Records, report.Checkpoints, report.FirstSequence, report.LastSequence)
+
+			if report.PrunedSequence > 0 {
+				fmt.Fprintf(out, "Records 1 to %d were removed by the retention\n", report.PrunedSequence)
+			}
+
+			if report.Unchained > 0 {
+				fmt.Fprintf(out, "Records written before chaining, not verified: %d\n", report.Unchained)
+			}
+
+			switch {
+			case key == nil:
+				fmt.Fprintln(out, "Checkpoints not verified, no key is configured")
+			case report.CheckpointedSequence == 0:
+				fmt.Fprintf(out, "No valid checkpoint, records not signed: %d\n", report.Unsigned)
+			default:
+				fmt.Fprintf(out, "Last checkpoint at %s, records after it not signed: %d\n",
+					report.CheckpointedTime.Format(time.RFC3339), report.Unsigned)
+				fmt.Fprintln(out, "Records removed from the end of the log after the last checkpoint can not be detected")
+			}
+
+			for _, problem := range report.Problems {
+				fmt.Fprintln(out, problem)
+			}
+
+			if !report.Valid() {
+				return fmt.Errorf("audit log verification failed with %d problems", len(report.Problems))
+			}
+
+			fmt.Fprintln(out, "Audit log is valid")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&auditPublicKey, "public-key", "", "path to the public key verifying the checkpoints, "+
+		"derived from the signing key of the configuration by default")
+	return cmd
+}
+
+// verificationKey returns the key verifying the checkpoints, nil when there is none
+func verificationKey() (ed25519.PublicKey, error) {
+	if auditPublicKey != "" {
+		data, err := os.ReadFile(auditPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+
+		return audit.ParsePublicKey(data)
+	}
+
+	config, err := ghcpconfig.Load(auditConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := config.AuditSigningKey()
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+// openSink opens the sink of the audit log configured for the server
+func openSink() (audit.Sink, error) {
+	config, err := ghcpconfig.Load(auditConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	sink, err := config.AuditSink()
+	if err != nil {
+		return nil, err
+	}
+
+	if sink == nil {
+		return nil, errors.New("audit log is not enabled in the configuration")
+	}
+
+	return sink, nil
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+
+	ghcpconfig "github.com/safedep/ghcp/config"
+	"github.com/spf13/cobra"
+)
+
+var validateConfigFile string
+
+func NewConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the server configuration",
+	}
+
+	cmd.AddCommand(newValidateCommand())
+	return cmd
+}
+
+func newValidateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "validate",
+		Short:         "Validate the server configuration along with the environment overrides",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := ghcpconfig.Load(validateConfigFile)
+			if err != nil {
+				return err
+			}
+
+			if err := config.Validate(); err != nil {
+				return fmt.Errorf("invalid configuration: %w", err)
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "Configuration is valid")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&validateConfigFile, "config", "", "path to the config file")
+	return cmd
+}
@@ -1,32 +1,56 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"connectrpc.com/connect"
 	dryhttp "github.com/safedep/dry/adapters/http"
 	"github.com/safedep/dry/log"
 	"github.com/safedep/dry/obs"
 	"github.com/safedep/ghcp/api"
+	ghcpconfig "github.com/safedep/ghcp/config"
 	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/audit"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/safedep/ghcp/pkg/queue"
 	"github.com/safedep/ghcp/services/ghcp"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 )
 
+// Interval between removals of the audit records older than the retention
+const auditRetentionInterval = time.Hour
+
+// Interval between removals of the delivery jobs finished before the retention
+const deliveryRetentionInterval = time.Hour
+
 var (
+	serverConfigFile         string
+	serverConfigReload       time.Duration
 	serverAddress            string
 	serverMockAuthentication bool
 	serverMockAuthorization  bool
+	serverOIDCIssuer         string
+	serverOIDCJWKSURL        string
+	serverOIDCJWKSFile       string
+	serverLegacyTagMatching  bool
+	serverRequireWorkflowID  bool
 )
 
 func NewServerCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use: "server",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := startServer()
+			config, err := loadConfig(cmd)
+			if err != nil {
+				log.Fatalf("failed to load config: %v", err)
+			}
+
+			err = startServer(cmd, config)
 			if err != nil {
 				log.Fatalf("failed to start server: %v", err)
 			}
@@ -35,14 +59,75 @@ func NewServerCommand() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringVar(&serverConfigFile, "config", "", "path to the config file")
+	cmd.Flags().DurationVar(&serverConfigReload, "config-reload-interval", 10*time.Second, "interval to check the config file for changes, 0 to reload only on SIGHUP")
 	cmd.Flags().StringVar(&serverAddress, "address", "127.0.0.1:8000", "address to listen on")
 	cmd.Flags().BoolVar(&serverMockAuthentication, "mock-authentication", false, "enable mock authentication")
 	cmd.Flags().BoolVar(&serverMockAuthorization, "mock-authorization", false, "enable mock authorization")
+	cmd.Flags().StringVar(&serverOIDCIssuer, "oidc-issuer", "", "additional trusted issuer of workload identity tokens")
+	cmd.Flags().StringVar(&serverOIDCJWKSURL, "oidc-jwks-url", "", "JWKS URL of the additional trusted issuer")
+	cmd.Flags().StringVar(&serverOIDCJWKSFile, "oidc-jwks-file", "", "JWKS file of the additional trusted issuer")
+	cmd.Flags().BoolVar(&serverLegacyTagMatching, "legacy-tag-matching", true, "match tagged comments created without a tag marker")
+	cmd.Flags().BoolVar(&serverRequireWorkflowID, "require-workflow-identity", false, "update tagged comments only from the workflow that created them")
 	return cmd
 }
 
-func startServer() error {
-	interceptors, err := buildConnectInterceptors()
+// loadConfig loads the config file and applies the flags explicitly set,
+// which take precedence over the file and the environment
+func loadConfig(cmd *cobra.Command) (ghcpconfig.Config, error) {
+	config, err := ghcpconfig.Load(serverConfigFile)
+	if err != nil {
+		return config, err
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("address") {
+		config.Server.Address = serverAddress
+	}
+
+	if flags.Changed("mock-authentication") {
+		config.Authentication.Mock = serverMockAuthentication
+	}
+
+	if flags.Changed("mock-authorization") {
+		config.Service.InsecureSkipAuthorization = serverMockAuthorization
+	}
+
+	if flags.Changed("legacy-tag-matching") {
+		config.Service.LegacyTagMatching = serverLegacyTagMatching
+	}
+
+	if flags.Changed("require-workflow-identity") {
+		config.Service.RequireMatchingWorkflowIdentity = serverRequireWorkflowID
+	}
+
+	if serverOIDCIssuer != "" {
+		issuer := ghcpconfig.IssuerConfig{Issuer: serverOIDCIssuer, JWKSSource: string(gh.JWKSSourceDiscovery)}
+		if serverOIDCJWKSURL != "" {
+			issuer.JWKSSource = string(gh.JWKSSourceURL)
+			issuer.JWKSURL = serverOIDCJWKSURL
+		} else if serverOIDCJWKSFile != "" {
+			issuer.JWKSSource = string(gh.JWKSSourceFile)
+			issuer.JWKSFile = serverOIDCJWKSFile
+		}
+
+		config.Authentication.Issuers = append(config.Authentication.Issuers, issuer)
+	}
+
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func startServer(cmd *cobra.Command, config ghcpconfig.Config) error {
+	authInterceptor, err := api.NewAuthenticationInterceptor(config.AuthenticationInterceptorConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create authentication interceptor: %w", err)
+	}
+
+	interceptors, err := buildConnectInterceptors(authInterceptor)
 	if err != nil {
 		return fmt.Errorf("failed to build connect interceptors: %w", err)
 	}
@@ -54,20 +139,109 @@ func startServer() error {
 		return fmt.Errorf("failed to create echo router: %w", err)
 	}
 
-	githubAdapter, err := github.NewGitHubAdapter(github.DefaultGitHubAdapterConfig())
+	githubAdapter, err := github.NewGitHubAdapter(config.GitHubAdapterConfig())
 	if err != nil {
 		return fmt.Errorf("failed to create github issue adapter: %w", err)
 	}
 
-	ghcpServiceConfig := ghcp.DefaultGitHubCommentProxyServiceConfig()
-	ghcpServiceConfig.InsecureSkipAuthorization = serverMockAuthorization
+	ghcpServiceConfig, err := config.GitHubCommentProxyServiceConfig()
+	if err != nil {
+		return fmt.Errorf("failed to create ghcp service config: %w", err)
+	}
 
 	ghcpService, err := ghcp.NewGitHubCommentProxyService(ghcpServiceConfig,
-		githubAdapter, githubAdapter)
+		githubAdapter, githubAdapter, githubAdapter, githubAdapter)
 	if err != nil {
 		return fmt.Errorf("failed to create ghcp service: %w", err)
 	}
 
+	rateLimitStore, err := config.RateLimitStore()
+	if err != nil {
+		return fmt.Errorf("failed to create rate limit store: %w", err)
+	}
+
+	ghcpService.SetRateLimitStore(rateLimitStore)
+
+	idempotencyStore, err := config.IdempotencyStore()
+	if err != nil {
+		return fmt.Errorf("failed to create idempotency store: %w", err)
+	}
+
+	ghcpService.SetIdempotencyStore(idempotencyStore)
+
+	locker, err := config.Locker()
+	if err != nil {
+		return fmt.Errorf("failed to create pull request locker: %w", err)
+	}
+
+	ghcpService.SetLocker(locker)
+
+	auditSink, err := config.AuditSink()
+	if err != nil {
+		return fmt.Errorf("failed to create audit sink: %w", err)
+	}
+
+	if auditSink != nil {
+		defer auditSink.Close()
+
+		signingKey, err := config.AuditSigningKey()
+		if err != nil {
+			return fmt.Errorf("failed to load audit signing key: %w", err)
+		}
+
+		// Records are chained so that gaps and edits can be detected
+		auditChain, err := audit.NewChain(context.Background(), auditSink, signingKey)
+		if err != nil {
+			return fmt.Errorf("failed to create audit chain: %w", err)
+		}
+
+		ghcpService.SetAuditSink(auditChain)
+
+		if signingKey != nil {
+			go audit.RunCheckpoints(context.Background(), auditChain, config.Audit.CheckpointInterval)
+		} else {
+			log.Warnf("Audit signing key is not set, records are chained without signed checkpoints")
+		}
+
+		if config.Audit.Retention > 0 {
+			go audit.RunRetention(context.Background(), auditChain, config.Audit.Retention, auditRetentionInterval)
+		}
+	}
+
+	deliveryQueue, err := config.DeliveryQueue()
+	if err != nil {
+		return fmt.Errorf("failed to create delivery queue: %w", err)
+	}
+
+	if deliveryQueue != nil {
+		defer deliveryQueue.Close()
+
+		// Queued comments are delivered in the background, including
+		// the comments left in the queue by a previous run
+		ghcpService.SetDeliveryQueue(deliveryQueue)
+		go ghcpService.RunDeliveryWorkers(context.Background(), config.DeliveryWorkerConfig())
+
+		if config.Delivery.Retention > 0 {
+			go queue.RunRetention(context.Background(), deliveryQueue, config.Delivery.Retention, deliveryRetentionInterval)
+		}
+	}
+
+	receiptSigner, err := config.ReceiptSigner()
+	if err != nil {
+		return fmt.Errorf("failed to create receipt signer: %w", err)
+	}
+
+	if receiptSigner != nil {
+		ghcpService.SetReceiptSigner(receiptSigner)
+
+		jwksHandler, err := api.NewJWKSHandler(receiptSigner.JWKS())
+		if err != nil {
+			return fmt.Errorf("failed to create JWKS handler: %w", err)
+		}
+
+		router.AddRoute(dryhttp.GET, api.JWKSPath, jwksHandler)
+	}
+
 	apiHandler, err := api.NewGhcpServiceHandler(ghcpService)
 	if err != nil {
 		return fmt.Errorf("failed to create ghcp service handler: %w", err)
@@ -78,8 +252,34 @@ func startServer() error {
 		return fmt.Errorf("failed to register ghcp service: %w", err)
 	}
 
-	log.Debugf("starting server on %s", serverAddress)
-	err = http.ListenAndServe(serverAddress, h2c.NewHandler(router.Handler(), &http2.Server{}))
+	// Policy settings are reloaded without a restart. The service and the
+	// interceptor swap their configuration without affecting in-flight requests.
+	reloader := ghcpconfig.NewReloader(config, serverConfigReload, func() (ghcpconfig.Config, error) {
+		return loadConfig(cmd)
+	}, func(config ghcpconfig.Config) error {
+		serviceConfig, err := config.GitHubCommentProxyServiceConfig()
+		if err != nil {
+			return err
+		}
+
+		// Validated before any change so that both are updated or neither is
+		if err := serviceConfig.Validate(); err != nil {
+			return err
+		}
+
+		if err := authInterceptor.UpdateConfig(config.AuthenticationInterceptorConfig()); err != nil {
+			return err
+		}
+
+		return ghcpService.UpdateConfig(serviceConfig)
+	})
+
+	if serverConfigFile != "" {
+		go reloader.Run(context.Background())
+	}
+
+	log.Debugf("starting server on %s", config.Server.Address)
+	err = http.ListenAndServe(config.Server.Address, h2c.NewHandler(router.Handler(), &http2.Server{}))
 	if err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
@@ -97,16 +297,9 @@ func registerService(router dryhttp.Router, h api.Handler, opts ...connect.Handl
 	return nil
 }
 
-func buildConnectInterceptors() (connect.HandlerOption, error) {
+func buildConnectInterceptors(authInterceptor connect.Interceptor) (connect.HandlerOption, error) {
 	var interceptors []connect.Interceptor
 
-	authInterceptor, err := api.NewAuthenticationInterceptor(api.AuthenticationInterceptorConfig{
-		MockAuthentication: serverMockAuthentication,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create authentication interceptor: %w", err)
-	}
-
 	interceptors = append(interceptors, authInterceptor)
 
 	validatorInterceptor, err := api.NewValidatorInterceptor()
@@ -0,0 +1,784 @@
+// Package config loads the configuration of the server from a YAML file
+// with overrides from the environment
+package config
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/safedep/ghcp/api"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/audit"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/safedep/ghcp/pkg/idempotency"
+	"github.com/safedep/ghcp/pkg/lock"
+	"github.com/safedep/ghcp/pkg/queue"
+	"github.com/safedep/ghcp/pkg/ratelimit"
+	"github.com/safedep/ghcp/pkg/receipt"
+	"github.com/safedep/ghcp/services/ghcp"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of the environment variables overriding the configuration. The name of the
+// variable is the path of the setting, e.g. GHCP_SERVICE_MAX_COMMENTS_PER_PR
+const EnvironmentPrefix = "GHCP"
+
+// Config is the configuration of the server
+type Config struct {
+	Server         ServerConfig         `yaml:"server"`
+	Authentication AuthenticationConfig `yaml:"authentication"`
+	Service        ServiceConfig        `yaml:"service"`
+	GitHub         GitHubConfig         `yaml:"github"`
+	RateLimit      RateLimitConfig      `yaml:"rate_limit"`
+	Idempotency    IdempotencyConfig    `yaml:"idempotency"`
+	Lock           LockConfig           `yaml:"lock"`
+	Audit          AuditConfig          `yaml:"audit"`
+	Receipts       ReceiptConfig        `yaml:"receipts"`
+	Delivery       DeliveryConfig       `yaml:"delivery"`
+	Redis          RedisConfig          `yaml:"redis"`
+}
+
+type ServerConfig struct {
+	Address string `yaml:"address"`
+}
+
+type AuthenticationConfig struct {
+	// Skip authentication of requests. For testing only.
+	Mock bool `yaml:"mock"`
+
+	// Audiences accepted in the GitHub Workload Identity Token
+	Audiences []string `yaml:"audiences"`
+
+	// Trusted issuers of GitHub Workload Identity Tokens
+	Issuers []IssuerConfig `yaml:"issuers"`
+}
+
+type IssuerConfig struct {
+	Issuer     string `yaml:"issuer"`
+	JWKSSource string `yaml:"jwks_source"`
+	JWKSURL    string `yaml:"jwks_url"`
+	JWKSFile   string `yaml:"jwks_file"`
+}
+
+type InstallationVerifierConfig struct {
+	Path   string `yaml:"path"`
+	Action string `yaml:"action"`
+}
+
+type AudiencePolicyConfig struct {
+	AllowOnlyPublicRepositories bool                         `yaml:"allow_only_public_repositories"`
+	MaxCommentsPerPR            int                          `yaml:"max_comments_per_pr"`
+	VerifyInstallation          bool                         `yaml:"verify_installation"`
+	InstallationVerifiers       []InstallationVerifierConfig `yaml:"installation_verifiers"`
+}
+
+// ServiceConfig maps onto ghcp.GitHubCommentProxyServiceConfig
+type ServiceConfig struct {
+	AllowOnlyPublicRepositories     bool                            `yaml:"allow_only_public_repositories"`
+	AllowOnlyOwnCommentUpdates      bool                            `yaml:"allow_only_own_comment_updates"`
+	BotUsername                     string                          `yaml:"bot_username"`
+	UseGitHubAppIdentity            *bool                           `yaml:"use_github_app_identity"`
+	AudiencePolicies                map[string]AudiencePolicyConfig `yaml:"audience_policies"`
+	VerifyInstallation              bool                            `yaml:"verify_installation"`
+	InstallationVerifiers           []InstallationVerifierConfig    `yaml:"installation_verifiers"`
+	InsecureSkipAuthorization       bool                            `yaml:"insecure_skip_authorization"`
+	MaxCommentsPerPR                int                             `yaml:"max_comments_per_pr"`
+	MaxReviewCommentsPerPR          int                             `yaml:"max_review_comments_per_pr"`
+	UpsertTaggedComments            bool                            `yaml:"upsert_tagged_comments"`
+	LegacyTagMatching               bool                            `yaml:"legacy_tag_matching"`
+	CommentSigningKey               string                          `yaml:"comment_signing_key"`
+	RequireMatchingWorkflowIdentity bool                            `yaml:"require_matching_workflow_identity"`
+	VerifyPullRequestBinding        bool                            `yaml:"verify_pull_request_binding"`
+	PullRequestBindingRules         map[string]string               `yaml:"pull_request_binding_rules"`
+	DefaultPullRequestBindingRule   string                          `yaml:"default_pull_request_binding_rule"`
+	DisableReviewComments           bool                            `yaml:"disable_review_comments"`
+	EnableChecks                    bool                            `yaml:"enable_checks"`
+	CheckNamespace                  string                          `yaml:"check_namespace"`
+	RepositoryPolicyPath            string                          `yaml:"repository_policy_path"`
+	RepositoryPolicyCacheTTL        time.Duration                   `yaml:"repository_policy_cache_ttl"`
+	AllowedRepositoryIDs            []int64                         `yaml:"allowed_repository_ids"`
+	AllowedOwnerIDs                 []int64                         `yaml:"allowed_owner_ids"`
+	DeniedRepositoryIDs             []int64                         `yaml:"denied_repository_ids"`
+	DeniedOwnerIDs                  []int64                         `yaml:"denied_owner_ids"`
+	IdempotencyKeyTTL               time.Duration                   `yaml:"idempotency_key_ttl"`
+	PullRequestLockTimeout          time.Duration                   `yaml:"pull_request_lock_timeout"`
+	PullRequestLockFailOpen         bool                            `yaml:"pull_request_lock_fail_open"`
+}
+
+// GitHubConfig maps onto github.GitHubAdapterConfig
+type GitHubConfig struct {
+	Token             string `yaml:"token"`
+	ClientId          string `yaml:"client_id"`
+	ClientSecret      string `yaml:"client_secret"`
+	AppID             int64  `yaml:"app_id"`
+	AppPrivateKey     string `yaml:"app_private_key"`
+	AppPrivateKeyFile string `yaml:"app_private_key_file"`
+	APIURL            string `yaml:"api_url"`
+	MaxIssueComments  int    `yaml:"max_issue_comments"`
+
+	RateLimit GitHubRateLimitConfig `yaml:"rate_limit"`
+}
+
+// GitHubRateLimitConfig maps onto github.RateLimitTransportConfig
+type GitHubRateLimitConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	LowBudget  float64       `yaml:"low_budget"`
+	MaxWait    time.Duration `yaml:"max_wait"`
+	MaxRetries int           `yaml:"max_retries"`
+}
+
+// Stores of the rate limits
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
+// RateLimitConfig holds the rate limits applied to the service and the
+// store holding them. Limits in memory are not shared between replicas.
+type RateLimitConfig struct {
+	Store string                `yaml:"store"`
+	Rules []RateLimitRuleConfig `yaml:"rules"`
+}
+
+// RateLimitRuleConfig maps onto ratelimit.Rule
+type RateLimitRuleConfig struct {
+	Scope     string        `yaml:"scope"`
+	TokenType string        `yaml:"token_type"`
+	Requests  int           `yaml:"requests"`
+	Per       time.Duration `yaml:"per"`
+	Burst     int           `yaml:"burst"`
+}
+
+// Stores of the idempotency keys
+const (
+	IdempotencyStoreMemory = "memory"
+	IdempotencyStoreRedis  = "redis"
+)
+
+// IdempotencyConfig holds the store of the idempotency keys. Keys in
+// memory are not shared between replicas.
+type IdempotencyConfig struct {
+	Store string `yaml:"store"`
+}
+
+// Stores of the locks of the pull requests
+const (
+	LockStoreMemory = "memory"
+	LockStoreRedis  = "redis"
+)
+
+// LockConfig holds the store of the locks serializing the requests writing to
+// a pull request. Locks in memory are not shared between replicas.
+type LockConfig struct {
+	Store string `yaml:"store"`
+}
+
+// Sinks of the audit log
+const (
+	AuditSinkJSONL  = "jsonl"
+	AuditSinkSQLite = "sqlite"
+)
+
+// AuditConfig holds the sink of the audit log. The audit log is disabled
+// when no sink is set. Records older than the retention are removed,
+// zero keeps them forever. With a signing key, checkpoints signing the
+// records are written at every checkpoint interval.
+type AuditConfig struct {
+	Sink               string        `yaml:"sink"`
+	Path               string        `yaml:"path"`
+	Retention          time.Duration `yaml:"retention"`
+	SigningKeyFile     string        `yaml:"signing_key_file"`
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"`
+}
+
+// ReceiptConfig holds the key signing the receipts of the comments. Receipts
+// are issued when a signing key is set. The issuer identifies the server in
+// the receipts, usually the URL serving its JWKS.
+type ReceiptConfig struct {
+	SigningKeyFile string `yaml:"signing_key_file"`
+	Issuer         string `yaml:"issuer"`
+}
+
+// DeliveryConfig holds the queue of the comments delivered asynchronously.
+// Asynchronous delivery is disabled when no queue path is set. Jobs
+// finished before the retention are removed, zero keeps them forever.
+type DeliveryConfig struct {
+	QueuePath   string        `yaml:"queue_path"`
+	Workers     int           `yaml:"workers"`
+	MaxAttempts int           `yaml:"max_attempts"`
+	Retention   time.Duration `yaml:"retention"`
+}
+
+// RedisConfig is the Redis server, or a server compatible with its
+// protocol, shared by the replicas of the server
+type RedisConfig struct {
+	URL string `yaml:"url"`
+}
+
+// Default returns the default configuration. Environment variables
+// read by the adapters before the configuration file was introduced
+// are honoured.
+func Default() Config {
+	service := ghcp.DefaultGitHubCommentProxyServiceConfig()
+	adapter := github.DefaultGitHubAdapterConfig()
+
+	bindingRules := make(map[string]string)
+	for event, rule := range service.PullRequestBindingRules {
+		bindingRules[event] = string(rule)
+	}
+
+	return Config{
+		Server: ServerConfig{
+			Address: "127.0.0.1:8000",
+		},
+		Authentication: AuthenticationConfig{
+			Audiences: service.GitHubTokenAudiences,
+			Issuers:   []IssuerConfig{issuerConfig(gh.GitHubIssuer())},
+		},
+		Service: ServiceConfig{
+			AllowOnlyPublicRepositories:     service.AllowOnlyPublicRepositories,
+			AllowOnlyOwnCommentUpdates:      service.AllowOnlyOwnCommentUpdates,
+			BotUsername:                     service.BotUsername,
+			VerifyInstallation:              service.VerifyInstallation,
+			InstallationVerifiers:           installationVerifierConfigs(service.InstallationVerifiers),
+			MaxCommentsPerPR:                service.MaxCommentsPerPR,
+			MaxReviewCommentsPerPR:          service.MaxReviewCommentsPerPR,
+			UpsertTaggedComments:            service.UpsertTaggedComments,
+			LegacyTagMatching:               service.LegacyTagMatching,
+			CommentSigningKey:               os.Getenv("GHCP_COMMENT_SIGNING_KEY"),
+			RequireMatchingWorkflowIdentity: service.RequireMatchingWorkflowIdentity,
+			VerifyPullRequestBinding:        service.VerifyPullRequestBinding,
+			PullRequestBindingRules:         bindingRules,
+			DefaultPullRequestBindingRule:   string(service.DefaultPullRequestBindingRule),
+			CheckNamespace:                  service.CheckNamespace,
+			RepositoryPolicyPath:            service.RepositoryPolicyPath,
+			RepositoryPolicyCacheTTL:        service.RepositoryPolicyCacheTTL,
+			IdempotencyKeyTTL:               service.IdempotencyKeyTTL,
+			PullRequestLockTimeout:          service.PullRequestLockTimeout,
+		},
+		GitHub: GitHubConfig{
+			Token:             adapter.Token,
+			ClientId:          adapter.ClientId,
+			ClientSecret:      adapter.ClientSecret,
+			AppID:             adapter.AppID,
+			AppPrivateKey:     string(adapter.AppPrivateKey),
+			AppPrivateKeyFile: adapter.AppPrivateKeyFile,
+			APIURL:            adapter.BaseURL,
+			MaxIssueComments:  adapter.MaxIssueComments,
+			RateLimit: GitHubRateLimitConfig{
+				Enabled:    adapter.RateLimit.Enabled,
+				LowBudget:  adapter.RateLimit.LowBudget,
+				MaxWait:    adapter.RateLimit.MaxWait,
+				MaxRetries: adapter.RateLimit.MaxRetries,
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Store: RateLimitStoreMemory,
+		},
+		Idempotency: IdempotencyConfig{
+			Store: IdempotencyStoreMemory,
+		},
+		Lock: LockConfig{
+			Store: LockStoreMemory,
+		},
+		Audit: AuditConfig{
+			CheckpointInterval: 5 * time.Minute,
+		},
+		Delivery: DeliveryConfig{
+			Workers:     ghcp.DefaultDeliveryWorkers,
+			MaxAttempts: ghcp.DefaultDeliveryMaxAttempts,
+			Retention:   7 * 24 * time.Hour,
+		},
+	}
+}
+
+// Load returns the default configuration overridden by the file, when a path
+// is given, and then by the environment. The configuration is not validated.
+func Load(path string) (Config, error) {
+	config := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		if err := parse(data, &config); err != nil {
+			return config, err
+		}
+	}
+
+	if err := applyEnvironment(&config, EnvironmentPrefix, os.LookupEnv); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// parse overrides the configuration with the settings in the file. Unknown
+// settings are rejected so that a typo does not silently keep a default.
+func parse(data []byte, config *Config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return nil
+}
+
+// Validate verifies that the configuration can be used to start the server
+func (c Config) Validate() error {
+	if c.Server.Address == "" {
+		return errors.New("server address is required")
+	}
+
+	if c.Authentication.Mock && !c.Service.InsecureSkipAuthorization {
+		return errors.New("mock authentication requires insecure_skip_authorization, " +
+			"requests carry no token to authorize")
+	}
+
+	// Without audiences every workload identity token is rejected
+	if len(c.Authentication.Audiences) == 0 {
+		return errors.New("at least one authentication audience is required")
+	}
+
+	if _, err := gh.NewIssuerRegistry(c.AuthenticationInterceptorConfig().Issuers); err != nil {
+		return fmt.Errorf("invalid issuers: %w", err)
+	}
+
+	if c.GitHub.AppID != 0 && c.GitHub.AppPrivateKey == "" && c.GitHub.AppPrivateKeyFile == "" {
+		return errors.New("app private key is required when app_id is set")
+	}
+
+	if c.GitHub.AppPrivateKey != "" && c.GitHub.AppPrivateKeyFile != "" {
+		return errors.New("only one of app_private_key or app_private_key_file is allowed")
+	}
+
+	if c.GitHub.MaxIssueComments < 0 {
+		return errors.New("max issue comments must not be negative")
+	}
+
+	if c.GitHub.RateLimit.LowBudget < 0 || c.GitHub.RateLimit.LowBudget >= 1 {
+		return errors.New("github rate limit low budget must be between 0 and 1")
+	}
+
+	if c.GitHub.RateLimit.MaxWait < 0 {
+		return errors.New("github rate limit max wait must not be negative")
+	}
+
+	if c.GitHub.RateLimit.MaxRetries < 0 {
+		return errors.New("github rate limit max retries must not be negative")
+	}
+
+	if c.Service.UseGitHubAppIdentity != nil && *c.Service.UseGitHubAppIdentity && c.GitHub.AppID == 0 {
+		return errors.New("use_github_app_identity requires app_id")
+	}
+
+	if err := c.validateRateLimit(); err != nil {
+		return err
+	}
+
+	switch c.Idempotency.Store {
+	case IdempotencyStoreMemory:
+	case IdempotencyStoreRedis:
+		if c.Redis.URL == "" {
+			return errors.New("redis url is required for the redis idempotency store")
+		}
+	default:
+		return fmt.Errorf("invalid idempotency store: %s", c.Idempotency.Store)
+	}
+
+	switch c.Lock.Store {
+	case LockStoreMemory:
+	case LockStoreRedis:
+		if c.Redis.URL == "" {
+			return errors.New("redis url is required for the redis lock store")
+		}
+	default:
+		return fmt.Errorf("invalid lock store: %s", c.Lock.Store)
+	}
+
+	switch c.Audit.Sink {
+	case "":
+	case AuditSinkJSONL, AuditSinkSQLite:
+		if c.Audit.Path == "" {
+			return errors.New("audit path is required when an audit sink is set")
+		}
+	default:
+		return fmt.Errorf("invalid audit sink: %s", c.Audit.Sink)
+	}
+
+	if c.Audit.Retention < 0 {
+		return errors.New("audit retention must not be negative")
+	}
+
+	if c.Audit.SigningKeyFile != "" {
+		if c.Audit.CheckpointInterval <= 0 {
+			return errors.New("audit checkpoint interval must be positive")
+		}
+
+		if _, err := c.AuditSigningKey(); err != nil {
+			return fmt.Errorf("invalid audit signing key: %w", err)
+		}
+	}
+
+	if c.Receipts.SigningKeyFile != "" {
+		if c.Receipts.Issuer == "" {
+			return errors.New("receipts issuer is required when a receipts signing key is set")
+		}
+
+		if _, err := c.ReceiptSigner(); err != nil {
+			return fmt.Errorf("invalid receipts signing key: %w", err)
+		}
+	}
+
+	if c.Delivery.QueuePath != "" {
+		if c.Delivery.Workers <= 0 {
+			return errors.New("delivery workers must be positive")
+		}
+
+		if c.Delivery.MaxAttempts <= 0 {
+			return errors.New("delivery max attempts must be positive")
+		}
+
+		if c.Delivery.Retention < 0 {
+			return errors.New("delivery retention must not be negative")
+		}
+	}
+
+	service, err := c.GitHubCommentProxyServiceConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := service.Validate(); err != nil {
+		return fmt.Errorf("invalid service config: %w", err)
+	}
+
+	return nil
+}
+
+func (c Config) validateRateLimit() error {
+	switch c.RateLimit.Store {
+	case RateLimitStoreMemory:
+	case RateLimitStoreRedis:
+		if c.Redis.URL == "" {
+			return errors.New("redis url is required for the redis rate limit store")
+		}
+	default:
+		return fmt.Errorf("invalid rate limit store: %s", c.RateLimit.Store)
+	}
+
+	if c.Redis.URL != "" {
+		if _, err := redis.ParseURL(c.Redis.URL); err != nil {
+			return fmt.Errorf("invalid redis url: %w", err)
+		}
+	}
+
+	for _, rule := range c.RateLimit.Rules {
+		switch gh.TokenType(rule.TokenType) {
+		case "", gh.TokenTypeAction, gh.TokenTypeUser, gh.TokenTypeWorkloadIdentity:
+		default:
+			return fmt.Errorf("invalid rate limit token type: %s", rule.TokenType)
+		}
+	}
+
+	return nil
+}
+
+// GitHubCommentProxyServiceConfig returns the configuration of the service.
+// Fails when a regular expression of an installation verifier is invalid.
+func (c Config) GitHubCommentProxyServiceConfig() (ghcp.GitHubCommentProxyServiceConfig, error) {
+	verifiers, err := installationVerifiers(c.Service.InstallationVerifiers)
+	if err != nil {
+		return ghcp.GitHubCommentProxyServiceConfig{}, err
+	}
+
+	policies := make(map[string]ghcp.GitHubTokenAudiencePolicy)
+	for audience, policy := range c.Service.AudiencePolicies {
+		policyVerifiers, err := installationVerifiers(policy.InstallationVerifiers)
+		if err != nil {
+			return ghcp.GitHubCommentProxyServiceConfig{}, fmt.Errorf("%w for audience %s", err, audience)
+		}
+
+		policies[audience] = ghcp.GitHubTokenAudiencePolicy{
+			AllowOnlyPublicRepositories: policy.AllowOnlyPublicRepositories,
+			MaxCommentsPerPR:            policy.MaxCommentsPerPR,
+			VerifyInstallation:          policy.VerifyInstallation,
+			InstallationVerifiers:       policyVerifiers,
+		}
+	}
+
+	bindingRules := make(map[string]ghcp.PullRequestBindingRule)
+	for event, rule := range c.Service.PullRequestBindingRules {
+		bindingRules[event] = ghcp.PullRequestBindingRule(rule)
+	}
+
+	// Comments are made as the app when it is configured unless disabled
+	useGitHubAppIdentity := c.GitHub.AppID != 0
+	if c.Service.UseGitHubAppIdentity != nil {
+		useGitHubAppIdentity = *c.Service.UseGitHubAppIdentity
+	}
+
+	var signingKey []byte
+	if c.Service.CommentSigningKey != "" {
+		signingKey = []byte(c.Service.CommentSigningKey)
+	}
+
+	var rateLimits []ratelimit.Rule
+	for _, rule := range c.RateLimit.Rules {
+		rateLimits = append(rateLimits, ratelimit.Rule{
+			Scope:     ratelimit.Scope(rule.Scope),
+			TokenType: rule.TokenType,
+			Requests:  rule.Requests,
+			Per:       rule.Per,
+			Burst:     rule.Burst,
+		})
+	}
+
+	return ghcp.GitHubCommentProxyServiceConfig{
+		AllowOnlyPublicRepositories:     c.Service.AllowOnlyPublicRepositories,
+		AllowOnlyOwnCommentUpdates:      c.Service.AllowOnlyOwnCommentUpdates,
+		BotUsername:                     c.Service.BotUsername,
+		UseGitHubAppIdentity:            useGitHubAppIdentity,
+		GitHubTokenAudiences:            c.Authentication.Audiences,
+		GitHubTokenAudiencePolicies:     policies,
+		VerifyInstallation:              c.Service.VerifyInstallation,
+		InstallationVerifiers:           verifiers,
+		InsecureSkipAuthorization:       c.Service.InsecureSkipAuthorization,
+		MaxCommentsPerPR:                c.Service.MaxCommentsPerPR,
+		MaxReviewCommentsPerPR:          c.Service.MaxReviewCommentsPerPR,
+		UpsertTaggedComments:            c.Service.UpsertTaggedComments,
+		LegacyTagMatching:               c.Service.LegacyTagMatching,
+		CommentSigningKey:               signingKey,
+		RequireMatchingWorkflowIdentity: c.Service.RequireMatchingWorkflowIdentity,
+		VerifyPullRequestBinding:        c.Service.VerifyPullRequestBinding,
+		PullRequestBindingRules:         bindingRules,
+		DefaultPullRequestBindingRule:   ghcp.PullRequestBindingRule(c.Service.DefaultPullRequestBindingRule),
+		DisableReviewComments:           c.Service.DisableReviewComments,
+		EnableChecks:                    c.Service.EnableChecks,
+		CheckNamespace:                  c.Service.CheckNamespace,
+		RepositoryPolicyPath:            c.Service.RepositoryPolicyPath,
+		RepositoryPolicyCacheTTL:        c.Service.RepositoryPolicyCacheTTL,
+		AllowedRepositoryIDs:            c.Service.AllowedRepositoryIDs,
+		AllowedOwnerIDs:                 c.Service.AllowedOwnerIDs,
+		DeniedRepositoryIDs:             c.Service.DeniedRepositoryIDs,
+		DeniedOwnerIDs:                  c.Service.DeniedOwnerIDs,
+		RateLimits:                      rateLimits,
+		IdempotencyKeyTTL:               c.Service.IdempotencyKeyTTL,
+		PullRequestLockTimeout:          c.Service.PullRequestLockTimeout,
+		PullRequestLockFailOpen:         c.Service.PullRequestLockFailOpen,
+	}, nil
+}
+
+// RateLimitStore returns the store of the rate limits
+func (c Config) RateLimitStore() (ratelimit.Store, error) {
+	if c.RateLimit.Store != RateLimitStoreRedis {
+		return ratelimit.NewMemoryStore(), nil
+	}
+
+	client, err := c.RedisClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return ratelimit.NewRedisStore(client), nil
+}
+
+// IdempotencyStore returns the store of the idempotency keys
+func (c Config) IdempotencyStore() (idempotency.Store, error) {
+	if c.Idempotency.Store != IdempotencyStoreRedis {
+		return idempotency.NewMemoryStore(), nil
+	}
+
+	client, err := c.RedisClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return idempotency.NewRedisStore(client), nil
+}
+
+// Locker returns the locker of the pull requests
+func (c Config) Locker() (lock.Locker, error) {
+	if c.Lock.Store != LockStoreRedis {
+		return lock.NewMemoryLocker(), nil
+	}
+
+	client, err := c.RedisClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return lock.NewRedisLocker(client), nil
+}
+
+// AuditSink returns the sink of the audit log, nil when the audit log is disabled
+func (c Config) AuditSink() (audit.Sink, error) {
+	switch c.Audit.Sink {
+	case AuditSinkJSONL:
+		return audit.NewFileSink(c.Audit.Path)
+	case AuditSinkSQLite:
+		return audit.NewSQLiteSink(c.Audit.Path)
+	default:
+		return nil, nil
+	}
+}
+
+// AuditSigningKey returns the key signing the checkpoints of the audit log, nil when not set
+func (c Config) AuditSigningKey() (ed25519.PrivateKey, error) {
+	if c.Audit.SigningKeyFile == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(c.Audit.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit signing key: %w", err)
+	}
+
+	return audit.ParsePrivateKey(data)
+}
+
+// DeliveryQueue returns the queue of the comments delivered asynchronously,
+// nil when asynchronous delivery is disabled
+func (c Config) DeliveryQueue() (queue.Queue, error) {
+	if c.Delivery.QueuePath == "" {
+		return nil, nil
+	}
+
+	return queue.NewSQLiteQueue(c.Delivery.QueuePath)
+}
+
+// DeliveryWorkerConfig returns the settings of the workers delivering the queued comments
+func (c Config) DeliveryWorkerConfig() ghcp.DeliveryWorkerConfig {
+	config := ghcp.DefaultDeliveryWorkerConfig()
+	config.Workers = c.Delivery.Workers
+	config.MaxAttempts = c.Delivery.MaxAttempts
+
+	return config
+}
+
+// ReceiptSigner returns the signer of the receipts, nil when receipts are disabled
+func (c Config) ReceiptSigner() (*receipt.Signer, error) {
+	if c.Receipts.SigningKeyFile == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(c.Receipts.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read receipts signing key: %w", err)
+	}
+
+	key, err := receipt.ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return receipt.NewSigner(c.Receipts.Issuer, key)
+}
+
+// RedisClient returns a client of the Redis server
+func (c Config) RedisClient() (*redis.Client, error) {
+	options, err := redis.ParseURL(c.Redis.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+
+	return redis.NewClient(options), nil
+}
+
+// GitHubAdapterConfig returns the configuration of the GitHub adapter
+func (c Config) GitHubAdapterConfig() github.GitHubAdapterConfig {
+	var appPrivateKey []byte
+	if c.GitHub.AppPrivateKey != "" {
+		appPrivateKey = []byte(c.GitHub.AppPrivateKey)
+	}
+
+	return github.GitHubAdapterConfig{
+		Token:             c.GitHub.Token,
+		ClientId:          c.GitHub.ClientId,
+		ClientSecret:      c.GitHub.ClientSecret,
+		AppID:             c.GitHub.AppID,
+		AppPrivateKey:     appPrivateKey,
+		AppPrivateKeyFile: c.GitHub.AppPrivateKeyFile,
+		BaseURL:           c.GitHub.APIURL,
+		MaxIssueComments:  c.GitHub.MaxIssueComments,
+		RateLimit: github.RateLimitTransportConfig{
+			Enabled:    c.GitHub.RateLimit.Enabled,
+			LowBudget:  c.GitHub.RateLimit.LowBudget,
+			MaxWait:    c.GitHub.RateLimit.MaxWait,
+			MaxRetries: c.GitHub.RateLimit.MaxRetries,
+		},
+	}
+}
+
+// AuthenticationInterceptorConfig returns the configuration of the authentication interceptor
+func (c Config) AuthenticationInterceptorConfig() api.AuthenticationInterceptorConfig {
+	issuers := make([]gh.IssuerConfig, 0, len(c.Authentication.Issuers))
+	for _, issuer := range c.Authentication.Issuers {
+		issuers = append(issuers, gh.IssuerConfig{
+			Issuer:     issuer.Issuer,
+			JWKSSource: gh.JWKSSource(issuer.JWKSSource),
+			JWKSURL:    issuer.JWKSURL,
+			JWKSFile:   issuer.JWKSFile,
+		})
+	}
+
+	return api.AuthenticationInterceptorConfig{
+		MockAuthentication: c.Authentication.Mock,
+		Audiences:          c.Authentication.Audiences,
+		Issuers:            issuers,
+	}
+}
+
+func issuerConfig(issuer gh.IssuerConfig) IssuerConfig {
+	return IssuerConfig{
+		Issuer:     issuer.Issuer,
+		JWKSSource: string(issuer.JWKSSource),
+		JWKSURL:    issuer.JWKSURL,
+		JWKSFile:   issuer.JWKSFile,
+	}
+}
+
+func installationVerifierConfigs(verifiers []ghcp.GitHubCommentsProxyInstallationVerifier) []InstallationVerifierConfig {
+	configs := make([]InstallationVerifierConfig, 0, len(verifiers))
+	for _, verifier := range verifiers {
+		configs = append(configs, InstallationVerifierConfig{
+			Path:   verifier.Path,
+			Action: verifier.Action.String(),
+		})
+	}
+
+	return configs
+}
+
+func installationVerifiers(configs []InstallationVerifierConfig) ([]ghcp.GitHubCommentsProxyInstallationVerifier, error) {
+	verifiers := make([]ghcp.GitHubCommentsProxyInstallationVerifier, 0, len(configs))
+	for _, config := range configs {
+		// An empty expression matches any file
+		if config.Action == "" {
+			return nil, fmt.Errorf("installation verifier action is required for %s", config.Path)
+		}
+
+		action, err := regexp.Compile(config.Action)
+		if err != nil {
+			return nil, fmt.Errorf("invalid installation verifier action for %s: %w", config.Path, err)
+		}
+
+		verifiers = append(verifiers, ghcp.GitHubCommentsProxyInstallationVerifier{
+			Path:   config.Path,
+			Action: action,
+		})
+	}
+
+	return verifiers, nil
+}
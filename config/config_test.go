@@ -0,0 +1,510 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/ratelimit"
+	"github.com/safedep/ghcp/pkg/receipt"
+	"github.com/safedep/ghcp/services/ghcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	config := Default()
+	assert.NoError(t, config.Validate())
+
+	service, err := config.GitHubCommentProxyServiceConfig()
+	assert.NoError(t, err)
+
+	defaults := ghcp.DefaultGitHubCommentProxyServiceConfig()
+	assert.Equal(t, defaults.MaxCommentsPerPR, service.MaxCommentsPerPR)
+	assert.Equal(t, defaults.BotUsername, service.BotUsername)
+	assert.True(t, service.UpsertTaggedComments)
+	assert.True(t, service.LegacyTagMatching)
+	assert.Equal(t, defaults.GitHubTokenAudiences, service.GitHubTokenAudiences)
+	assert.Equal(t, defaults.PullRequestBindingRules, service.PullRequestBindingRules)
+	assert.Len(t, service.InstallationVerifiers, len(defaults.InstallationVerifiers))
+	assert.Equal(t, defaults.InstallationVerifiers[0].Action.String(), service.InstallationVerifiers[0].Action.String())
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ghcp.yml")
+	err := os.WriteFile(path, []byte(`
+server:
+  address: 0.0.0.0:9000
+authentication:
+  audiences: [safedep-ghcp, other]
+service:
+  bot_username: other-bot
+  max_comments_per_pr: 5
+  verify_installation: true
+  installation_verifiers:
+    - path: .github/workflows/scan.yml
+      action: 'uses:\s+safedep/vet-action'
+  audience_policies:
+    other:
+      max_comments_per_pr: 1
+  pull_request_binding_rules:
+    push: deny
+  repository_policy_cache_ttl: 1m
+  idempotency_key_ttl: 2h
+  pull_request_lock_timeout: 5s
+github:
+  api_url: https://github.example.com/api/v3/
+  rate_limit:
+    enabled: true
+    max_wait: 10s
+rate_limit:
+  store: redis
+  rules:
+    - scope: repository
+      requests: 100
+      per: 1h
+      burst: 10
+    - scope: actor
+      token_type: workload_identity
+      requests: 20
+      per: 1h
+idempotency:
+  store: redis
+lock:
+  store: redis
+redis:
+  url: redis://localhost:6379/0
+`), 0o600)
+	assert.NoError(t, err)
+
+	t.Setenv("GHCP_SERVICE_MAX_COMMENTS_PER_PR", "7")
+	t.Setenv("GHCP_SERVICE_ENABLE_CHECKS", "true")
+	t.Setenv("GHCP_SERVICE_USE_GITHUB_APP_IDENTITY", "false")
+	t.Setenv("GHCP_AUTHENTICATION_AUDIENCES", "safedep-ghcp, other ,")
+	t.Setenv("GHCP_GITHUB_MAX_ISSUE_COMMENTS", "")
+	t.Setenv("GHCP_SERVICE_DENIED_OWNER_IDS", "10, 20")
+	t.Setenv("GHCP_GITHUB_RATE_LIMIT_LOW_BUDGET", "0.2")
+
+	config, err := Load(path)
+	assert.NoError(t, err)
+	assert.NoError(t, config.Validate())
+
+	assert.Equal(t, "0.0.0.0:9000", config.Server.Address)
+	assert.Equal(t, "https://github.example.com/api/v3/", config.GitHubAdapterConfig().BaseURL)
+	assert.Equal(t, github.RateLimitTransportConfig{
+		Enabled:    true,
+		LowBudget:  0.2,
+		MaxWait:    10 * time.Second,
+		MaxRetries: github.DefaultRateLimitMaxRetries,
+	}, config.GitHubAdapterConfig().RateLimit)
+	assert.Equal(t, []string{"safedep-ghcp", "other"}, config.AuthenticationInterceptorConfig().Audiences)
+
+	service, err := config.GitHubCommentProxyServiceConfig()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "other-bot", service.BotUsername)
+	assert.Equal(t, 7, service.MaxCommentsPerPR)
+	assert.True(t, service.EnableChecks)
+	assert.Equal(t, ghcp.DefaultCheckNamespace, service.CheckNamespace)
+	assert.False(t, service.UseGitHubAppIdentity)
+	assert.True(t, service.AllowOnlyPublicRepositories)
+	assert.Equal(t, time.Minute, service.RepositoryPolicyCacheTTL)
+	assert.Equal(t, []int64{10, 20}, service.DeniedOwnerIDs)
+	assert.Equal(t, 2*time.Hour, service.IdempotencyKeyTTL)
+	assert.Equal(t, 5*time.Second, service.PullRequestLockTimeout)
+	assert.Equal(t, []ratelimit.Rule{
+		{Scope: ratelimit.ScopeRepository, Requests: 100, Per: time.Hour, Burst: 10},
+		{Scope: ratelimit.ScopeActor, TokenType: "workload_identity", Requests: 20, Per: time.Hour},
+	}, service.RateLimits)
+
+	_, err = config.RateLimitStore()
+	assert.NoError(t, err)
+	_, err = config.IdempotencyStore()
+	assert.NoError(t, err)
+	_, err = config.Locker()
+	assert.NoError(t, err)
+	assert.Equal(t, ghcp.PullRequestBindingRuleDeny, service.PullRequestBindingRules["push"])
+	assert.Equal(t, 1, service.GitHubTokenAudiencePolicies["other"].MaxCommentsPerPR)
+	assert.Len(t, service.InstallationVerifiers, 1)
+	assert.True(t, service.InstallationVerifiers[0].Action.MatchString("uses: safedep/vet-action@v1"))
+}
+
+func TestLoadFailures(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		env     map[string]string
+		err     string
+	}{
+		{
+			name:    "unknown setting",
+			content: "service:\n  max_comment_per_pr: 1",
+			err:     "field max_comment_per_pr not found",
+		},
+		{
+			name: "invalid environment value",
+			env:  map[string]string{"GHCP_SERVICE_MAX_COMMENTS_PER_PR": "many"},
+			err:  "invalid value of GHCP_SERVICE_MAX_COMMENTS_PER_PR",
+		},
+		{
+			name: "environment value for a list of objects",
+			env:  map[string]string{"GHCP_SERVICE_INSTALLATION_VERIFIERS": "vet.yml"},
+			err:  "invalid value of GHCP_SERVICE_INSTALLATION_VERIFIERS: not supported in the environment",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ghcp.yml")
+			assert.NoError(t, os.WriteFile(path, []byte(c.content), 0o600))
+
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := Load(path)
+			assert.ErrorContains(t, err, c.err)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(*Config)
+		err    string
+	}{
+		{
+			name: "no authentication audiences",
+			modify: func(c *Config) {
+				c.Authentication.Audiences = []string{}
+			},
+			err: "at least one authentication audience is required",
+		},
+		{
+			name: "invalid installation verifier regex",
+			modify: func(c *Config) {
+				c.Service.InstallationVerifiers = []InstallationVerifierConfig{{Path: ".github/workflows/vet.yml", Action: "uses:(["}}
+			},
+			err: "invalid installation verifier action for .github/workflows/vet.yml",
+		},
+		{
+			name: "empty installation verifier regex",
+			modify: func(c *Config) {
+				c.Service.InstallationVerifiers = []InstallationVerifierConfig{{Path: ".github/workflows/vet.yml"}}
+			},
+			err: "installation verifier action is required for .github/workflows/vet.yml",
+		},
+		{
+			name: "installation verification without verifiers",
+			modify: func(c *Config) {
+				c.Service.VerifyInstallation = true
+				c.Service.InstallationVerifiers = nil
+			},
+			err: "installation verifiers are required when VerifyInstallation is true",
+		},
+		{
+			name:   "mock authentication with authorization",
+			modify: func(c *Config) { c.Authentication.Mock = true },
+			err:    "mock authentication requires insecure_skip_authorization",
+		},
+		{
+			name: "audience policy for an audience not accepted",
+			modify: func(c *Config) {
+				c.Service.AudiencePolicies = map[string]AudiencePolicyConfig{"other": {MaxCommentsPerPR: 1}}
+			},
+			err: "audience policy for other is not an accepted audience",
+		},
+		{
+			name:   "invalid binding rule",
+			modify: func(c *Config) { c.Service.PullRequestBindingRules["push"] = "maybe" },
+			err:    "invalid pull request binding rule for event push: maybe",
+		},
+		{
+			name:   "workflow identity without signing key",
+			modify: func(c *Config) { c.Service.RequireMatchingWorkflowIdentity = true; c.Service.CommentSigningKey = "" },
+			err:    "comment signing key is required when RequireMatchingWorkflowIdentity is true",
+		},
+		{
+			name: "duplicate issuers",
+			modify: func(c *Config) {
+				c.Authentication.Issuers = append(c.Authentication.Issuers, c.Authentication.Issuers[0])
+			},
+			err: "duplicate issuer",
+		},
+		{
+			name: "app identity without app",
+			modify: func(c *Config) {
+				enabled := true
+				c.GitHub.AppID = 0
+				c.Service.UseGitHubAppIdentity = &enabled
+			},
+			err: "use_github_app_identity requires app_id",
+		},
+		{
+			name:   "invalid repository id",
+			modify: func(c *Config) { c.Service.DeniedRepositoryIDs = []int64{0} },
+			err:    "invalid denied repository id: 0",
+		},
+		{
+			name:   "invalid rate limit store",
+			modify: func(c *Config) { c.RateLimit.Store = "memcached" },
+			err:    "invalid rate limit store: memcached",
+		},
+		{
+			name:   "redis rate limit store without url",
+			modify: func(c *Config) { c.RateLimit.Store = RateLimitStoreRedis },
+			err:    "redis url is required for the redis rate limit store",
+		},
+		{
+			name:   "invalid idempotency store",
+			modify: func(c *Config) { c.Idempotency.Store = "memcached" },
+			err:    "invalid idempotency store: memcached",
+		},
+		{
+			name:   "redis idempotency store without url",
+			modify: func(c *Config) { c.Idempotency.Store = IdempotencyStoreRedis },
+			err:    "redis url is required for the redis idempotency store",
+		},
+		{
+			name:   "negative idempotency key ttl",
+			modify: func(c *Config) { c.Service.IdempotencyKeyTTL = -time.Second },
+			err:    "idempotency key TTL must not be negative",
+		},
+		{
+			name: "checks without namespace",
+			modify: func(c *Config) {
+				c.Service.EnableChecks = true
+				c.Service.CheckNamespace = ""
+			},
+			err: "check namespace is required when EnableChecks is true",
+		},
+		{
+			name:   "invalid lock store",
+			modify: func(c *Config) { c.Lock.Store = "etcd" },
+			err:    "invalid lock store: etcd",
+		},
+		{
+			name:   "redis lock store without url",
+			modify: func(c *Config) { c.Lock.Store = LockStoreRedis },
+			err:    "redis url is required for the redis lock store",
+		},
+		{
+			name:   "negative pull request lock timeout",
+			modify: func(c *Config) { c.Service.PullRequestLockTimeout = -time.Second },
+			err:    "pull request lock timeout must not be negative",
+		},
+		{
+			name:   "invalid audit sink",
+			modify: func(c *Config) { c.Audit.Sink = "syslog" },
+			err:    "invalid audit sink: syslog",
+		},
+		{
+			name:   "audit sink without path",
+			modify: func(c *Config) { c.Audit.Sink = AuditSinkSQLite },
+			err:    "audit path is required when an audit sink is set",
+		},
+		{
+			name: "negative audit retention",
+			modify: func(c *Config) {
+				c.Audit = AuditConfig{Sink: AuditSinkJSONL, Path: "audit.jsonl", Retention: -time.Hour}
+			},
+			err: "audit retention must not be negative",
+		},
+		{
+			name:   "missing audit signing key",
+			modify: func(c *Config) { c.Audit.SigningKeyFile = "/nonexistent/audit.pem" },
+			err:    "invalid audit signing key: failed to read audit signing key",
+		},
+		{
+			name: "audit checkpoint interval",
+			modify: func(c *Config) {
+				c.Audit.SigningKeyFile = "audit.pem"
+				c.Audit.CheckpointInterval = 0
+			},
+			err: "audit checkpoint interval must be positive",
+		},
+		{
+			name:   "receipts without issuer",
+			modify: func(c *Config) { c.Receipts.SigningKeyFile = "receipts.pem" },
+			err:    "receipts issuer is required when a receipts signing key is set",
+		},
+		{
+			name: "missing receipts signing key",
+			modify: func(c *Config) {
+				c.Receipts = ReceiptConfig{SigningKeyFile: "/nonexistent/receipts.pem", Issuer: "https://ghcp.example.com"}
+			},
+			err: "invalid receipts signing key: failed to read receipts signing key",
+		},
+		{
+			name: "delivery without workers",
+			modify: func(c *Config) {
+				c.Delivery.QueuePath = "queue.db"
+				c.Delivery.Workers = 0
+			},
+			err: "delivery workers must be positive",
+		},
+		{
+			name: "delivery without attempts",
+			modify: func(c *Config) {
+				c.Delivery.QueuePath = "queue.db"
+				c.Delivery.MaxAttempts = 0
+			},
+			err: "delivery max attempts must be positive",
+		},
+		{
+			name: "negative delivery retention",
+			modify: func(c *Config) {
+				c.Delivery.QueuePath = "queue.db"
+				c.Delivery.Retention = -time.Hour
+			},
+			err: "delivery retention must not be negative",
+		},
+		{
+			name: "invalid rate limit rule",
+			modify: func(c *Config) {
+				c.RateLimit.Rules = []RateLimitRuleConfig{{Scope: "repository", Requests: 10}}
+			},
+			err: "rate limit period must be at least 1ms for scope repository",
+		},
+		{
+			name: "invalid rate limit token type",
+			modify: func(c *Config) {
+				c.RateLimit.Rules = []RateLimitRuleConfig{{Scope: "actor", TokenType: "oidc", Requests: 10, Per: time.Hour}}
+			},
+			err: "invalid rate limit token type: oidc",
+		},
+		{
+			name:   "app without private key",
+			modify: func(c *Config) { c.GitHub.AppID = 1; c.GitHub.AppPrivateKey = ""; c.GitHub.AppPrivateKeyFile = "" },
+			err:    "app private key is required when app_id is set",
+		},
+		{
+			name:   "github rate limit low budget out of range",
+			modify: func(c *Config) { c.GitHub.RateLimit.LowBudget = 1 },
+			err:    "github rate limit low budget must be between 0 and 1",
+		},
+		{
+			name:   "negative github rate limit max wait",
+			modify: func(c *Config) { c.GitHub.RateLimit.MaxWait = -time.Second },
+			err:    "github rate limit max wait must not be negative",
+		},
+		{
+			name:   "negative github rate limit max retries",
+			modify: func(c *Config) { c.GitHub.RateLimit.MaxRetries = -1 },
+			err:    "github rate limit max retries must not be negative",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := Default()
+			c.modify(&config)
+
+			assert.ErrorContains(t, config.Validate(), c.err)
+		})
+	}
+}
+
+func TestAuditSink(t *testing.T) {
+	config := Default()
+
+	sink, err := config.AuditSink()
+	assert.NoError(t, err)
+	assert.Nil(t, sink)
+
+	for _, name := range []string{AuditSinkJSONL, AuditSinkSQLite} {
+		t.Run(name, func(t *testing.T) {
+			config.Audit = AuditConfig{Sink: name, Path: filepath.Join(t.TempDir(), "audit")}
+			assert.NoError(t, config.Validate())
+
+			sink, err := config.AuditSink()
+			assert.NoError(t, err)
+			assert.NotNil(t, sink)
+			assert.NoError(t, sink.Close())
+		})
+	}
+}
+
+func TestAuditSigningKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "audit.pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	config := Default()
+
+	signingKey, err := config.AuditSigningKey()
+	assert.NoError(t, err)
+	assert.Nil(t, signingKey)
+
+	config.Audit.SigningKeyFile = path
+	assert.NoError(t, config.Validate())
+
+	signingKey, err = config.AuditSigningKey()
+	assert.NoError(t, err)
+	assert.Equal(t, key, signingKey)
+}
+
+func TestReceiptSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "receipts.pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	config := Default()
+
+	signer, err := config.ReceiptSigner()
+	assert.NoError(t, err)
+	assert.Nil(t, signer)
+
+	config.Receipts = ReceiptConfig{SigningKeyFile: path, Issuer: "https://ghcp.example.com"}
+	assert.NoError(t, config.Validate())
+
+	signer, err = config.ReceiptSigner()
+	assert.NoError(t, err)
+	assert.NotNil(t, signer)
+
+	token, err := signer.Sign(receipt.Claims{CommentID: "10"})
+	assert.NoError(t, err)
+
+	claims, err := receipt.Verify(token, signer.JWKS())
+	assert.NoError(t, err)
+	assert.Equal(t, "https://ghcp.example.com", claims.Issuer)
+}
+
+func TestDeliveryQueue(t *testing.T) {
+	config := Default()
+
+	q, err := config.DeliveryQueue()
+	assert.NoError(t, err)
+	assert.Nil(t, q)
+
+	config.Delivery.QueuePath = filepath.Join(t.TempDir(), "queue.db")
+	config.Delivery.Workers = 4
+	assert.NoError(t, config.Validate())
+
+	q, err = config.DeliveryQueue()
+	assert.NoError(t, err)
+	assert.NotNil(t, q)
+	assert.NoError(t, q.Close())
+
+	workers := config.DeliveryWorkerConfig()
+	assert.Equal(t, 4, workers.Workers)
+	assert.Equal(t, ghcp.DefaultDeliveryMaxAttempts, workers.MaxAttempts)
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnvironment overrides the settings of the configuration from environment
+// variables named by the prefix and the path of the setting in the file. Lists of
+// values are comma separated. Empty variables are ignored. Maps and lists of objects
+// are only read from the file.
+func applyEnvironment(config *Config, prefix string, lookup func(string) (string, bool)) error {
+	return applyEnvironmentValue(reflect.ValueOf(config).Elem(), prefix, lookup)
+}
+
+func applyEnvironmentValue(v reflect.Value, name string, lookup func(string) (string, bool)) error {
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if tag == "" || tag == "-" {
+				continue
+			}
+
+			err := applyEnvironmentValue(v.Field(i), name+"_"+strings.ToUpper(tag), lookup)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	value, ok := lookup(name)
+	if !ok || value == "" {
+		return nil
+	}
+
+	if err := setValue(v, value); err != nil {
+		return fmt.Errorf("invalid value of %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func setValue(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), value); err != nil {
+			return err
+		}
+
+		v.Set(p)
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+	case reflect.Slice:
+		values := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(elem, s); err != nil {
+				return err
+			}
+
+			values = reflect.Append(values, elem)
+		}
+
+		v.Set(values)
+	default:
+		return fmt.Errorf("not supported in the environment")
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/safedep/dry/log"
+	"github.com/safedep/dry/obs"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	configHashMetric   = obs.NewGauge("ghcp_config_hash", "Hash of the active configuration")
+	configReloadMetric = obs.NewCounterVec("ghcp_config_reload_total", "Total number of configuration reloads",
+		[]string{"result"})
+)
+
+// Version returns the version of the configuration, which is derived from
+// its content. Servers with the same configuration have the same version.
+func (c Config) Version() string {
+	hash := c.hash()
+	return hex.EncodeToString(hash[:6])
+}
+
+func (c Config) hash() [sha256.Size]byte {
+	// Marshalling a struct can not fail
+	data, _ := yaml.Marshal(c)
+	return sha256.Sum256(data)
+}
+
+// Reloader reloads the configuration when it changes and applies it to the running
+// server. The configuration is checked periodically and on SIGHUP.
+type Reloader struct {
+	load     func() (Config, error)
+	apply    func(Config) error
+	interval time.Duration
+
+	m      sync.Mutex
+	active Config
+}
+
+// NewReloader creates a reloader for the active configuration. The configuration is
+// loaded using load and the changes are applied using apply, which must either apply
+// the whole configuration or leave the running server unchanged.
+func NewReloader(active Config, interval time.Duration,
+	load func() (Config, error), apply func(Config) error) *Reloader {
+	recordActiveConfig(active)
+
+	return &Reloader{
+		load:     load,
+		apply:    apply,
+		interval: interval,
+		active:   active,
+	}
+}
+
+// Reload loads the configuration and applies it when it has changed. The active
+// configuration is retained when the configuration is invalid or can not be applied.
+func (r *Reloader) Reload() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	config, err := r.load()
+	if err != nil {
+		configReloadMetric.WithLabels(map[string]string{"result": "failure"}).Inc()
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if config.Version() == r.active.Version() {
+		return nil
+	}
+
+	if err := config.Validate(); err != nil {
+		configReloadMetric.WithLabels(map[string]string{"result": "failure"}).Inc()
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	if err := r.apply(config); err != nil {
+		configReloadMetric.WithLabels(map[string]string{"result": "failure"}).Inc()
+		return fmt.Errorf("failed to apply config: %w", err)
+	}
+
+	if !reflect.DeepEqual(config.Server, r.active.Server) || !reflect.DeepEqual(config.GitHub, r.active.GitHub) ||
+		config.RateLimit.Store != r.active.RateLimit.Store || config.Idempotency != r.active.Idempotency ||
+		config.Lock != r.active.Lock || config.Audit != r.active.Audit || config.Receipts != r.active.Receipts ||
+		config.Delivery != r.active.Delivery || config.Redis != r.active.Redis {
+		log.Warnf("Changes to server, github, store, audit, receipts, delivery and redis settings are applied on restart")
+	}
+
+	r.active = config
+	configReloadMetric.WithLabels(map[string]string{"result": "success"}).Inc()
+	recordActiveConfig(config)
+
+	return nil
+}
+
+// Run reloads the configuration on SIGHUP and, when the interval is positive,
+// periodically until the context is cancelled
+func (r *Reloader) Run(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	var tick <-chan time.Time
+	if r.interval > 0 {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			log.Infof("Reloading config on SIGHUP")
+		case <-tick:
+		}
+
+		if err := r.Reload(); err != nil {
+			log.Errorf("failed to reload config, retaining version %s: %s", r.Active().Version(), err)
+		}
+	}
+}
+
+// Active returns the active configuration
+func (r *Reloader) Active() Config {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.active
+}
+
+func recordActiveConfig(config Config) {
+	hash := config.hash()
+
+	// Gauges are floats, 48 bits of the hash are represented exactly
+	configHashMetric.Set(float64(binary.BigEndian.Uint64(hash[:8]) >> 16))
+	log.Infof("Active config version: %s", config.Version())
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigVersion(t *testing.T) {
+	config := Default()
+	assert.Len(t, config.Version(), 12)
+	assert.Equal(t, config.Version(), Default().Version())
+
+	config.Service.MaxCommentsPerPR = 1
+	assert.NotEqual(t, Default().Version(), config.Version())
+}
+
+func TestReloaderReload(t *testing.T) {
+	changed := Default()
+	changed.Service.MaxCommentsPerPR = 1
+
+	invalid := Default()
+	invalid.Server.Address = ""
+
+	cases := []struct {
+		name     string
+		load     Config
+		loadErr  error
+		applyErr error
+		applied  bool
+		active   Config
+		err      string
+	}{
+		{
+			name:    "changed config is applied",
+			load:    changed,
+			applied: true,
+			active:  changed,
+		},
+		{
+			name:   "unchanged config is skipped",
+			load:   Default(),
+			active: Default(),
+		},
+		{
+			name:    "load failure retains the active config",
+			loadErr: errors.New("no such file"),
+			active:  Default(),
+			err:     "failed to load config: no such file",
+		},
+		{
+			name:   "invalid config retains the active config",
+			load:   invalid,
+			active: Default(),
+			err:    "invalid configuration: server address is required",
+		},
+		{
+			name:     "apply failure retains the active config",
+			load:     changed,
+			applyErr: errors.New("invalid issuer"),
+			applied:  true,
+			active:   Default(),
+			err:      "failed to apply config: invalid issuer",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			applied := false
+			reloader := NewReloader(Default(), 0, func() (Config, error) {
+				return c.load, c.loadErr
+			}, func(config Config) error {
+				applied = true
+				assert.Equal(t, c.load, config)
+				return c.applyErr
+			})
+
+			err := reloader.Reload()
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, c.applied, applied)
+			assert.Equal(t, c.active.Version(), reloader.Active().Version())
+		})
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/safedep/dry/log"
 	"github.com/safedep/dry/obs"
+	"github.com/safedep/ghcp/cmd/audit"
+	"github.com/safedep/ghcp/cmd/config"
 	"github.com/spf13/cobra"
 )
 
@@ -31,6 +33,8 @@ func main() {
 	})
 
 	cmd.AddCommand(server.NewServerCommand())
+	cmd.AddCommand(config.NewConfigCommand())
+	cmd.AddCommand(audit.NewAuditCommand())
 
 	if err := cmd.Execute(); err != nil {
 		log.Fatalf("failed to execute command: %v", err)
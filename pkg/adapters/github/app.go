@@ -0,0 +1,242 @@
+package github
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/go-github/v69/github"
+	"github.com/safedep/dry/log"
+)
+
+const (
+	// GitHub accepts app JWTs valid for at most 10 minutes
+	appJWTValidity = 9 * time.Minute
+
+	// Installation tokens are valid for an hour. We refresh them before
+	// they expire to avoid using a token that expires in-flight.
+	installationTokenRefreshWindow = 5 * time.Minute
+
+	// How long we remember whether the app is installed on a repository
+	installationLookupTTL = 10 * time.Minute
+)
+
+// GitHubAppIdentity is the identity of the GitHub App used to comment
+// on a repository where the app is installed
+type GitHubAppIdentity struct {
+	AppID int64
+	Slug  string
+}
+
+// BotLogin returns the login of the bot user of the app, which is
+// the author of the comments created by the app
+func (i GitHubAppIdentity) BotLogin() string {
+	return fmt.Sprintf("%s[bot]", i.Slug)
+}
+
+// appJWTTransport authenticates requests as the GitHub App using a JWT
+// signed with the app private key
+// https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+type appJWTTransport struct {
+	transport http.RoundTripper
+	appID     int64
+	key       *rsa.PrivateKey
+
+	m         sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func (t *appJWTTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.getToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return t.transport.RoundTrip(req)
+}
+
+func (t *appJWTTransport) getToken() (string, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	now := time.Now()
+	if t.token != "" && now.Add(time.Minute).Before(t.expiresAt) {
+		return t.token, nil
+	}
+
+	expiresAt := now.Add(appJWTValidity)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		// Allow for clock drift with GitHub
+		IssuedAt:  now.Add(-time.Minute).Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		Issuer:    strconv.FormatInt(t.appID, 10),
+	}).SignedString(t.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app JWT: %w", err)
+	}
+
+	t.token = token
+	t.expiresAt = expiresAt
+
+	return t.token, nil
+}
+
+type appInstallation struct {
+	// Zero when the app is not installed
+	id        int64
+	checkedAt time.Time
+}
+
+type installationToken struct {
+	client    *github.Client
+	expiresAt time.Time
+}
+
+// githubApp maintains the installation access tokens of a GitHub App
+type githubApp struct {
+	appID     int64
+	client    *github.Client
+	newClient func(owner, token string) *github.Client
+	m         sync.Mutex
+
+	identity      *GitHubAppIdentity
+	installations map[string]appInstallation
+	tokens        map[string]installationToken
+}
+
+// newGitHubApp creates the app with clients sending requests with the
+// transport of the credential of the app or its installation
+func newGitHubApp(config GitHubAdapterConfig, newClient func(*http.Client) *github.Client,
+	transport func(credential string) http.RoundTripper) (*githubApp, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(config.AppPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app private key: %w", err)
+	}
+
+	appClient := newClient(&http.Client{
+		Transport: &appJWTTransport{transport: transport("app"), appID: config.AppID, key: key},
+	})
+
+	return &githubApp{
+		appID:  config.AppID,
+		client: appClient,
+		newClient: func(owner, token string) *github.Client {
+			return newClient(&http.Client{Transport: transport("installation:" + owner)}).WithAuthToken(token)
+		},
+		installations: make(map[string]appInstallation),
+		tokens:        make(map[string]installationToken),
+	}, nil
+}
+
+// installationClient returns a client authenticated with the installation access token
+// of the app for the repository. Returns nil when the app is not installed on the repository.
+func (a *githubApp) installationClient(ctx context.Context, owner, repo string) (*github.Client, error) {
+	installationId, err := a.findInstallation(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if installationId == 0 {
+		return nil, nil
+	}
+
+	// An app has a single installation per owner
+	key := strings.ToLower(owner)
+
+	a.m.Lock()
+	cached, ok := a.tokens[key]
+	a.m.Unlock()
+
+	if ok && time.Now().Add(installationTokenRefreshWindow).Before(cached.expiresAt) {
+		return cached.client, nil
+	}
+
+	log.Debugf("Creating installation token for owner: %s installation: %d", owner, installationId)
+
+	token, _, err := a.client.Apps.CreateInstallationToken(ctx, installationId, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token: %w", err)
+	}
+
+	cached = installationToken{
+		client:    a.newClient(key, token.GetToken()),
+		expiresAt: token.GetExpiresAt().Time,
+	}
+
+	a.m.Lock()
+	a.tokens[key] = cached
+	a.m.Unlock()
+
+	return cached.client, nil
+}
+
+// findInstallation returns the installation ID of the app for the repository
+// or zero when the app is not installed on the repository
+func (a *githubApp) findInstallation(ctx context.Context, owner, repo string) (int64, error) {
+	key := strings.ToLower(fmt.Sprintf("%s/%s", owner, repo))
+
+	a.m.Lock()
+	cached, ok := a.installations[key]
+	a.m.Unlock()
+
+	if ok && time.Since(cached.checkedAt) < installationLookupTTL {
+		return cached.id, nil
+	}
+
+	installation, _, err := a.client.Apps.FindRepositoryInstallation(ctx, owner, repo)
+	if err != nil && !isNotFound(err) {
+		return 0, fmt.Errorf("failed to find app installation: %w", err)
+	}
+
+	cached = appInstallation{id: installation.GetID(), checkedAt: time.Now()}
+
+	a.m.Lock()
+	a.installations[key] = cached
+	a.m.Unlock()
+
+	return cached.id, nil
+}
+
+// getIdentity returns the identity of the app
+func (a *githubApp) getIdentity(ctx context.Context) (*GitHubAppIdentity, error) {
+	a.m.Lock()
+	identity := a.identity
+	a.m.Unlock()
+
+	if identity != nil {
+		return identity, nil
+	}
+
+	app, _, err := a.client.Apps.Get(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app: %w", err)
+	}
+
+	identity = &GitHubAppIdentity{AppID: app.GetID(), Slug: app.GetSlug()}
+
+	a.m.Lock()
+	a.identity = identity
+	a.m.Unlock()
+
+	return identity, nil
+}
+
+func isNotFound(err error) bool {
+	var errorResponse *github.ErrorResponse
+	if errors.As(err, &errorResponse) {
+		return errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusNotFound
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitHubAppAdapter(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	privateKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	var tokensCreated atomic.Int32
+
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	assertAppJWT := func(t *testing.T, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims := jwt.StandardClaims{}
+		_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "42", claims.Issuer)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/safedep/ghcp/installation", func(w http.ResponseWriter, r *http.Request) {
+		assertAppJWT(t, r)
+		writeJSON(w, map[string]interface{}{"id": 7})
+	})
+	mux.HandleFunc("GET /api/v3/repos/other/repo/installation", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]interface{}{"message": "Not Found"})
+	})
+	mux.HandleFunc("POST /api/v3/app/installations/7/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		assertAppJWT(t, r)
+		tokensCreated.Add(1)
+		writeJSON(w, map[string]interface{}{
+			"token":      "ghs_installation",
+			"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+		})
+	})
+	mux.HandleFunc("GET /api/v3/app", func(w http.ResponseWriter, r *http.Request) {
+		assertAppJWT(t, r)
+		writeJSON(w, map[string]interface{}{"id": 42, "slug": "safedep-ghcp"})
+	})
+	mux.HandleFunc("POST /api/v3/repos/{owner}/{repo}/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"id": 1, "body": r.Header.Get("Authorization")})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	adapter, err := NewGitHubAdapter(GitHubAdapterConfig{
+		Token:         "ghp_static",
+		AppID:         42,
+		AppPrivateKey: privateKey,
+		BaseURL:       server.URL,
+	})
+	assert.NoError(t, err)
+
+	t.Run("should comment using installation token when app is installed", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			comment, err := adapter.CreateIssueComment(context.Background(), "safedep", "ghcp", 1, "test")
+			assert.NoError(t, err)
+			assert.Equal(t, "Bearer ghs_installation", comment.GetBody())
+		}
+
+		// Installation token is cached
+		assert.Equal(t, int32(1), tokensCreated.Load())
+	})
+
+	t.Run("should comment using static token when app is not installed", func(t *testing.T) {
+		comment, err := adapter.CreateIssueComment(context.Background(), "other", "repo", 1, "test")
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer ghp_static", comment.GetBody())
+	})
+
+	t.Run("should return app identity when app is installed", func(t *testing.T) {
+		identity, err := adapter.GetAppIdentity(context.Background(), "safedep", "ghcp")
+		assert.NoError(t, err)
+		assert.Equal(t, &GitHubAppIdentity{AppID: 42, Slug: "safedep-ghcp"}, identity)
+		assert.Equal(t, "safedep-ghcp[bot]", identity.BotLogin())
+	})
+
+	t.Run("should not return app identity when app is not installed", func(t *testing.T) {
+		identity, err := adapter.GetAppIdentity(context.Background(), "other", "repo")
+		assert.NoError(t, err)
+		assert.Nil(t, identity)
+	})
+}
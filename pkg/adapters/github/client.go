@@ -2,15 +2,27 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/google/go-github/v69/github"
 	"github.com/safedep/dry/log"
-	"google.golang.org/protobuf/proto"
 )
 
+const (
+	// Default maximum number of comments read from an issue
+	defaultMaxIssueComments = 1000
+
+	// Maximum page size supported by the GitHub API
+	issueCommentsPageSize = 100
+)
+
+// ErrNotFound is returned when the requested resource does not exist
+var ErrNotFound = errors.New("not found")
+
 type GitHubAdapterConfig struct {
 	// PAT / Token based authentication
 	Token string
@@ -21,6 +33,27 @@ type GitHubAdapterConfig struct {
 	ClientId     string
 	ClientSecret string
 
+	// GitHub App credentials. When configured, the adapter uses the installation
+	// access token of the app for repositories where the app is installed and
+	// falls back to the credentials above otherwise.
+	// https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/authenticating-as-a-github-app-installation
+	AppID             int64
+	AppPrivateKey     []byte
+	AppPrivateKeyFile string
+
+	// Base URL of the GitHub API. Defaults to https://api.github.com/
+	// Useful for GitHub Enterprise Server.
+	BaseURL string
+
+	// Maximum number of comments read from an issue or the review comments
+	// read from a pull request. Comments beyond this are ignored. This bounds
+	// the API calls made for a single request.
+	MaxIssueComments int
+
+	// Requests of each credential are paced by the rate limits reported by
+	// GitHub so that a burst of requests does not lock out the credential
+	RateLimit RateLimitTransportConfig
+
 	// This is useful when we want to supply a client that
 	// can handle rate limiting, etc.
 	HTTPClient *http.Client
@@ -35,33 +68,80 @@ func DefaultGitHubAdapterConfig() GitHubAdapterConfig {
 	clientId, clientSecret := os.Getenv("GITHUB_CLIENT_ID"),
 		os.Getenv("GITHUB_CLIENT_SECRET")
 
+	appId, _ := strconv.ParseInt(os.Getenv("GHCP_GITHUB_APP_ID"), 10, 64)
+
+	maxIssueComments, err := strconv.Atoi(os.Getenv("GHCP_GITHUB_MAX_ISSUE_COMMENTS"))
+	if err != nil || maxIssueComments <= 0 {
+		maxIssueComments = defaultMaxIssueComments
+	}
+
 	return GitHubAdapterConfig{
-		Token:        token,
-		ClientId:     clientId,
-		ClientSecret: clientSecret,
+		Token:             token,
+		ClientId:          clientId,
+		ClientSecret:      clientSecret,
+		AppID:             appId,
+		AppPrivateKey:     []byte(os.Getenv("GHCP_GITHUB_APP_PRIVATE_KEY")),
+		AppPrivateKeyFile: os.Getenv("GHCP_GITHUB_APP_PRIVATE_KEY_FILE"),
+		BaseURL:           os.Getenv("GHCP_GITHUB_API_URL"),
+		MaxIssueComments:  maxIssueComments,
+		RateLimit:         DefaultRateLimitTransportConfig(),
 	}
 }
 
 //go:generate mockery --name=GitHubIssueAdapter
 type GitHubIssueAdapter interface {
 	ListIssueComments(ctx context.Context, owner, repo string, number int) ([]*github.IssueComment, error)
+
+	// WalkIssueComments calls fn for each comment on the issue, most recently created
+	// first, until fn returns false. Pages after the first are fetched only as required.
+	WalkIssueComments(ctx context.Context, owner, repo string, number int, fn func(*github.IssueComment) bool) error
+
 	CreateIssueComment(ctx context.Context, owner, repo string, number int, comment string) (*github.IssueComment, error)
 	UpdateIssueComment(ctx context.Context, owner, repo string, commentId int, comment string) (*github.IssueComment, error)
+	DeleteIssueComment(ctx context.Context, owner, repo string, commentId int) error
+
+	// GetAppIdentity returns the identity of the GitHub App used to comment on the
+	// repository. Returns nil when the comments are not made by a GitHub App.
+	GetAppIdentity(ctx context.Context, owner, repo string) (*GitHubAppIdentity, error)
 }
 
 //go:generate mockery --name=GitHubRepositoryAdapter
 type GitHubRepositoryAdapter interface {
 	GetRepository(ctx context.Context, owner, repo string) (*github.Repository, error)
+
+	// GetFileContent returns the content of the file on the default branch
+	// or ErrNotFound when the file does not exist
 	GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error)
 	GetPullRequest(ctx context.Context, owner, repo string, number int) (*github.PullRequest, error)
 }
 
+//go:generate mockery --name=GitHubPullRequestAdapter
+type GitHubPullRequestAdapter interface {
+	ListPullRequestComments(ctx context.Context, owner, repo string, number int) ([]*github.PullRequestComment, error)
+	CreatePullRequestReview(ctx context.Context, owner, repo string, number int,
+		review *github.PullRequestReviewRequest) (*github.PullRequestReview, error)
+	ListPullRequestCommits(ctx context.Context, owner, repo string, number int) ([]*github.RepositoryCommit, error)
+}
+
+//go:generate mockery --name=GitHubCheckAdapter
+type GitHubCheckAdapter interface {
+	// ListCheckRuns returns the check runs with the name created by the app on the ref
+	ListCheckRuns(ctx context.Context, owner, repo, ref, name string, appId int64) ([]*github.CheckRun, error)
+	CreateCheckRun(ctx context.Context, owner, repo string, opts github.CreateCheckRunOptions) (*github.CheckRun, error)
+	UpdateCheckRun(ctx context.Context, owner, repo string, checkRunId int64,
+		opts github.UpdateCheckRunOptions) (*github.CheckRun, error)
+	CreateCommitStatus(ctx context.Context, owner, repo, sha string, status *github.RepoStatus) (*github.RepoStatus, error)
+}
+
 type githubClient struct {
 	client *github.Client
 	config GitHubAdapterConfig
+	app    *githubApp
 }
 
 var _ GitHubIssueAdapter = &githubClient{}
+var _ GitHubPullRequestAdapter = &githubClient{}
+var _ GitHubCheckAdapter = &githubClient{}
 
 type basicAuthTransportWrapper struct {
 	Transport http.RoundTripper
@@ -79,10 +159,54 @@ func NewGitHubAdapter(config GitHubAdapterConfig) (*githubClient, error) {
 		config.HTTPClient = http.DefaultClient
 	}
 
-	client := github.NewClient(config.HTTPClient)
+	if config.MaxIssueComments <= 0 {
+		config.MaxIssueComments = defaultMaxIssueComments
+	}
+
+	var rateLimits *rateLimitTracker
+	if config.RateLimit.Enabled {
+		rateLimits = newRateLimitTracker(config.RateLimit)
+	}
+
+	// transport returns the transport of the requests made with the credential
+	transport := func(credential string) http.RoundTripper {
+		return rateLimits.transport(credential, config.HTTPClient.Transport)
+	}
+
+	newClient := func(httpClient *http.Client) *github.Client {
+		client := github.NewClient(httpClient)
+		if config.BaseURL != "" {
+			// Error is only possible with an invalid URL which we validate below
+			client, _ = client.WithEnterpriseURLs(config.BaseURL, config.BaseURL)
+		}
+
+		return client
+	}
+
+	if config.BaseURL != "" {
+		if _, err := github.NewClient(nil).WithEnterpriseURLs(config.BaseURL, config.BaseURL); err != nil {
+			return nil, fmt.Errorf("invalid base URL: %w", err)
+		}
+	}
 
 	// Client credentials have highest precedence
 	// for client authentication
+	credential := "anonymous"
+	if config.ClientId != "" && config.ClientSecret != "" {
+		credential = "client"
+	} else if config.Token != "" {
+		credential = "token"
+	}
+
+	httpClient := config.HTTPClient
+	if rateLimits != nil {
+		rateLimitedClient := *config.HTTPClient
+		rateLimitedClient.Transport = transport(credential)
+		httpClient = &rateLimitedClient
+	}
+
+	client := newClient(httpClient)
+
 	if config.ClientId != "" && config.ClientSecret != "" {
 		log.Debugf("Using client credentials for GitHub authentication")
 		client.Client().Transport = &basicAuthTransportWrapper{
@@ -97,37 +221,298 @@ func NewGitHubAdapter(config GitHubAdapterConfig) (*githubClient, error) {
 		log.Warnf("Created a GitHub client without a token. This may cause rate limiting issues.")
 	}
 
+	var app *githubApp
+	if config.AppID != 0 {
+		if len(config.AppPrivateKey) == 0 && config.AppPrivateKeyFile != "" {
+			key, err := os.ReadFile(config.AppPrivateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read app private key: %w", err)
+			}
+
+			config.AppPrivateKey = key
+		}
+
+		log.Debugf("Using GitHub App: %d for GitHub authentication where installed", config.AppID)
+
+		var err error
+		app, err = newGitHubApp(config, newClient, transport)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GitHub App client: %w", err)
+		}
+	}
+
 	return &githubClient{
 		client: client,
 		config: config,
+		app:    app,
 	}, nil
 }
 
+// clientFor returns the client to use for the repository. This is the
+// installation client of the GitHub App when installed on the repository.
+func (g *githubClient) clientFor(ctx context.Context, owner, repo string) (*github.Client, error) {
+	if g.app == nil {
+		return g.client, nil
+	}
+
+	client, err := g.app.installationClient(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		return g.client, nil
+	}
+
+	return client, nil
+}
+
+func (g *githubClient) GetAppIdentity(ctx context.Context, owner, repo string) (*GitHubAppIdentity, error) {
+	if g.app == nil {
+		return nil, nil
+	}
+
+	installationId, err := g.app.findInstallation(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if installationId == 0 {
+		return nil, nil
+	}
+
+	return g.app.getIdentity(ctx)
+}
+
 func (g *githubClient) ListIssueComments(ctx context.Context, owner, repo string, number int) ([]*github.IssueComment, error) {
-	comments, _, err := g.client.Issues.ListComments(ctx, owner, repo, int(number), &github.IssueListCommentsOptions{
-		Sort:      proto.String("updated"),
-		Direction: proto.String("desc"),
+	var comments []*github.IssueComment
+	err := g.WalkIssueComments(ctx, owner, repo, number, func(comment *github.IssueComment) bool {
+		comments = append(comments, comment)
+		return true
 	})
 
 	return comments, err
 }
 
+func (g *githubClient) WalkIssueComments(ctx context.Context, owner, repo string, number int,
+	fn func(*github.IssueComment) bool) error {
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	// The endpoint ignores the sort order and returns the comments oldest
+	// first. Pages are visited from the last one so that the most recent
+	// comments are visited first and the oldest are ignored at the maximum.
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: issueCommentsPageSize},
+	}
+
+	firstPage, resp, err := client.Issues.ListComments(ctx, owner, repo, number, opts)
+	if err != nil {
+		return err
+	}
+
+	page := max(resp.LastPage, 1)
+	visited := 0
+
+	for ; page >= 1; page-- {
+		comments := firstPage
+		if page > 1 {
+			opts.Page = page
+			comments, _, err = client.Issues.ListComments(ctx, owner, repo, number, opts)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i := len(comments) - 1; i >= 0; i-- {
+			if visited >= g.config.MaxIssueComments {
+				log.Warnf("Reached maximum of %d comments on %s/%s#%d, ignoring older comments",
+					g.config.MaxIssueComments, owner, repo, number)
+				return nil
+			}
+
+			visited++
+			if !fn(comments[i]) {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
 func (g *githubClient) CreateIssueComment(ctx context.Context, owner, repo string, number int, comment string) (*github.IssueComment, error) {
-	issueComment, _, err := g.client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &comment})
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	issueComment, _, err := client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &comment})
 	return issueComment, err
 }
 
 func (g *githubClient) UpdateIssueComment(ctx context.Context, owner, repo string, commentId int, comment string) (*github.IssueComment, error) {
-	issueComment, _, err := g.client.Issues.EditComment(ctx, owner, repo, int64(commentId), &github.IssueComment{Body: &comment})
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	issueComment, _, err := client.Issues.EditComment(ctx, owner, repo, int64(commentId), &github.IssueComment{Body: &comment})
 	return issueComment, err
 }
 
+func (g *githubClient) DeleteIssueComment(ctx context.Context, owner, repo string, commentId int) error {
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Issues.DeleteComment(ctx, owner, repo, int64(commentId))
+	return err
+}
+
+// ListPullRequestComments returns the review comments on the pull request
+func (g *githubClient) ListPullRequestComments(ctx context.Context, owner, repo string, number int) ([]*github.PullRequestComment, error) {
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []*github.PullRequestComment
+
+	// Unlike issue comments, the endpoint honours the sort order. The most
+	// recent comments are read first so that the oldest are ignored.
+	opts := &github.PullRequestListCommentsOptions{
+		Sort:        "created",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: issueCommentsPageSize},
+	}
+
+	for {
+		res, resp, err := client.PullRequests.ListComments(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		comments = append(comments, res...)
+		if len(comments) >= g.config.MaxIssueComments {
+			log.Warnf("Reached maximum of %d review comments on %s/%s#%d, ignoring older comments",
+				g.config.MaxIssueComments, owner, repo, number)
+			return comments[:g.config.MaxIssueComments], nil
+		}
+
+		if resp.NextPage == 0 {
+			return comments, nil
+		}
+
+		opts.Page = resp.NextPage
+	}
+}
+
+func (g *githubClient) CreatePullRequestReview(ctx context.Context, owner, repo string, number int,
+	review *github.PullRequestReviewRequest) (*github.PullRequestReview, error) {
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	res, _, err := client.PullRequests.CreateReview(ctx, owner, repo, number, review)
+	return res, err
+}
+
+// ListPullRequestCommits returns the commits of the pull request. GitHub
+// returns at most 250 commits of a pull request.
+func (g *githubClient) ListPullRequestCommits(ctx context.Context, owner, repo string, number int) ([]*github.RepositoryCommit, error) {
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*github.RepositoryCommit
+
+	opts := &github.ListOptions{PerPage: issueCommentsPageSize}
+	for {
+		res, resp, err := client.PullRequests.ListCommits(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		commits = append(commits, res...)
+		if resp.NextPage == 0 {
+			return commits, nil
+		}
+
+		opts.Page = resp.NextPage
+	}
+}
+
+func (g *githubClient) ListCheckRuns(ctx context.Context, owner, repo, ref, name string, appId int64) ([]*github.CheckRun, error) {
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	res, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, ref, &github.ListCheckRunsOptions{
+		CheckName: github.Ptr(name),
+		AppID:     github.Ptr(appId),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.CheckRuns, nil
+}
+
+func (g *githubClient) CreateCheckRun(ctx context.Context, owner, repo string,
+	opts github.CreateCheckRunOptions) (*github.CheckRun, error) {
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	checkRun, _, err := client.Checks.CreateCheckRun(ctx, owner, repo, opts)
+	return checkRun, err
+}
+
+func (g *githubClient) UpdateCheckRun(ctx context.Context, owner, repo string, checkRunId int64,
+	opts github.UpdateCheckRunOptions) (*github.CheckRun, error) {
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	checkRun, _, err := client.Checks.UpdateCheckRun(ctx, owner, repo, checkRunId, opts)
+	return checkRun, err
+}
+
+func (g *githubClient) CreateCommitStatus(ctx context.Context, owner, repo, sha string,
+	status *github.RepoStatus) (*github.RepoStatus, error) {
+	client, err := g.clientFor(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	res, _, err := client.Repositories.CreateStatus(ctx, owner, repo, sha, status)
+	return res, err
+}
+
 func (g *githubClient) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
 	content, _, _, err := g.client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{})
 	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("file %s: %w", path, ErrNotFound)
+		}
+
 		return nil, err
 	}
 
+	// Directories have no file content
+	if content == nil {
+		return nil, fmt.Errorf("file %s: %w", path, ErrNotFound)
+	}
+
 	data, err := content.GetContent()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get content of file %s: %w", path, err)
@@ -157,3 +542,27 @@ func (g *githubClient) GetRateLimits(ctx context.Context) (*github.RateLimits, e
 	limits, _, err := g.client.RateLimit.Get(ctx)
 	return limits, err
 }
+
+// ListInstallationRepositories returns the repositories accessible to the
+// installation token used by the client. For a GITHUB_TOKEN issued to a
+// workflow run, this is the repository the workflow is running in.
+func (g *githubClient) ListInstallationRepositories(ctx context.Context) ([]*github.Repository, error) {
+	var repositories []*github.Repository
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		res, resp, err := g.client.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		repositories = append(repositories, res.Repositories...)
+		if resp.NextPage == 0 {
+			break
+		}
+
+		opts.Page = resp.NextPage
+	}
+
+	return repositories, nil
+}
@@ -2,9 +2,16 @@ package github
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
 	"testing"
 
+	"github.com/google/go-github/v69/github"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,3 +59,134 @@ func TestGitHubClientAdapterListIssueComments(t *testing.T) {
 		})
 	}
 }
+
+func TestGitHubClientAdapterWalkIssueComments(t *testing.T) {
+	const totalComments = 250
+
+	var pagesFetched atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pagesFetched.Add(1)
+
+		assert.Equal(t, "/api/v3/repos/safedep/ghcp/issues/1/comments", r.URL.Path)
+		assert.Equal(t, "100", r.URL.Query().Get("per_page"))
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+
+		var comments []map[string]interface{}
+		for i := (page - 1) * 100; i < page*100 && i < totalComments; i++ {
+			comments = append(comments, map[string]interface{}{"id": i + 1})
+		}
+
+		// Comments are returned oldest first regardless of the sort order
+		if page*100 < totalComments {
+			lastPage := (totalComments + 99) / 100
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=%d&per_page=100>; rel="next", `+
+				`<http://%s%s?page=%d&per_page=100>; rel="last"`,
+				r.Host, r.URL.Path, page+1, r.Host, r.URL.Path, lastPage))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(comments)
+	}))
+	defer server.Close()
+
+	newAdapter := func(t *testing.T, maxComments int) *githubClient {
+		adapter, err := NewGitHubAdapter(GitHubAdapterConfig{
+			Token:            "ghp_static",
+			BaseURL:          server.URL,
+			MaxIssueComments: maxComments,
+		})
+
+		assert.NoError(t, err)
+		return adapter
+	}
+
+	t.Run("should list comments across all pages", func(t *testing.T) {
+		pagesFetched.Store(0)
+
+		comments, err := newAdapter(t, 0).ListIssueComments(context.Background(), "safedep", "ghcp", 1)
+		assert.NoError(t, err)
+		assert.Len(t, comments, totalComments)
+		assert.Equal(t, int64(totalComments), comments[0].GetID())
+		assert.Equal(t, int64(1), comments[totalComments-1].GetID())
+		assert.Equal(t, int32(3), pagesFetched.Load())
+	})
+
+	t.Run("should ignore the oldest comments at the maximum number of comments", func(t *testing.T) {
+		pagesFetched.Store(0)
+
+		comments, err := newAdapter(t, 150).ListIssueComments(context.Background(), "safedep", "ghcp", 1)
+		assert.NoError(t, err)
+		assert.Len(t, comments, 150)
+		assert.Equal(t, int64(totalComments), comments[0].GetID())
+		assert.Equal(t, int64(101), comments[149].GetID())
+		assert.Equal(t, int32(3), pagesFetched.Load())
+	})
+
+	t.Run("should stop when the walk function returns false", func(t *testing.T) {
+		pagesFetched.Store(0)
+
+		var visited []int64
+		err := newAdapter(t, 0).WalkIssueComments(context.Background(), "safedep", "ghcp", 1,
+			func(comment *github.IssueComment) bool {
+				visited = append(visited, comment.GetID())
+				return comment.GetID() != 220
+			})
+
+		assert.NoError(t, err)
+		assert.Len(t, visited, 31)
+		assert.Equal(t, int32(2), pagesFetched.Load())
+	})
+
+	t.Run("should visit a single page once", func(t *testing.T) {
+		pagesFetched.Store(0)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pagesFetched.Add(1)
+
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{{"id": 1}, {"id": 2}})
+		}))
+		defer server.Close()
+
+		adapter, err := NewGitHubAdapter(GitHubAdapterConfig{Token: "ghp_static", BaseURL: server.URL})
+		assert.NoError(t, err)
+
+		comments, err := adapter.ListIssueComments(context.Background(), "safedep", "ghcp", 1)
+		assert.NoError(t, err)
+		assert.Len(t, comments, 2)
+		assert.Equal(t, int64(2), comments[0].GetID())
+		assert.Equal(t, int32(1), pagesFetched.Load())
+	})
+}
+
+func TestGitHubClientAdapterListPullRequestComments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v3/repos/safedep/ghcp/pulls/1/comments", r.URL.Path)
+
+		// The most recent comments are requested first
+		assert.Equal(t, "created", r.URL.Query().Get("sort"))
+		assert.Equal(t, "desc", r.URL.Query().Get("direction"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{{"id": 3}, {"id": 2}, {"id": 1}})
+	}))
+	defer server.Close()
+
+	adapter, err := NewGitHubAdapter(GitHubAdapterConfig{
+		Token:            "ghp_static",
+		BaseURL:          server.URL,
+		MaxIssueComments: 2,
+	})
+	assert.NoError(t, err)
+
+	comments, err := adapter.ListPullRequestComments(context.Background(), "safedep", "ghcp", 1)
+	assert.NoError(t, err)
+	assert.Len(t, comments, 2)
+	assert.Equal(t, int64(3), comments[0].GetID())
+	assert.Equal(t, int64(2), comments[1].GetID())
+}
@@ -0,0 +1,285 @@
+// Code generated by mockery v2.46.3. DO NOT EDIT.
+
+package github
+
+import (
+	context "context"
+
+	v69github "github.com/google/go-github/v69/github"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockGitHubCheckAdapter is an autogenerated mock type for the GitHubCheckAdapter type
+type MockGitHubCheckAdapter struct {
+	mock.Mock
+}
+
+type MockGitHubCheckAdapter_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockGitHubCheckAdapter) EXPECT() *MockGitHubCheckAdapter_Expecter {
+	return &MockGitHubCheckAdapter_Expecter{mock: &_m.Mock}
+}
+
+// CreateCheckRun provides a mock function with given fields: ctx, owner, repo, opts
+func (_m *MockGitHubCheckAdapter) CreateCheckRun(ctx context.Context, owner string, repo string, opts v69github.CreateCheckRunOptions) (*v69github.CheckRun, error) {
+	ret := _m.Called(ctx, owner, repo, opts)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateCheckRun")
+	}
+
+	var r0 *v69github.CheckRun
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, v69github.CreateCheckRunOptions) (*v69github.CheckRun, error)); ok {
+		return rf(ctx, owner, repo, opts)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, v69github.CreateCheckRunOptions) *v69github.CheckRun); ok {
+		r0 = rf(ctx, owner, repo, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*v69github.CheckRun)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, v69github.CreateCheckRunOptions) error); ok {
+		r1 = rf(ctx, owner, repo, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockGitHubCheckAdapter_CreateCheckRun_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateCheckRun'
+type MockGitHubCheckAdapter_CreateCheckRun_Call struct {
+	*mock.Call
+}
+
+// CreateCheckRun is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+//   - opts v69github.CreateCheckRunOptions
+func (_e *MockGitHubCheckAdapter_Expecter) CreateCheckRun(ctx interface{}, owner interface{}, repo interface{}, opts interface{}) *MockGitHubCheckAdapter_CreateCheckRun_Call {
+	return &MockGitHubCheckAdapter_CreateCheckRun_Call{Call: _e.mock.On("CreateCheckRun", ctx, owner, repo, opts)}
+}
+
+func (_c *MockGitHubCheckAdapter_CreateCheckRun_Call) Run(run func(ctx context.Context, owner string, repo string, opts v69github.CreateCheckRunOptions)) *MockGitHubCheckAdapter_CreateCheckRun_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(v69github.CreateCheckRunOptions))
+	})
+	return _c
+}
+
+func (_c *MockGitHubCheckAdapter_CreateCheckRun_Call) Return(_a0 *v69github.CheckRun, _a1 error) *MockGitHubCheckAdapter_CreateCheckRun_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockGitHubCheckAdapter_CreateCheckRun_Call) RunAndReturn(run func(context.Context, string, string, v69github.CreateCheckRunOptions) (*v69github.CheckRun, error)) *MockGitHubCheckAdapter_CreateCheckRun_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CreateCommitStatus provides a mock function with given fields: ctx, owner, repo, sha, status
+func (_m *MockGitHubCheckAdapter) CreateCommitStatus(ctx context.Context, owner string, repo string, sha string, status *v69github.RepoStatus) (*v69github.RepoStatus, error) {
+	ret := _m.Called(ctx, owner, repo, sha, status)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateCommitStatus")
+	}
+
+	var r0 *v69github.RepoStatus
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, *v69github.RepoStatus) (*v69github.RepoStatus, error)); ok {
+		return rf(ctx, owner, repo, sha, status)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, *v69github.RepoStatus) *v69github.RepoStatus); ok {
+		r0 = rf(ctx, owner, repo, sha, status)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*v69github.RepoStatus)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, *v69github.RepoStatus) error); ok {
+		r1 = rf(ctx, owner, repo, sha, status)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockGitHubCheckAdapter_CreateCommitStatus_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateCommitStatus'
+type MockGitHubCheckAdapter_CreateCommitStatus_Call struct {
+	*mock.Call
+}
+
+// CreateCommitStatus is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+//   - sha string
+//   - status *v69github.RepoStatus
+func (_e *MockGitHubCheckAdapter_Expecter) CreateCommitStatus(ctx interface{}, owner interface{}, repo interface{}, sha interface{}, status interface{}) *MockGitHubCheckAdapter_CreateCommitStatus_Call {
+	return &MockGitHubCheckAdapter_CreateCommitStatus_Call{Call: _e.mock.On("CreateCommitStatus", ctx, owner, repo, sha, status)}
+}
+
+func (_c *MockGitHubCheckAdapter_CreateCommitStatus_Call) Run(run func(ctx context.Context, owner string, repo string, sha string, status *v69github.RepoStatus)) *MockGitHubCheckAdapter_CreateCommitStatus_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(string), args[4].(*v69github.RepoStatus))
+	})
+	return _c
+}
+
+func (_c *MockGitHubCheckAdapter_CreateCommitStatus_Call) Return(_a0 *v69github.RepoStatus, _a1 error) *MockGitHubCheckAdapter_CreateCommitStatus_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockGitHubCheckAdapter_CreateCommitStatus_Call) RunAndReturn(run func(context.Context, string, string, string, *v69github.RepoStatus) (*v69github.RepoStatus, error)) *MockGitHubCheckAdapter_CreateCommitStatus_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListCheckRuns provides a mock function with given fields: ctx, owner, repo, ref, name, appId
+func (_m *MockGitHubCheckAdapter) ListCheckRuns(ctx context.Context, owner string, repo string, ref string, name string, appId int64) ([]*v69github.CheckRun, error) {
+	ret := _m.Called(ctx, owner, repo, ref, name, appId)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListCheckRuns")
+	}
+
+	var r0 []*v69github.CheckRun
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, int64) ([]*v69github.CheckRun, error)); ok {
+		return rf(ctx, owner, repo, ref, name, appId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, int64) []*v69github.CheckRun); ok {
+		r0 = rf(ctx, owner, repo, ref, name, appId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*v69github.CheckRun)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string, int64) error); ok {
+		r1 = rf(ctx, owner, repo, ref, name, appId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockGitHubCheckAdapter_ListCheckRuns_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListCheckRuns'
+type MockGitHubCheckAdapter_ListCheckRuns_Call struct {
+	*mock.Call
+}
+
+// ListCheckRuns is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+//   - ref string
+//   - name string
+//   - appId int64
+func (_e *MockGitHubCheckAdapter_Expecter) ListCheckRuns(ctx interface{}, owner interface{}, repo interface{}, ref interface{}, name interface{}, appId interface{}) *MockGitHubCheckAdapter_ListCheckRuns_Call {
+	return &MockGitHubCheckAdapter_ListCheckRuns_Call{Call: _e.mock.On("ListCheckRuns", ctx, owner, repo, ref, name, appId)}
+}
+
+func (_c *MockGitHubCheckAdapter_ListCheckRuns_Call) Run(run func(ctx context.Context, owner string, repo string, ref string, name string, appId int64)) *MockGitHubCheckAdapter_ListCheckRuns_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(string), args[4].(string), args[5].(int64))
+	})
+	return _c
+}
+
+func (_c *MockGitHubCheckAdapter_ListCheckRuns_Call) Return(_a0 []*v69github.CheckRun, _a1 error) *MockGitHubCheckAdapter_ListCheckRuns_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockGitHubCheckAdapter_ListCheckRuns_Call) RunAndReturn(run func(context.Context, string, string, string, string, int64) ([]*v69github.CheckRun, error)) *MockGitHubCheckAdapter_ListCheckRuns_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateCheckRun provides a mock function with given fields: ctx, owner, repo, checkRunId, opts
+func (_m *MockGitHubCheckAdapter) UpdateCheckRun(ctx context.Context, owner string, repo string, checkRunId int64, opts v69github.UpdateCheckRunOptions) (*v69github.CheckRun, error) {
+	ret := _m.Called(ctx, owner, repo, checkRunId, opts)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateCheckRun")
+	}
+
+	var r0 *v69github.CheckRun
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64, v69github.UpdateCheckRunOptions) (*v69github.CheckRun, error)); ok {
+		return rf(ctx, owner, repo, checkRunId, opts)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64, v69github.UpdateCheckRunOptions) *v69github.CheckRun); ok {
+		r0 = rf(ctx, owner, repo, checkRunId, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*v69github.CheckRun)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int64, v69github.UpdateCheckRunOptions) error); ok {
+		r1 = rf(ctx, owner, repo, checkRunId, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockGitHubCheckAdapter_UpdateCheckRun_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateCheckRun'
+type MockGitHubCheckAdapter_UpdateCheckRun_Call struct {
+	*mock.Call
+}
+
+// UpdateCheckRun is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+//   - checkRunId int64
+//   - opts v69github.UpdateCheckRunOptions
+func (_e *MockGitHubCheckAdapter_Expecter) UpdateCheckRun(ctx interface{}, owner interface{}, repo interface{}, checkRunId interface{}, opts interface{}) *MockGitHubCheckAdapter_UpdateCheckRun_Call {
+	return &MockGitHubCheckAdapter_UpdateCheckRun_Call{Call: _e.mock.On("UpdateCheckRun", ctx, owner, repo, checkRunId, opts)}
+}
+
+func (_c *MockGitHubCheckAdapter_UpdateCheckRun_Call) Run(run func(ctx context.Context, owner string, repo string, checkRunId int64, opts v69github.UpdateCheckRunOptions)) *MockGitHubCheckAdapter_UpdateCheckRun_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(int64), args[4].(v69github.UpdateCheckRunOptions))
+	})
+	return _c
+}
+
+func (_c *MockGitHubCheckAdapter_UpdateCheckRun_Call) Return(_a0 *v69github.CheckRun, _a1 error) *MockGitHubCheckAdapter_UpdateCheckRun_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockGitHubCheckAdapter_UpdateCheckRun_Call) RunAndReturn(run func(context.Context, string, string, int64, v69github.UpdateCheckRunOptions) (*v69github.CheckRun, error)) *MockGitHubCheckAdapter_UpdateCheckRun_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockGitHubCheckAdapter creates a new instance of MockGitHubCheckAdapter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockGitHubCheckAdapter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockGitHubCheckAdapter {
+	mock := &MockGitHubCheckAdapter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -84,6 +84,115 @@ func (_c *MockGitHubIssueAdapter_CreateIssueComment_Call) RunAndReturn(run func(
 	return _c
 }
 
+// DeleteIssueComment provides a mock function with given fields: ctx, owner, repo, commentId
+func (_m *MockGitHubIssueAdapter) DeleteIssueComment(ctx context.Context, owner string, repo string, commentId int) error {
+	ret := _m.Called(ctx, owner, repo, commentId)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteIssueComment")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) error); ok {
+		r0 = rf(ctx, owner, repo, commentId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockGitHubIssueAdapter_DeleteIssueComment_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteIssueComment'
+type MockGitHubIssueAdapter_DeleteIssueComment_Call struct {
+	*mock.Call
+}
+
+// DeleteIssueComment is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+//   - commentId int
+func (_e *MockGitHubIssueAdapter_Expecter) DeleteIssueComment(ctx interface{}, owner interface{}, repo interface{}, commentId interface{}) *MockGitHubIssueAdapter_DeleteIssueComment_Call {
+	return &MockGitHubIssueAdapter_DeleteIssueComment_Call{Call: _e.mock.On("DeleteIssueComment", ctx, owner, repo, commentId)}
+}
+
+func (_c *MockGitHubIssueAdapter_DeleteIssueComment_Call) Run(run func(ctx context.Context, owner string, repo string, commentId int)) *MockGitHubIssueAdapter_DeleteIssueComment_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(int))
+	})
+	return _c
+}
+
+func (_c *MockGitHubIssueAdapter_DeleteIssueComment_Call) Return(_a0 error) *MockGitHubIssueAdapter_DeleteIssueComment_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockGitHubIssueAdapter_DeleteIssueComment_Call) RunAndReturn(run func(context.Context, string, string, int) error) *MockGitHubIssueAdapter_DeleteIssueComment_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetAppIdentity provides a mock function with given fields: ctx, owner, repo
+func (_m *MockGitHubIssueAdapter) GetAppIdentity(ctx context.Context, owner string, repo string) (*GitHubAppIdentity, error) {
+	ret := _m.Called(ctx, owner, repo)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetAppIdentity")
+	}
+
+	var r0 *GitHubAppIdentity
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (*GitHubAppIdentity, error)); ok {
+		return rf(ctx, owner, repo)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *GitHubAppIdentity); ok {
+		r0 = rf(ctx, owner, repo)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*GitHubAppIdentity)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, owner, repo)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockGitHubIssueAdapter_GetAppIdentity_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetAppIdentity'
+type MockGitHubIssueAdapter_GetAppIdentity_Call struct {
+	*mock.Call
+}
+
+// GetAppIdentity is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+func (_e *MockGitHubIssueAdapter_Expecter) GetAppIdentity(ctx interface{}, owner interface{}, repo interface{}) *MockGitHubIssueAdapter_GetAppIdentity_Call {
+	return &MockGitHubIssueAdapter_GetAppIdentity_Call{Call: _e.mock.On("GetAppIdentity", ctx, owner, repo)}
+}
+
+func (_c *MockGitHubIssueAdapter_GetAppIdentity_Call) Run(run func(ctx context.Context, owner string, repo string)) *MockGitHubIssueAdapter_GetAppIdentity_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *MockGitHubIssueAdapter_GetAppIdentity_Call) Return(_a0 *GitHubAppIdentity, _a1 error) *MockGitHubIssueAdapter_GetAppIdentity_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockGitHubIssueAdapter_GetAppIdentity_Call) RunAndReturn(run func(context.Context, string, string) (*GitHubAppIdentity, error)) *MockGitHubIssueAdapter_GetAppIdentity_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // ListIssueComments provides a mock function with given fields: ctx, owner, repo, number
 func (_m *MockGitHubIssueAdapter) ListIssueComments(ctx context.Context, owner string, repo string, number int) ([]*v69github.IssueComment, error) {
 	ret := _m.Called(ctx, owner, repo, number)
@@ -207,6 +316,56 @@ func (_c *MockGitHubIssueAdapter_UpdateIssueComment_Call) RunAndReturn(run func(
 	return _c
 }
 
+// WalkIssueComments provides a mock function with given fields: ctx, owner, repo, number, fn
+func (_m *MockGitHubIssueAdapter) WalkIssueComments(ctx context.Context, owner string, repo string, number int, fn func(*v69github.IssueComment) bool) error {
+	ret := _m.Called(ctx, owner, repo, number, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for WalkIssueComments")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, func(*v69github.IssueComment) bool) error); ok {
+		r0 = rf(ctx, owner, repo, number, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockGitHubIssueAdapter_WalkIssueComments_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'WalkIssueComments'
+type MockGitHubIssueAdapter_WalkIssueComments_Call struct {
+	*mock.Call
+}
+
+// WalkIssueComments is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+//   - number int
+//   - fn func(*v69github.IssueComment) bool
+func (_e *MockGitHubIssueAdapter_Expecter) WalkIssueComments(ctx interface{}, owner interface{}, repo interface{}, number interface{}, fn interface{}) *MockGitHubIssueAdapter_WalkIssueComments_Call {
+	return &MockGitHubIssueAdapter_WalkIssueComments_Call{Call: _e.mock.On("WalkIssueComments", ctx, owner, repo, number, fn)}
+}
+
+func (_c *MockGitHubIssueAdapter_WalkIssueComments_Call) Run(run func(ctx context.Context, owner string, repo string, number int, fn func(*v69github.IssueComment) bool)) *MockGitHubIssueAdapter_WalkIssueComments_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(int), args[4].(func(*v69github.IssueComment) bool))
+	})
+	return _c
+}
+
+func (_c *MockGitHubIssueAdapter_WalkIssueComments_Call) Return(_a0 error) *MockGitHubIssueAdapter_WalkIssueComments_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockGitHubIssueAdapter_WalkIssueComments_Call) RunAndReturn(run func(context.Context, string, string, int, func(*v69github.IssueComment) bool) error) *MockGitHubIssueAdapter_WalkIssueComments_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewMockGitHubIssueAdapter creates a new instance of MockGitHubIssueAdapter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockGitHubIssueAdapter(t interface {
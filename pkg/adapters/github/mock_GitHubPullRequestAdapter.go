@@ -0,0 +1,221 @@
+// Code generated by mockery v2.46.3. DO NOT EDIT.
+
+package github
+
+import (
+	context "context"
+
+	v69github "github.com/google/go-github/v69/github"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockGitHubPullRequestAdapter is an autogenerated mock type for the GitHubPullRequestAdapter type
+type MockGitHubPullRequestAdapter struct {
+	mock.Mock
+}
+
+type MockGitHubPullRequestAdapter_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockGitHubPullRequestAdapter) EXPECT() *MockGitHubPullRequestAdapter_Expecter {
+	return &MockGitHubPullRequestAdapter_Expecter{mock: &_m.Mock}
+}
+
+// CreatePullRequestReview provides a mock function with given fields: ctx, owner, repo, number, review
+func (_m *MockGitHubPullRequestAdapter) CreatePullRequestReview(ctx context.Context, owner string, repo string, number int, review *v69github.PullRequestReviewRequest) (*v69github.PullRequestReview, error) {
+	ret := _m.Called(ctx, owner, repo, number, review)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreatePullRequestReview")
+	}
+
+	var r0 *v69github.PullRequestReview
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, *v69github.PullRequestReviewRequest) (*v69github.PullRequestReview, error)); ok {
+		return rf(ctx, owner, repo, number, review)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, *v69github.PullRequestReviewRequest) *v69github.PullRequestReview); ok {
+		r0 = rf(ctx, owner, repo, number, review)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*v69github.PullRequestReview)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, *v69github.PullRequestReviewRequest) error); ok {
+		r1 = rf(ctx, owner, repo, number, review)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockGitHubPullRequestAdapter_CreatePullRequestReview_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreatePullRequestReview'
+type MockGitHubPullRequestAdapter_CreatePullRequestReview_Call struct {
+	*mock.Call
+}
+
+// CreatePullRequestReview is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+//   - number int
+//   - review *v69github.PullRequestReviewRequest
+func (_e *MockGitHubPullRequestAdapter_Expecter) CreatePullRequestReview(ctx interface{}, owner interface{}, repo interface{}, number interface{}, review interface{}) *MockGitHubPullRequestAdapter_CreatePullRequestReview_Call {
+	return &MockGitHubPullRequestAdapter_CreatePullRequestReview_Call{Call: _e.mock.On("CreatePullRequestReview", ctx, owner, repo, number, review)}
+}
+
+func (_c *MockGitHubPullRequestAdapter_CreatePullRequestReview_Call) Run(run func(ctx context.Context, owner string, repo string, number int, review *v69github.PullRequestReviewRequest)) *MockGitHubPullRequestAdapter_CreatePullRequestReview_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(int), args[4].(*v69github.PullRequestReviewRequest))
+	})
+	return _c
+}
+
+func (_c *MockGitHubPullRequestAdapter_CreatePullRequestReview_Call) Return(_a0 *v69github.PullRequestReview, _a1 error) *MockGitHubPullRequestAdapter_CreatePullRequestReview_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockGitHubPullRequestAdapter_CreatePullRequestReview_Call) RunAndReturn(run func(context.Context, string, string, int, *v69github.PullRequestReviewRequest) (*v69github.PullRequestReview, error)) *MockGitHubPullRequestAdapter_CreatePullRequestReview_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListPullRequestComments provides a mock function with given fields: ctx, owner, repo, number
+func (_m *MockGitHubPullRequestAdapter) ListPullRequestComments(ctx context.Context, owner string, repo string, number int) ([]*v69github.PullRequestComment, error) {
+	ret := _m.Called(ctx, owner, repo, number)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListPullRequestComments")
+	}
+
+	var r0 []*v69github.PullRequestComment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) ([]*v69github.PullRequestComment, error)); ok {
+		return rf(ctx, owner, repo, number)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) []*v69github.PullRequestComment); ok {
+		r0 = rf(ctx, owner, repo, number)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*v69github.PullRequestComment)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, owner, repo, number)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockGitHubPullRequestAdapter_ListPullRequestComments_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListPullRequestComments'
+type MockGitHubPullRequestAdapter_ListPullRequestComments_Call struct {
+	*mock.Call
+}
+
+// ListPullRequestComments is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+//   - number int
+func (_e *MockGitHubPullRequestAdapter_Expecter) ListPullRequestComments(ctx interface{}, owner interface{}, repo interface{}, number interface{}) *MockGitHubPullRequestAdapter_ListPullRequestComments_Call {
+	return &MockGitHubPullRequestAdapter_ListPullRequestComments_Call{Call: _e.mock.On("ListPullRequestComments", ctx, owner, repo, number)}
+}
+
+func (_c *MockGitHubPullRequestAdapter_ListPullRequestComments_Call) Run(run func(ctx context.Context, owner string, repo string, number int)) *MockGitHubPullRequestAdapter_ListPullRequestComments_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(int))
+	})
+	return _c
+}
+
+func (_c *MockGitHubPullRequestAdapter_ListPullRequestComments_Call) Return(_a0 []*v69github.PullRequestComment, _a1 error) *MockGitHubPullRequestAdapter_ListPullRequestComments_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockGitHubPullRequestAdapter_ListPullRequestComments_Call) RunAndReturn(run func(context.Context, string, string, int) ([]*v69github.PullRequestComment, error)) *MockGitHubPullRequestAdapter_ListPullRequestComments_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListPullRequestCommits provides a mock function with given fields: ctx, owner, repo, number
+func (_m *MockGitHubPullRequestAdapter) ListPullRequestCommits(ctx context.Context, owner string, repo string, number int) ([]*v69github.RepositoryCommit, error) {
+	ret := _m.Called(ctx, owner, repo, number)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListPullRequestCommits")
+	}
+
+	var r0 []*v69github.RepositoryCommit
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) ([]*v69github.RepositoryCommit, error)); ok {
+		return rf(ctx, owner, repo, number)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) []*v69github.RepositoryCommit); ok {
+		r0 = rf(ctx, owner, repo, number)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*v69github.RepositoryCommit)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, owner, repo, number)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockGitHubPullRequestAdapter_ListPullRequestCommits_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListPullRequestCommits'
+type MockGitHubPullRequestAdapter_ListPullRequestCommits_Call struct {
+	*mock.Call
+}
+
+// ListPullRequestCommits is a helper method to define mock.On call
+//   - ctx context.Context
+//   - owner string
+//   - repo string
+//   - number int
+func (_e *MockGitHubPullRequestAdapter_Expecter) ListPullRequestCommits(ctx interface{}, owner interface{}, repo interface{}, number interface{}) *MockGitHubPullRequestAdapter_ListPullRequestCommits_Call {
+	return &MockGitHubPullRequestAdapter_ListPullRequestCommits_Call{Call: _e.mock.On("ListPullRequestCommits", ctx, owner, repo, number)}
+}
+
+func (_c *MockGitHubPullRequestAdapter_ListPullRequestCommits_Call) Run(run func(ctx context.Context, owner string, repo string, number int)) *MockGitHubPullRequestAdapter_ListPullRequestCommits_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(int))
+	})
+	return _c
+}
+
+func (_c *MockGitHubPullRequestAdapter_ListPullRequestCommits_Call) Return(_a0 []*v69github.RepositoryCommit, _a1 error) *MockGitHubPullRequestAdapter_ListPullRequestCommits_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockGitHubPullRequestAdapter_ListPullRequestCommits_Call) RunAndReturn(run func(context.Context, string, string, int) ([]*v69github.RepositoryCommit, error)) *MockGitHubPullRequestAdapter_ListPullRequestCommits_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockGitHubPullRequestAdapter creates a new instance of MockGitHubPullRequestAdapter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockGitHubPullRequestAdapter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockGitHubPullRequestAdapter {
+	mock := &MockGitHubPullRequestAdapter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,456 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/safedep/dry/log"
+	"github.com/safedep/dry/obs"
+)
+
+const (
+	// Fraction of the rate limit below which requests are paced over
+	// the remaining time of the rate limit window
+	DefaultRateLimitLowBudget = 0.1
+
+	// Maximum time a request waits for the rate limit of its credential.
+	// Requests that would wait longer fail with RateLimitWaitError.
+	DefaultRateLimitMaxWait = 30 * time.Second
+
+	// Maximum number of retries of an idempotent request failed by GitHub
+	DefaultRateLimitMaxRetries = 2
+
+	// How long a credential is blocked after hitting a secondary rate limit
+	// when GitHub does not tell when to retry
+	// https://docs.github.com/en/rest/using-the-rest-api/rate-limits-for-the-rest-api#exceeding-the-rate-limit
+	secondaryRateLimitBackoff = time.Minute
+
+	// Backoff before the first retry of a request without Retry-After
+	retryBackoff = time.Second
+
+	// Maximum size of an error body read to detect a secondary rate limit
+	maxRateLimitBodySize = 64 << 10
+)
+
+// Rate limit resource of requests not reporting one
+const defaultRateLimitResource = "core"
+
+var (
+	rateLimitRemainingMetric = newRateLimitGaugeVec("ghcp_github_rate_limit_remaining", "Number of requests remaining in the GitHub rate limit window")
+	rateLimitLimitMetric     = newRateLimitGaugeVec("ghcp_github_rate_limit_limit", "Number of requests allowed in the GitHub rate limit window")
+	rateLimitResetMetric     = newRateLimitGaugeVec("ghcp_github_rate_limit_reset_timestamp_seconds", "Time at which the GitHub rate limit window resets")
+	rateLimitThrottledMetric = obs.NewCounterVec("ghcp_github_rate_limit_throttled_total", "Total number of GitHub requests delayed by a rate limit", []string{"credential"})
+	rateLimitRejectedMetric  = obs.NewCounterVec("ghcp_github_rate_limit_rejected_total", "Total number of GitHub requests failed without waiting for a rate limit", []string{"credential"})
+	secondaryRateLimitMetric = obs.NewCounterVec("ghcp_github_secondary_rate_limit_total", "Total number of GitHub secondary rate limits hit", []string{"credential"})
+	requestRetryMetric       = obs.NewCounterVec("ghcp_github_request_retry_total", "Total number of GitHub requests retried", []string{"credential"})
+)
+
+// newRateLimitGaugeVec registers a gauge labelled by credential and resource.
+// dry does not support gauge vectors so the gauge is registered like the
+// metrics created by dry.
+func newRateLimitGaugeVec(name, desc string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: strings.ReplaceAll(obs.AppServiceName("ghcp"), "-", "_"),
+		Name:      name,
+		Help:      desc,
+		ConstLabels: prometheus.Labels{
+			"service": obs.AppServiceName("app"),
+			"env":     obs.AppServiceEnv("dev"),
+		},
+	}, []string{"credential", "resource"})
+
+	prometheus.MustRegister(gauge)
+	return gauge
+}
+
+// RateLimitTransportConfig configures how requests are paced by the rate
+// limits GitHub reports for each credential
+// https://docs.github.com/en/rest/using-the-rest-api/rate-limits-for-the-rest-api
+type RateLimitTransportConfig struct {
+	Enabled bool
+
+	// Fraction of the rate limit below which requests are spread over the
+	// remaining time of the window instead of exhausting the budget
+	LowBudget float64
+
+	// Maximum time a request waits for the rate limit. Requests that
+	// would wait longer fail with RateLimitWaitError.
+	MaxWait time.Duration
+
+	// Maximum number of retries of GET and HEAD requests failed
+	// with a server error or too many requests
+	MaxRetries int
+}
+
+func DefaultRateLimitTransportConfig() RateLimitTransportConfig {
+	return RateLimitTransportConfig{
+		Enabled:    true,
+		LowBudget:  DefaultRateLimitLowBudget,
+		MaxWait:    DefaultRateLimitMaxWait,
+		MaxRetries: DefaultRateLimitMaxRetries,
+	}
+}
+
+// RateLimitWaitError is returned when a request would wait longer than
+// allowed for the rate limit of its credential
+type RateLimitWaitError struct {
+	Credential string
+	Resource   string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitWaitError) Error() string {
+	return fmt.Sprintf("GitHub rate limit of %s exhausted for %s, retry after %s",
+		e.Resource, e.Credential, e.RetryAfter.Round(time.Second))
+}
+
+// rateLimitTracker holds the budgets of the credentials of an adapter. The
+// budget of a credential outlives its clients so that a refreshed
+// installation token shares the budget of the installation.
+type rateLimitTracker struct {
+	config  RateLimitTransportConfig
+	m       sync.Mutex
+	budgets map[string]*rateLimitBudget
+}
+
+func newRateLimitTracker(config RateLimitTransportConfig) *rateLimitTracker {
+	return &rateLimitTracker{
+		config:  config,
+		budgets: make(map[string]*rateLimitBudget),
+	}
+}
+
+// transport returns the transport pacing the requests of the credential.
+// Requests are sent with the transport when the tracker is nil.
+func (t *rateLimitTracker) transport(credential string, transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if t == nil {
+		return transport
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	budget, ok := t.budgets[credential]
+	if !ok {
+		budget = &rateLimitBudget{resources: make(map[string]*resourceBudget)}
+		t.budgets[credential] = budget
+	}
+
+	return &rateLimitTransport{
+		transport:  transport,
+		credential: credential,
+		budget:     budget,
+		config:     t.config,
+	}
+}
+
+// rateLimitBudget is the rate limit state of a credential
+type rateLimitBudget struct {
+	m            sync.Mutex
+	resources    map[string]*resourceBudget
+	blockedUntil time.Time
+}
+
+type resourceBudget struct {
+	limit     int
+	remaining int
+	reset     time.Time
+
+	// Time of the next request when requests are paced
+	nextSlot time.Time
+}
+
+// reserve takes a request from the budget of the resource and returns how long
+// to wait before sending it. Nothing is taken when the wait is over maxWait.
+func (b *rateLimitBudget) reserve(resource string, now time.Time, lowBudget float64,
+	maxWait time.Duration) (time.Duration, bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	var wait time.Duration
+	if now.Before(b.blockedUntil) {
+		wait = b.blockedUntil.Sub(now)
+	}
+
+	r, ok := b.resources[resource]
+	if !ok || !now.Before(r.reset) {
+		// Nothing is known of the current window
+		return wait, wait <= maxWait
+	}
+
+	if r.remaining <= 0 {
+		wait = max(wait, r.reset.Sub(now))
+		return wait, wait <= maxWait
+	}
+
+	if float64(r.remaining) > lowBudget*float64(r.limit) {
+		if wait > maxWait {
+			return wait, false
+		}
+
+		r.remaining--
+		return wait, true
+	}
+
+	// Spread the remaining requests over the rest of the window
+	slot := now.Add(wait)
+	if r.nextSlot.After(slot) {
+		slot = r.nextSlot
+	}
+
+	if slot.Sub(now) > maxWait {
+		return slot.Sub(now), false
+	}
+
+	r.nextSlot = slot.Add(r.reset.Sub(now) / time.Duration(r.remaining))
+	r.remaining--
+
+	return slot.Sub(now), true
+}
+
+// update records the rate limit reported by GitHub for the resource
+func (b *rateLimitBudget) update(resource string, limit, remaining int, reset time.Time) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	r, ok := b.resources[resource]
+	if !ok {
+		r = &resourceBudget{}
+		b.resources[resource] = r
+	}
+
+	// Responses of concurrent requests arrive out of order. Within a
+	// window the lowest remaining count is the most recent.
+	if ok && r.reset.Equal(reset) {
+		remaining = min(remaining, r.remaining)
+	}
+
+	r.limit = limit
+	r.remaining = remaining
+	r.reset = reset
+}
+
+// block holds the requests of the credential until the time
+func (b *rateLimitBudget) block(until time.Time) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// rateLimitTransport paces the requests of a credential by the rate limits
+// reported by GitHub and retries idempotent requests failed by GitHub
+type rateLimitTransport struct {
+	transport  http.RoundTripper
+	credential string
+	budget     *rateLimitBudget
+	config     RateLimitTransportConfig
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource := requestResource(req)
+
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(req.Context(), resource); err != nil {
+			return nil, err
+		}
+
+		res, err := t.transport.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := t.observe(res); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+
+		if attempt >= t.config.MaxRetries || !retryableRequest(req, res) {
+			return res, nil
+		}
+
+		// Requests over a rate limit wait for the budget of the credential
+		var delay time.Duration
+		if res.StatusCode != http.StatusTooManyRequests {
+			delay = retryDelay(res, attempt)
+			if delay > t.config.MaxWait {
+				return res, nil
+			}
+		}
+
+		log.Debugf("Retrying GitHub request: %s %s status: %d after: %s",
+			req.Method, req.URL.Path, res.StatusCode, delay)
+
+		requestRetryMetric.WithLabels(map[string]string{"credential": t.credential}).Inc()
+
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxRateLimitBodySize))
+		res.Body.Close()
+
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait waits until the request can be sent within the rate limit of the credential
+func (t *rateLimitTransport) wait(ctx context.Context, resource string) error {
+	wait, ok := t.budget.reserve(resource, time.Now(), t.config.LowBudget, t.config.MaxWait)
+	if !ok {
+		rateLimitRejectedMetric.WithLabels(map[string]string{"credential": t.credential}).Inc()
+		return &RateLimitWaitError{Credential: t.credential, Resource: resource, RetryAfter: wait}
+	}
+
+	if wait <= 0 {
+		return nil
+	}
+
+	log.Debugf("Waiting %s for GitHub rate limit of %s for %s", wait, resource, t.credential)
+	rateLimitThrottledMetric.WithLabels(map[string]string{"credential": t.credential}).Inc()
+
+	return sleep(ctx, wait)
+}
+
+// observe records the rate limit reported in the response. Secondary rate
+// limits are not reported in headers and are detected from the error.
+func (t *rateLimitTransport) observe(res *http.Response) error {
+	now := time.Now()
+
+	limit, limitErr := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	remaining, remainingErr := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	reset, resetErr := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+	if limitErr == nil && remainingErr == nil && resetErr == nil {
+		resource := res.Header.Get("X-RateLimit-Resource")
+		if resource == "" {
+			resource = defaultRateLimitResource
+		}
+
+		t.budget.update(resource, limit, remaining, time.Unix(reset, 0))
+
+		labels := prometheus.Labels{"credential": t.credential, "resource": resource}
+		rateLimitLimitMetric.With(labels).Set(float64(limit))
+		rateLimitRemainingMetric.With(labels).Set(float64(remaining))
+		rateLimitResetMetric.With(labels).Set(float64(reset))
+	}
+
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	// The primary rate limit is exhausted and already recorded
+	if remainingErr == nil && remaining == 0 {
+		return nil
+	}
+
+	if retryAfter, ok := ParseRetryAfter(res.Header.Get("Retry-After"), now); ok {
+		t.blockSecondary(now.Add(retryAfter))
+		return nil
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		t.blockSecondary(now.Add(secondaryRateLimitBackoff))
+		return nil
+	}
+
+	// A forbidden response is a secondary rate limit only when the message says so
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxRateLimitBodySize))
+	if err != nil {
+		return fmt.Errorf("failed to read GitHub response: %w", err)
+	}
+
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	if strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+		t.blockSecondary(now.Add(secondaryRateLimitBackoff))
+	}
+
+	return nil
+}
+
+func (t *rateLimitTransport) blockSecondary(until time.Time) {
+	log.Warnf("GitHub secondary rate limit hit for %s, blocking requests until %s",
+		t.credential, until.Format(time.RFC3339))
+
+	secondaryRateLimitMetric.WithLabels(map[string]string{"credential": t.credential}).Inc()
+	t.budget.block(until)
+}
+
+// requestResource returns the rate limit resource of the request. Only the
+// resources with a separate limit used by the adapter are distinguished.
+func requestResource(req *http.Request) string {
+	path := req.URL.Path
+	switch {
+	case strings.Contains(path, "/search/"):
+		return "search"
+	case strings.HasSuffix(path, "/graphql"):
+		return "graphql"
+	default:
+		return defaultRateLimitResource
+	}
+}
+
+// retryableRequest returns true when the request is idempotent and
+// failed by GitHub being unavailable or rate limiting it
+func retryableRequest(req *http.Request, res *http.Response) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	return res.StatusCode == http.StatusTooManyRequests ||
+		res.StatusCode >= http.StatusInternalServerError
+}
+
+// retryDelay returns the delay before retrying the request. GitHub tells
+// when to retry with Retry-After, otherwise the delay backs off exponentially.
+func retryDelay(res *http.Response, attempt int) time.Duration {
+	if delay, ok := ParseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+		return delay
+	}
+
+	return retryBackoff << attempt
+}
+
+// ParseRetryAfter parses the Retry-After header of a GitHub response, in seconds
+// or as an HTTP date, into the delay from now
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,299 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v69/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitBudgetReserve(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		name      string
+		resources map[string]*resourceBudget
+		blocked   time.Duration
+		waits     []time.Duration
+		ok        bool
+	}{
+		{
+			name:  "unknown budget",
+			waits: []time.Duration{0, 0},
+			ok:    true,
+		},
+		{
+			name: "budget above low budget",
+			resources: map[string]*resourceBudget{
+				"core": {limit: 100, remaining: 50, reset: now.Add(time.Hour)},
+			},
+			waits: []time.Duration{0, 0},
+			ok:    true,
+		},
+		{
+			name: "window reset",
+			resources: map[string]*resourceBudget{
+				"core": {limit: 100, remaining: 0, reset: now.Add(-time.Second)},
+			},
+			waits: []time.Duration{0},
+			ok:    true,
+		},
+		{
+			name: "low budget paced over the window",
+			resources: map[string]*resourceBudget{
+				"core": {limit: 100, remaining: 5, reset: now.Add(50 * time.Second)},
+			},
+			waits: []time.Duration{0, 10 * time.Second, 22500 * time.Millisecond},
+			ok:    true,
+		},
+		{
+			name: "exhausted budget resets within max wait",
+			resources: map[string]*resourceBudget{
+				"core": {limit: 100, remaining: 0, reset: now.Add(20 * time.Second)},
+			},
+			waits: []time.Duration{20 * time.Second},
+			ok:    true,
+		},
+		{
+			name: "exhausted budget resets after max wait",
+			resources: map[string]*resourceBudget{
+				"core": {limit: 100, remaining: 0, reset: now.Add(time.Hour)},
+			},
+			waits: []time.Duration{time.Hour},
+			ok:    false,
+		},
+		{
+			name: "budget of other resource exhausted",
+			resources: map[string]*resourceBudget{
+				"search": {limit: 30, remaining: 0, reset: now.Add(time.Hour)},
+			},
+			waits: []time.Duration{0},
+			ok:    true,
+		},
+		{
+			name:    "blocked by secondary rate limit",
+			blocked: 10 * time.Second,
+			waits:   []time.Duration{10 * time.Second},
+			ok:      true,
+		},
+		{
+			name:    "blocked by secondary rate limit after max wait",
+			blocked: time.Minute,
+			waits:   []time.Duration{time.Minute},
+			ok:      false,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			budget := &rateLimitBudget{resources: test.resources, blockedUntil: now.Add(test.blocked)}
+			if budget.resources == nil {
+				budget.resources = make(map[string]*resourceBudget)
+			}
+
+			for _, expected := range test.waits {
+				wait, ok := budget.reserve("core", now, DefaultRateLimitLowBudget, DefaultRateLimitMaxWait)
+				assert.Equal(t, test.ok, ok)
+				assert.Equal(t, expected, wait)
+			}
+		})
+	}
+}
+
+func TestRateLimitBudgetUpdate(t *testing.T) {
+	budget := &rateLimitBudget{resources: make(map[string]*resourceBudget)}
+	reset := time.Now().Add(time.Hour)
+
+	budget.update("core", 100, 50, reset)
+	budget.update("core", 100, 60, reset)
+	assert.Equal(t, 50, budget.resources["core"].remaining)
+
+	budget.update("core", 100, 99, reset.Add(time.Hour))
+	assert.Equal(t, 99, budget.resources["core"].remaining)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		value string
+		wait  time.Duration
+		ok    bool
+	}{
+		{"empty", "", 0, false},
+		{"seconds", "30", 30 * time.Second, true},
+		{"negative seconds", "-1", 0, false},
+		{"http date", now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{"http date in the past", now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"invalid", "soon", 0, false},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			wait, ok := ParseRetryAfter(test.value, now)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.wait, wait)
+		})
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	cases := []struct {
+		name     string
+		handler  func(w http.ResponseWriter, attempt int32)
+		call     func(client *githubClient) error
+		requests int32
+		err      func(t *testing.T, err error)
+	}{
+		{
+			name: "idempotent request retried on server error",
+			handler: func(w http.ResponseWriter, attempt int32) {
+				if attempt == 1 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+
+				_, _ = w.Write([]byte(`{"id": 1}`))
+			},
+			call: func(client *githubClient) error {
+				_, err := client.GetRepository(context.Background(), "safedep", "ghcp")
+				return err
+			},
+			requests: 2,
+		},
+		{
+			name: "idempotent request retried up to max retries",
+			handler: func(w http.ResponseWriter, attempt int32) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			call: func(client *githubClient) error {
+				_, err := client.GetRepository(context.Background(), "safedep", "ghcp")
+				return err
+			},
+			requests: 3,
+			err: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "503")
+			},
+		},
+		{
+			name: "retry after over max wait",
+			handler: func(w http.ResponseWriter, attempt int32) {
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			call: func(client *githubClient) error {
+				_, err := client.GetRepository(context.Background(), "safedep", "ghcp")
+				return err
+			},
+			requests: 1,
+			err: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "503")
+			},
+		},
+		{
+			name: "non idempotent request not retried",
+			handler: func(w http.ResponseWriter, attempt int32) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			call: func(client *githubClient) error {
+				_, err := client.CreateIssueComment(context.Background(), "safedep", "ghcp", 1, "comment")
+				return err
+			},
+			requests: 1,
+			err: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "502")
+			},
+		},
+		{
+			name: "secondary rate limit blocks the credential",
+			handler: func(w http.ResponseWriter, attempt int32) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message": "You have exceeded a secondary rate limit."}`))
+			},
+			call: func(client *githubClient) error {
+				_, err := client.CreateIssueComment(context.Background(), "safedep", "ghcp", 1, "comment")
+				assert.ErrorContains(t, err, "secondary rate limit")
+
+				_, err = client.CreateIssueComment(context.Background(), "safedep", "ghcp", 1, "comment")
+				return err
+			},
+			requests: 1,
+			err: func(t *testing.T, err error) {
+				var waitErr *RateLimitWaitError
+				assert.True(t, errors.As(err, &waitErr))
+				assert.Equal(t, "token", waitErr.Credential)
+				assert.Greater(t, waitErr.RetryAfter, 50*time.Second)
+			},
+		},
+		{
+			name: "exhausted budget fails requests until reset",
+			handler: func(w http.ResponseWriter, attempt int32) {
+				w.Header().Set("X-RateLimit-Limit", "5000")
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+				w.Header().Set("X-RateLimit-Resource", "core")
+				_, _ = w.Write([]byte(`{"id": 1}`))
+			},
+			call: func(client *githubClient) error {
+				_, err := client.CreateIssueComment(context.Background(), "safedep", "ghcp", 1, "comment")
+				assert.NoError(t, err)
+
+				// A new client of the credential, like a client of a refreshed
+				// installation token, shares the budget of the credential
+				client.client, err = github.NewClient(client.client.Client()).
+					WithEnterpriseURLs(client.config.BaseURL, client.config.BaseURL)
+				assert.NoError(t, err)
+
+				_, err = client.CreateIssueComment(context.Background(), "safedep", "ghcp", 1, "comment")
+				return err
+			},
+			requests: 1,
+			err: func(t *testing.T, err error) {
+				var waitErr *RateLimitWaitError
+				assert.True(t, errors.As(err, &waitErr))
+				assert.Equal(t, "core", waitErr.Resource)
+			},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				test.handler(w, requests.Add(1))
+			}))
+			defer server.Close()
+
+			client, err := NewGitHubAdapter(GitHubAdapterConfig{
+				Token:   "test-token",
+				BaseURL: server.URL + "/",
+				RateLimit: RateLimitTransportConfig{
+					Enabled:    true,
+					LowBudget:  DefaultRateLimitLowBudget,
+					MaxWait:    time.Second,
+					MaxRetries: 2,
+				},
+			})
+			assert.NoError(t, err)
+
+			err = test.call(client)
+			if test.err != nil {
+				test.err(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, test.requests, requests.Load())
+		})
+	}
+}
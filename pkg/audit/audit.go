@@ -0,0 +1,150 @@
+// Package audit records the decisions of the service on the requests it
+// proxies so that every write to GitHub can be traced back to its caller
+package audit
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Decision is the outcome of a request
+type Decision string
+
+const (
+	// The request was authorized and executed
+	DecisionAllowed Decision = "allowed"
+
+	// The request was refused by a check of the service
+	DecisionDenied Decision = "denied"
+
+	// The request failed, e.g. because GitHub was unavailable
+	DecisionFailed Decision = "failed"
+)
+
+// Record is the decision of the service on a request, or a checkpoint
+// of the records written before it
+type Record struct {
+	// Position of the record in the chain and the hash of the record before it.
+	// The hash covers all the other fields of the record.
+	Sequence uint64 `json:"seq,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Decision  Decision  `json:"decision"`
+
+	// Reason of the decision, the reason of the error for denied and failed requests
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// Target of the request
+	Owner    string `json:"owner"`
+	Repo     string `json:"repo"`
+	PrNumber string `json:"pr_number,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+
+	// Action performed and the ID of the comment, review, check run or
+	// commit status written. Bodies are recorded by their SHA-256 digest.
+	Action     string `json:"action,omitempty"`
+	ResourceID string `json:"resource_id,omitempty"`
+	BodySHA256 string `json:"body_sha256,omitempty"`
+	Replayed   bool   `json:"replayed,omitempty"`
+
+	// Job of a request delivered asynchronously, recorded when the
+	// request is queued and when the job is delivered or failed
+	JobID string `json:"job_id,omitempty"`
+
+	Caller Caller `json:"caller"`
+
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	Pruned     *Pruned     `json:"pruned,omitempty"`
+}
+
+// Caller identifies the workflow run, or user, on whose behalf a request was made.
+// Empty when authorization is skipped.
+type Caller struct {
+	TokenType      string `json:"token_type,omitempty"`
+	Issuer         string `json:"issuer,omitempty"`
+	Subject        string `json:"subject,omitempty"`
+	Actor          string `json:"actor,omitempty"`
+	Repository     string `json:"repository,omitempty"`
+	RepositoryID   string `json:"repository_id,omitempty"`
+	EventName      string `json:"event_name,omitempty"`
+	Ref            string `json:"ref,omitempty"`
+	Workflow       string `json:"workflow,omitempty"`
+	WorkflowRef    string `json:"workflow_ref,omitempty"`
+	WorkflowSHA    string `json:"workflow_sha,omitempty"`
+	JobWorkflowRef string `json:"job_workflow_ref,omitempty"`
+	RunID          string `json:"run_id,omitempty"`
+	RunNumber      string `json:"run_number,omitempty"`
+	RunAttempt     string `json:"run_attempt,omitempty"`
+}
+
+// Filter selects records. Empty fields match all records.
+type Filter struct {
+	Owner    string
+	Repo     string
+	PrNumber string
+	Actor    string
+	RunID    string
+	Decision Decision
+	Since    time.Time
+	Until    time.Time
+
+	// Maximum number of records returned, the most recent ones. Zero returns all records.
+	Limit int
+}
+
+// Matches returns true when the record is selected by the filter
+func (f Filter) Matches(r Record) bool {
+	if f.Owner != "" && !strings.EqualFold(f.Owner, r.Owner) {
+		return false
+	}
+
+	if f.Repo != "" && !strings.EqualFold(f.Repo, r.Repo) {
+		return false
+	}
+
+	if f.PrNumber != "" && f.PrNumber != r.PrNumber {
+		return false
+	}
+
+	if f.Actor != "" && !strings.EqualFold(f.Actor, r.Caller.Actor) {
+		return false
+	}
+
+	if f.RunID != "" && f.RunID != r.Caller.RunID {
+		return false
+	}
+
+	if f.Decision != "" && f.Decision != r.Decision {
+		return false
+	}
+
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && !r.Time.Before(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+// Sink stores the records. Records are only appended, they are
+// removed once older than the retention period.
+type Sink interface {
+	// Write appends the record
+	Write(ctx context.Context, record Record) error
+
+	// Query returns the records selected by the filter, oldest first
+	Query(ctx context.Context, filter Filter) ([]Record, error)
+
+	// Prune removes the records older than the time and returns the number removed
+	Prune(ctx context.Context, before time.Time) (int, error)
+
+	Close() error
+}
@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMatches(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	record := Record{
+		Time:     now,
+		Decision: DecisionAllowed,
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Caller:   Caller{Actor: "octocat", RunID: "42"},
+	}
+
+	cases := []struct {
+		name    string
+		filter  Filter
+		matches bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"target", Filter{Owner: "SafeDep", Repo: "ghcp", PrNumber: "1"}, true},
+		{"other pr", Filter{Owner: "safedep", Repo: "ghcp", PrNumber: "2"}, false},
+		{"actor", Filter{Actor: "Octocat"}, true},
+		{"run id", Filter{RunID: "43"}, false},
+		{"decision", Filter{Decision: DecisionDenied}, false},
+		{"since", Filter{Since: now}, true},
+		{"since later", Filter{Since: now.Add(time.Second)}, false},
+		{"until", Filter{Until: now}, false},
+		{"until later", Filter{Until: now.Add(time.Second)}, true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.matches, test.filter.Matches(record))
+		})
+	}
+}
+
+func TestSinks(t *testing.T) {
+	sinks := map[string]func(t *testing.T) Sink{
+		"file": func(t *testing.T) Sink {
+			sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+			assert.NoError(t, err)
+
+			return sink
+		},
+		"sqlite": func(t *testing.T) Sink {
+			sink, err := NewSQLiteSink(filepath.Join(t.TempDir(), "audit.db"))
+			assert.NoError(t, err)
+
+			return sink
+		},
+	}
+
+	now := time.Unix(1700000000, 0).UTC()
+	records := []Record{
+		{
+			Time:       now,
+			Operation:  "create_comment",
+			Decision:   DecisionAllowed,
+			Reason:     "AUTHORIZED",
+			Owner:      "safedep",
+			Repo:       "ghcp",
+			PrNumber:   "1",
+			Action:     "created",
+			ResourceID: "10",
+			BodySHA256: "abc",
+			Caller:     Caller{TokenType: "workload_identity", Actor: "octocat", RunID: "42"},
+		},
+		{
+			Time:      now.Add(time.Minute),
+			Operation: "create_comment",
+			Decision:  DecisionDenied,
+			Reason:    "COMMENT_LIMIT_REACHED",
+			Error:     "maximum number of comments (1) reached for PR",
+			Owner:     "safedep",
+			Repo:      "ghcp",
+			PrNumber:  "1",
+			Caller:    Caller{TokenType: "workload_identity", Actor: "octocat", RunID: "43"},
+		},
+		{
+			Time:      now.Add(2 * time.Minute),
+			Operation: "delete_comment",
+			Decision:  DecisionAllowed,
+			Owner:     "safedep",
+			Repo:      "vet",
+			PrNumber:  "2",
+			Action:    "deleted",
+			Caller:    Caller{Actor: "hubot", RunID: "44"},
+		},
+	}
+
+	for name, newSink := range sinks {
+		t.Run(name, func(t *testing.T) {
+			sink := newSink(t)
+			defer sink.Close()
+
+			ctx := context.Background()
+			for _, record := range records {
+				assert.NoError(t, sink.Write(ctx, record))
+			}
+
+			res, err := sink.Query(ctx, Filter{})
+			assert.NoError(t, err)
+			assert.Equal(t, records, res)
+
+			res, err = sink.Query(ctx, Filter{Owner: "SafeDep", Repo: "ghcp", PrNumber: "1"})
+			assert.NoError(t, err)
+			assert.Equal(t, records[:2], res)
+
+			res, err = sink.Query(ctx, Filter{Actor: "octocat", Decision: DecisionDenied})
+			assert.NoError(t, err)
+			assert.Equal(t, records[1:2], res)
+
+			res, err = sink.Query(ctx, Filter{RunID: "44"})
+			assert.NoError(t, err)
+			assert.Equal(t, records[2:], res)
+
+			res, err = sink.Query(ctx, Filter{Since: now.Add(time.Minute), Until: now.Add(2 * time.Minute)})
+			assert.NoError(t, err)
+			assert.Equal(t, records[1:2], res)
+
+			// The most recent records are returned
+			res, err = sink.Query(ctx, Filter{Limit: 2})
+			assert.NoError(t, err)
+			assert.Equal(t, records[1:], res)
+
+			pruned, err := sink.Prune(ctx, now.Add(time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, pruned)
+
+			pruned, err = sink.Prune(ctx, now.Add(time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, 0, pruned)
+
+			// Records are appended after pruning
+			record := Record{Time: now.Add(3 * time.Minute), Decision: DecisionAllowed, Owner: "safedep", Repo: "ghcp"}
+			assert.NoError(t, sink.Write(ctx, record))
+
+			res, err = sink.Query(ctx, Filter{})
+			assert.NoError(t, err)
+			assert.Equal(t, append(append([]Record{}, records[1:]...), record), res)
+		})
+	}
+}
+
+func TestFileSinkInvalidRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte("{}\nnot json\n"), 0o600))
+
+	sink, err := NewFileSink(path)
+	assert.NoError(t, err)
+	defer sink.Close()
+
+	_, err = sink.Query(context.Background(), Filter{})
+	assert.ErrorContains(t, err, "failed to parse audit record at line 2")
+}
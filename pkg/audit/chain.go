@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/safedep/dry/log"
+)
+
+// Operations of the records written by the chain
+const (
+	OperationCheckpoint = "checkpoint"
+	OperationPrune      = "prune"
+)
+
+// Checkpoint is a signature of the chain up to the record before the checkpoint
+type Checkpoint struct {
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+}
+
+// Pruned marks the records up to the sequence as removed by the retention. The
+// oldest remaining record follows the last record removed, which had the hash.
+type Pruned struct {
+	Sequence uint64 `json:"seq"`
+	Hash     string `json:"hash"`
+}
+
+type chain struct {
+	m    sync.Mutex
+	sink Sink
+	key  ed25519.PrivateKey
+	now  func() time.Time
+
+	// Last record written to the sink
+	sequence uint64
+	hash     string
+	time     time.Time
+
+	// Records written since the last checkpoint
+	pending int
+}
+
+var _ Sink = (*chain)(nil)
+
+// NewChain returns a sink linking each record written to the sink with the hash of
+// the record before it. With a key, checkpoints signing the chain are written by
+// Checkpoint. The chain continues from the last record of the sink. The records of
+// a sink must only be written by a single chain. The time of a record is the time
+// it is written to the chain, so that the records are in the time order of their
+// sequence, which the retention relies on.
+func NewChain(ctx context.Context, sink Sink, key ed25519.PrivateKey) (*chain, error) {
+	last, err := sink.Query(ctx, Filter{Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last audit record: %w", err)
+	}
+
+	c := &chain{sink: sink, key: key, now: time.Now}
+	if len(last) > 0 {
+		c.sequence = last[0].Sequence
+		c.hash = last[0].Hash
+		c.time = last[0].Time
+
+		if last[0].Checkpoint == nil {
+			c.pending = 1
+		}
+	}
+
+	return c, nil
+}
+
+func (c *chain) Write(ctx context.Context, record Record) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if err := c.append(ctx, record); err != nil {
+		return err
+	}
+
+	c.pending++
+	return nil
+}
+
+// Checkpoint writes a checkpoint signing the chain when records were written since
+// the last checkpoint. Records before a checkpoint can not be changed without the key.
+func (c *chain) Checkpoint(ctx context.Context) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.checkpoint(ctx)
+}
+
+func (c *chain) checkpoint(ctx context.Context) error {
+	if c.key == nil || c.pending == 0 {
+		return nil
+	}
+
+	record := Record{
+		Operation: OperationCheckpoint,
+		Checkpoint: &Checkpoint{
+			KeyID:     KeyID(c.key.Public().(ed25519.PublicKey)),
+			Signature: hex.EncodeToString(ed25519.Sign(c.key, checkpointMessage(c.sequence+1, c.hash))),
+		},
+	}
+
+	if err := c.append(ctx, record); err != nil {
+		return err
+	}
+
+	c.pending = 0
+	return nil
+}
+
+// append links the record to the chain and writes it. The record is timed by
+// the chain, never before the record before it even when the clock goes back.
+func (c *chain) append(ctx context.Context, record Record) error {
+	record.Time = c.now().UTC()
+	if record.Time.Before(c.time) {
+		record.Time = c.time
+	}
+
+	record.Sequence = c.sequence + 1
+	record.PrevHash = c.hash
+
+	hash, err := recordHash(record)
+	if err != nil {
+		return err
+	}
+
+	record.Hash = hash
+	if err := c.sink.Write(ctx, record); err != nil {
+		return err
+	}
+
+	c.sequence = record.Sequence
+	c.hash = record.Hash
+	c.time = record.Time
+	return nil
+}
+
+func (c *chain) Query(ctx context.Context, filter Filter) ([]Record, error) {
+	return c.sink.Query(ctx, filter)
+}
+
+// Prune removes the records older than the time and appends a record marking the
+// last record removed, signed by a checkpoint. Records removed other than by the
+// retention are not marked, which is detected by the verification.
+func (c *chain) Prune(ctx context.Context, before time.Time) (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	last, err := c.sink.Query(ctx, Filter{Until: before, Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read last audit record to prune: %w", err)
+	}
+
+	pruned, err := c.sink.Prune(ctx, before)
+	if err != nil || pruned == 0 || len(last) == 0 || last[0].Sequence == 0 {
+		return pruned, err
+	}
+
+	record := Record{
+		Operation: OperationPrune,
+		Pruned:    &Pruned{Sequence: last[0].Sequence, Hash: last[0].Hash},
+	}
+
+	if err := c.append(ctx, record); err != nil {
+		return pruned, fmt.Errorf("failed to write audit prune record: %w", err)
+	}
+
+	c.pending++
+	if err := c.checkpoint(ctx); err != nil {
+		return pruned, fmt.Errorf("failed to sign audit prune record: %w", err)
+	}
+
+	return pruned, nil
+}
+
+func (c *chain) Close() error {
+	return c.sink.Close()
+}
+
+// RunCheckpoints writes a checkpoint at every interval until the context is done
+func RunCheckpoints(ctx context.Context, c *chain, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Checkpoint(ctx); err != nil {
+				log.Errorf("failed to write audit checkpoint: %s", err)
+			}
+		}
+	}
+}
+
+// recordHash returns the hex encoded SHA-256 hash of the record without its hash
+func recordHash(record Record) (string, error) {
+	record.Hash = ""
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// checkpointMessage is the message signed by the checkpoint at the sequence
+func checkpointMessage(sequence uint64, prevHash string) []byte {
+	return []byte(fmt.Sprintf("ghcp-audit-checkpoint:%d:%s", sequence, prevHash))
+}
@@ -0,0 +1,393 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	publicKey := key.Public().(ed25519.PublicKey)
+	now := time.Unix(1700000000, 0).UTC()
+
+	record := func(i int) Record {
+		return Record{
+			Time:      now.Add(time.Duration(i) * time.Minute),
+			Operation: "create_comment",
+			Decision:  DecisionAllowed,
+			Owner:     "safedep",
+			Repo:      "ghcp",
+			PrNumber:  "1",
+			Caller:    Caller{Actor: "octocat", RunID: "42"},
+		}
+	}
+
+	// newChain returns a chain timing the records a minute apart from now
+	newChain := func(t *testing.T, sink Sink) *chain {
+		chain, err := NewChain(context.Background(), sink, key)
+		assert.NoError(t, err)
+
+		next := now
+		chain.now = func() time.Time {
+			defer func() { next = next.Add(time.Minute) }()
+			return next
+		}
+
+		return chain
+	}
+
+	// Records 1 to 3, a checkpoint and records 5 and 6
+	newChainRecords := func(t *testing.T) []Record {
+		sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+		assert.NoError(t, err)
+		defer sink.Close()
+
+		ctx := context.Background()
+		chain := newChain(t, sink)
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, chain.Write(ctx, record(i)))
+		}
+
+		assert.NoError(t, chain.Checkpoint(ctx))
+
+		// No checkpoint without new records
+		assert.NoError(t, chain.Checkpoint(ctx))
+
+		for i := 3; i < 5; i++ {
+			assert.NoError(t, chain.Write(ctx, record(i)))
+		}
+
+		records, err := sink.Query(ctx, Filter{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 6)
+
+		return records
+	}
+
+	// rechain recomputes the hashes from the record, as done by someone
+	// editing the log without the key
+	rechain := func(records []Record, from int) {
+		for i := from; i < len(records); i++ {
+			if i > 0 {
+				records[i].PrevHash = records[i-1].Hash
+			}
+
+			records[i].Hash, _ = recordHash(records[i])
+		}
+	}
+
+	t.Run("valid chain", func(t *testing.T) {
+		records := newChainRecords(t)
+
+		report := Verify(records, publicKey)
+		assert.True(t, report.Valid(), report.Problems)
+		assert.Equal(t, 5, report.Records)
+		assert.Equal(t, 1, report.Checkpoints)
+		assert.Equal(t, uint64(1), report.FirstSequence)
+		assert.Equal(t, uint64(6), report.LastSequence)
+		assert.Equal(t, uint64(4), report.CheckpointedSequence)
+		assert.Equal(t, records[3].Time, report.CheckpointedTime)
+		assert.Equal(t, 2, report.Unsigned)
+		assert.Equal(t, OperationCheckpoint, records[3].Operation)
+	})
+
+	t.Run("chain continues from the last record", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		ctx := context.Background()
+
+		for i := 0; i < 2; i++ {
+			sink, err := NewFileSink(path)
+			assert.NoError(t, err)
+
+			chain := newChain(t, sink)
+
+			assert.NoError(t, chain.Write(ctx, record(i)))
+			assert.NoError(t, chain.Checkpoint(ctx))
+			assert.NoError(t, chain.Close())
+		}
+
+		sink, err := NewFileSink(path)
+		assert.NoError(t, err)
+		defer sink.Close()
+
+		records, err := sink.Query(ctx, Filter{})
+		assert.NoError(t, err)
+
+		report := Verify(records, publicKey)
+		assert.True(t, report.Valid(), report.Problems)
+		assert.Equal(t, 2, report.Records)
+		assert.Equal(t, 2, report.Checkpoints)
+		assert.Equal(t, uint64(4), report.CheckpointedSequence)
+	})
+
+	// Records 3 to 6 of the chain, followed by a prune record removing
+	// records 1 and 2 and a checkpoint signing it
+	newPrunedRecords := func(t *testing.T) []Record {
+		sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+		assert.NoError(t, err)
+		defer sink.Close()
+
+		ctx := context.Background()
+		chain := newChain(t, sink)
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, chain.Write(ctx, record(i)))
+		}
+
+		assert.NoError(t, chain.Checkpoint(ctx))
+
+		for i := 3; i < 5; i++ {
+			assert.NoError(t, chain.Write(ctx, record(i)))
+		}
+
+		pruned, err := chain.Prune(ctx, now.Add(2*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, pruned)
+
+		records, err := sink.Query(ctx, Filter{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 6)
+
+		return records
+	}
+
+	t.Run("oldest records removed by retention", func(t *testing.T) {
+		records := newPrunedRecords(t)
+
+		report := Verify(records, publicKey)
+		assert.True(t, report.Valid(), report.Problems)
+		assert.Equal(t, uint64(3), report.FirstSequence)
+		assert.Equal(t, uint64(2), report.PrunedSequence)
+		assert.Equal(t, uint64(8), report.CheckpointedSequence)
+		assert.Equal(t, 0, report.Unsigned)
+		assert.Equal(t, &Pruned{Sequence: 2, Hash: records[0].PrevHash}, records[4].Pruned)
+	})
+
+	t.Run("records timed out of order around the retention", func(t *testing.T) {
+		for name, newSink := range map[string]func(path string) (Sink, error){
+			"file":   func(path string) (Sink, error) { return NewFileSink(path) },
+			"sqlite": func(path string) (Sink, error) { return NewSQLiteSink(path) },
+		} {
+			t.Run(name, func(t *testing.T) {
+				sink, err := newSink(filepath.Join(t.TempDir(), "audit"))
+				assert.NoError(t, err)
+				defer sink.Close()
+
+				ctx := context.Background()
+				chain := newChain(t, sink)
+
+				// Requests timed before they are written, and a clock going back
+				clock := []time.Duration{0, 3 * time.Minute, 2 * time.Minute, 5 * time.Minute, 6 * time.Minute, 7 * time.Minute}
+				chain.now = func() time.Time {
+					next := now.Add(clock[0])
+					clock = clock[1:]
+					return next
+				}
+
+				for _, i := range []int{0, 3, 2, 5} {
+					assert.NoError(t, chain.Write(ctx, record(i)))
+				}
+
+				pruned, err := chain.Prune(ctx, now.Add(150*time.Second))
+				assert.NoError(t, err)
+				assert.Equal(t, 1, pruned)
+
+				records, err := sink.Query(ctx, Filter{})
+				assert.NoError(t, err)
+				assert.Len(t, records, 5)
+
+				report := Verify(records, publicKey)
+				assert.True(t, report.Valid(), report.Problems)
+				assert.Equal(t, uint64(2), report.FirstSequence)
+				assert.Equal(t, uint64(1), report.PrunedSequence)
+				assert.Equal(t, records[0].Time, records[1].Time)
+			})
+		}
+	})
+
+	t.Run("nothing to prune", func(t *testing.T) {
+		sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+		assert.NoError(t, err)
+		defer sink.Close()
+
+		ctx := context.Background()
+		chain := newChain(t, sink)
+		assert.NoError(t, chain.Write(ctx, record(0)))
+
+		pruned, err := chain.Prune(ctx, now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, pruned)
+
+		records, err := sink.Query(ctx, Filter{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 1)
+	})
+
+	t.Run("records written before chaining", func(t *testing.T) {
+		records := append([]Record{record(0)}, newChainRecords(t)...)
+
+		report := Verify(records, publicKey)
+		assert.True(t, report.Valid(), report.Problems)
+		assert.Equal(t, 1, report.Unchained)
+	})
+
+	t.Run("checkpoints not verified without a key", func(t *testing.T) {
+		report := Verify(newChainRecords(t), nil)
+		assert.True(t, report.Valid(), report.Problems)
+		assert.Equal(t, uint64(0), report.CheckpointedSequence)
+	})
+
+	cases := []struct {
+		name    string
+		tamper  func([]Record) []Record
+		problem string
+	}{
+		{
+			name: "edited record",
+			tamper: func(records []Record) []Record {
+				records[1].Caller.RunID = "43"
+				return records
+			},
+			problem: "record 2: hash does not match the record",
+		},
+		{
+			name: "edited record with its hash",
+			tamper: func(records []Record) []Record {
+				records[1].Caller.RunID = "43"
+				records[1].Hash, _ = recordHash(records[1])
+				return records
+			},
+			problem: "record 3: previous hash does not match record 2",
+		},
+		{
+			name: "edited chain",
+			tamper: func(records []Record) []Record {
+				records[1].Caller.RunID = "43"
+				rechain(records, 1)
+				return records
+			},
+			problem: "record 4: invalid checkpoint signature",
+		},
+		{
+			name: "removed record",
+			tamper: func(records []Record) []Record {
+				return append(records[:1], records[2:]...)
+			},
+			problem: "records 2 to 2 are missing",
+		},
+		{
+			name: "reordered records",
+			tamper: func(records []Record) []Record {
+				records[4], records[5] = records[5], records[4]
+				return records
+			},
+			problem: "records 5 to 5 are missing",
+		},
+		{
+			name: "unchained record",
+			tamper: func(records []Record) []Record {
+				return append(records, record(6))
+			},
+			problem: "unchained record after record 6",
+		},
+		{
+			name: "checkpoint by another key",
+			tamper: func(records []Record) []Record {
+				_, other, _ := ed25519.GenerateKey(rand.Reader)
+				records[3].Checkpoint.KeyID = KeyID(other.Public().(ed25519.PublicKey))
+				rechain(records, 3)
+				return records
+			},
+			problem: "record 4: checkpoint signed by unknown key",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			report := Verify(test.tamper(newChainRecords(t)), publicKey)
+			assert.False(t, report.Valid())
+			assert.Contains(t, report.Problems[0], test.problem)
+		})
+	}
+
+	prunedCases := []struct {
+		name    string
+		tamper  func([]Record) []Record
+		problem string
+	}{
+		{
+			name: "oldest records removed without the retention",
+			tamper: func(records []Record) []Record {
+				return records[1:4]
+			},
+			problem: "records 1 to 3 are missing, they were not removed by the retention",
+		},
+		{
+			name: "prune record not signed",
+			tamper: func(records []Record) []Record {
+				return records[:5]
+			},
+			problem: "record 7: prune record is not signed by a checkpoint",
+		},
+		{
+			name: "prune record of other records",
+			tamper: func(records []Record) []Record {
+				records[4].Pruned.Hash = records[1].Hash
+				rechain(records, 4)
+				return records
+			},
+			problem: "record 8: invalid checkpoint signature",
+		},
+	}
+
+	for _, test := range prunedCases {
+		t.Run(test.name, func(t *testing.T) {
+			report := Verify(test.tamper(newPrunedRecords(t)), publicKey)
+			assert.False(t, report.Valid())
+			assert.Contains(t, report.Problems[0], test.problem)
+		})
+	}
+
+	t.Run("oldest records removed without the retention and without a key", func(t *testing.T) {
+		report := Verify(newChainRecords(t)[2:], nil)
+		assert.False(t, report.Valid())
+		assert.Contains(t, report.Problems[0], "records 1 to 2 are missing, they were not removed by the retention")
+	})
+}
+
+func TestParseKeys(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	assert.NoError(t, err)
+
+	parsedPrivate, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	assert.NoError(t, err)
+	assert.Equal(t, privateKey, parsedPrivate)
+
+	parsedPublic, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, parsedPublic)
+	assert.Len(t, KeyID(parsedPublic), 16)
+
+	_, err = ParsePrivateKey([]byte("not a key"))
+	assert.ErrorContains(t, err, "failed to decode PEM private key")
+
+	_, err = ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("invalid")}))
+	assert.ErrorContains(t, err, "failed to parse public key")
+}
@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Longest line read from the file. Records do not include bodies.
+const fileSinkMaxLineSize = 1 << 20
+
+type fileSink struct {
+	m    sync.Mutex
+	path string
+	file *os.File
+}
+
+var _ Sink = (*fileSink)(nil)
+
+// NewFileSink creates a sink appending the records to a file, one JSON
+// record per line. The file is created when it does not exist.
+func NewFileSink(path string) (*fileSink, error) {
+	file, err := openFileSink(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSink{path: path, file: file}, nil
+}
+
+func openFileSink(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return file, nil
+}
+
+func (s *fileSink) Write(_ context.Context, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+
+	return nil
+}
+
+func (s *fileSink) Query(_ context.Context, filter Filter) ([]Record, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var records []Record
+	err := s.scan(func(record Record) error {
+		if !filter.Matches(record) {
+			return nil
+		}
+
+		records = append(records, record)
+		if filter.Limit > 0 && len(records) > filter.Limit {
+			records = records[1:]
+		}
+
+		return nil
+	})
+
+	return records, err
+}
+
+func (s *fileSink) Prune(_ context.Context, before time.Time) (int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Records are kept in a new file which replaces the log
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create audit log: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writer := bufio.NewWriter(tmp)
+	pruned := 0
+
+	err = s.scan(func(record Record) error {
+		if record.Time.Before(before) {
+			pruned++
+			return nil
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit record: %w", err)
+		}
+
+		_, err = writer.Write(append(data, '\n'))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if pruned == 0 {
+		return 0, nil
+	}
+
+	if err := writer.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	if err := tmp.Chmod(0o600); err != nil {
+		return 0, fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return 0, fmt.Errorf("failed to replace audit log: %w", err)
+	}
+
+	file, err := openFileSink(s.path)
+	if err != nil {
+		return 0, err
+	}
+
+	s.file.Close()
+	s.file = file
+
+	return pruned, nil
+}
+
+func (s *fileSink) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.file.Close()
+}
+
+// scan calls the function with each record of the file, oldest first
+func (s *fileSink) scan(fn func(Record) error) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), fileSinkMaxLineSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("failed to parse audit record at line %d: %w", line, err)
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/safedep/dry/log"
+)
+
+// RunRetention removes the records older than the retention period from the
+// sink at every interval until the context is done
+func RunRetention(ctx context.Context, sink Sink, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		prune(ctx, sink, retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func prune(ctx context.Context, sink Sink, retention time.Duration) {
+	pruned, err := sink.Prune(ctx, time.Now().Add(-retention))
+	if err != nil {
+		log.Errorf("failed to prune audit records: %s", err)
+		return
+	}
+
+	if pruned > 0 {
+		log.Infof("Pruned %d audit records older than %s", pruned, retention)
+	}
+}
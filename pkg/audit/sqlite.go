@@ -0,0 +1,176 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// Registers the pure Go SQLite driver, the server is built without cgo
+	_ "modernc.org/sqlite"
+)
+
+// The columns queried are stored along with the record
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS audit_records (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time INTEGER NOT NULL,
+	owner TEXT NOT NULL COLLATE NOCASE,
+	repo TEXT NOT NULL COLLATE NOCASE,
+	pr_number TEXT NOT NULL,
+	actor TEXT NOT NULL COLLATE NOCASE,
+	run_id TEXT NOT NULL,
+	decision TEXT NOT NULL,
+	record TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_records_time ON audit_records (time);
+CREATE INDEX IF NOT EXISTS audit_records_target ON audit_records (owner, repo, pr_number);
+`
+
+type sqliteSink struct {
+	db *sql.DB
+}
+
+var _ Sink = (*sqliteSink)(nil)
+
+// NewSQLiteSink creates a sink storing the records in a SQLite database.
+// The database is created when it does not exist.
+func NewSQLiteSink(path string) (*sqliteSink, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit database: %w", err)
+	}
+
+	// SQLite allows a single writer, records are appended in order
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create audit database: %w", err)
+	}
+
+	return &sqliteSink{db: db}, nil
+}
+
+func (s *sqliteSink) Write(ctx context.Context, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO audit_records
+		(time, owner, repo, pr_number, actor, run_id, decision, record) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.Time.UnixNano(), record.Owner, record.Repo, record.PrNumber, record.Caller.Actor,
+		record.Caller.RunID, string(record.Decision), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqliteSink) Query(ctx context.Context, filter Filter) ([]Record, error) {
+	var conditions []string
+	var args []any
+
+	where := func(condition string, arg any) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+
+	if filter.Owner != "" {
+		where("owner = ?", filter.Owner)
+	}
+
+	if filter.Repo != "" {
+		where("repo = ?", filter.Repo)
+	}
+
+	if filter.PrNumber != "" {
+		where("pr_number = ?", filter.PrNumber)
+	}
+
+	if filter.Actor != "" {
+		where("actor = ?", filter.Actor)
+	}
+
+	if filter.RunID != "" {
+		where("run_id = ?", filter.RunID)
+	}
+
+	if filter.Decision != "" {
+		where("decision = ?", string(filter.Decision))
+	}
+
+	if !filter.Since.IsZero() {
+		where("time >= ?", filter.Since.UnixNano())
+	}
+
+	if !filter.Until.IsZero() {
+		where("time < ?", filter.Until.UnixNano())
+	}
+
+	query := "SELECT record FROM audit_records"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit records: %w", err)
+	}
+
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read audit record: %w", err)
+		}
+
+		var record Record
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse audit record: %w", err)
+		}
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query audit records: %w", err)
+	}
+
+	// Most recent records were selected first
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	return records, nil
+}
+
+func (s *sqliteSink) Prune(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM audit_records WHERE time < ?", before.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune audit records: %w", err)
+	}
+
+	pruned, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune audit records: %w", err)
+	}
+
+	return int(pruned), nil
+}
+
+func (s *sqliteSink) Close() error {
+	return s.db.Close()
+}
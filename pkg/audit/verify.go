@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Report is the result of verifying the records of a sink
+type Report struct {
+	// Records and checkpoints in the chain
+	Records     int
+	Checkpoints int
+
+	// First and last sequence of the chain. The first sequence is greater
+	// than one when the oldest records were removed by the retention.
+	FirstSequence uint64
+	LastSequence  uint64
+
+	// Sequence of the last record removed by the retention, zero when none was removed
+	PrunedSequence uint64
+
+	// Sequence and time of the last valid checkpoint. Records after it can be
+	// changed, or removed from the end of the log, without being detected.
+	CheckpointedSequence uint64
+	CheckpointedTime     time.Time
+
+	// Records and checkpoints after the last valid checkpoint, zero without a key
+	Unsigned int
+
+	// Records written before the records were chained
+	Unchained int
+
+	// Gaps, edits and invalid checkpoints found in the chain
+	Problems []string
+}
+
+// Valid returns true when no problem was found
+func (r Report) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify verifies that the records, oldest first, form a chain without gaps or
+// edits. The oldest record must be the first of the chain or follow the records
+// removed by the retention. The checkpoints are verified with the key, they are
+// not verified when the key is nil.
+func Verify(records []Record, key ed25519.PublicKey) Report {
+	var report Report
+	var first, prev *Record
+
+	// Prune records by the sequence of the last record they mark as removed
+	pruned := make(map[uint64]*Record)
+
+	problem := func(format string, args ...any) {
+		report.Problems = append(report.Problems, fmt.Sprintf(format, args...))
+	}
+
+	for i := range records {
+		record := &records[i]
+
+		if record.Sequence == 0 {
+			if prev != nil {
+				problem("unchained record after record %d", prev.Sequence)
+			} else {
+				report.Unchained++
+			}
+
+			continue
+		}
+
+		if hash, err := recordHash(*record); err != nil || hash != record.Hash {
+			problem("record %d: hash does not match the record", record.Sequence)
+		}
+
+		switch {
+		case prev == nil:
+			first = record
+			report.FirstSequence = record.Sequence
+			if record.Sequence == 1 && record.PrevHash != "" {
+				problem("record 1: first record has a previous hash")
+			}
+		case record.Sequence <= prev.Sequence:
+			problem("record %d: out of order after record %d", record.Sequence, prev.Sequence)
+		case record.Sequence != prev.Sequence+1:
+			problem("records %d to %d are missing", prev.Sequence+1, record.Sequence-1)
+		case record.PrevHash != prev.Hash:
+			problem("record %d: previous hash does not match record %d", record.Sequence, prev.Sequence)
+		}
+
+		report.LastSequence = record.Sequence
+		prev = record
+
+		if record.Pruned != nil {
+			pruned[record.Pruned.Sequence] = record
+		}
+
+		if record.Checkpoint == nil {
+			report.Records++
+		} else {
+			report.Checkpoints++
+		}
+
+		switch {
+		case key == nil:
+		case record.Checkpoint != nil && verifyCheckpoint(*record, key, problem):
+			report.CheckpointedSequence = record.Sequence
+			report.CheckpointedTime = record.Time
+			report.Unsigned = 0
+		default:
+			report.Unsigned++
+		}
+	}
+
+	if first != nil && first.Sequence > 1 {
+		verifyPruned(first, pruned[first.Sequence-1], key, &report, problem)
+	}
+
+	return report
+}
+
+// verifyPruned verifies that the records before the first record were removed by
+// the retention, as marked by a prune record signed by a checkpoint
+func verifyPruned(first, marker *Record, key ed25519.PublicKey, report *Report, problem func(string, ...any)) {
+	switch {
+	case marker == nil:
+		problem("records 1 to %d are missing, they were not removed by the retention", first.Sequence-1)
+	case marker.Pruned.Hash != first.PrevHash:
+		problem("record %d: previous hash does not match prune record %d", first.Sequence, marker.Sequence)
+	case key != nil && marker.Sequence > report.CheckpointedSequence:
+		problem("record %d: prune record is not signed by a checkpoint", marker.Sequence)
+	default:
+		report.PrunedSequence = first.Sequence - 1
+	}
+}
+
+func verifyCheckpoint(record Record, key ed25519.PublicKey, problem func(string, ...any)) bool {
+	if record.Checkpoint.KeyID != KeyID(key) {
+		problem("record %d: checkpoint signed by unknown key %s", record.Sequence, record.Checkpoint.KeyID)
+		return false
+	}
+
+	signature, err := hex.DecodeString(record.Checkpoint.Signature)
+	if err != nil || !ed25519.Verify(key, checkpointMessage(record.Sequence, record.PrevHash), signature) {
+		problem("record %d: invalid checkpoint signature", record.Sequence)
+		return false
+	}
+
+	return true
+}
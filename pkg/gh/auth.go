@@ -3,6 +3,7 @@ package gh
 import (
 	"context"
 	"errors"
+	"strings"
 )
 
 type githubTokenContextKey struct{}
@@ -18,34 +19,44 @@ const (
 // GitHubTokenContext holds information extracted from the GitHub Workload Identity Token
 // https://docs.github.com/en/actions/security-for-github-actions/security-hardening-your-deployments/about-security-hardening-with-openid-connect
 type GitHubTokenContext struct {
-	Subject              string `json:"sub"`
-	Issuer               string `json:"iss"`
-	Environment          string `json:"environment"`
-	Audience             string `json:"aud"`
-	Repository           string `json:"repository"`
-	RepositoryOwner      string `json:"repository_owner"`
-	RepositoryVisibility string `json:"repository_visibility"`
-	RepositoryID         string `json:"repository_id"`
-	RepositoryOwnerID    string `json:"repository_owner_id"`
-	Ref                  string `json:"ref"`
-	RunID                string `json:"run_id"`
-	RunNumber            string `json:"run_number"`
-	RunAttempt           string `json:"run_attempt"`
-	RunnerEnvironment    string `json:"runner_environment"`
-	Actor                string `json:"actor"`
-	Workflow             string `json:"workflow"`
-	WorkflowRef          string `json:"workflow_ref"`
-	WorkflowSHA          string `json:"workflow_sha"`
-	HeadRef              string `json:"head_ref"`
-	BaseRef              string `json:"base_ref"`
-	RefType              string `json:"ref_type"`
-	EventName            string `json:"event_name"`
-	JobWorkflowRef       string `json:"job_workflow_ref"`
+	Subject              string   `json:"sub"`
+	Issuer               string   `json:"iss"`
+	Environment          string   `json:"environment"`
+	Audience             []string `json:"aud"`
+	Repository           string   `json:"repository"`
+	RepositoryOwner      string   `json:"repository_owner"`
+	RepositoryVisibility string   `json:"repository_visibility"`
+	RepositoryID         string   `json:"repository_id"`
+	RepositoryOwnerID    string   `json:"repository_owner_id"`
+	Ref                  string   `json:"ref"`
+	RunID                string   `json:"run_id"`
+	RunNumber            string   `json:"run_number"`
+	RunAttempt           string   `json:"run_attempt"`
+	RunnerEnvironment    string   `json:"runner_environment"`
+	Actor                string   `json:"actor"`
+	Workflow             string   `json:"workflow"`
+	WorkflowRef          string   `json:"workflow_ref"`
+	WorkflowSHA          string   `json:"workflow_sha"`
+	HeadRef              string   `json:"head_ref"`
+	BaseRef              string   `json:"base_ref"`
+	RefType              string   `json:"ref_type"`
+	EventName            string   `json:"event_name"`
+	JobWorkflowRef       string   `json:"job_workflow_ref"`
+
+	// Repositories accessible to the token. This is populated for GITHUB_TOKEN
+	// by introspecting the installation the token was issued for.
+	Repositories []GitHubTokenRepository `json:"repositories,omitempty"`
 
 	// TokenType is the type of token
 	TokenType TokenType
 }
 
+// GitHubTokenRepository identifies a repository accessible to a token
+type GitHubTokenRepository struct {
+	ID       string `json:"id"`
+	FullName string `json:"full_name"`
+}
+
 // Inject GitHub token context into the context
 func InjectGitHubTokenContext(ctx context.Context, tokenContext GitHubTokenContext) context.Context {
 	return context.WithValue(ctx, githubTokenContextKey{}, tokenContext)
@@ -76,3 +87,15 @@ func (t GitHubTokenContext) IsUserToken() bool {
 func (t GitHubTokenContext) IsWorkloadIdentityToken() bool {
 	return t.TokenType == TokenTypeWorkloadIdentity
 }
+
+// FindRepository returns the repository accessible to the token
+// matching the full name (owner/repo). Names are compared case-insensitively.
+func (t GitHubTokenContext) FindRepository(fullName string) (GitHubTokenRepository, bool) {
+	for _, repository := range t.Repositories {
+		if strings.EqualFold(repository.FullName, fullName) {
+			return repository, true
+		}
+	}
+
+	return GitHubTokenRepository{}, false
+}
@@ -0,0 +1,224 @@
+package gh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt"
+	"github.com/safedep/dry/log"
+)
+
+const (
+	// Issuer of GitHub Workload Identity Tokens on github.com
+	GitHubIssuerURL = "https://token.actions.githubusercontent.com"
+)
+
+// JWKSSource is the source of the keys used to verify tokens of an issuer
+type JWKSSource string
+
+const (
+	// Keys are fetched from the jwks_uri of the OIDC discovery document
+	JWKSSourceDiscovery JWKSSource = "discovery"
+
+	// Keys are fetched from a static JWKS URL
+	JWKSSourceURL JWKSSource = "url"
+
+	// Keys are read from a local JWKS file
+	JWKSSourceFile JWKSSource = "file"
+)
+
+// IssuerConfig is the configuration of a trusted issuer of
+// GitHub Workload Identity Tokens
+type IssuerConfig struct {
+	// Issuer URL, must be an exact match of the iss claim in the token
+	Issuer string
+
+	// Source of the keys used to verify tokens. Defaults to discovery.
+	JWKSSource JWKSSource
+
+	// JWKS URL when the source is url
+	JWKSURL string
+
+	// Path to the JWKS file when the source is file
+	JWKSFile string
+}
+
+// GitHubIssuer returns the issuer for github.com
+func GitHubIssuer() IssuerConfig {
+	return IssuerConfig{
+		Issuer:     GitHubIssuerURL,
+		JWKSSource: JWKSSourceDiscovery,
+	}
+}
+
+// GitHubEnterpriseServerIssuer returns the issuer for a GitHub Enterprise Server instance
+// https://docs.github.com/en/enterprise-server@latest/actions/security-for-github-actions/security-hardening-your-deployments/about-security-hardening-with-openid-connect
+func GitHubEnterpriseServerIssuer(hostname string) IssuerConfig {
+	return IssuerConfig{
+		Issuer:     fmt.Sprintf("https://%s/_services/token", hostname),
+		JWKSSource: JWKSSourceDiscovery,
+	}
+}
+
+// GitHubEnterpriseCloudIssuer returns the issuer for a GHE.com (data residency) enterprise
+// https://docs.github.com/en/enterprise-cloud@latest/admin/data-residency/network-details-for-ghecom
+func GitHubEnterpriseCloudIssuer(subdomain string) IssuerConfig {
+	return IssuerConfig{
+		Issuer:     fmt.Sprintf("https://token.actions.%s.ghe.com", subdomain),
+		JWKSSource: JWKSSourceDiscovery,
+	}
+}
+
+type issuer struct {
+	config IssuerConfig
+
+	m        sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+// IssuerRegistry verifies tokens using the trusted issuer matching the
+// iss claim of the token
+type IssuerRegistry struct {
+	issuers map[string]*issuer
+}
+
+// NewIssuerRegistry creates a registry of trusted issuers. No network calls are made
+// while creating the registry. Issuers using discovery are resolved on first use.
+func NewIssuerRegistry(configs []IssuerConfig) (*IssuerRegistry, error) {
+	registry := &IssuerRegistry{issuers: make(map[string]*issuer)}
+
+	for _, config := range configs {
+		if config.Issuer == "" {
+			return nil, errors.New("issuer is required")
+		}
+
+		if _, ok := registry.issuers[config.Issuer]; ok {
+			return nil, fmt.Errorf("duplicate issuer: %s", config.Issuer)
+		}
+
+		if config.JWKSSource == "" {
+			config.JWKSSource = JWKSSourceDiscovery
+		}
+
+		iss := &issuer{config: config}
+
+		switch config.JWKSSource {
+		case JWKSSourceDiscovery:
+			// Resolved on first use
+		case JWKSSourceURL:
+			if config.JWKSURL == "" {
+				return nil, fmt.Errorf("jwks url is required for issuer: %s", config.Issuer)
+			}
+
+			iss.verifier = newVerifier(config.Issuer, oidc.NewRemoteKeySet(context.Background(), config.JWKSURL))
+		case JWKSSourceFile:
+			keySet, err := loadJWKSFile(config.JWKSFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load jwks for issuer: %s: %w", config.Issuer, err)
+			}
+
+			iss.verifier = newVerifier(config.Issuer, keySet)
+		default:
+			return nil, fmt.Errorf("unknown jwks source for issuer: %s: %s", config.Issuer, config.JWKSSource)
+		}
+
+		registry.issuers[config.Issuer] = iss
+	}
+
+	return registry, nil
+}
+
+// Verify verifies the raw token using the issuer of the token. The audience
+// is not verified, it is left to the caller.
+func (r *IssuerRegistry) Verify(ctx context.Context, rawToken string) (*oidc.IDToken, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := (&jwt.Parser{}).ParseUnverified(rawToken, claims); err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	iss, ok := claims["iss"].(string)
+	if !ok || iss == "" {
+		return nil, errors.New("token does not have an issuer")
+	}
+
+	issuer, ok := r.issuers[iss]
+	if !ok {
+		return nil, fmt.Errorf("untrusted issuer: %s", iss)
+	}
+
+	verifier, err := issuer.getVerifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifier.Verify(ctx, rawToken)
+}
+
+func (i *issuer) getVerifier(ctx context.Context) (*oidc.IDTokenVerifier, error) {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if i.verifier != nil {
+		return i.verifier, nil
+	}
+
+	log.Debugf("Discovering OIDC provider for issuer: %s", i.config.Issuer)
+
+	// The provider must outlive the request context since
+	// it is used to refresh the keys
+	provider, err := oidc.NewProvider(context.WithoutCancel(ctx), i.config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider for issuer: %s: %w", i.config.Issuer, err)
+	}
+
+	i.verifier = provider.Verifier(verifierConfig())
+	return i.verifier, nil
+}
+
+func newVerifier(issuer string, keySet oidc.KeySet) *oidc.IDTokenVerifier {
+	return oidc.NewVerifier(issuer, keySet, verifierConfig())
+}
+
+func verifierConfig() *oidc.Config {
+	// The client ID check supports only a single audience, we
+	// expect the audience to be verified by the caller
+	return &oidc.Config{SkipClientIDCheck: true}
+}
+
+func loadJWKSFile(path string) (oidc.KeySet, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("jwks file is required")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks file: %w", err)
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks file: %w", err)
+	}
+
+	keySet := &oidc.StaticKeySet{}
+	for _, key := range jwks.Keys {
+		if !key.IsPublic() {
+			return nil, fmt.Errorf("jwks file contains a non public key: %s", key.KeyID)
+		}
+
+		keySet.PublicKeys = append(keySet.PublicKeys, key.Key)
+	}
+
+	if len(keySet.PublicKeys) == 0 {
+		return nil, errors.New("jwks file does not contain any key")
+	}
+
+	return keySet, nil
+}
@@ -0,0 +1,148 @@
+package gh
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testIssuerURL = "https://token.actions.example.com"
+
+func newTestIssuerKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	jwks, err := json.Marshal(jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+		},
+	})
+	assert.NoError(t, err)
+
+	return key, jwks
+}
+
+func mintTestToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       jose.JSONWebKey{Key: key, KeyID: "test"},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+	assert.NoError(t, err)
+
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+
+	jws, err := signer.Sign(payload)
+	assert.NoError(t, err)
+
+	token, err := jws.CompactSerialize()
+	assert.NoError(t, err)
+
+	return token
+}
+
+func testClaims(issuer string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":        issuer,
+		"aud":        "safedep-ghcp",
+		"sub":        "repo:safedep/ghcp:pull_request",
+		"repository": "safedep/ghcp",
+		"iat":        time.Now().Unix(),
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestIssuerConfigs(t *testing.T) {
+	assert.Equal(t, "https://token.actions.githubusercontent.com", GitHubIssuer().Issuer)
+	assert.Equal(t, "https://github.example.com/_services/token", GitHubEnterpriseServerIssuer("github.example.com").Issuer)
+	assert.Equal(t, "https://token.actions.octocorp.ghe.com", GitHubEnterpriseCloudIssuer("octocorp").Issuer)
+}
+
+func TestIssuerRegistryWithJWKSFile(t *testing.T) {
+	key, jwks := newTestIssuerKey(t)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(jwksFile, jwks, 0o600))
+
+	registry, err := NewIssuerRegistry([]IssuerConfig{
+		GitHubIssuer(),
+		{Issuer: testIssuerURL, JWKSSource: JWKSSourceFile, JWKSFile: jwksFile},
+	})
+	assert.NoError(t, err)
+
+	t.Run("should verify token from trusted issuer", func(t *testing.T) {
+		idToken, err := registry.Verify(context.Background(), mintTestToken(t, key, testClaims(testIssuerURL)))
+		assert.NoError(t, err)
+		assert.Equal(t, testIssuerURL, idToken.Issuer)
+		assert.Equal(t, []string{"safedep-ghcp"}, idToken.Audience)
+	})
+
+	t.Run("should reject token from untrusted issuer", func(t *testing.T) {
+		_, err := registry.Verify(context.Background(), mintTestToken(t, key, testClaims("https://untrusted.example.com")))
+		assert.ErrorContains(t, err, "untrusted issuer")
+	})
+
+	t.Run("should reject token signed by another key", func(t *testing.T) {
+		otherKey, _ := newTestIssuerKey(t)
+
+		_, err := registry.Verify(context.Background(), mintTestToken(t, otherKey, testClaims(testIssuerURL)))
+		assert.Error(t, err)
+	})
+
+	t.Run("should reject expired token", func(t *testing.T) {
+		claims := testClaims(testIssuerURL)
+		claims["exp"] = time.Now().Add(-time.Hour).Unix()
+
+		_, err := registry.Verify(context.Background(), mintTestToken(t, key, claims))
+		assert.Error(t, err)
+	})
+}
+
+func TestIssuerRegistryWithJWKSURL(t *testing.T) {
+	key, jwks := newTestIssuerKey(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	registry, err := NewIssuerRegistry([]IssuerConfig{
+		{Issuer: testIssuerURL, JWKSSource: JWKSSourceURL, JWKSURL: server.URL},
+	})
+	assert.NoError(t, err)
+
+	_, err = registry.Verify(context.Background(), mintTestToken(t, key, testClaims(testIssuerURL)))
+	assert.NoError(t, err)
+}
+
+func TestNewIssuerRegistryErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		configs []IssuerConfig
+		err     string
+	}{
+		{"missing issuer", []IssuerConfig{{}}, "issuer is required"},
+		{"duplicate issuer", []IssuerConfig{GitHubIssuer(), GitHubIssuer()}, "duplicate issuer"},
+		{"missing jwks url", []IssuerConfig{{Issuer: testIssuerURL, JWKSSource: JWKSSourceURL}}, "jwks url is required"},
+		{"missing jwks file", []IssuerConfig{{Issuer: testIssuerURL, JWKSSource: JWKSSourceFile, JWKSFile: "/does/not/exist"}}, "failed to load jwks"},
+		{"unknown jwks source", []IssuerConfig{{Issuer: testIssuerURL, JWKSSource: "unknown"}}, "unknown jwks source"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewIssuerRegistry(c.configs)
+			assert.ErrorContains(t, err, c.err)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Package idempotency remembers the responses of requests by the idempotency
+// key sent by the client so that a retried request is not executed again
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const keyPrefix = "ghcp:idempotency"
+
+// Record is what is remembered for a key. A record is pending while the request
+// is executed and holds the response once it is completed.
+type Record struct {
+	// Fingerprint of the request, to detect a key reused for another request
+	Fingerprint string          `json:"fingerprint"`
+	Completed   bool            `json:"completed"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+// Store holds the records. Stores must be safe for use by concurrent requests
+// across the replicas sharing them.
+type Store interface {
+	// Reserve stores the record for the key when the key does not exist and returns
+	// true. Otherwise the existing record is returned along with false.
+	Reserve(ctx context.Context, key string, record Record, ttl time.Duration) (Record, bool, error)
+
+	// Complete replaces the record of the key
+	Complete(ctx context.Context, key string, record Record, ttl time.Duration) error
+
+	// Release removes the key so that the request can be retried
+	Release(ctx context.Context, key string) error
+
+	// Extend extends the expiry of the key to at least ttl from now, to keep the key
+	// of a request that is still executing. Expiries are never shortened and keys
+	// that do not exist are not created.
+	Extend(ctx context.Context, key string, ttl time.Duration) error
+}
@@ -0,0 +1,118 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) (Store, func(time.Duration)){
+		"memory": func(t *testing.T) (Store, func(time.Duration)) {
+			now := time.Unix(1700000000, 0)
+			store := newMemoryStore(func() time.Time { return now })
+
+			return store, func(d time.Duration) { now = now.Add(d) }
+		},
+		"redis": func(t *testing.T) (Store, func(time.Duration)) {
+			server := miniredis.RunT(t)
+			store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+			return store, server.FastForward
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store, advance := newStore(t)
+			ctx := context.Background()
+
+			pending := Record{Fingerprint: "a"}
+			record, reserved, err := store.Reserve(ctx, "key", pending, time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, reserved)
+			assert.Equal(t, pending, record)
+
+			record, reserved, err = store.Reserve(ctx, "key", Record{Fingerprint: "b"}, time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, reserved)
+			assert.Equal(t, pending, record)
+
+			// Pending keys are kept while the request executes
+			advance(50 * time.Second)
+			assert.NoError(t, store.Extend(ctx, "key", time.Minute))
+			advance(50 * time.Second)
+
+			_, reserved, err = store.Reserve(ctx, "key", pending, time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, reserved)
+
+			completed := Record{Fingerprint: "a", Completed: true, Response: json.RawMessage(`{"commentId":"1"}`)}
+			assert.NoError(t, store.Complete(ctx, "key", completed, time.Hour))
+
+			record, reserved, err = store.Reserve(ctx, "key", pending, time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, reserved)
+			assert.Equal(t, completed, record)
+
+			// Expiries are not shortened
+			assert.NoError(t, store.Extend(ctx, "key", time.Minute))
+			advance(30 * time.Minute)
+
+			record, _, err = store.Reserve(ctx, "key", pending, time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, completed, record)
+
+			// Records expire
+			advance(2 * time.Hour)
+			_, reserved, err = store.Reserve(ctx, "key", pending, time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, reserved)
+
+			// Released keys can be reserved again
+			assert.NoError(t, store.Release(ctx, "key"))
+			_, reserved, err = store.Reserve(ctx, "key", pending, time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, reserved)
+
+			// Keys that do not exist are not created
+			assert.NoError(t, store.Extend(ctx, "other", time.Minute))
+			_, reserved, err = store.Reserve(ctx, "other", pending, time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, reserved)
+		})
+	}
+}
+
+func TestMemoryStoreConcurrentReserve(t *testing.T) {
+	store := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	reservations := 0
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, reserved, err := store.Reserve(context.Background(), "key", Record{}, time.Minute)
+			assert.NoError(t, err)
+
+			if reserved {
+				m.Lock()
+				reservations++
+				m.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1, reservations)
+}
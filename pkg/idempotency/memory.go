@@ -0,0 +1,95 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Records are pruned when the store grows beyond this size
+const memoryStorePruneSize = 10000
+
+type memoryRecord struct {
+	record  Record
+	expires time.Time
+}
+
+type memoryStore struct {
+	m       sync.Mutex
+	now     func() time.Time
+	records map[string]memoryRecord
+}
+
+var _ Store = (*memoryStore)(nil)
+
+// NewMemoryStore creates a store holding the records in memory. The
+// records are not shared with other replicas of the service.
+func NewMemoryStore() *memoryStore {
+	return newMemoryStore(time.Now)
+}
+
+func newMemoryStore(now func() time.Time) *memoryStore {
+	return &memoryStore{
+		now:     now,
+		records: make(map[string]memoryRecord),
+	}
+}
+
+func (s *memoryStore) Reserve(_ context.Context, key string, record Record, ttl time.Duration) (Record, bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := s.now()
+	if len(s.records) >= memoryStorePruneSize {
+		s.prune(now)
+	}
+
+	if existing, ok := s.records[key]; ok && now.Before(existing.expires) {
+		return existing.record, false, nil
+	}
+
+	s.records[key] = memoryRecord{record: record, expires: now.Add(ttl)}
+	return record, true, nil
+}
+
+func (s *memoryStore) Complete(_ context.Context, key string, record Record, ttl time.Duration) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.records[key] = memoryRecord{record: record, expires: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryStore) Release(_ context.Context, key string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+func (s *memoryStore) Extend(_ context.Context, key string, ttl time.Duration) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := s.now()
+	existing, ok := s.records[key]
+	if !ok || !now.Before(existing.expires) {
+		return nil
+	}
+
+	if expires := now.Add(ttl); expires.After(existing.expires) {
+		existing.expires = expires
+		s.records[key] = existing
+	}
+
+	return nil
+}
+
+func (s *memoryStore) prune(now time.Time) {
+	for key, r := range s.records {
+		if !now.Before(r.expires) {
+			delete(s.records, key)
+		}
+	}
+}
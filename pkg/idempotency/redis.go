@@ -0,0 +1,107 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// extendScript extends the expiry of the key when it expires earlier
+//
+// KEYS[1] - record
+// ARGV[1] - expiry in milliseconds
+var extendScript = redis.NewScript(`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl >= 0 and ttl < tonumber(ARGV[1]) then
+  redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+
+return 0
+`)
+
+type redisStore struct {
+	client redis.UniversalClient
+}
+
+var _ Store = (*redisStore)(nil)
+
+// NewRedisStore creates a store holding the records in Redis, or a server
+// compatible with its protocol, to share them between replicas
+func NewRedisStore(client redis.UniversalClient) *redisStore {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) Reserve(ctx context.Context, key string, record Record, ttl time.Duration) (Record, bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	// The key can expire between the two commands, the
+	// reservation is then attempted again
+	for i := 0; i < 2; i++ {
+		reserved, err := s.client.SetNX(ctx, s.key(key), data, ttl).Result()
+		if err != nil {
+			return Record{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+
+		if reserved {
+			return record, true, nil
+		}
+
+		existing, err := s.client.Get(ctx, s.key(key)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+
+		if err != nil {
+			return Record{}, false, fmt.Errorf("failed to get idempotency record: %w", err)
+		}
+
+		var r Record
+		if err := json.Unmarshal(existing, &r); err != nil {
+			return Record{}, false, fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+		}
+
+		return r, false, nil
+	}
+
+	return Record{}, false, fmt.Errorf("failed to reserve idempotency key: key expired while reserving")
+}
+
+func (s *redisStore) Complete(ctx context.Context, key string, record Record, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	if err := s.client.Set(ctx, s.key(key), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store idempotency record: %w", err)
+	}
+
+	return nil
+}
+
+func (s *redisStore) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, s.key(key)).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *redisStore) Extend(ctx context.Context, key string, ttl time.Duration) error {
+	if err := extendScript.Run(ctx, s.client, []string{s.key(key)}, ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to extend idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *redisStore) key(key string) string {
+	return keyPrefix + ":" + key
+}
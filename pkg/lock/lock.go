@@ -0,0 +1,35 @@
+// Package lock provides exclusive locks by key to serialize
+// requests acting on the same resource
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const keyPrefix = "ghcp:lock"
+
+// ErrLockLost is returned when extending a lock that is no longer held by the lease
+var ErrLockLost = errors.New("lock is no longer held")
+
+// Locker acquires locks. Lockers must be safe for use by concurrent requests
+// across the replicas sharing them.
+type Locker interface {
+	// Lock blocks until the lock of the key is acquired or the context is done. A lock
+	// shared between replicas is released when the TTL expires, in case its holder fails.
+	Lock(ctx context.Context, key string, ttl time.Duration) (Lease, error)
+}
+
+// Lease is an acquired lock
+type Lease interface {
+	// Contended is true when the lock was held by another request when requested
+	Contended() bool
+
+	// Extend renews the TTL of the lock for a holder that is still working. It fails
+	// with ErrLockLost when the lock expired and may have been acquired by another request.
+	Extend(ctx context.Context, ttl time.Duration) error
+
+	// Unlock releases the lock. Unlocking more than once has no effect.
+	Unlock(ctx context.Context) error
+}
@@ -0,0 +1,161 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLockers() map[string]func(t *testing.T) Locker {
+	return map[string]func(t *testing.T) Locker{
+		"memory": func(t *testing.T) Locker {
+			return NewMemoryLocker()
+		},
+		"redis": func(t *testing.T) Locker {
+			server := miniredis.RunT(t)
+			return NewRedisLocker(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+		},
+	}
+}
+
+func TestLockers(t *testing.T) {
+	for name, newLocker := range testLockers() {
+		t.Run(name, func(t *testing.T) {
+			locker := newLocker(t)
+			ctx := context.Background()
+
+			lease, err := locker.Lock(ctx, "key", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, lease.Contended())
+
+			// Other keys are not locked
+			other, err := locker.Lock(ctx, "other", time.Minute)
+			assert.NoError(t, err)
+			assert.NoError(t, other.Unlock(ctx))
+
+			// Waiting is bounded by the context
+			timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+
+			_, err = locker.Lock(timeoutCtx, "key", time.Minute)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+			// A waiting request acquires the lock once released
+			acquired := make(chan Lease)
+			go func() {
+				lease, err := locker.Lock(ctx, "key", time.Minute)
+				assert.NoError(t, err)
+				acquired <- lease
+			}()
+
+			time.Sleep(20 * time.Millisecond)
+			assert.NoError(t, lease.Unlock(ctx))
+
+			waited := <-acquired
+			assert.True(t, waited.Contended())
+
+			// Unlocking again has no effect
+			assert.NoError(t, lease.Unlock(ctx))
+
+			timeoutCtx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+
+			_, err = locker.Lock(timeoutCtx, "key", time.Minute)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+			assert.NoError(t, waited.Unlock(ctx))
+		})
+	}
+}
+
+func TestLockersSerialize(t *testing.T) {
+	for name, newLocker := range testLockers() {
+		t.Run(name, func(t *testing.T) {
+			locker := newLocker(t)
+			ctx := context.Background()
+
+			var holders, maxHolders atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					lease, err := locker.Lock(ctx, "key", time.Minute)
+					if !assert.NoError(t, err) {
+						return
+					}
+
+					n := holders.Add(1)
+					for {
+						m := maxHolders.Load()
+						if n <= m || maxHolders.CompareAndSwap(m, n) {
+							break
+						}
+					}
+
+					time.Sleep(time.Millisecond)
+					holders.Add(-1)
+					assert.NoError(t, lease.Unlock(ctx))
+				}()
+			}
+
+			wg.Wait()
+			assert.Equal(t, int32(1), maxHolders.Load())
+		})
+	}
+}
+
+func TestMemoryLockerRemovesUnusedLocks(t *testing.T) {
+	locker := NewMemoryLocker()
+	ctx := context.Background()
+
+	lease, err := locker.Lock(ctx, "key", time.Minute)
+	assert.NoError(t, err)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	_, err = locker.Lock(timeoutCtx, "key", time.Minute)
+	assert.Error(t, err)
+
+	assert.NoError(t, lease.Unlock(ctx))
+	assert.Empty(t, locker.locks)
+}
+
+func TestRedisLockerExpiry(t *testing.T) {
+	server := miniredis.RunT(t)
+	locker := NewRedisLocker(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	ctx := context.Background()
+
+	expired, err := locker.Lock(ctx, "key", time.Minute)
+	assert.NoError(t, err)
+
+	// The lock of a holder still working is extended
+	server.FastForward(50 * time.Second)
+	assert.NoError(t, expired.Extend(ctx, time.Minute))
+	server.FastForward(50 * time.Second)
+	assert.True(t, server.Exists(keyPrefix+":key"))
+
+	// The lock of a failed holder expires
+	server.FastForward(2 * time.Minute)
+
+	lease, err := locker.Lock(ctx, "key", time.Minute)
+	assert.NoError(t, err)
+
+	// An expired lease is not extended
+	assert.ErrorIs(t, expired.Extend(ctx, time.Minute), ErrLockLost)
+
+	// Unlocking an expired lease does not release the lock acquired since
+	assert.NoError(t, expired.Unlock(ctx))
+	assert.True(t, server.Exists(keyPrefix+":key"))
+
+	assert.NoError(t, lease.Unlock(ctx))
+	assert.False(t, server.Exists(keyPrefix+":key"))
+}
@@ -0,0 +1,93 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type memoryLock struct {
+	// Holds a value while the lock is held
+	held chan struct{}
+
+	// Number of requests holding or waiting for the lock
+	refs int
+}
+
+type memoryLocker struct {
+	m     sync.Mutex
+	locks map[string]*memoryLock
+}
+
+var _ Locker = (*memoryLocker)(nil)
+
+// NewMemoryLocker creates a locker holding the locks in memory. The locks are
+// not shared with other replicas of the service. The TTL is not used, locks
+// are held until they are unlocked.
+func NewMemoryLocker() *memoryLocker {
+	return &memoryLocker{locks: make(map[string]*memoryLock)}
+}
+
+func (l *memoryLocker) Lock(ctx context.Context, key string, _ time.Duration) (Lease, error) {
+	l.m.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &memoryLock{held: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+
+	lock.refs++
+	l.m.Unlock()
+
+	select {
+	case lock.held <- struct{}{}:
+		return &memoryLease{locker: l, key: key, lock: lock}, nil
+	default:
+	}
+
+	select {
+	case lock.held <- struct{}{}:
+		return &memoryLease{locker: l, key: key, lock: lock, contended: true}, nil
+	case <-ctx.Done():
+		l.release(key, lock)
+		return nil, fmt.Errorf("failed to acquire lock: %w", ctx.Err())
+	}
+}
+
+// release drops a reference to the lock, removing it when unused
+func (l *memoryLocker) release(key string, lock *memoryLock) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+type memoryLease struct {
+	locker    *memoryLocker
+	key       string
+	lock      *memoryLock
+	contended bool
+	once      sync.Once
+}
+
+func (l *memoryLease) Contended() bool {
+	return l.contended
+}
+
+// Extend has no effect, locks in memory do not expire
+func (l *memoryLease) Extend(_ context.Context, _ time.Duration) error {
+	return nil
+}
+
+func (l *memoryLease) Unlock(_ context.Context) error {
+	l.once.Do(func() {
+		<-l.lock.held
+		l.locker.release(l.key, l.lock)
+	})
+
+	return nil
+}
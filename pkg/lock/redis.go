@@ -0,0 +1,132 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Interval between attempts to acquire a held lock, doubled up to the maximum
+	redisRetryInterval    = 10 * time.Millisecond
+	redisMaxRetryInterval = 250 * time.Millisecond
+)
+
+// Deletes the lock only when it is still held by the lease, it may have expired
+// and been acquired by another request
+var redisUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Extends the lock only when it is still held by the lease
+var redisExtendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+type redisLocker struct {
+	client redis.UniversalClient
+}
+
+var _ Locker = (*redisLocker)(nil)
+
+// NewRedisLocker creates a locker holding the locks in Redis, or a server
+// compatible with its protocol, to share them between replicas
+func NewRedisLocker(client redis.UniversalClient) *redisLocker {
+	return &redisLocker{client: client}
+}
+
+func (l *redisLocker) Lock(ctx context.Context, key string, ttl time.Duration) (Lease, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	key = keyPrefix + ":" + key
+	interval := redisRetryInterval
+	contended := false
+
+	for {
+		acquired, err := l.client.SetNX(ctx, key, token, ttl).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("failed to acquire lock: %w", ctx.Err())
+			}
+
+			return nil, fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		if acquired {
+			return &redisLease{client: l.client, key: key, token: token, contended: contended}, nil
+		}
+
+		contended = true
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("failed to acquire lock: %w", ctx.Err())
+		}
+
+		interval = min(2*interval, redisMaxRetryInterval)
+	}
+}
+
+type redisLease struct {
+	client    redis.UniversalClient
+	key       string
+	token     string
+	contended bool
+	once      sync.Once
+}
+
+func (l *redisLease) Contended() bool {
+	return l.contended
+}
+
+func (l *redisLease) Extend(ctx context.Context, ttl time.Duration) error {
+	extended, err := redisExtendScript.Run(ctx, l.client, []string{l.key}, l.token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to extend lock: %w", err)
+	}
+
+	if extended == 0 {
+		return ErrLockLost
+	}
+
+	return nil
+}
+
+func (l *redisLease) Unlock(ctx context.Context) error {
+	var err error
+	l.once.Do(func() {
+		err = redisUnlockScript.Run(ctx, l.client, []string{l.key}, l.token).Err()
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	return nil
+}
+
+func newToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate lock token: %w", err)
+	}
+
+	return hex.EncodeToString(token), nil
+}
@@ -0,0 +1,95 @@
+// Package queue persists the jobs delivered to GitHub asynchronously
+// so that they survive restarts of the server
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// State of a job in the queue
+type State string
+
+const (
+	// The job waits for its first or next attempt
+	StatePending State = "pending"
+
+	// The job is being delivered by a worker
+	StateRunning State = "running"
+
+	// The job was delivered
+	StateDelivered State = "delivered"
+
+	// The job failed and will not be attempted again
+	StateFailed State = "failed"
+)
+
+// ErrNotFound is returned when the job does not exist
+var ErrNotFound = errors.New("job not found")
+
+// Job is a write to deliver to GitHub. The payload and the
+// result are opaque to the queue.
+type Job struct {
+	ID            string
+	Kind          string
+	Payload       []byte
+	State         State
+	Attempts      int
+	LastError     string
+	Result        []byte
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	NextAttemptAt time.Time
+}
+
+// Finished returns true when the job will not be attempted again
+func (j Job) Finished() bool {
+	return j.State == StateDelivered || j.State == StateFailed
+}
+
+// Queue holds the jobs until they are delivered or failed
+type Queue interface {
+	// Enqueue adds a job due immediately
+	Enqueue(ctx context.Context, kind string, payload []byte) (Job, error)
+
+	// Claim returns the job due the earliest and marks it as running for the
+	// lease. A job not finished within its lease is claimed again, so jobs
+	// are delivered at least once. A due job already attempted maxAttempts
+	// times, e.g. because its worker failed, is failed instead of claimed.
+	// Returns false when no job is due.
+	Claim(ctx context.Context, lease time.Duration, maxAttempts int) (Job, bool, error)
+
+	// Complete marks the job as delivered with its result
+	Complete(ctx context.Context, id string, result []byte) error
+
+	// Retry schedules the next attempt of the job
+	Retry(ctx context.Context, id string, at time.Time, lastError string) error
+
+	// Fail marks the job as failed
+	Fail(ctx context.Context, id string, lastError string) error
+
+	// Get returns the job, ErrNotFound when it does not exist
+	Get(ctx context.Context, id string) (Job, error)
+
+	// Depth returns the number of jobs not finished
+	Depth(ctx context.Context) (int, error)
+
+	// Prune removes the jobs finished before the time and
+	// returns the number of jobs removed
+	Prune(ctx context.Context, before time.Time) (int, error)
+
+	Close() error
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
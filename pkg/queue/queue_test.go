@@ -0,0 +1,212 @@
+package queue
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteQueue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	q, err := newSQLiteQueue(filepath.Join(t.TempDir(), "queue.db"), func() time.Time { return now })
+	assert.NoError(t, err)
+	defer q.Close()
+
+	_, ok, err := q.Claim(ctx, time.Minute, 5)
+	assert.NoError(t, err)
+	assert.False(t, ok, "empty queue")
+
+	first, err := q.Enqueue(ctx, "comment", []byte(`{"n":1}`))
+	assert.NoError(t, err)
+	assert.Len(t, first.ID, 32)
+	assert.Equal(t, StatePending, first.State)
+
+	now = now.Add(time.Second)
+	second, err := q.Enqueue(ctx, "comment", []byte(`{"n":2}`))
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	depth, err := q.Depth(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, depth)
+
+	// Jobs are claimed in order
+	job, ok, err := q.Claim(ctx, time.Minute, 5)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, first.ID, job.ID)
+	assert.Equal(t, StateRunning, job.State)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, []byte(`{"n":1}`), job.Payload)
+
+	// The first job is retried after the second
+	assert.NoError(t, q.Retry(ctx, first.ID, now.Add(time.Minute), "bad gateway"))
+
+	job, ok, err = q.Claim(ctx, time.Minute, 5)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, second.ID, job.ID)
+
+	_, ok, err = q.Claim(ctx, time.Minute, 5)
+	assert.NoError(t, err)
+	assert.False(t, ok, "retry not due")
+
+	assert.NoError(t, q.Complete(ctx, second.ID, []byte(`{"commentId":"10"}`)))
+
+	job, err = q.Get(ctx, second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StateDelivered, job.State)
+	assert.True(t, job.Finished())
+	assert.Equal(t, []byte(`{"commentId":"10"}`), job.Result)
+
+	now = now.Add(time.Minute)
+	job, ok, err = q.Claim(ctx, time.Minute, 5)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, first.ID, job.ID)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, "bad gateway", job.LastError)
+
+	// A job not finished within its lease is claimed again
+	now = now.Add(time.Minute)
+	job, ok, err = q.Claim(ctx, time.Minute, 5)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, first.ID, job.ID)
+	assert.Equal(t, 3, job.Attempts)
+
+	assert.NoError(t, q.Fail(ctx, first.ID, "not found"))
+
+	job, err = q.Get(ctx, first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StateFailed, job.State)
+	assert.Equal(t, "not found", job.LastError)
+	assert.Nil(t, job.Result)
+
+	depth, err = q.Depth(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, depth)
+
+	_, err = q.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, q.Complete(ctx, "unknown", nil), ErrNotFound)
+}
+
+func TestSQLiteQueueMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	q, err := newSQLiteQueue(filepath.Join(t.TempDir(), "queue.db"), func() time.Time { return now })
+	assert.NoError(t, err)
+	defer q.Close()
+
+	crashed, err := q.Enqueue(ctx, "comment", []byte("{}"))
+	assert.NoError(t, err)
+
+	// The worker of the job fails on each attempt, leaving the job running
+	for attempt := 1; attempt <= 2; attempt++ {
+		job, ok, err := q.Claim(ctx, time.Minute, 2)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, crashed.ID, job.ID)
+		assert.Equal(t, attempt, job.Attempts)
+
+		now = now.Add(time.Minute)
+	}
+
+	next, err := q.Enqueue(ctx, "comment", []byte("{}"))
+	assert.NoError(t, err)
+
+	// The job is failed once its lease expired on the last attempt
+	job, ok, err := q.Claim(ctx, time.Minute, 2)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, next.ID, job.ID)
+
+	job, err = q.Get(ctx, crashed.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StateFailed, job.State)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, "not finished after 2 attempts", job.LastError)
+
+	// Failed jobs are kept when no other job is due
+	now = now.Add(time.Minute)
+	assert.NoError(t, q.Fail(ctx, next.ID, "not found"))
+
+	stalled, err := q.Enqueue(ctx, "comment", []byte("{}"))
+	assert.NoError(t, err)
+
+	_, ok, err = q.Claim(ctx, time.Minute, 1)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	now = now.Add(time.Minute)
+	_, ok, err = q.Claim(ctx, time.Minute, 1)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	job, err = q.Get(ctx, stalled.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StateFailed, job.State)
+}
+
+func TestSQLiteQueuePrune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	q, err := newSQLiteQueue(filepath.Join(t.TempDir(), "queue.db"), func() time.Time { return now })
+	assert.NoError(t, err)
+	defer q.Close()
+
+	delivered, err := q.Enqueue(ctx, "comment", []byte("{}"))
+	assert.NoError(t, err)
+	assert.NoError(t, q.Complete(ctx, delivered.ID, nil))
+
+	pending, err := q.Enqueue(ctx, "comment", []byte("{}"))
+	assert.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	recent, err := q.Enqueue(ctx, "comment", []byte("{}"))
+	assert.NoError(t, err)
+	assert.NoError(t, q.Fail(ctx, recent.ID, "not found"))
+
+	// Only jobs finished before the time are removed
+	pruned, err := q.Prune(ctx, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+
+	_, err = q.Get(ctx, delivered.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for _, id := range []string{pending.ID, recent.ID} {
+		_, err := q.Get(ctx, id)
+		assert.NoError(t, err)
+	}
+}
+
+func TestSQLiteQueueDurable(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	q, err := NewSQLiteQueue(path)
+	assert.NoError(t, err)
+
+	job, err := q.Enqueue(ctx, "comment", []byte("payload"))
+	assert.NoError(t, err)
+	assert.NoError(t, q.Close())
+
+	q, err = NewSQLiteQueue(path)
+	assert.NoError(t, err)
+	defer q.Close()
+
+	claimed, ok, err := q.Claim(ctx, time.Minute, 5)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, job.ID, claimed.ID)
+	assert.Equal(t, []byte("payload"), claimed.Payload)
+}
@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/safedep/dry/log"
+)
+
+// RunRetention removes the jobs finished before the retention period from
+// the queue at every interval until the context is done
+func RunRetention(ctx context.Context, queue Queue, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		prune(ctx, queue, retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func prune(ctx context.Context, queue Queue, retention time.Duration) {
+	pruned, err := queue.Prune(ctx, time.Now().Add(-retention))
+	if err != nil {
+		log.Errorf("failed to prune delivery jobs: %s", err)
+		return
+	}
+
+	if pruned > 0 {
+		log.Infof("Pruned %d delivery jobs finished more than %s ago", pruned, retention)
+	}
+}
@@ -0,0 +1,242 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	// Registers the pure Go SQLite driver, the server is built without cgo
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS delivery_jobs (
+	id TEXT PRIMARY KEY,
+	kind TEXT NOT NULL,
+	payload BLOB NOT NULL,
+	state TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	result BLOB,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	next_attempt_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS delivery_jobs_due ON delivery_jobs (state, next_attempt_at);
+`
+
+const sqliteJobColumns = `id, kind, payload, state, attempts, last_error,
+	result, created_at, updated_at, next_attempt_at`
+
+type sqliteQueue struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+var _ Queue = (*sqliteQueue)(nil)
+
+// NewSQLiteQueue creates a queue storing the jobs in a SQLite database.
+// The database is created when it does not exist.
+func NewSQLiteQueue(path string) (*sqliteQueue, error) {
+	return newSQLiteQueue(path, time.Now)
+}
+
+func newSQLiteQueue(path string, now func() time.Time) (*sqliteQueue, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue database: %w", err)
+	}
+
+	// SQLite allows a single writer, jobs are claimed by one worker at a time
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create queue database: %w", err)
+	}
+
+	return &sqliteQueue{db: db, now: now}, nil
+}
+
+func (q *sqliteQueue) Enqueue(ctx context.Context, kind string, payload []byte) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	now := q.now()
+	job := Job{
+		ID:            id,
+		Kind:          kind,
+		Payload:       payload,
+		State:         StatePending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		NextAttemptAt: now,
+	}
+
+	_, err = q.db.ExecContext(ctx, `INSERT INTO delivery_jobs
+		(id, kind, payload, state, created_at, updated_at, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Kind, job.Payload, string(job.State), now.UnixNano(), now.UnixNano(), now.UnixNano())
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	return job, nil
+}
+
+func (q *sqliteQueue) Claim(ctx context.Context, lease time.Duration, maxAttempts int) (Job, bool, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Job{}, false, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	// Running jobs are due when their lease expired
+	now := q.now()
+	for {
+		job, err := scanJob(tx.QueryRowContext(ctx, `SELECT `+sqliteJobColumns+` FROM delivery_jobs
+			WHERE state IN (?, ?) AND next_attempt_at <= ? ORDER BY next_attempt_at, created_at LIMIT 1`,
+			string(StatePending), string(StateRunning), now.UnixNano()))
+		if errors.Is(err, ErrNotFound) {
+			break
+		}
+
+		if err != nil {
+			return Job{}, false, err
+		}
+
+		// A job whose worker failed on its last attempt is not attempted again
+		if maxAttempts > 0 && job.Attempts >= maxAttempts {
+			_, err = tx.ExecContext(ctx, `UPDATE delivery_jobs SET state = ?, last_error = ?,
+				updated_at = ? WHERE id = ?`, string(StateFailed),
+				fmt.Sprintf("not finished after %d attempts", job.Attempts), now.UnixNano(), job.ID)
+			if err != nil {
+				return Job{}, false, fmt.Errorf("failed to fail job: %w", err)
+			}
+
+			continue
+		}
+
+		job.State = StateRunning
+		job.Attempts++
+		job.UpdatedAt = now
+		job.NextAttemptAt = now.Add(lease)
+
+		_, err = tx.ExecContext(ctx, `UPDATE delivery_jobs SET state = ?, attempts = ?,
+			updated_at = ?, next_attempt_at = ? WHERE id = ?`,
+			string(job.State), job.Attempts, now.UnixNano(), job.NextAttemptAt.UnixNano(), job.ID)
+		if err != nil {
+			return Job{}, false, fmt.Errorf("failed to claim job: %w", err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return Job{}, false, fmt.Errorf("failed to claim job: %w", err)
+		}
+
+		return job, true, nil
+	}
+
+	// Jobs failed while looking for a due job are kept failed
+	if err := tx.Commit(); err != nil {
+		return Job{}, false, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	return Job{}, false, nil
+}
+
+func (q *sqliteQueue) Complete(ctx context.Context, id string, result []byte) error {
+	now := q.now().UnixNano()
+	return q.update(ctx, `UPDATE delivery_jobs SET state = ?, result = ?, last_error = '',
+		updated_at = ? WHERE id = ?`, string(StateDelivered), result, now, id)
+}
+
+func (q *sqliteQueue) Retry(ctx context.Context, id string, at time.Time, lastError string) error {
+	now := q.now().UnixNano()
+	return q.update(ctx, `UPDATE delivery_jobs SET state = ?, last_error = ?,
+		updated_at = ?, next_attempt_at = ? WHERE id = ?`, string(StatePending), lastError, now, at.UnixNano(), id)
+}
+
+func (q *sqliteQueue) Fail(ctx context.Context, id string, lastError string) error {
+	now := q.now().UnixNano()
+	return q.update(ctx, `UPDATE delivery_jobs SET state = ?, last_error = ?,
+		updated_at = ? WHERE id = ?`, string(StateFailed), lastError, now, id)
+}
+
+func (q *sqliteQueue) update(ctx context.Context, query string, args ...any) error {
+	res, err := q.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+
+	if updated == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (q *sqliteQueue) Get(ctx context.Context, id string) (Job, error) {
+	return scanJob(q.db.QueryRowContext(ctx, `SELECT `+sqliteJobColumns+` FROM delivery_jobs WHERE id = ?`, id))
+}
+
+func (q *sqliteQueue) Depth(ctx context.Context) (int, error) {
+	var depth int
+	err := q.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM delivery_jobs WHERE state IN (?, ?)",
+		string(StatePending), string(StateRunning)).Scan(&depth)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count jobs: %w", err)
+	}
+
+	return depth, nil
+}
+
+func (q *sqliteQueue) Prune(ctx context.Context, before time.Time) (int, error) {
+	res, err := q.db.ExecContext(ctx, "DELETE FROM delivery_jobs WHERE state IN (?, ?) AND updated_at < ?",
+		string(StateDelivered), string(StateFailed), before.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune jobs: %w", err)
+	}
+
+	pruned, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune jobs: %w", err)
+	}
+
+	return int(pruned), nil
+}
+
+func (q *sqliteQueue) Close() error {
+	return q.db.Close()
+}
+
+func scanJob(row *sql.Row) (Job, error) {
+	var job Job
+	var state string
+	var createdAt, updatedAt, nextAttemptAt int64
+
+	err := row.Scan(&job.ID, &job.Kind, &job.Payload, &state, &job.Attempts, &job.LastError,
+		&job.Result, &createdAt, &updatedAt, &nextAttemptAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to read job: %w", err)
+	}
+
+	job.State = State(state)
+	job.CreatedAt = time.Unix(0, createdAt)
+	job.UpdatedAt = time.Unix(0, updatedAt)
+	job.NextAttemptAt = time.Unix(0, nextAttemptAt)
+
+	return job, nil
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Buckets are pruned when the store grows beyond this size
+const memoryStorePruneSize = 10000
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	expires time.Time
+}
+
+type memoryStore struct {
+	m       sync.Mutex
+	now     func() time.Time
+	buckets map[string]*bucket
+}
+
+var _ Store = (*memoryStore)(nil)
+
+// NewMemoryStore creates a store holding the buckets in memory. The limits
+// are not shared with other replicas of the service.
+func NewMemoryStore() *memoryStore {
+	return newMemoryStore(time.Now)
+}
+
+func newMemoryStore(now func() time.Time) *memoryStore {
+	return &memoryStore{
+		now:     now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, rule Rule) (Result, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := s.now()
+	if len(s.buckets) >= memoryStorePruneSize {
+		s.prune(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rule.capacity(), updated: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = rule.tokensAt(b.tokens, b.updated, now)
+	b.updated = now
+	b.expires = now.Add(rule.refill())
+
+	if b.tokens < 1 {
+		return Result{RetryAfter: rule.wait(b.tokens)}, nil
+	}
+
+	b.tokens--
+	return Result{Allowed: true, Remaining: int(b.tokens)}, nil
+}
+
+func (s *memoryStore) Refund(_ context.Context, key string, rule Rule) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		return nil
+	}
+
+	now := s.now()
+	b.tokens = math.Min(rule.tokensAt(b.tokens, b.updated, now)+1, rule.capacity())
+	b.updated = now
+
+	return nil
+}
+
+// prune removes the buckets that are full again, they are
+// the same as buckets that do not exist
+func (s *memoryStore) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.expires) {
+			delete(s.buckets, key)
+		}
+	}
+}
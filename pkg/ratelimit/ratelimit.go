@@ -0,0 +1,192 @@
+// Package ratelimit implements token bucket rate limits shared by the
+// replicas of the service through a store
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Scope is what a rate limit is counted against
+type Scope string
+
+const (
+	ScopeRepository Scope = "repository"
+	ScopeOwner      Scope = "owner"
+	ScopeActor      Scope = "actor"
+)
+
+const keyPrefix = "ghcp:ratelimit"
+
+// Rule limits the requests in a scope to Requests in Per. Up to Burst requests
+// are allowed at once, which defaults to Requests. A rule with a TokenType
+// applies only to requests authenticated with that type of token.
+type Rule struct {
+	Scope     Scope
+	TokenType string
+	Requests  int
+	Per       time.Duration
+	Burst     int
+}
+
+// Validate verifies that the rule is consistent
+func (r Rule) Validate() error {
+	switch r.Scope {
+	case ScopeRepository, ScopeOwner, ScopeActor:
+	default:
+		return fmt.Errorf("invalid rate limit scope: %s", r.Scope)
+	}
+
+	if r.Requests <= 0 {
+		return fmt.Errorf("rate limit requests must be greater than 0 for scope %s", r.Scope)
+	}
+
+	if r.Per < time.Millisecond {
+		return fmt.Errorf("rate limit period must be at least 1ms for scope %s", r.Scope)
+	}
+
+	if r.Burst < 0 {
+		return fmt.Errorf("rate limit burst must not be negative for scope %s", r.Scope)
+	}
+
+	return nil
+}
+
+// capacity is the number of tokens in a full bucket
+func (r Rule) capacity() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+
+	return float64(r.Requests)
+}
+
+// refill is the time to refill an empty bucket
+func (r Rule) refill() time.Duration {
+	return time.Duration(math.Ceil(r.capacity() * float64(r.Per) / float64(r.Requests)))
+}
+
+// wait is the time until the bucket has a token
+func (r Rule) wait(tokens float64) time.Duration {
+	return time.Duration(math.Ceil((1 - tokens) * float64(r.Per) / float64(r.Requests)))
+}
+
+// tokensAt returns the tokens in the bucket after refilling it since updated
+func (r Rule) tokensAt(tokens float64, updated, now time.Time) float64 {
+	if !now.After(updated) {
+		return tokens
+	}
+
+	tokens += float64(now.Sub(updated)) * float64(r.Requests) / float64(r.Per)
+	return math.Min(tokens, r.capacity())
+}
+
+// Subject identifies the caller of a request
+type Subject struct {
+	// Repository in owner/repo form
+	Repository string
+	Owner      string
+	Actor      string
+	TokenType  string
+}
+
+func (s Subject) value(scope Scope) string {
+	switch scope {
+	case ScopeRepository:
+		return s.Repository
+	case ScopeOwner:
+		return s.Owner
+	case ScopeActor:
+		return s.Actor
+	default:
+		return ""
+	}
+}
+
+// Result is the state of a bucket after taking a token
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Store holds the buckets. Take removes a token from the bucket of the key
+// when one is available. Refund puts a taken token back into the bucket.
+type Store interface {
+	Take(ctx context.Context, key string, rule Rule) (Result, error)
+	Refund(ctx context.Context, key string, rule Rule) error
+}
+
+// LimitExceededError is returned when a request is over a rate limit
+type LimitExceededError struct {
+	Scope      Scope
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s %s, retry after %s",
+		e.Scope, e.Key, e.RetryAfter.Round(time.Second))
+}
+
+// Check takes a token for the subject from the bucket of every rule that applies
+// to it. Rules are checked in order and a LimitExceededError is returned for the
+// first rule over its limit. Scopes the subject has no value for are skipped.
+//
+// A refused request does not count against any limit, the tokens taken for the
+// earlier rules are refunded. Otherwise a caller over its actor limit would keep
+// draining the buckets of the repository and owner shared with other callers.
+func Check(ctx context.Context, store Store, rules []Rule, subject Subject) error {
+	type taken struct {
+		key  string
+		rule Rule
+	}
+
+	var tokens []taken
+	refund := func() {
+		// Refunds are best effort, a token that is not refunded makes
+		// the limit stricter and never looser
+		for i := len(tokens) - 1; i >= 0; i-- {
+			_ = store.Refund(ctx, tokens[i].key, tokens[i].rule)
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.TokenType != "" && !strings.EqualFold(rule.TokenType, subject.TokenType) {
+			continue
+		}
+
+		value := strings.ToLower(subject.value(rule.Scope))
+		if value == "" {
+			continue
+		}
+
+		tokenType := rule.TokenType
+		if tokenType == "" {
+			tokenType = "*"
+		}
+
+		key := fmt.Sprintf("%s:%s:%s:%s", keyPrefix, rule.Scope, tokenType, value)
+		result, err := store.Take(ctx, key, rule)
+		if err != nil {
+			refund()
+			return fmt.Errorf("failed to take rate limit token: %w", err)
+		}
+
+		if !result.Allowed {
+			refund()
+			return &LimitExceededError{
+				Scope:      rule.Scope,
+				Key:        value,
+				RetryAfter: result.RetryAfter,
+			}
+		}
+
+		tokens = append(tokens, taken{key: key, rule: rule})
+	}
+
+	return nil
+}
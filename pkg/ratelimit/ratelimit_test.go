@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		rule Rule
+		err  string
+	}{
+		{
+			name: "valid rule",
+			rule: Rule{Scope: ScopeRepository, Requests: 10, Per: time.Minute},
+		},
+		{
+			name: "invalid scope",
+			rule: Rule{Scope: "org", Requests: 10, Per: time.Minute},
+			err:  "invalid rate limit scope: org",
+		},
+		{
+			name: "no requests",
+			rule: Rule{Scope: ScopeOwner, Per: time.Minute},
+			err:  "rate limit requests must be greater than 0 for scope owner",
+		},
+		{
+			name: "no period",
+			rule: Rule{Scope: ScopeActor, Requests: 10},
+			err:  "rate limit period must be at least 1ms for scope actor",
+		},
+		{
+			name: "negative burst",
+			rule: Rule{Scope: ScopeActor, Requests: 10, Per: time.Minute, Burst: -1},
+			err:  "rate limit burst must not be negative for scope actor",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.rule.Validate()
+			if c.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.err)
+			}
+		})
+	}
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T, now func() time.Time) Store{
+		"memory": func(t *testing.T, now func() time.Time) Store {
+			return newMemoryStore(now)
+		},
+		"redis": func(t *testing.T, now func() time.Time) Store {
+			server := miniredis.RunT(t)
+			store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+			store.now = now
+
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Unix(1700000000, 0)
+			store := newStore(t, func() time.Time { return now })
+
+			rule := Rule{Scope: ScopeRepository, Requests: 2, Per: time.Minute}
+			ctx := context.Background()
+
+			res, err := store.Take(ctx, "a", rule)
+			assert.NoError(t, err)
+			assert.Equal(t, Result{Allowed: true, Remaining: 1}, res)
+
+			res, err = store.Take(ctx, "a", rule)
+			assert.NoError(t, err)
+			assert.Equal(t, Result{Allowed: true, Remaining: 0}, res)
+
+			res, err = store.Take(ctx, "a", rule)
+			assert.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.InDelta(t, 30*time.Second, res.RetryAfter, float64(time.Millisecond))
+
+			// Buckets are independent
+			res, err = store.Take(ctx, "b", rule)
+			assert.NoError(t, err)
+			assert.True(t, res.Allowed)
+
+			// A token is refilled every 30 seconds
+			now = now.Add(20 * time.Second)
+			res, err = store.Take(ctx, "a", rule)
+			assert.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.InDelta(t, 10*time.Second, res.RetryAfter, float64(time.Millisecond))
+
+			now = now.Add(10 * time.Second)
+			res, err = store.Take(ctx, "a", rule)
+			assert.NoError(t, err)
+			assert.True(t, res.Allowed)
+
+			// Refill does not exceed the burst
+			now = now.Add(time.Hour)
+			burst := Rule{Scope: ScopeRepository, Requests: 2, Per: time.Minute, Burst: 3}
+			for i := 2; i >= 0; i-- {
+				res, err = store.Take(ctx, "c", burst)
+				assert.NoError(t, err)
+				assert.Equal(t, Result{Allowed: true, Remaining: i}, res)
+			}
+
+			res, err = store.Take(ctx, "c", burst)
+			assert.NoError(t, err)
+			assert.False(t, res.Allowed)
+
+			// A refunded token can be taken again, up to the burst
+			assert.NoError(t, store.Refund(ctx, "c", burst))
+			res, err = store.Take(ctx, "c", burst)
+			assert.NoError(t, err)
+			assert.Equal(t, Result{Allowed: true, Remaining: 0}, res)
+
+			now = now.Add(time.Hour)
+			assert.NoError(t, store.Refund(ctx, "c", burst))
+			res, err = store.Take(ctx, "c", burst)
+			assert.NoError(t, err)
+			assert.Equal(t, Result{Allowed: true, Remaining: 2}, res)
+
+			// Refunds to unknown buckets are ignored
+			assert.NoError(t, store.Refund(ctx, "d", burst))
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rules := []Rule{
+		{Scope: ScopeRepository, Requests: 2, Per: time.Hour},
+		{Scope: ScopeActor, TokenType: "workload_identity", Requests: 1, Per: time.Hour},
+	}
+
+	store := newMemoryStore(func() time.Time { return time.Unix(1700000000, 0) })
+	ctx := context.Background()
+
+	// Actor rules apply only to workload identity tokens
+	action := Subject{Repository: "safedep/ghcp", Owner: "safedep", Actor: "octocat", TokenType: "action"}
+	assert.NoError(t, Check(ctx, store, rules, action))
+
+	workload := Subject{Repository: "safedep/vet", Owner: "safedep", Actor: "octocat", TokenType: "workload_identity"}
+	assert.NoError(t, Check(ctx, store, rules, workload))
+
+	var limitErr *LimitExceededError
+
+	err := Check(ctx, store, rules, workload)
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, ScopeActor, limitErr.Scope)
+	assert.Equal(t, "octocat", limitErr.Key)
+	assert.Equal(t, time.Hour, limitErr.RetryAfter)
+
+	// The refused request did not take a token of the repository
+	other := Subject{Repository: "safedep/vet", Owner: "safedep", TokenType: "action"}
+	assert.NoError(t, Check(ctx, store, rules, other))
+
+	err = Check(ctx, store, rules, other)
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, ScopeRepository, limitErr.Scope)
+
+	// Repositories are matched without case
+	action.Repository = "SafeDep/GHCP"
+	assert.NoError(t, Check(ctx, store, rules, action))
+
+	err = Check(ctx, store, rules, action)
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, ScopeRepository, limitErr.Scope)
+	assert.Equal(t, "safedep/ghcp", limitErr.Key)
+	assert.ErrorContains(t, err, "rate limit exceeded for repository safedep/ghcp, retry after 30m0s")
+
+	// Scopes without a value are skipped
+	assert.NoError(t, Check(ctx, store, rules, Subject{TokenType: "workload_identity"}))
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills the bucket since it was last updated and takes a token
+// when one is available. Tokens are stored as a string to retain the fraction.
+//
+// KEYS[1] - bucket
+// ARGV[1] - capacity
+// ARGV[2] - tokens per millisecond
+// ARGV[3] - current time in milliseconds
+// ARGV[4] - time to refill the bucket in milliseconds
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil or updated == nil then
+  tokens = capacity
+  updated = now
+end
+
+if now > updated then
+  tokens = math.min(capacity, tokens + (now - updated) * rate)
+  updated = now
+end
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(updated))
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+
+return {allowed, math.floor(tokens), wait}
+`)
+
+// refundScript refills the bucket since it was last updated and puts a token
+// back. A bucket that expired is full and is left as it is.
+//
+// KEYS[1] - bucket
+// ARGV[1] - capacity
+// ARGV[2] - tokens per millisecond
+// ARGV[3] - current time in milliseconds
+// ARGV[4] - time to refill the bucket in milliseconds
+var refundScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil or updated == nil then
+  return 0
+end
+
+if now > updated then
+  tokens = tokens + (now - updated) * rate
+  updated = now
+end
+
+tokens = math.min(capacity, tokens + 1)
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(updated))
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+
+return 1
+`)
+
+type redisStore struct {
+	client redis.UniversalClient
+	now    func() time.Time
+}
+
+var _ Store = (*redisStore)(nil)
+
+// NewRedisStore creates a store holding the buckets in Redis, or a server
+// compatible with its protocol, to share the limits between replicas.
+// The clocks of the replicas are expected to be synchronized.
+func NewRedisStore(client redis.UniversalClient) *redisStore {
+	return &redisStore{
+		client: client,
+		now:    time.Now,
+	}
+}
+
+func (s *redisStore) Take(ctx context.Context, key string, rule Rule) (Result, error) {
+	rate := float64(rule.Requests) / float64(rule.Per.Milliseconds())
+	refill := rule.refill().Milliseconds() + 1
+
+	res, err := takeScript.Run(ctx, s.client, []string{key},
+		strconv.FormatFloat(rule.capacity(), 'f', -1, 64),
+		strconv.FormatFloat(rate, 'f', -1, 64),
+		s.now().UnixMilli(), refill).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to run rate limit script: %w", err)
+	}
+
+	if len(res) != 3 {
+		return Result{}, fmt.Errorf("unexpected rate limit script result: %v", res)
+	}
+
+	return Result{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
+
+func (s *redisStore) Refund(ctx context.Context, key string, rule Rule) error {
+	rate := float64(rule.Requests) / float64(rule.Per.Milliseconds())
+	refill := rule.refill().Milliseconds() + 1
+
+	err := refundScript.Run(ctx, s.client, []string{key},
+		strconv.FormatFloat(rule.capacity(), 'f', -1, 64),
+		strconv.FormatFloat(rate, 'f', -1, 64),
+		s.now().UnixMilli(), refill).Err()
+	if err != nil {
+		return fmt.Errorf("failed to run rate limit refund script: %w", err)
+	}
+
+	return nil
+}
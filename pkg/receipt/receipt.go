@@ -0,0 +1,166 @@
+// Package receipt issues signed receipts of the comments posted by the service.
+// A receipt is a JWT verifiable with the keys published by the server, so that
+// anyone can verify later that a comment was posted through the service on
+// behalf of a specific caller.
+package receipt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// Algorithms of the receipts
+var signatureAlgorithms = []jose.SignatureAlgorithm{jose.ES256, jose.EdDSA}
+
+// Claims of a receipt
+type Claims struct {
+	jwt.Claims
+
+	RepositoryID string `json:"repository_id"`
+	Repository   string `json:"repository"`
+	PrNumber     string `json:"pr_number"`
+	CommentID    string `json:"comment_id"`
+	Action       string `json:"action"`
+
+	// SHA-256 digest of the body in the request
+	BodySHA256 string `json:"body_sha256"`
+
+	Caller Caller `json:"caller"`
+}
+
+// Caller identifies the workflow run, or user, on whose behalf the comment was posted
+type Caller struct {
+	TokenType   string `json:"token_type,omitempty"`
+	Issuer      string `json:"issuer,omitempty"`
+	Subject     string `json:"subject,omitempty"`
+	Actor       string `json:"actor,omitempty"`
+	Repository  string `json:"repository,omitempty"`
+	WorkflowRef string `json:"workflow_ref,omitempty"`
+	RunID       string `json:"run_id,omitempty"`
+	RunAttempt  string `json:"run_attempt,omitempty"`
+}
+
+// Signer signs the receipts
+type Signer struct {
+	issuer string
+	key    jose.JSONWebKey
+	signer jose.Signer
+}
+
+// NewSigner creates a signer of receipts issued by the issuer, the URL of
+// the server. The key must be an ECDSA P-256 or an Ed25519 key.
+func NewSigner(issuer string, key crypto.Signer) (*Signer, error) {
+	var algorithm jose.SignatureAlgorithm
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("receipt signing key must be an ECDSA P-256 or an Ed25519 key")
+		}
+
+		algorithm = jose.ES256
+	case ed25519.PrivateKey:
+		algorithm = jose.EdDSA
+	default:
+		return nil, errors.New("receipt signing key must be an ECDSA P-256 or an Ed25519 key")
+	}
+
+	jwk := jose.JSONWebKey{Key: key, Algorithm: string(algorithm), Use: "sig"}
+
+	publicKey := jwk.Public()
+	thumbprint, err := publicKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute key ID: %w", err)
+	}
+
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: algorithm, Key: jwk},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create receipt signer: %w", err)
+	}
+
+	return &Signer{issuer: issuer, key: jwk, signer: signer}, nil
+}
+
+// Sign returns the compact serialization of the receipt with the claims.
+// The issuer, time and ID of the receipt are set by the signer.
+func (s *Signer) Sign(claims Claims) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate receipt ID: %w", err)
+	}
+
+	claims.Issuer = s.issuer
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ID = hex.EncodeToString(id)
+
+	token, err := jwt.Signed(s.signer).Claims(claims).Serialize()
+	if err != nil {
+		return "", fmt.Errorf("failed to sign receipt: %w", err)
+	}
+
+	return token, nil
+}
+
+// JWKS returns the key set publishing the key verifying the receipts
+func (s *Signer) JWKS() jose.JSONWebKeySet {
+	return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{s.key.Public()}}
+}
+
+// Verify verifies the receipt with the key set and returns its claims
+func Verify(receipt string, jwks jose.JSONWebKeySet) (Claims, error) {
+	token, err := jwt.ParseSigned(receipt, signatureAlgorithms)
+	if err != nil {
+		return Claims{}, fmt.Errorf("failed to parse receipt: %w", err)
+	}
+
+	if len(token.Headers) != 1 {
+		return Claims{}, errors.New("receipt must have a single signature")
+	}
+
+	keys := jwks.Key(token.Headers[0].KeyID)
+	if len(keys) == 0 {
+		return Claims{}, fmt.Errorf("receipt signed by unknown key: %s", token.Headers[0].KeyID)
+	}
+
+	var claims Claims
+	if err := token.Claims(keys[0].Key, &claims); err != nil {
+		return Claims{}, fmt.Errorf("failed to verify receipt: %w", err)
+	}
+
+	return claims, nil
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS #8 ECDSA P-256 or Ed25519 private key
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key can not sign")
+	}
+
+	return signer, nil
+}
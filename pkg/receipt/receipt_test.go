@@ -0,0 +1,113 @@
+package receipt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	claims := Claims{
+		RepositoryID: "100",
+		Repository:   "safedep/ghcp",
+		PrNumber:     "1",
+		CommentID:    "10",
+		Action:       "created",
+		BodySHA256:   "abc",
+		Caller:       Caller{TokenType: "workload_identity", Actor: "octocat", RunID: "42"},
+	}
+
+	keys := map[string]crypto.Signer{"ES256": ecKey, "EdDSA": edKey}
+	for algorithm, key := range keys {
+		t.Run(algorithm, func(t *testing.T) {
+			signer, err := NewSigner("https://ghcp.example.com", key)
+			assert.NoError(t, err)
+
+			token, err := signer.Sign(claims)
+			assert.NoError(t, err)
+			assert.Len(t, strings.Split(token, "."), 3)
+
+			jwks := signer.JWKS()
+			assert.Len(t, jwks.Keys, 1)
+			assert.True(t, jwks.Keys[0].IsPublic())
+			assert.Equal(t, algorithm, jwks.Keys[0].Algorithm)
+
+			// The key set is published as JSON
+			data, err := json.Marshal(jwks)
+			assert.NoError(t, err)
+
+			var published jose.JSONWebKeySet
+			assert.NoError(t, json.Unmarshal(data, &published))
+
+			verified, err := Verify(token, published)
+			assert.NoError(t, err)
+			assert.Equal(t, "https://ghcp.example.com", verified.Issuer)
+			assert.NotEmpty(t, verified.ID)
+			assert.NotNil(t, verified.IssuedAt)
+			assert.Equal(t, claims.CommentID, verified.CommentID)
+			assert.Equal(t, claims.Caller, verified.Caller)
+
+			// Receipts are not verified by other keys
+			otherKey := map[string]crypto.Signer{"ES256": edKey, "EdDSA": ecKey}[algorithm]
+			other, err := NewSigner("https://ghcp.example.com", otherKey)
+			assert.NoError(t, err)
+
+			_, err = Verify(token, other.JWKS())
+			assert.ErrorContains(t, err, "receipt signed by unknown key")
+
+			// Edited receipts are not verified
+			parts := strings.Split(token, ".")
+			forged, err := other.Sign(Claims{CommentID: "11"})
+			assert.NoError(t, err)
+
+			_, err = Verify(parts[0]+"."+strings.Split(forged, ".")[1]+"."+parts[2], jwks)
+			assert.ErrorContains(t, err, "failed to verify receipt")
+		})
+	}
+}
+
+func TestNewSignerUnsupportedKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+
+	_, err = NewSigner("https://ghcp.example.com", ecKey)
+	assert.ErrorContains(t, err, "must be an ECDSA P-256 or an Ed25519 key")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	_, err = NewSigner("https://ghcp.example.com", rsaKey)
+	assert.ErrorContains(t, err, "must be an ECDSA P-256 or an Ed25519 key")
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	parsed, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+
+	_, err = ParsePrivateKey([]byte("not a key"))
+	assert.ErrorContains(t, err, "failed to decode PEM private key")
+}
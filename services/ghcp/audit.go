@@ -0,0 +1,139 @@
+package ghcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/audit"
+	"github.com/safedep/ghcp/pkg/gh"
+)
+
+// Operations recorded in the audit log
+const (
+	auditOperationCreateComment      = "create_comment"
+	auditOperationDeleteComment      = "delete_comment"
+	auditOperationCreateReview       = "create_review"
+	auditOperationCreateCheckRun     = "create_check_run"
+	auditOperationCreateCommitStatus = "create_commit_status"
+	auditOperationDeliverComment     = "deliver_comment"
+)
+
+// Actions recorded in the audit log, along with the comment actions
+const (
+	auditActionCreated = string(CommentActionCreated)
+	auditActionUpdated = string(CommentActionUpdated)
+	auditActionDeleted = "deleted"
+)
+
+// Reasons of the decisions not caused by an error
+const (
+	auditReasonAuthorized           = "AUTHORIZED"
+	auditReasonAuthorizationSkipped = "AUTHORIZATION_SKIPPED"
+	auditReasonInternal             = "INTERNAL"
+)
+
+// Reasons of requests denied by the repository access lists. Clients are told the
+// request is unauthorized, the audit log records the list that refused it.
+var auditRepositoryAccessReasons = map[RepositoryAccessDenialReason]string{
+	RepositoryAccessDeniedRepository: "REPOSITORY_DENIED",
+	RepositoryAccessDeniedOwner:      "OWNER_DENIED",
+	RepositoryAccessNotAllowed:       "REPOSITORY_NOT_ALLOWED",
+}
+
+// recordAudit completes the record with the decision on the request and its
+// caller and writes it to the audit sink. Requests are not failed when the
+// record can not be written.
+func (s *gitHubCommentProxyService) recordAudit(ctx context.Context, operation string,
+	target pullRequestTarget, record audit.Record, err error) {
+	// The audit chain times the records again when they are written in order
+	record.Time = time.Now().UTC()
+	record.Operation = operation
+	record.Owner = target.GetOwner()
+	record.Repo = target.GetRepo()
+	record.PrNumber = target.GetPrNumber()
+	record.Decision, record.Reason = auditDecision(err)
+
+	tokenContext, tokenErr := gh.ExtractGitHubTokenContext(ctx)
+	if tokenErr == nil {
+		record.Caller = auditCaller(tokenContext)
+	} else if err == nil {
+		record.Reason = auditReasonAuthorizationSkipped
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	auditRecordMetric.WithLabels(map[string]string{"decision": string(record.Decision)}).Inc()
+
+	if s.auditSink == nil {
+		return
+	}
+
+	// The record is written even when the client has gone away
+	if err := s.auditSink.Write(context.WithoutCancel(ctx), record); err != nil {
+		auditWriteFailedMetric.Inc()
+		log.Errorf("failed to write audit record: %s", err)
+	}
+}
+
+// auditDecision returns the decision on a request failed with the error along with
+// its reason. Requests refused by the service are denied, other failures are failed.
+func auditDecision(err error) (audit.Decision, string) {
+	if err == nil {
+		return audit.DecisionAllowed, auditReasonAuthorized
+	}
+
+	var accessErr *RepositoryAccessDeniedError
+	if errors.As(err, &accessErr) {
+		if reason, ok := auditRepositoryAccessReasons[accessErr.Reason]; ok {
+			return audit.DecisionDenied, reason
+		}
+	}
+
+	var serviceErr *Error
+	if !errors.As(classifyError(err), &serviceErr) {
+		return audit.DecisionFailed, auditReasonInternal
+	}
+
+	switch serviceErr.Code {
+	case ErrorCodeUnavailable, ErrorCodeAborted:
+		return audit.DecisionFailed, serviceErr.Reason
+	default:
+		return audit.DecisionDenied, serviceErr.Reason
+	}
+}
+
+func auditCaller(tokenContext gh.GitHubTokenContext) audit.Caller {
+	return audit.Caller{
+		TokenType:      string(tokenContext.TokenType),
+		Issuer:         tokenContext.Issuer,
+		Subject:        tokenContext.Subject,
+		Actor:          tokenContext.Actor,
+		Repository:     tokenContext.Repository,
+		RepositoryID:   tokenContext.RepositoryID,
+		EventName:      tokenContext.EventName,
+		Ref:            tokenContext.Ref,
+		Workflow:       tokenContext.Workflow,
+		WorkflowRef:    tokenContext.WorkflowRef,
+		WorkflowSHA:    tokenContext.WorkflowSHA,
+		JobWorkflowRef: tokenContext.JobWorkflowRef,
+		RunID:          tokenContext.RunID,
+		RunNumber:      tokenContext.RunNumber,
+		RunAttempt:     tokenContext.RunAttempt,
+	}
+}
+
+// bodyDigest returns the hex encoded SHA-256 digest of the body, empty for an empty body
+func bodyDigest(body string) string {
+	if body == "" {
+		return ""
+	}
+
+	hash := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(hash[:])
+}
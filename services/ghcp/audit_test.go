@@ -0,0 +1,226 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/audit"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreatePullRequestCommentAudit(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		Repository:  "safedep/ghcp",
+		Actor:       "octocat",
+		EventName:   "pull_request",
+		WorkflowRef: "safedep/ghcp/.github/workflows/vet.yml@refs/pull/1/merge",
+		RunID:       "42",
+		RunAttempt:  "1",
+		TokenType:   gh.TokenTypeWorkloadIdentity,
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		BotUsername:               "test-bot",
+		MaxCommentsPerPR:          1,
+	}
+
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+	}
+
+	botComment := &ghapi.IssueComment{User: &ghapi.User{Login: ghapi.Ptr("test-bot")}}
+
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		mock   func(*github.MockGitHubIssueAdapter)
+		assert func(*testing.T, audit.Record)
+	}{
+		{
+			name: "comment created",
+			ctx:  gh.InjectGitHubTokenContext(context.Background(), token),
+			mock: func(m *github.MockGitHubIssueAdapter) {
+				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).Return(nil, nil)
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+					Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil)
+			},
+			assert: func(t *testing.T, record audit.Record) {
+				assert.Equal(t, audit.DecisionAllowed, record.Decision)
+				assert.Equal(t, "AUTHORIZED", record.Reason)
+				assert.Equal(t, "created", record.Action)
+				assert.Equal(t, "10", record.ResourceID)
+				assert.Equal(t, bodyDigest("test comment"), record.BodySHA256)
+				assert.Equal(t, audit.Caller{
+					TokenType:   "workload_identity",
+					Actor:       "octocat",
+					Repository:  "safedep/ghcp",
+					EventName:   "pull_request",
+					WorkflowRef: "safedep/ghcp/.github/workflows/vet.yml@refs/pull/1/merge",
+					RunID:       "42",
+					RunAttempt:  "1",
+				}, record.Caller)
+			},
+		},
+		{
+			name: "comment limit reached",
+			ctx:  gh.InjectGitHubTokenContext(context.Background(), token),
+			mock: func(m *github.MockGitHubIssueAdapter) {
+				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
+					Return([]*ghapi.IssueComment{botComment}, nil)
+			},
+			assert: func(t *testing.T, record audit.Record) {
+				assert.Equal(t, audit.DecisionDenied, record.Decision)
+				assert.Equal(t, ErrorReasonCommentLimitReached, record.Reason)
+				assert.Equal(t, "maximum number of comments (1) reached for PR", record.Error)
+				assert.Empty(t, record.ResourceID)
+				assert.Equal(t, "42", record.Caller.RunID)
+			},
+		},
+		{
+			name: "github unavailable",
+			ctx:  gh.InjectGitHubTokenContext(context.Background(), token),
+			mock: func(m *github.MockGitHubIssueAdapter) {
+				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
+					Return(nil, &ghapi.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}})
+			},
+			assert: func(t *testing.T, record audit.Record) {
+				assert.Equal(t, audit.DecisionFailed, record.Decision)
+				assert.Equal(t, ErrorReasonGitHubUnavailable, record.Reason)
+			},
+		},
+		{
+			name: "unclassified failure",
+			ctx:  gh.InjectGitHubTokenContext(context.Background(), token),
+			mock: func(m *github.MockGitHubIssueAdapter) {
+				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
+					Return(nil, errors.New("connection reset"))
+			},
+			assert: func(t *testing.T, record audit.Record) {
+				assert.Equal(t, audit.DecisionFailed, record.Decision)
+				assert.Equal(t, "INTERNAL", record.Reason)
+				assert.Contains(t, record.Error, "connection reset")
+			},
+		},
+		{
+			name: "authorization skipped",
+			ctx:  context.Background(),
+			mock: func(m *github.MockGitHubIssueAdapter) {
+				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).Return(nil, nil)
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+					Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil)
+			},
+			assert: func(t *testing.T, record audit.Record) {
+				assert.Equal(t, audit.DecisionAllowed, record.Decision)
+				assert.Equal(t, "AUTHORIZATION_SKIPPED", record.Reason)
+				assert.Empty(t, record.Caller)
+			},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			test.mock(ghIssueAdapter)
+
+			service, err := NewGitHubCommentProxyService(config, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t),
+				github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+			assert.NoError(t, err)
+			defer sink.Close()
+
+			service.SetAuditSink(sink)
+			_, _ = service.CreatePullRequestComment(test.ctx, request)
+
+			records, err := sink.Query(context.Background(), audit.Filter{})
+			assert.NoError(t, err)
+			assert.Len(t, records, 1)
+
+			record := records[0]
+			assert.Equal(t, "create_comment", record.Operation)
+			assert.Equal(t, "safedep", record.Owner)
+			assert.Equal(t, "ghcp", record.Repo)
+			assert.Equal(t, "1", record.PrNumber)
+			assert.False(t, record.Time.IsZero())
+
+			test.assert(t, record)
+		})
+	}
+}
+
+func TestAuditDecision(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		decision audit.Decision
+		reason   string
+	}{
+		{"allowed", nil, audit.DecisionAllowed, "AUTHORIZED"},
+		{
+			"repository denied",
+			newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+				fmt.Errorf("failed to verify repository access: %w",
+					&RepositoryAccessDeniedError{Reason: RepositoryAccessDeniedRepository})),
+			audit.DecisionDenied, "REPOSITORY_DENIED",
+		},
+		{
+			"owner denied",
+			newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+				&RepositoryAccessDeniedError{Reason: RepositoryAccessDeniedOwner}),
+			audit.DecisionDenied, "OWNER_DENIED",
+		},
+		{
+			"repository not allowed",
+			newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+				&RepositoryAccessDeniedError{Reason: RepositoryAccessNotAllowed}),
+			audit.DecisionDenied, "REPOSITORY_NOT_ALLOWED",
+		},
+		{
+			"repository opted out",
+			newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+				fmt.Errorf("failed to verify repository policy: %w",
+					newError(ErrorCodePermissionDenied, ErrorReasonRepositoryOptedOut, errors.New("opted out")))),
+			audit.DecisionDenied, "REPOSITORY_OPTED_OUT",
+		},
+		{
+			"workflow not allowed",
+			newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+				fmt.Errorf("failed to verify repository policy: %w",
+					newError(ErrorCodePermissionDenied, ErrorReasonWorkflowNotAllowed, errors.New("not allowed")))),
+			audit.DecisionDenied, "WORKFLOW_NOT_ALLOWED",
+		},
+		{
+			"other denial",
+			newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized, errors.New("repository is not public")),
+			audit.DecisionDenied, ErrorReasonUnauthorized,
+		},
+		{
+			"aborted",
+			newError(ErrorCodeAborted, ErrorReasonPullRequestBusy, errors.New("busy")),
+			audit.DecisionFailed, ErrorReasonPullRequestBusy,
+		},
+		{"unclassified", errors.New("connection reset"), audit.DecisionFailed, "INTERNAL"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			decision, reason := auditDecision(c.err)
+			assert.Equal(t, c.decision, decision)
+			assert.Equal(t, c.reason, reason)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package ghcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+)
+
+// botIdentity identifies the comments made by the bot on a repository
+type botIdentity struct {
+	username string
+
+	// GitHub App used to comment on the repository, if any
+	app *github.GitHubAppIdentity
+}
+
+// resolveBotIdentity returns the identity used by the bot to comment on the repository
+func (s *gitHubCommentProxyService) resolveBotIdentity(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, owner, repo string) (botIdentity, error) {
+	identity := botIdentity{username: config.BotUsername}
+	if !config.UseGitHubAppIdentity {
+		return identity, nil
+	}
+
+	app, err := s.ghIssueAdapter.GetAppIdentity(ctx, owner, repo)
+	if err != nil {
+		return identity, fmt.Errorf("failed to get app identity: %w", err)
+	}
+
+	identity.app = app
+	return identity, nil
+}
+
+// isAuthorOf returns true if the comment was created by the bot
+func (b botIdentity) isAuthorOf(comment *ghapi.IssueComment) bool {
+	return b.isLogin(comment.GetUser().GetLogin())
+}
+
+// isReviewCommentAuthorOf returns true if the review comment was created by the bot
+func (b botIdentity) isReviewCommentAuthorOf(comment *ghapi.PullRequestComment) bool {
+	return b.isLogin(comment.GetUser().GetLogin())
+}
+
+// isLogin returns true if the login is of the bot
+func (b botIdentity) isLogin(login string) bool {
+	if b.app == nil {
+		return login == b.username
+	}
+
+	// The [bot] suffix is reserved for GitHub Apps, the login can not be
+	// registered by a user. The performed_via_github_app metadata is not
+	// exposed on issue comments by the GitHub client, the login is sufficient.
+	return strings.EqualFold(login, b.app.BotLogin())
+}
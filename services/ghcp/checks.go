@@ -0,0 +1,587 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/audit"
+)
+
+const (
+	// Prefix of check run names and commit status contexts by default
+	DefaultCheckNamespace = "ghcp/"
+
+	// GitHub accepts at most 50 annotations in a single request
+	maxCheckRunAnnotations = 50
+
+	// GitHub truncates commit status descriptions beyond this
+	maxCommitStatusDescriptionLength = 140
+)
+
+var (
+	commitSHARegexp = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+	checkRunStatuses    = []string{"queued", "in_progress", "completed"}
+	checkRunConclusions = []string{"success", "failure", "neutral", "cancelled", "skipped", "timed_out", "action_required"}
+	annotationLevels    = []string{"notice", "warning", "failure"}
+	commitStatusStates  = []string{"error", "failure", "pending", "success"}
+)
+
+// CreateCheckRunRequest is the request to create or update a check run on a commit
+// of a pull request. A check run created earlier by the bot with the same name on
+// the commit is updated.
+type CreateCheckRunRequest struct {
+	Owner    string `json:"owner"`
+	Repo     string `json:"repo"`
+	PrNumber string `json:"prNumber"`
+
+	// Commit of the pull request. Defaults to the head commit.
+	Sha string `json:"sha,omitempty"`
+
+	Name        string                `json:"name"`
+	Status      string                `json:"status,omitempty"`
+	Conclusion  string                `json:"conclusion,omitempty"`
+	Title       string                `json:"title,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Text        string                `json:"text,omitempty"`
+	DetailsUrl  string                `json:"detailsUrl,omitempty"`
+	Annotations []*CheckRunAnnotation `json:"annotations,omitempty"`
+}
+
+// CheckRunAnnotation is an annotation on lines of a file in the check run
+type CheckRunAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"startLine"`
+	EndLine         int    `json:"endLine"`
+	AnnotationLevel string `json:"annotationLevel"`
+	Message         string `json:"message"`
+	Title           string `json:"title,omitempty"`
+}
+
+func (r *CreateCheckRunRequest) GetOwner() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Owner
+}
+
+func (r *CreateCheckRunRequest) GetRepo() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Repo
+}
+
+func (r *CreateCheckRunRequest) GetPrNumber() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.PrNumber
+}
+
+func (r *CreateCheckRunRequest) GetSha() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Sha
+}
+
+func (r *CreateCheckRunRequest) GetName() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Name
+}
+
+// Validate validates the request
+func (r *CreateCheckRunRequest) Validate() error {
+	if err := validatePullRequestCommit(r); err != nil {
+		return err
+	}
+
+	if r.GetName() == "" {
+		return errors.New("name is required")
+	}
+
+	if r.Status != "" && !oneOf(r.Status, checkRunStatuses) {
+		return fmt.Errorf("status must be one of %v", checkRunStatuses)
+	}
+
+	if r.Conclusion != "" && !oneOf(r.Conclusion, checkRunConclusions) {
+		return fmt.Errorf("conclusion must be one of %v", checkRunConclusions)
+	}
+
+	if (r.Status == "completed") != (r.Conclusion != "") {
+		return errors.New("conclusion is required if and only if status is completed")
+	}
+
+	if r.Summary == "" && (r.Title != "" || r.Text != "" || len(r.Annotations) > 0) {
+		return errors.New("summary is required with title, text or annotations")
+	}
+
+	if len(r.Annotations) > maxCheckRunAnnotations {
+		return fmt.Errorf("at most %d annotations are allowed", maxCheckRunAnnotations)
+	}
+
+	for i, annotation := range r.Annotations {
+		if err := annotation.validate(); err != nil {
+			return fmt.Errorf("invalid annotation %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *CheckRunAnnotation) validate() error {
+	if a == nil {
+		return errors.New("annotation is required")
+	}
+
+	if a.Path == "" {
+		return errors.New("path is required")
+	}
+
+	if a.StartLine <= 0 || a.EndLine < a.StartLine {
+		return errors.New("start_line must be positive and not after end_line")
+	}
+
+	if !oneOf(a.AnnotationLevel, annotationLevels) {
+		return fmt.Errorf("annotation_level must be one of %v", annotationLevels)
+	}
+
+	if a.Message == "" {
+		return errors.New("message is required")
+	}
+
+	return nil
+}
+
+// output returns the output of the check run, nil when there is no output
+func (r *CreateCheckRunRequest) output() *ghapi.CheckRunOutput {
+	if r.Summary == "" {
+		return nil
+	}
+
+	title := r.Title
+	if title == "" {
+		title = r.Name
+	}
+
+	output := &ghapi.CheckRunOutput{
+		Title:   ghapi.Ptr(title),
+		Summary: ghapi.Ptr(r.Summary),
+	}
+
+	if r.Text != "" {
+		output.Text = ghapi.Ptr(r.Text)
+	}
+
+	for _, annotation := range r.Annotations {
+		a := &ghapi.CheckRunAnnotation{
+			Path:            ghapi.Ptr(annotation.Path),
+			StartLine:       ghapi.Ptr(annotation.StartLine),
+			EndLine:         ghapi.Ptr(annotation.EndLine),
+			AnnotationLevel: ghapi.Ptr(annotation.AnnotationLevel),
+			Message:         ghapi.Ptr(annotation.Message),
+		}
+
+		if annotation.Title != "" {
+			a.Title = ghapi.Ptr(annotation.Title)
+		}
+
+		output.Annotations = append(output.Annotations, a)
+	}
+
+	return output
+}
+
+// CreateCheckRunResponse is the response with the check run created or updated
+type CreateCheckRunResponse struct {
+	CheckRunId string `json:"checkRunId"`
+	Sha        string `json:"sha"`
+	Updated    bool   `json:"updated,omitempty"`
+}
+
+// CreateCommitStatusRequest is the request to create a commit status on a commit
+// of a pull request
+type CreateCommitStatusRequest struct {
+	Owner    string `json:"owner"`
+	Repo     string `json:"repo"`
+	PrNumber string `json:"prNumber"`
+
+	// Commit of the pull request. Defaults to the head commit.
+	Sha string `json:"sha,omitempty"`
+
+	State       string `json:"state"`
+	Context     string `json:"context"`
+	Description string `json:"description,omitempty"`
+	TargetUrl   string `json:"targetUrl,omitempty"`
+}
+
+func (r *CreateCommitStatusRequest) GetOwner() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Owner
+}
+
+func (r *CreateCommitStatusRequest) GetRepo() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Repo
+}
+
+func (r *CreateCommitStatusRequest) GetPrNumber() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.PrNumber
+}
+
+func (r *CreateCommitStatusRequest) GetSha() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Sha
+}
+
+// Validate validates the request
+func (r *CreateCommitStatusRequest) Validate() error {
+	if err := validatePullRequestCommit(r); err != nil {
+		return err
+	}
+
+	if !oneOf(r.State, commitStatusStates) {
+		return fmt.Errorf("state must be one of %v", commitStatusStates)
+	}
+
+	if r.Context == "" {
+		return errors.New("context is required")
+	}
+
+	if len(r.Description) > maxCommitStatusDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxCommitStatusDescriptionLength)
+	}
+
+	return nil
+}
+
+// CreateCommitStatusResponse is the response with the commit status created
+type CreateCommitStatusResponse struct {
+	StatusId string `json:"statusId"`
+	Sha      string `json:"sha"`
+}
+
+// pullRequestCommit is a commit of a pull request a request acts on
+type pullRequestCommit interface {
+	pullRequestTarget
+	GetSha() string
+}
+
+func validatePullRequestCommit(r pullRequestCommit) error {
+	if r.GetOwner() == "" {
+		return errors.New("owner is required")
+	}
+
+	if r.GetRepo() == "" {
+		return errors.New("repo is required")
+	}
+
+	if n, err := strconv.Atoi(r.GetPrNumber()); err != nil || n <= 0 {
+		return errors.New("pr_number must be a positive number")
+	}
+
+	if r.GetSha() != "" && !commitSHARegexp.MatchString(r.GetSha()) {
+		return errors.New("sha must be a full commit SHA")
+	}
+
+	return nil
+}
+
+// verifyCheckName verifies that checks are enabled and the check run name or commit
+// status context is within the namespace of the service. Required checks of the
+// repository are named by the repository, a check outside the namespace could
+// report a passing result for them.
+func verifyCheckName(config GitHubCommentProxyServiceConfig, name string) error {
+	if !config.EnableChecks {
+		return newError(ErrorCodePermissionDenied, ErrorReasonFeatureDisabled,
+			errors.New("checks are disabled for the repository"))
+	}
+
+	if !strings.HasPrefix(name, config.CheckNamespace) || len(name) == len(config.CheckNamespace) {
+		return newError(ErrorCodeInvalidArgument, ErrorReasonInvalidCheckName,
+			fmt.Errorf("check name must start with %q", config.CheckNamespace))
+	}
+
+	return nil
+}
+
+// CreateCheckRun creates or updates a check run on a commit of the pull request. Check
+// runs can only be created by a GitHub App, the app must be installed on the repository.
+func (s *gitHubCommentProxyService) CreateCheckRun(ctx context.Context,
+	request *CreateCheckRunRequest) (*CreateCheckRunResponse, error) {
+	r, err := func() (*CreateCheckRunResponse, error) {
+		if err := request.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+
+		config, _, err := s.authorize(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := verifyCheckName(config, request.GetName()); err != nil {
+			return nil, err
+		}
+
+		unlock, err := s.lockPullRequest(ctx, config, request)
+		if err != nil {
+			return nil, err
+		}
+
+		defer unlock()
+
+		createCheckRunMetric.Inc()
+
+		app, err := s.ghIssueAdapter.GetAppIdentity(ctx, request.GetOwner(), request.GetRepo())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get app identity: %w", err)
+		}
+
+		if app == nil {
+			return nil, newError(ErrorCodeFailedPrecondition, ErrorReasonFeatureDisabled,
+				errors.New("check runs require the GitHub App to be installed on the repository"))
+		}
+
+		sha, err := s.resolvePullRequestCommit(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		existing, err := s.ghCheckAdapter.ListCheckRuns(ctx, request.GetOwner(), request.GetRepo(),
+			sha, request.GetName(), app.AppID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list check runs: %w", err)
+		}
+
+		var detailsUrl *string
+		if request.DetailsUrl != "" {
+			detailsUrl = ghapi.Ptr(request.DetailsUrl)
+		}
+
+		var status, conclusion *string
+		if request.Status != "" {
+			status = ghapi.Ptr(request.Status)
+		}
+
+		if request.Conclusion != "" {
+			conclusion = ghapi.Ptr(request.Conclusion)
+		}
+
+		// Check runs are listed latest first
+		if len(existing) > 0 {
+			log.Debugf("Updating check run: %d on SHA: %s", existing[0].GetID(), sha)
+
+			checkRun, err := s.ghCheckAdapter.UpdateCheckRun(ctx, request.GetOwner(), request.GetRepo(),
+				existing[0].GetID(), ghapi.UpdateCheckRunOptions{
+					Name:       request.GetName(),
+					DetailsURL: detailsUrl,
+					Status:     status,
+					Conclusion: conclusion,
+					Output:     request.output(),
+				})
+			if err != nil {
+				return nil, fmt.Errorf("failed to update check run: %w", err)
+			}
+
+			return &CreateCheckRunResponse{
+				CheckRunId: strconv.FormatInt(checkRun.GetID(), 10),
+				Sha:        sha,
+				Updated:    true,
+			}, nil
+		}
+
+		log.Debugf("Creating check run: %s on SHA: %s", request.GetName(), sha)
+
+		checkRun, err := s.ghCheckAdapter.CreateCheckRun(ctx, request.GetOwner(), request.GetRepo(),
+			ghapi.CreateCheckRunOptions{
+				Name:       request.GetName(),
+				HeadSHA:    sha,
+				DetailsURL: detailsUrl,
+				Status:     status,
+				Conclusion: conclusion,
+				Output:     request.output(),
+			})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create check run: %w", err)
+		}
+
+		return &CreateCheckRunResponse{
+			CheckRunId: strconv.FormatInt(checkRun.GetID(), 10),
+			Sha:        sha,
+		}, nil
+	}()
+
+	var record audit.Record
+	if r != nil {
+		record.Action = auditActionCreated
+		if r.Updated {
+			record.Action = auditActionUpdated
+		}
+
+		record.ResourceID = r.CheckRunId
+	}
+
+	s.recordAudit(ctx, auditOperationCreateCheckRun, request, record, err)
+
+	if err != nil {
+		log.Errorf("failed to execute service: %s", err)
+		failedServiceExecutionMetric.Inc()
+		return nil, classifyError(err)
+	}
+
+	successfulServiceExecutionMetric.Inc()
+	return r, nil
+}
+
+// CreateCommitStatus creates a commit status on a commit of the pull request
+func (s *gitHubCommentProxyService) CreateCommitStatus(ctx context.Context,
+	request *CreateCommitStatusRequest) (*CreateCommitStatusResponse, error) {
+	r, err := func() (*CreateCommitStatusResponse, error) {
+		if err := request.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+
+		config, _, err := s.authorize(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := verifyCheckName(config, request.Context); err != nil {
+			return nil, err
+		}
+
+		unlock, err := s.lockPullRequest(ctx, config, request)
+		if err != nil {
+			return nil, err
+		}
+
+		defer unlock()
+
+		createCommitStatusMetric.Inc()
+
+		sha, err := s.resolvePullRequestCommit(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		status := &ghapi.RepoStatus{
+			State:   ghapi.Ptr(request.State),
+			Context: ghapi.Ptr(request.Context),
+		}
+
+		if request.Description != "" {
+			status.Description = ghapi.Ptr(request.Description)
+		}
+
+		if request.TargetUrl != "" {
+			status.TargetURL = ghapi.Ptr(request.TargetUrl)
+		}
+
+		log.Debugf("Creating commit status: %s on SHA: %s", request.Context, sha)
+
+		res, err := s.ghCheckAdapter.CreateCommitStatus(ctx, request.GetOwner(), request.GetRepo(), sha, status)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create commit status: %w", err)
+		}
+
+		return &CreateCommitStatusResponse{
+			StatusId: strconv.FormatInt(res.GetID(), 10),
+			Sha:      sha,
+		}, nil
+	}()
+
+	var record audit.Record
+	if r != nil {
+		record.Action = auditActionCreated
+		record.ResourceID = r.StatusId
+	}
+
+	s.recordAudit(ctx, auditOperationCreateCommitStatus, request, record, err)
+
+	if err != nil {
+		log.Errorf("failed to execute service: %s", err)
+		failedServiceExecutionMetric.Inc()
+		return nil, classifyError(err)
+	}
+
+	successfulServiceExecutionMetric.Inc()
+	return r, nil
+}
+
+// resolvePullRequestCommit returns the commit of the open pull request for the request.
+// This is the head commit unless a commit is requested, which must be a commit of the
+// pull request. This prevents the service from being used to mark arbitrary commits.
+func (s *gitHubCommentProxyService) resolvePullRequestCommit(ctx context.Context,
+	request pullRequestCommit) (string, error) {
+	prNumber, err := strconv.Atoi(request.GetPrNumber())
+	if err != nil {
+		return "", fmt.Errorf("failed to convert pr number to int: %w", err)
+	}
+
+	pr, err := s.ghRepoAdapter.GetPullRequest(ctx, request.GetOwner(), request.GetRepo(), prNumber)
+	if err != nil {
+		return "", fmt.Errorf("failed to get pull request: %w", err)
+	}
+
+	if pr.GetState() != "open" {
+		return "", newError(ErrorCodeFailedPrecondition, ErrorReasonPullRequestClosed,
+			fmt.Errorf("pull request is not open: %s", pr.GetState()))
+	}
+
+	headSHA := pr.GetHead().GetSHA()
+	if request.GetSha() == "" || strings.EqualFold(request.GetSha(), headSHA) {
+		return headSHA, nil
+	}
+
+	commits, err := s.ghPullRequestAdapter.ListPullRequestCommits(ctx, request.GetOwner(),
+		request.GetRepo(), prNumber)
+	if err != nil {
+		return "", fmt.Errorf("failed to list pull request commits: %w", err)
+	}
+
+	for _, commit := range commits {
+		if strings.EqualFold(commit.GetSHA(), request.GetSha()) {
+			return commit.GetSHA(), nil
+		}
+	}
+
+	return "", newError(ErrorCodeInvalidArgument, ErrorReasonCommitNotInPullRequest,
+		fmt.Errorf("commit %s is not part of PR: %d", request.GetSha(), prNumber))
+}
+
+func oneOf(value string, values []string) bool {
+	for _, v := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
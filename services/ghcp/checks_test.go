@@ -0,0 +1,421 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	testHeadSHA   = strings.Repeat("a", 40)
+	testCommitSHA = strings.Repeat("b", 40)
+	testOtherSHA  = strings.Repeat("c", 40)
+)
+
+func TestCreateCheckRunRequestValidate(t *testing.T) {
+	request := func(fn func(*CreateCheckRunRequest)) *CreateCheckRunRequest {
+		r := &CreateCheckRunRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", Name: "ghcp/vet"}
+		fn(r)
+		return r
+	}
+
+	cases := []struct {
+		name    string
+		request *CreateCheckRunRequest
+		err     string
+	}{
+		{
+			name:    "valid request",
+			request: request(func(r *CreateCheckRunRequest) {}),
+		},
+		{
+			name: "valid completed request with annotations",
+			request: request(func(r *CreateCheckRunRequest) {
+				r.Status, r.Conclusion, r.Summary = "completed", "failure", "1 issue"
+				r.Annotations = []*CheckRunAnnotation{
+					{Path: "go.mod", StartLine: 3, EndLine: 3, AnnotationLevel: "failure", Message: "vulnerable"},
+				}
+			}),
+		},
+		{
+			name:    "short sha",
+			request: request(func(r *CreateCheckRunRequest) { r.Sha = "abc" }),
+			err:     "sha must be a full commit SHA",
+		},
+		{
+			name:    "missing name",
+			request: request(func(r *CreateCheckRunRequest) { r.Name = "" }),
+			err:     "name is required",
+		},
+		{
+			name:    "completed without conclusion",
+			request: request(func(r *CreateCheckRunRequest) { r.Status = "completed" }),
+			err:     "conclusion is required if and only if status is completed",
+		},
+		{
+			name:    "unknown conclusion",
+			request: request(func(r *CreateCheckRunRequest) { r.Status, r.Conclusion = "completed", "passed" }),
+			err:     "conclusion must be one of",
+		},
+		{
+			name:    "annotations without summary",
+			request: request(func(r *CreateCheckRunRequest) { r.Annotations = []*CheckRunAnnotation{{}} }),
+			err:     "summary is required with title, text or annotations",
+		},
+		{
+			name: "annotation with unknown level",
+			request: request(func(r *CreateCheckRunRequest) {
+				r.Summary = "1 issue"
+				r.Annotations = []*CheckRunAnnotation{
+					{Path: "go.mod", StartLine: 3, EndLine: 3, AnnotationLevel: "error", Message: "vulnerable"},
+				}
+			}),
+			err: "invalid annotation 0: annotation_level must be one of",
+		},
+		{
+			name: "too many annotations",
+			request: request(func(r *CreateCheckRunRequest) {
+				r.Summary = "many issues"
+				r.Annotations = make([]*CheckRunAnnotation, maxCheckRunAnnotations+1)
+			}),
+			err: "at most 50 annotations are allowed",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.request.Validate()
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCreateCheckRun(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		Repository:      "safedep/ghcp",
+		RepositoryOwner: "safedep",
+		Audience:        []string{GitHubTokenAudienceName},
+		TokenType:       gh.TokenTypeWorkloadIdentity,
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+		EnableChecks:         true,
+		CheckNamespace:       DefaultCheckNamespace,
+	}
+
+	app := &github.GitHubAppIdentity{AppID: 7, Slug: "safedep"}
+
+	request := func(sha string) *CreateCheckRunRequest {
+		return &CreateCheckRunRequest{
+			Owner:      "safedep",
+			Repo:       "ghcp",
+			PrNumber:   "1",
+			Sha:        sha,
+			Name:       "ghcp/vet",
+			Status:     "completed",
+			Conclusion: "failure",
+			Summary:    "1 issue",
+			Annotations: []*CheckRunAnnotation{
+				{Path: "go.mod", StartLine: 3, EndLine: 3, AnnotationLevel: "failure", Message: "vulnerable"},
+			},
+		}
+	}
+
+	output := &ghapi.CheckRunOutput{
+		Title:   ghapi.Ptr("ghcp/vet"),
+		Summary: ghapi.Ptr("1 issue"),
+		Annotations: []*ghapi.CheckRunAnnotation{
+			{
+				Path: ghapi.Ptr("go.mod"), StartLine: ghapi.Ptr(3), EndLine: ghapi.Ptr(3),
+				AnnotationLevel: ghapi.Ptr("failure"), Message: ghapi.Ptr("vulnerable"),
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		request  *CreateCheckRunRequest
+		app      *github.GitHubAppIdentity
+		state    string
+		commits  []string
+		existing []*ghapi.CheckRun
+		sha      string
+		updated  bool
+		err      string
+		code     ErrorCode
+	}{
+		{
+			name:    "create check run on the head commit",
+			request: request(""),
+			app:     app,
+			state:   "open",
+			sha:     testHeadSHA,
+		},
+		{
+			name:    "create check run on a commit of the pull request",
+			request: request(testCommitSHA),
+			app:     app,
+			state:   "open",
+			commits: []string{testCommitSHA, testHeadSHA},
+			sha:     testCommitSHA,
+		},
+		{
+			name:     "update existing check run",
+			request:  request(testHeadSHA),
+			app:      app,
+			state:    "open",
+			existing: []*ghapi.CheckRun{{ID: ghapi.Ptr(int64(20))}},
+			sha:      testHeadSHA,
+			updated:  true,
+		},
+		{
+			name:    "create check run fails for a commit not in the pull request",
+			request: request(testOtherSHA),
+			app:     app,
+			state:   "open",
+			commits: []string{testCommitSHA, testHeadSHA},
+			err:     "commit " + testOtherSHA + " is not part of PR: 1",
+			code:    ErrorCodeInvalidArgument,
+		},
+		{
+			name:    "create check run fails when the pull request is not open",
+			request: request(""),
+			app:     app,
+			state:   "closed",
+			err:     "pull request is not open: closed",
+			code:    ErrorCodeFailedPrecondition,
+		},
+		{
+			name:    "create check run fails without GitHub App",
+			request: request(""),
+			err:     "check runs require the GitHub App to be installed on the repository",
+			code:    ErrorCodeFailedPrecondition,
+		},
+		{
+			name: "create check run fails for a name outside the namespace",
+			request: func() *CreateCheckRunRequest {
+				r := request("")
+				r.Name = "ci/build"
+				return r
+			}(),
+			err:  `check name must start with "ghcp/"`,
+			code: ErrorCodeInvalidArgument,
+		},
+		{
+			name: "create check run fails for the namespace as name",
+			request: func() *CreateCheckRunRequest {
+				r := request("")
+				r.Name = "ghcp/"
+				return r
+			}(),
+			err:  `check name must start with "ghcp/"`,
+			code: ErrorCodeInvalidArgument,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+			ghPullRequestAdapter := github.NewMockGitHubPullRequestAdapter(t)
+			ghCheckAdapter := github.NewMockGitHubCheckAdapter(t)
+
+			ghIssueAdapter.EXPECT().GetAppIdentity(mock.Anything, "safedep", "ghcp").Return(c.app, nil).Maybe()
+
+			if c.state != "" {
+				ghRepoAdapter.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+					Return(&ghapi.PullRequest{State: ghapi.Ptr(c.state), Head: &ghapi.PullRequestBranch{SHA: ghapi.Ptr(testHeadSHA)}}, nil)
+			}
+
+			if c.commits != nil {
+				commits := []*ghapi.RepositoryCommit{}
+				for _, sha := range c.commits {
+					commits = append(commits, &ghapi.RepositoryCommit{SHA: ghapi.Ptr(sha)})
+				}
+
+				ghPullRequestAdapter.EXPECT().ListPullRequestCommits(mock.Anything, "safedep", "ghcp", 1).
+					Return(commits, nil)
+			}
+
+			if c.sha != "" {
+				ghCheckAdapter.EXPECT().ListCheckRuns(mock.Anything, "safedep", "ghcp", c.sha, "ghcp/vet", int64(7)).
+					Return(c.existing, nil)
+			}
+
+			if c.sha != "" && c.updated {
+				ghCheckAdapter.EXPECT().UpdateCheckRun(mock.Anything, "safedep", "ghcp", int64(20), ghapi.UpdateCheckRunOptions{
+					Name:       "ghcp/vet",
+					Status:     ghapi.Ptr("completed"),
+					Conclusion: ghapi.Ptr("failure"),
+					Output:     output,
+				}).Return(&ghapi.CheckRun{ID: ghapi.Ptr(int64(20))}, nil)
+			} else if c.sha != "" {
+				ghCheckAdapter.EXPECT().CreateCheckRun(mock.Anything, "safedep", "ghcp", ghapi.CreateCheckRunOptions{
+					Name:       "ghcp/vet",
+					HeadSHA:    c.sha,
+					Status:     ghapi.Ptr("completed"),
+					Conclusion: ghapi.Ptr("failure"),
+					Output:     output,
+				}).Return(&ghapi.CheckRun{ID: ghapi.Ptr(int64(20))}, nil)
+			}
+
+			service, err := NewGitHubCommentProxyService(config, ghIssueAdapter,
+				ghRepoAdapter, ghPullRequestAdapter, ghCheckAdapter)
+			assert.NoError(t, err)
+
+			ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+			res, err := service.CreateCheckRun(ctx, c.request)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				assert.Nil(t, res)
+
+				var serviceErr *Error
+				assert.True(t, errors.As(err, &serviceErr))
+				assert.Equal(t, c.code, serviceErr.Code)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "20", res.CheckRunId)
+			assert.Equal(t, c.sha, res.Sha)
+			assert.Equal(t, c.updated, res.Updated)
+		})
+	}
+}
+
+func TestCreateCommitStatus(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		Repository:      "safedep/ghcp",
+		RepositoryOwner: "safedep",
+		Audience:        []string{GitHubTokenAudienceName},
+		TokenType:       gh.TokenTypeWorkloadIdentity,
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+		EnableChecks:         true,
+		CheckNamespace:       DefaultCheckNamespace,
+	}
+
+	cases := []struct {
+		name    string
+		request *CreateCommitStatusRequest
+		state   string
+		sha     string
+		err     string
+	}{
+		{
+			name: "create commit status on the head commit",
+			request: &CreateCommitStatusRequest{
+				Owner: "safedep", Repo: "ghcp", PrNumber: "1",
+				State: "success", Context: "ghcp/vet", Description: "no issues",
+			},
+			state: "open",
+			sha:   testHeadSHA,
+		},
+		{
+			name: "create commit status fails with unknown state",
+			request: &CreateCommitStatusRequest{
+				Owner: "safedep", Repo: "ghcp", PrNumber: "1", State: "passed", Context: "ghcp/vet",
+			},
+			err: "state must be one of",
+		},
+		{
+			name: "create commit status fails with long description",
+			request: &CreateCommitStatusRequest{
+				Owner: "safedep", Repo: "ghcp", PrNumber: "1", State: "success", Context: "ghcp/vet",
+				Description: strings.Repeat("a", maxCommitStatusDescriptionLength+1),
+			},
+			err: "description must be at most 140 characters",
+		},
+		{
+			name: "create commit status fails when the token is for another repository",
+			request: &CreateCommitStatusRequest{
+				Owner: "other", Repo: "ghcp", PrNumber: "1", State: "success", Context: "ghcp/vet",
+			},
+			err: "repository owner mismatch",
+		},
+		{
+			name: "create commit status fails for a context outside the namespace",
+			request: &CreateCommitStatusRequest{
+				Owner: "safedep", Repo: "ghcp", PrNumber: "1", State: "success", Context: "ci/build",
+			},
+			err: `check name must start with "ghcp/"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+			ghCheckAdapter := github.NewMockGitHubCheckAdapter(t)
+
+			if c.state != "" {
+				ghRepoAdapter.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+					Return(&ghapi.PullRequest{State: ghapi.Ptr(c.state), Head: &ghapi.PullRequestBranch{SHA: ghapi.Ptr(testHeadSHA)}}, nil)
+			}
+
+			if c.sha != "" {
+				ghCheckAdapter.EXPECT().CreateCommitStatus(mock.Anything, "safedep", "ghcp", c.sha, &ghapi.RepoStatus{
+					State:       ghapi.Ptr(c.request.State),
+					Context:     ghapi.Ptr(c.request.Context),
+					Description: ghapi.Ptr(c.request.Description),
+				}).Return(&ghapi.RepoStatus{ID: ghapi.Ptr(int64(30))}, nil)
+			}
+
+			service, err := NewGitHubCommentProxyService(config, github.NewMockGitHubIssueAdapter(t),
+				ghRepoAdapter, github.NewMockGitHubPullRequestAdapter(t), ghCheckAdapter)
+			assert.NoError(t, err)
+
+			ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+			res, err := service.CreateCommitStatus(ctx, c.request)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				assert.Nil(t, res)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "30", res.StatusId)
+			assert.Equal(t, c.sha, res.Sha)
+		})
+	}
+}
+
+func TestChecksAreOptIn(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		Repository:      "safedep/ghcp",
+		RepositoryOwner: "safedep",
+		Audience:        []string{GitHubTokenAudienceName},
+		TokenType:       gh.TokenTypeWorkloadIdentity,
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+		CheckNamespace:       DefaultCheckNamespace,
+	}
+
+	service, err := NewGitHubCommentProxyService(config, github.NewMockGitHubIssueAdapter(t),
+		github.NewMockGitHubRepositoryAdapter(t), github.NewMockGitHubPullRequestAdapter(t),
+		github.NewMockGitHubCheckAdapter(t))
+	assert.NoError(t, err)
+
+	ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+	_, err = service.CreateCommitStatus(ctx, &CreateCommitStatusRequest{
+		Owner: "safedep", Repo: "ghcp", PrNumber: "1", State: "success", Context: "ghcp/vet",
+	})
+
+	assert.ErrorContains(t, err, "checks are disabled for the repository")
+}
@@ -0,0 +1,289 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/audit"
+	"github.com/safedep/ghcp/pkg/gh"
+)
+
+// DeletePullRequestCommentRequest is the request to delete a comment created by
+// the bot on a pull request. The comment is identified by its tag or its ID.
+type DeletePullRequestCommentRequest struct {
+	Owner     string `json:"owner"`
+	Repo      string `json:"repo"`
+	PrNumber  string `json:"prNumber"`
+	Tag       string `json:"tag,omitempty"`
+	CommentId string `json:"commentId,omitempty"`
+}
+
+func (r *DeletePullRequestCommentRequest) GetOwner() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Owner
+}
+
+func (r *DeletePullRequestCommentRequest) GetRepo() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Repo
+}
+
+func (r *DeletePullRequestCommentRequest) GetPrNumber() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.PrNumber
+}
+
+func (r *DeletePullRequestCommentRequest) GetTag() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Tag
+}
+
+func (r *DeletePullRequestCommentRequest) GetCommentId() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.CommentId
+}
+
+// Validate validates the request
+func (r *DeletePullRequestCommentRequest) Validate() error {
+	if r.GetOwner() == "" {
+		return errors.New("owner is required")
+	}
+
+	if r.GetRepo() == "" {
+		return errors.New("repo is required")
+	}
+
+	if n, err := strconv.Atoi(r.GetPrNumber()); err != nil || n <= 0 {
+		return errors.New("pr_number must be a positive number")
+	}
+
+	if (r.GetTag() == "") == (r.GetCommentId() == "") {
+		return errors.New("exactly one of tag or comment_id is required")
+	}
+
+	if r.GetCommentId() != "" {
+		if n, err := strconv.ParseInt(r.GetCommentId(), 10, 64); err != nil || n <= 0 {
+			return errors.New("comment_id must be a positive number")
+		}
+	}
+
+	return nil
+}
+
+// DeletePullRequestCommentResponse is the response with the ID of the deleted comment
+type DeletePullRequestCommentResponse struct {
+	CommentId string `json:"commentId"`
+}
+
+func (r *DeletePullRequestCommentResponse) GetCommentId() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.CommentId
+}
+
+// DeletePullRequestComment deletes a comment created by the bot on the pull request.
+// The request is authorized the same way as creating a comment.
+func (s *gitHubCommentProxyService) DeletePullRequestComment(ctx context.Context,
+	request *DeletePullRequestCommentRequest) (*DeletePullRequestCommentResponse, error) {
+	r, err := func() (*DeletePullRequestCommentResponse, error) {
+		if err := request.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+
+		config, tokenContext, err := s.authorize(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		prNumber, err := strconv.Atoi(request.GetPrNumber())
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert pr number to int: %w", err)
+		}
+
+		unlock, err := s.lockPullRequest(ctx, config, request)
+		if err != nil {
+			return nil, err
+		}
+
+		defer unlock()
+
+		deleteCommentMetric.Inc()
+
+		bot, err := s.resolveBotIdentity(ctx, config, request.GetOwner(), request.GetRepo())
+		if err != nil {
+			return nil, err
+		}
+
+		var comment *ghapi.IssueComment
+		if request.GetTag() != "" {
+			comment, err = s.findCommentForDeleteByTag(ctx, config, tokenContext, bot, prNumber, request)
+		} else {
+			comment, err = s.findCommentForDeleteById(ctx, config, tokenContext, bot, prNumber, request)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debugf("Deleting commentId: %d on PR: %s", comment.GetID(), request.GetPrNumber())
+
+		err = s.ghIssueAdapter.DeleteIssueComment(ctx, request.GetOwner(), request.GetRepo(), int(comment.GetID()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete issue comment: %w", err)
+		}
+
+		return &DeletePullRequestCommentResponse{
+			CommentId: strconv.FormatInt(comment.GetID(), 10),
+		}, nil
+	}()
+
+	record := audit.Record{Tag: request.GetTag()}
+	if r != nil {
+		record.Action = auditActionDeleted
+		record.ResourceID = r.CommentId
+	}
+
+	s.recordAudit(ctx, auditOperationDeleteComment, request, record, err)
+
+	if err != nil {
+		log.Errorf("failed to execute service: %s", err)
+		failedServiceExecutionMetric.Inc()
+		return nil, classifyError(err)
+	}
+
+	successfulServiceExecutionMetric.Inc()
+	return r, nil
+}
+
+// findCommentForDeleteByTag returns the comment by the bot matching the tag using
+// the same rules as updating a tagged comment
+func (s *gitHubCommentProxyService) findCommentForDeleteByTag(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, tokenContext gh.GitHubTokenContext, bot botIdentity,
+	prNumber int, request *DeletePullRequestCommentRequest) (*ghapi.IssueComment, error) {
+	if err := verifyWorkflowIdentity(config, tokenContext); err != nil {
+		return nil, err
+	}
+
+	marker, err := s.newTagMarker(ctx, config, tokenContext, request.GetOwner(), request.GetRepo(),
+		prNumber, request.GetTag())
+	if err != nil {
+		return nil, err
+	}
+
+	var comment *ghapi.IssueComment
+	var comments []*ghapi.IssueComment
+	err = s.ghIssueAdapter.WalkIssueComments(ctx, request.GetOwner(), request.GetRepo(), prNumber,
+		func(c *ghapi.IssueComment) bool {
+			if s.isTaggedComment(config, bot, c, marker) {
+				comment = c
+				return false
+			}
+
+			comments = append(comments, c)
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list issue comments: %w", err)
+	}
+
+	if comment == nil && config.LegacyTagMatching {
+		comment, err = s.findLegacyTaggedComment(config, bot, comments, marker)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if comment == nil {
+		return nil, newError(ErrorCodeNotFound, ErrorReasonTagNotFound,
+			fmt.Errorf("no comment found with Tag: %s", request.GetTag()))
+	}
+
+	// Legacy matching allows comments by other users when updates of
+	// such comments are allowed. Deletes are always limited to the bot.
+	if !bot.isAuthorOf(comment) {
+		return nil, newError(ErrorCodePermissionDenied, ErrorReasonCommentNotOwnedByBot,
+			errors.New("refusing to delete comment created by another user"))
+	}
+
+	return comment, nil
+}
+
+// findCommentForDeleteById returns the comment with the ID on the pull request. The
+// comment must be on the pull request and created by the bot. When workflow identity
+// is required, the comment must have a marker signed for the workflow.
+func (s *gitHubCommentProxyService) findCommentForDeleteById(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, tokenContext gh.GitHubTokenContext, bot botIdentity,
+	prNumber int, request *DeletePullRequestCommentRequest) (*ghapi.IssueComment, error) {
+	commentId, err := strconv.ParseInt(request.GetCommentId(), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert comment id to int: %w", err)
+	}
+
+	var comment *ghapi.IssueComment
+	err = s.ghIssueAdapter.WalkIssueComments(ctx, request.GetOwner(), request.GetRepo(), prNumber,
+		func(c *ghapi.IssueComment) bool {
+			if c.GetID() == commentId {
+				comment = c
+				return false
+			}
+
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list issue comments: %w", err)
+	}
+
+	if comment == nil {
+		return nil, newError(ErrorCodeNotFound, ErrorReasonCommentNotFound,
+			fmt.Errorf("no comment found with ID: %d on PR: %d", commentId, prNumber))
+	}
+
+	if !bot.isAuthorOf(comment) {
+		return nil, newError(ErrorCodePermissionDenied, ErrorReasonCommentNotOwnedByBot,
+			errors.New("refusing to delete comment created by another user"))
+	}
+
+	if !config.RequireMatchingWorkflowIdentity {
+		return comment, nil
+	}
+
+	if err := verifyWorkflowIdentity(config, tokenContext); err != nil {
+		return nil, err
+	}
+
+	expected, err := s.newTagMarker(ctx, config, tokenContext, request.GetOwner(), request.GetRepo(), prNumber, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, marker := range parseTagMarkers(comment.GetBody()) {
+		expected.Tag = marker.Tag
+		if s.matchesTagMarker(config, marker, expected) {
+			return comment, nil
+		}
+	}
+
+	return nil, newError(ErrorCodePermissionDenied, ErrorReasonCommentNotOwnedByBot,
+		errors.New("refusing to delete comment created by another workflow"))
+}
@@ -0,0 +1,238 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDeletePullRequestComment(t *testing.T) {
+	signingKey := []byte("0123456789abcdef0123456789abcdef")
+	signer := tagMarkerSigner{key: signingKey}
+
+	token := gh.GitHubTokenContext{
+		Repository:      "safedep/ghcp",
+		RepositoryID:    "100",
+		RepositoryOwner: "safedep",
+		Audience:        []string{GitHubTokenAudienceName},
+		TokenType:       gh.TokenTypeWorkloadIdentity,
+		WorkflowRef:     "safedep/ghcp/.github/workflows/vet.yml@refs/pull/1/merge",
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		BotUsername:          "safedep-bot",
+		GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+	}
+
+	botComment := func(id int64, body string) *ghapi.IssueComment {
+		return &ghapi.IssueComment{ID: proto.Int64(id), Body: proto.String(body),
+			User: &ghapi.User{Login: proto.String("safedep-bot")}}
+	}
+
+	userComment := func(id int64, body string) *ghapi.IssueComment {
+		return &ghapi.IssueComment{ID: proto.Int64(id), Body: proto.String(body),
+			User: &ghapi.User{Login: proto.String("test-user")}}
+	}
+
+	cases := []struct {
+		name      string
+		config    GitHubCommentProxyServiceConfig
+		token     gh.GitHubTokenContext
+		request   *DeletePullRequestCommentRequest
+		comments  []*ghapi.IssueComment
+		commentId int
+		err       string
+		code      ErrorCode
+	}{
+		{
+			name:    "delete comment by tag",
+			config:  config,
+			token:   token,
+			request: &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", Tag: "test-tag"},
+			comments: []*ghapi.IssueComment{
+				userComment(1, withTagMarker("spoofed", "test-tag")),
+				botComment(2, withTagMarker("test comment", "test-tag")),
+			},
+			commentId: 2,
+		},
+		{
+			name:    "delete comment by tag fails when no comment by the bot has the tag",
+			config:  config,
+			token:   token,
+			request: &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", Tag: "test-tag"},
+			comments: []*ghapi.IssueComment{
+				userComment(1, withTagMarker("spoofed", "test-tag")),
+				botComment(2, withTagMarker("test comment", "test-tag-2")),
+			},
+			err: "no comment found with Tag: test-tag",
+		},
+		{
+			name: "delete comment by tag fails for legacy comment by another user",
+			config: GitHubCommentProxyServiceConfig{
+				BotUsername:          "safedep-bot",
+				LegacyTagMatching:    true,
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			},
+			token:    token,
+			request:  &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", Tag: "test-tag"},
+			comments: []*ghapi.IssueComment{userComment(1, "test comment with tag: test-tag")},
+			err:      "refusing to delete comment created by another user",
+			code:     ErrorCodePermissionDenied,
+		},
+		{
+			name:      "delete comment by id",
+			config:    config,
+			token:     token,
+			request:   &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", CommentId: "2"},
+			comments:  []*ghapi.IssueComment{botComment(1, "test comment 1"), botComment(2, "test comment 2")},
+			commentId: 2,
+		},
+		{
+			name:     "delete comment by id fails when the comment is by another user",
+			config:   config,
+			token:    token,
+			request:  &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", CommentId: "1"},
+			comments: []*ghapi.IssueComment{userComment(1, "test comment")},
+			err:      "refusing to delete comment created by another user",
+			code:     ErrorCodePermissionDenied,
+		},
+		{
+			name:     "delete comment by id fails when the comment is not on the pull request",
+			config:   config,
+			token:    token,
+			request:  &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", CommentId: "3"},
+			comments: []*ghapi.IssueComment{botComment(1, "test comment")},
+			err:      "no comment found with ID: 3 on PR: 1",
+		},
+		{
+			name: "delete comment by id fails when the comment is by another workflow",
+			config: GitHubCommentProxyServiceConfig{
+				BotUsername:                     "safedep-bot",
+				CommentSigningKey:               signingKey,
+				RequireMatchingWorkflowIdentity: true,
+				GitHubTokenAudiences:            []string{GitHubTokenAudienceName},
+			},
+			token:   token,
+			request: &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", CommentId: "1"},
+			comments: []*ghapi.IssueComment{botComment(1, signer.sign(tagMarker{
+				Tag:          "test-tag",
+				RepositoryID: "100",
+				PullRequest:  "1",
+				Workflow:     "safedep/ghcp/.github/workflows/other.yml",
+			}).withMarker("test comment"))},
+			err:  "refusing to delete comment created by another workflow",
+			code: ErrorCodePermissionDenied,
+		},
+		{
+			name: "delete comment by id when the comment is by the same workflow",
+			config: GitHubCommentProxyServiceConfig{
+				BotUsername:                     "safedep-bot",
+				CommentSigningKey:               signingKey,
+				RequireMatchingWorkflowIdentity: true,
+				GitHubTokenAudiences:            []string{GitHubTokenAudienceName},
+			},
+			token:   token,
+			request: &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", CommentId: "1"},
+			comments: []*ghapi.IssueComment{botComment(1, signer.sign(tagMarker{
+				Tag:          "test-tag",
+				RepositoryID: "100",
+				PullRequest:  "1",
+				Workflow:     "safedep/ghcp/.github/workflows/vet.yml",
+			}).withMarker("test comment"))},
+			commentId: 1,
+		},
+		{
+			name: "delete untagged comment by id when the comment is by the same workflow",
+			config: GitHubCommentProxyServiceConfig{
+				BotUsername:                     "safedep-bot",
+				CommentSigningKey:               signingKey,
+				RequireMatchingWorkflowIdentity: true,
+				GitHubTokenAudiences:            []string{GitHubTokenAudienceName},
+			},
+			token:   token,
+			request: &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", CommentId: "1"},
+			comments: []*ghapi.IssueComment{botComment(1, signer.sign(tagMarker{
+				RepositoryID: "100",
+				PullRequest:  "1",
+				Workflow:     "safedep/ghcp/.github/workflows/vet.yml",
+			}).withMarker("test comment"))},
+			commentId: 1,
+		},
+		{
+			name: "delete comment by id fails when the comment is for another pull request",
+			config: GitHubCommentProxyServiceConfig{
+				BotUsername:                     "safedep-bot",
+				CommentSigningKey:               signingKey,
+				RequireMatchingWorkflowIdentity: true,
+				GitHubTokenAudiences:            []string{GitHubTokenAudienceName},
+			},
+			token:   token,
+			request: &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", CommentId: "1"},
+			comments: []*ghapi.IssueComment{botComment(1, signer.sign(tagMarker{
+				Tag:          "test-tag",
+				RepositoryID: "100",
+				PullRequest:  "2",
+				Workflow:     "safedep/ghcp/.github/workflows/vet.yml",
+			}).withMarker("test comment"))},
+			err:  "refusing to delete comment created by another workflow",
+			code: ErrorCodePermissionDenied,
+		},
+		{
+			name:    "delete comment fails when both tag and comment id are provided",
+			config:  config,
+			token:   token,
+			request: &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", Tag: "test-tag", CommentId: "1"},
+			err:     "exactly one of tag or comment_id is required",
+		},
+		{
+			name:    "delete comment fails when the token is for another repository",
+			config:  config,
+			token:   token,
+			request: &DeletePullRequestCommentRequest{Owner: "safedep", Repo: "vet", PrNumber: "1", Tag: "test-tag"},
+			err:     "repository mismatch",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			if c.comments != nil {
+				expectWalkIssueComments(ghIssueAdapter, c.comments)
+			}
+
+			if c.commentId != 0 {
+				ghIssueAdapter.EXPECT().DeleteIssueComment(mock.Anything, "safedep", "ghcp", c.commentId).Return(nil)
+			}
+
+			service, err := NewGitHubCommentProxyService(c.config, ghIssueAdapter,
+				github.NewMockGitHubRepositoryAdapter(t), github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			ctx := gh.InjectGitHubTokenContext(context.Background(), c.token)
+			res, err := service.DeletePullRequestComment(ctx, c.request)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				assert.Nil(t, res)
+
+				if c.code != "" {
+					var serviceErr *Error
+					assert.True(t, errors.As(err, &serviceErr))
+					assert.Equal(t, c.code, serviceErr.Code)
+					assert.Equal(t, ErrorReasonCommentNotOwnedByBot, serviceErr.Reason)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, strconv.Itoa(c.commentId), res.GetCommentId())
+		})
+	}
+}
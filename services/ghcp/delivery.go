@@ -0,0 +1,524 @@
+package ghcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/audit"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/safedep/ghcp/pkg/queue"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// Number of workers delivering the jobs
+	DefaultDeliveryWorkers = 2
+
+	// Number of attempts to deliver a job before it is failed
+	DefaultDeliveryMaxAttempts = 10
+
+	// Kind of the jobs creating or updating a comment
+	deliveryJobKindComment = "create_comment"
+
+	// Longest an attempt runs. The lease is longer so that a job is not
+	// claimed again while it is being delivered.
+	deliveryAttemptTimeout = time.Minute
+	deliveryLease          = 2 * deliveryAttemptTimeout
+)
+
+// DeliveryWorkerConfig holds the settings of the workers delivering the
+// jobs. Attempts are delayed exponentially from the minimum to the maximum
+// backoff unless GitHub asks to retry after a given time.
+type DeliveryWorkerConfig struct {
+	Workers      int
+	MaxAttempts  int
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+}
+
+// DefaultDeliveryWorkerConfig returns the default settings of the delivery workers
+func DefaultDeliveryWorkerConfig() DeliveryWorkerConfig {
+	return DeliveryWorkerConfig{
+		Workers:      DefaultDeliveryWorkers,
+		MaxAttempts:  DefaultDeliveryMaxAttempts,
+		MinBackoff:   2 * time.Second,
+		MaxBackoff:   10 * time.Minute,
+		PollInterval: time.Second,
+	}
+}
+
+type asyncDeliveryContextKey struct{}
+
+// InjectAsyncDelivery returns a context requesting the comment to be delivered asynchronously
+func InjectAsyncDelivery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, asyncDeliveryContextKey{}, true)
+}
+
+// AsyncDeliveryRequested returns true when the client requested asynchronous delivery
+func AsyncDeliveryRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(asyncDeliveryContextKey{}).(bool)
+	return requested
+}
+
+// commentDeliveryJob is the payload of a job creating or updating a comment. The
+// token context is retained to apply the policies of the caller on delivery.
+type commentDeliveryJob struct {
+	Request      json.RawMessage        `json:"request"`
+	TokenContext *gh.GitHubTokenContext `json:"tokenContext,omitempty"`
+}
+
+// commentDeliveryResult is the result of a job delivered
+type commentDeliveryResult struct {
+	CommentId string        `json:"commentId"`
+	Action    CommentAction `json:"action"`
+	Receipt   string        `json:"receipt,omitempty"`
+}
+
+// SetDeliveryQueue sets the queue of the comments delivered asynchronously, which
+// is disabled by default. It must be called before the service handles requests.
+func (s *gitHubCommentProxyService) SetDeliveryQueue(q queue.Queue) {
+	s.deliveryQueue = q
+}
+
+// enqueuePullRequestComment persists the authorized request to be delivered by the workers
+func (s *gitHubCommentProxyService) enqueuePullRequestComment(ctx context.Context,
+	request *ghcpv1.CreatePullRequestCommentRequest) (*PullRequestCommentResult, error) {
+	data, err := protojson.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	payload := commentDeliveryJob{Request: data}
+	if tokenContext, err := gh.ExtractGitHubTokenContext(ctx); err == nil {
+		payload.TokenContext = &tokenContext
+	}
+
+	data, err = json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal delivery job: %w", err)
+	}
+
+	// The job is persisted even when the client has gone away
+	job, err := s.deliveryQueue.Enqueue(context.WithoutCancel(ctx), deliveryJobKindComment, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue delivery job: %w", err)
+	}
+
+	deliveryEnqueuedMetric.Inc()
+	s.updateDeliveryQueueDepth(ctx)
+
+	log.Debugf("Queued comment on PR: %s as job: %s", request.GetPrNumber(), job.ID)
+
+	return &PullRequestCommentResult{
+		Response: &ghcpv1.CreatePullRequestCommentResponse{},
+		Action:   CommentActionQueued,
+		JobID:    job.ID,
+	}, nil
+}
+
+// RunDeliveryWorkers delivers the queued jobs until the context is done
+func (s *gitHubCommentProxyService) RunDeliveryWorkers(ctx context.Context, config DeliveryWorkerConfig) {
+	s.updateDeliveryQueueDepth(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runDeliveryWorker(ctx, config)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (s *gitHubCommentProxyService) runDeliveryWorker(ctx context.Context, config DeliveryWorkerConfig) {
+	for {
+		job, claimed, err := s.deliveryQueue.Claim(ctx, deliveryLease, config.MaxAttempts)
+		if err != nil {
+			log.Errorf("failed to claim delivery job: %s", err)
+		}
+
+		if claimed {
+			s.deliverJob(ctx, config, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(config.PollInterval):
+		}
+	}
+}
+
+// deliverJob makes an attempt to deliver the job. Failures GitHub may recover
+// from are retried until the job runs out of attempts.
+func (s *gitHubCommentProxyService) deliverJob(ctx context.Context, config DeliveryWorkerConfig, job queue.Job) {
+	// An attempt is not interrupted when the workers are stopped
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deliveryAttemptTimeout)
+	defer cancel()
+
+	defer s.updateDeliveryQueueDepth(ctx)
+
+	var payload commentDeliveryJob
+	request := &ghcpv1.CreatePullRequestCommentRequest{}
+
+	err := json.Unmarshal(job.Payload, &payload)
+	if err == nil {
+		err = protojson.Unmarshal(payload.Request, request)
+	}
+
+	if err != nil || job.Kind != deliveryJobKindComment {
+		deliveryAttemptMetric.WithLabels(map[string]string{"result": "failed"}).Inc()
+		log.Errorf("failed to read delivery job %s of kind %s: %v", job.ID, job.Kind, err)
+
+		if err := s.deliveryQueue.Fail(ctx, job.ID, "invalid job"); err != nil {
+			log.Errorf("failed to update delivery job: %s", err)
+		}
+
+		return
+	}
+
+	if payload.TokenContext != nil {
+		ctx = gh.InjectGitHubTokenContext(ctx, *payload.TokenContext)
+	}
+
+	r, err := s.deliverPullRequestComment(ctx, request)
+	if err == nil {
+		s.completeDeliveryJob(ctx, job, request, r)
+		return
+	}
+
+	delay, retryable := deliveryRetryDelay(err, job.Attempts, config)
+	if retryable && job.Attempts < config.MaxAttempts {
+		deliveryAttemptMetric.WithLabels(map[string]string{"result": "retried"}).Inc()
+		log.Warnf("Failed to deliver job %s on attempt %d, retrying in %s: %s", job.ID, job.Attempts, delay, err)
+
+		if err := s.deliveryQueue.Retry(ctx, job.ID, time.Now().Add(delay), err.Error()); err != nil {
+			log.Errorf("failed to update delivery job: %s", err)
+		}
+
+		return
+	}
+
+	deliveryAttemptMetric.WithLabels(map[string]string{"result": "failed"}).Inc()
+	log.Errorf("failed to deliver job %s after %d attempts: %s", job.ID, job.Attempts, err)
+
+	if err := s.deliveryQueue.Fail(ctx, job.ID, err.Error()); err != nil {
+		log.Errorf("failed to update delivery job: %s", err)
+	}
+
+	s.recordAudit(ctx, auditOperationDeliverComment, request, audit.Record{
+		Tag:        request.GetTag(),
+		BodySHA256: bodyDigest(request.GetBody()),
+		JobID:      job.ID,
+	}, err)
+}
+
+func (s *gitHubCommentProxyService) completeDeliveryJob(ctx context.Context, job queue.Job,
+	request *ghcpv1.CreatePullRequestCommentRequest, r *PullRequestCommentResult) {
+	if s.receiptSigner != nil {
+		r.Receipt = s.issueReceipt(ctx, request, r)
+	}
+
+	deliveryAttemptMetric.WithLabels(map[string]string{"result": "delivered"}).Inc()
+	deliveryLatencyMetric.Observe(time.Since(job.CreatedAt).Seconds())
+
+	data, err := json.Marshal(commentDeliveryResult{
+		CommentId: r.Response.GetCommentId(),
+		Action:    r.Action,
+		Receipt:   r.Receipt,
+	})
+	if err == nil {
+		err = s.deliveryQueue.Complete(ctx, job.ID, data)
+	}
+
+	// The comment is posted, the job would be delivered again on a retry
+	if err != nil {
+		log.Errorf("failed to complete delivery job %s: %s", job.ID, err)
+	}
+
+	s.recordAudit(ctx, auditOperationDeliverComment, request, audit.Record{
+		Tag:        request.GetTag(),
+		BodySHA256: bodyDigest(request.GetBody()),
+		Action:     string(r.Action),
+		ResourceID: r.Response.GetCommentId(),
+		JobID:      job.ID,
+	}, nil)
+}
+
+// deliverPullRequestComment creates or updates the comment of a job. The policies
+// of the caller are applied again, they may have changed since the job was queued.
+// Rate limits and installation verification are not, the request passed them.
+func (s *gitHubCommentProxyService) deliverPullRequestComment(ctx context.Context,
+	request *ghcpv1.CreatePullRequestCommentRequest) (*PullRequestCommentResult, error) {
+	config := *s.config.Load()
+
+	tokenContext, err := gh.ExtractGitHubTokenContext(ctx)
+	if !config.InsecureSkipAuthorization {
+		if err != nil {
+			return nil, newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+				fmt.Errorf("failed to extract GitHub Workload Identity Token context: %w", err))
+		}
+
+		config, err = s.configForCaller(ctx, config, tokenContext, request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	prNumber, err := strconv.Atoi(request.GetPrNumber())
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert pr number to int: %w", err)
+	}
+
+	unlock, err := s.lockPullRequest(ctx, config, request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	if request.GetTag() == "" {
+		return s.createNewComment(ctx, config, tokenContext, prNumber, request)
+	}
+
+	return s.updateExistingComment(ctx, config, tokenContext, prNumber, request)
+}
+
+// deliveryRetryDelay returns how long to wait before the next attempt and whether
+// the failure can be retried. Requests refused by GitHub or the service are not.
+func deliveryRetryDelay(err error, attempt int, config DeliveryWorkerConfig) (time.Duration, bool) {
+	var waitErr *github.RateLimitWaitError
+	if errors.As(err, &waitErr) {
+		return max(waitErr.RetryAfter, config.MinBackoff), true
+	}
+
+	var rateLimitErr *ghapi.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return max(time.Until(rateLimitErr.Rate.Reset.Time), config.MinBackoff), true
+	}
+
+	var abuseErr *ghapi.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return max(*abuseErr.RetryAfter, config.MinBackoff), true
+		}
+
+		return deliveryBackoff(attempt, config), true
+	}
+
+	var responseErr *ghapi.ErrorResponse
+	if errors.As(err, &responseErr) && responseErr.Response != nil {
+		status := responseErr.Response.StatusCode
+		if status != http.StatusTooManyRequests && status < http.StatusInternalServerError {
+			return 0, false
+		}
+
+		if delay, ok := github.ParseRetryAfter(responseErr.Response.Header.Get("Retry-After"), time.Now()); ok {
+			return max(delay, config.MinBackoff), true
+		}
+
+		return deliveryBackoff(attempt, config), true
+	}
+
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		switch serviceErr.Code {
+		case ErrorCodeUnavailable, ErrorCodeAborted:
+			return deliveryBackoff(attempt, config), true
+		default:
+			return 0, false
+		}
+	}
+
+	// Failures to reach GitHub
+	return deliveryBackoff(attempt, config), true
+}
+
+// deliveryBackoff doubles the delay with every attempt up to the maximum
+func deliveryBackoff(attempt int, config DeliveryWorkerConfig) time.Duration {
+	delay := config.MinBackoff
+	for i := 1; i < attempt && delay < config.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, config.MaxBackoff)
+}
+
+func (s *gitHubCommentProxyService) updateDeliveryQueueDepth(ctx context.Context) {
+	depth, err := s.deliveryQueue.Depth(ctx)
+	if err != nil {
+		log.Errorf("failed to get delivery queue depth: %s", err)
+		return
+	}
+
+	deliveryQueueDepthMetric.Set(float64(depth))
+}
+
+var deliveryJobIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// GetDeliveryJobRequest is the request for the progress of a comment delivered asynchronously
+type GetDeliveryJobRequest struct {
+	JobId string `json:"jobId"`
+}
+
+func (r *GetDeliveryJobRequest) GetJobId() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.JobId
+}
+
+// Validate validates the request
+func (r *GetDeliveryJobRequest) Validate() error {
+	if r.GetJobId() == "" {
+		return errors.New("job_id is required")
+	}
+
+	if !deliveryJobIDPattern.MatchString(r.GetJobId()) {
+		return errors.New("job_id is invalid")
+	}
+
+	return nil
+}
+
+// GetDeliveryJobResponse is the progress of a comment delivered asynchronously.
+// The comment is set once the job is delivered, the error of the last attempt
+// while the job is retried or when it failed.
+type GetDeliveryJobResponse struct {
+	JobId         string     `json:"jobId"`
+	State         string     `json:"state"`
+	Attempts      int        `json:"attempts"`
+	CommentId     string     `json:"commentId,omitempty"`
+	Action        string     `json:"action,omitempty"`
+	Receipt       string     `json:"receipt,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+}
+
+// GetDeliveryJob returns the progress of a comment delivered asynchronously. Jobs
+// are visible to the callers with access to the repository of the comment.
+func (s *gitHubCommentProxyService) GetDeliveryJob(ctx context.Context,
+	request *GetDeliveryJobRequest) (*GetDeliveryJobResponse, error) {
+	r, err := func() (*GetDeliveryJobResponse, error) {
+		if err := request.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+
+		if s.deliveryQueue == nil {
+			return nil, newError(ErrorCodePermissionDenied, ErrorReasonFeatureDisabled,
+				errors.New("asynchronous delivery is disabled"))
+		}
+
+		jobNotFound := newError(ErrorCodeNotFound, ErrorReasonJobNotFound,
+			fmt.Errorf("no job found with ID: %s", request.GetJobId()))
+
+		job, err := s.deliveryQueue.Get(ctx, request.GetJobId())
+		if errors.Is(err, queue.ErrNotFound) {
+			return nil, jobNotFound
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		var payload commentDeliveryJob
+		target := &ghcpv1.CreatePullRequestCommentRequest{}
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal delivery job: %w", err)
+		}
+
+		if err := protojson.Unmarshal(payload.Request, target); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal delivery job request: %w", err)
+		}
+
+		// Jobs of other repositories are reported as not found
+		// so that their existence is not disclosed
+		if err := s.authorizeDeliveryJobAccess(ctx, target); err != nil {
+			if errors.Is(err, errDeliveryJobAccessDenied) {
+				return nil, jobNotFound
+			}
+
+			return nil, err
+		}
+
+		response := &GetDeliveryJobResponse{
+			JobId:     job.ID,
+			State:     string(job.State),
+			Attempts:  job.Attempts,
+			Error:     job.LastError,
+			CreatedAt: job.CreatedAt.UTC(),
+			UpdatedAt: job.UpdatedAt.UTC(),
+		}
+
+		if job.State == queue.StatePending {
+			nextAttemptAt := job.NextAttemptAt.UTC()
+			response.NextAttemptAt = &nextAttemptAt
+		}
+
+		if job.State == queue.StateDelivered {
+			var result commentDeliveryResult
+			if err := json.Unmarshal(job.Result, &result); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal delivery job result: %w", err)
+			}
+
+			response.CommentId = result.CommentId
+			response.Action = string(result.Action)
+			response.Receipt = result.Receipt
+		}
+
+		return response, nil
+	}()
+	if err != nil {
+		log.Errorf("failed to execute service: %s", err)
+		failedServiceExecutionMetric.Inc()
+		return nil, classifyError(err)
+	}
+
+	successfulServiceExecutionMetric.Inc()
+	return r, nil
+}
+
+var errDeliveryJobAccessDenied = errors.New("caller can not access the repository of the job")
+
+// authorizeDeliveryJobAccess verifies that the caller has a token for the repository of the job
+func (s *gitHubCommentProxyService) authorizeDeliveryJobAccess(ctx context.Context, target pullRequestTarget) error {
+	if s.config.Load().InsecureSkipAuthorization {
+		return nil
+	}
+
+	tokenContext, err := gh.ExtractGitHubTokenContext(ctx)
+	if err != nil {
+		return newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+			fmt.Errorf("failed to extract GitHub Workload Identity Token context: %w", err))
+	}
+
+	fullName := fmt.Sprintf("%s/%s", target.GetOwner(), target.GetRepo())
+	if strings.EqualFold(tokenContext.Repository, fullName) {
+		return nil
+	}
+
+	if _, ok := tokenContext.FindRepository(fullName); ok {
+		return nil
+	}
+
+	return errDeliveryJobAccessDenied
+}
@@ -0,0 +1,331 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/audit"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/safedep/ghcp/pkg/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newDeliveryTestService(t *testing.T, config GitHubCommentProxyServiceConfig,
+	ghIssueAdapter *github.MockGitHubIssueAdapter) (*gitHubCommentProxyService, queue.Queue) {
+	service, err := NewGitHubCommentProxyService(config, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t),
+		github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+	assert.NoError(t, err)
+
+	q, err := queue.NewSQLiteQueue(filepath.Join(t.TempDir(), "queue.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+
+	service.SetDeliveryQueue(q)
+	return service, q
+}
+
+func TestCreatePullRequestCommentAsync(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		Repository: "safedep/ghcp",
+		Actor:      "octocat",
+		RunID:      "42",
+		TokenType:  gh.TokenTypeWorkloadIdentity,
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		BotUsername:               "test-bot",
+	}
+
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+	}
+
+	ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+	service, _ := newDeliveryTestService(t, config, ghIssueAdapter)
+
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+	assert.NoError(t, err)
+	defer sink.Close()
+
+	service.SetAuditSink(sink)
+
+	// GitHub is not called before the response
+	ctx := InjectAsyncDelivery(gh.InjectGitHubTokenContext(context.Background(), token))
+	result, err := service.CreatePullRequestComment(ctx, request)
+	assert.NoError(t, err)
+	assert.Equal(t, CommentActionQueued, result.Action)
+	assert.Len(t, result.JobID, 32)
+	assert.Empty(t, result.Response.GetCommentId())
+
+	job, err := service.GetDeliveryJob(ctx, &GetDeliveryJobRequest{JobId: result.JobID})
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", job.State)
+	assert.NotNil(t, job.NextAttemptAt)
+
+	ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+		Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil)
+
+	workerCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	workerConfig := DefaultDeliveryWorkerConfig()
+	workerConfig.PollInterval = 10 * time.Millisecond
+
+	go service.RunDeliveryWorkers(workerCtx, workerConfig)
+
+	assert.Eventually(t, func() bool {
+		job, err = service.GetDeliveryJob(ctx, &GetDeliveryJobRequest{JobId: result.JobID})
+		return err == nil && job.State == "delivered"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "10", job.CommentId)
+	assert.Equal(t, "created", job.Action)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Nil(t, job.NextAttemptAt)
+
+	records, err := sink.Query(context.Background(), audit.Filter{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	assert.Equal(t, "create_comment", records[0].Operation)
+	assert.Equal(t, "queued", records[0].Action)
+	assert.Equal(t, result.JobID, records[0].JobID)
+
+	// The delivery is recorded with the caller of the request
+	assert.Equal(t, "deliver_comment", records[1].Operation)
+	assert.Equal(t, audit.DecisionAllowed, records[1].Decision)
+	assert.Equal(t, "created", records[1].Action)
+	assert.Equal(t, "10", records[1].ResourceID)
+	assert.Equal(t, result.JobID, records[1].JobID)
+	assert.Equal(t, "42", records[1].Caller.RunID)
+}
+
+func TestCreatePullRequestCommentAsyncDisabled(t *testing.T) {
+	ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+	ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+		Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil)
+
+	service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		BotUsername:               "test-bot",
+	}, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t),
+		github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+	assert.NoError(t, err)
+
+	// The comment is delivered synchronously without a queue
+	result, err := service.CreatePullRequestComment(InjectAsyncDelivery(context.Background()),
+		&ghcpv1.CreatePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", Body: "test comment"})
+	assert.NoError(t, err)
+	assert.Equal(t, CommentActionCreated, result.Action)
+	assert.Equal(t, "10", result.Response.GetCommentId())
+	assert.Empty(t, result.JobID)
+
+	_, err = service.GetDeliveryJob(context.Background(),
+		&GetDeliveryJobRequest{JobId: "0123456789abcdef0123456789abcdef"})
+
+	var serviceErr *Error
+	assert.ErrorAs(t, err, &serviceErr)
+	assert.Equal(t, ErrorReasonFeatureDisabled, serviceErr.Reason)
+}
+
+func TestDeliverJob(t *testing.T) {
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+	}
+
+	badGateway := &ghapi.ErrorResponse{Response: &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Header:     http.Header{"Retry-After": []string{"30"}},
+	}}
+
+	notFound := &ghapi.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}
+
+	cases := []struct {
+		name        string
+		attempts    int
+		err         error
+		state       queue.State
+		nextAttempt time.Duration
+	}{
+		{"retried after the delay asked by github", 1, badGateway, queue.StatePending, 30 * time.Second},
+		{"retried with backoff", 2, errors.New("connection reset"), queue.StatePending, 4 * time.Second},
+		{"failed when refused", 1, notFound, queue.StateFailed, 0},
+		{"failed after the last attempt", 3, badGateway, queue.StateFailed, 0},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+				Return(nil, test.err).Times(test.attempts)
+
+			service, q := newDeliveryTestService(t, GitHubCommentProxyServiceConfig{
+				InsecureSkipAuthorization: true,
+				BotUsername:               "test-bot",
+			}, ghIssueAdapter)
+
+			result, err := service.CreatePullRequestComment(InjectAsyncDelivery(context.Background()), request)
+			assert.NoError(t, err)
+
+			workerConfig := DefaultDeliveryWorkerConfig()
+			workerConfig.MaxAttempts = 3
+
+			var job queue.Job
+			var before time.Time
+			for i := 0; i < test.attempts; i++ {
+				// Attempts are made as soon as they are claimed
+				if i > 0 {
+					assert.NoError(t, q.Retry(context.Background(), result.JobID, time.Now(), ""))
+				}
+
+				claimed, ok, err := q.Claim(context.Background(), time.Minute, 5)
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				before = time.Now()
+				service.deliverJob(context.Background(), workerConfig, claimed)
+			}
+
+			job, err = q.Get(context.Background(), result.JobID)
+			assert.NoError(t, err)
+
+			if test.nextAttempt > 0 {
+				assert.WithinDuration(t, before.Add(test.nextAttempt), job.NextAttemptAt, time.Second)
+			}
+
+			assert.Equal(t, test.state, job.State)
+			assert.Equal(t, test.attempts, job.Attempts)
+			assert.NotEmpty(t, job.LastError)
+		})
+	}
+}
+
+func TestDeliveryRetryDelay(t *testing.T) {
+	config := DeliveryWorkerConfig{MinBackoff: time.Second, MaxBackoff: time.Minute}
+
+	retryAfter := 45 * time.Second
+	response := func(status int, retryAfter string) error {
+		header := http.Header{}
+		if retryAfter != "" {
+			header.Set("Retry-After", retryAfter)
+		}
+
+		return &ghapi.ErrorResponse{Response: &http.Response{StatusCode: status, Header: header}}
+	}
+
+	cases := []struct {
+		name      string
+		err       error
+		attempt   int
+		delay     time.Duration
+		retryable bool
+	}{
+		{"secondary rate limit", &ghapi.AbuseRateLimitError{RetryAfter: &retryAfter}, 1, retryAfter, true},
+		{"secondary rate limit without delay", &ghapi.AbuseRateLimitError{}, 2, 2 * time.Second, true},
+		{"retry after", response(http.StatusServiceUnavailable, "120"), 1, 2 * time.Minute, true},
+		{"too many requests", response(http.StatusTooManyRequests, "5"), 1, 5 * time.Second, true},
+		{"retry after below minimum", response(http.StatusBadGateway, "0"), 1, time.Second, true},
+		{"backoff", response(http.StatusBadGateway, ""), 3, 4 * time.Second, true},
+		{"backoff capped", response(http.StatusBadGateway, ""), 20, time.Minute, true},
+		{"github rate limit wait", &github.RateLimitWaitError{RetryAfter: time.Hour}, 1, time.Hour, true},
+		{"unprocessable", response(http.StatusUnprocessableEntity, ""), 1, 0, false},
+		{"pull request busy", newError(ErrorCodeAborted, ErrorReasonPullRequestBusy, errors.New("busy")), 1, time.Second, true},
+		{"comment limit", newError(ErrorCodeResourceExhausted, ErrorReasonCommentLimitReached, errors.New("limit")), 1, 0, false},
+		{"network failure", errors.New("connection reset"), 2, 2 * time.Second, true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			delay, retryable := deliveryRetryDelay(test.err, test.attempt, config)
+			assert.Equal(t, test.retryable, retryable)
+			assert.Equal(t, test.delay, delay)
+		})
+	}
+
+	t.Run("primary rate limit", func(t *testing.T) {
+		reset := time.Now().Add(10 * time.Minute)
+		delay, retryable := deliveryRetryDelay(&ghapi.RateLimitError{
+			Rate: ghapi.Rate{Reset: ghapi.Timestamp{Time: reset}},
+		}, 1, config)
+
+		assert.True(t, retryable)
+		assert.InDelta(t, (10 * time.Minute).Seconds(), delay.Seconds(), 1)
+	})
+}
+
+func TestGetDeliveryJobAccess(t *testing.T) {
+	service, _ := newDeliveryTestService(t, DefaultGitHubCommentProxyServiceConfig(),
+		github.NewMockGitHubIssueAdapter(t))
+
+	result, err := service.enqueuePullRequestComment(context.Background(),
+		&ghcpv1.CreatePullRequestCommentRequest{Owner: "safedep", Repo: "ghcp", PrNumber: "1", Body: "test comment"})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		jobId  string
+		reason string
+	}{
+		{
+			name:  "token of the repository",
+			ctx:   gh.InjectGitHubTokenContext(context.Background(), gh.GitHubTokenContext{Repository: "SafeDep/ghcp"}),
+			jobId: result.JobID,
+		},
+		{
+			name: "token with access to the repository",
+			ctx: gh.InjectGitHubTokenContext(context.Background(), gh.GitHubTokenContext{
+				Repositories: []gh.GitHubTokenRepository{{FullName: "safedep/ghcp"}},
+			}),
+			jobId: result.JobID,
+		},
+		{
+			name:   "token of another repository",
+			ctx:    gh.InjectGitHubTokenContext(context.Background(), gh.GitHubTokenContext{Repository: "safedep/vet"}),
+			jobId:  result.JobID,
+			reason: ErrorReasonJobNotFound,
+		},
+		{
+			name:   "unknown job",
+			ctx:    gh.InjectGitHubTokenContext(context.Background(), gh.GitHubTokenContext{Repository: "safedep/ghcp"}),
+			jobId:  "0123456789abcdef0123456789abcdef",
+			reason: ErrorReasonJobNotFound,
+		},
+		{
+			name:   "no token",
+			ctx:    context.Background(),
+			jobId:  result.JobID,
+			reason: ErrorReasonUnauthorized,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			job, err := service.GetDeliveryJob(test.ctx, &GetDeliveryJobRequest{JobId: test.jobId})
+			if test.reason == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, result.JobID, job.JobId)
+				return
+			}
+
+			var serviceErr *Error
+			assert.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, test.reason, serviceErr.Reason)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package ghcp
+
+import (
+	"errors"
+	"net/http"
+
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+)
+
+// ErrorCode classifies a failure of the service so that clients can
+// decide whether to retry, warn or fail
+type ErrorCode string
+
+const (
+	// The caller is not allowed to act on the repository
+	ErrorCodePermissionDenied ErrorCode = "permission_denied"
+
+	// The pull request is not in a state that allows the request
+	ErrorCodeFailedPrecondition ErrorCode = "failed_precondition"
+
+	// A limit of the service is reached
+	ErrorCodeResourceExhausted ErrorCode = "resource_exhausted"
+
+	// The resource the request refers to does not exist
+	ErrorCodeNotFound ErrorCode = "not_found"
+
+	// GitHub failed to serve the request. The request can be retried.
+	ErrorCodeUnavailable ErrorCode = "unavailable"
+
+	// The request is not valid
+	ErrorCodeInvalidArgument ErrorCode = "invalid_argument"
+
+	// The request conflicts with a concurrent request. The request can be retried.
+	ErrorCodeAborted ErrorCode = "aborted"
+)
+
+// Reasons identify the failure within its code
+const (
+	ErrorReasonUnauthorized         = "UNAUTHORIZED"
+	ErrorReasonPullRequestClosed    = "PULL_REQUEST_CLOSED"
+	ErrorReasonCommentLimitReached  = "COMMENT_LIMIT_REACHED"
+	ErrorReasonReviewLimitReached   = "REVIEW_COMMENT_LIMIT_REACHED"
+	ErrorReasonRateLimited          = "RATE_LIMITED"
+	ErrorReasonCommentNotFound      = "COMMENT_NOT_FOUND"
+	ErrorReasonTagNotFound          = "TAG_NOT_FOUND"
+	ErrorReasonGitHubUnavailable    = "GITHUB_UNAVAILABLE"
+	ErrorReasonFeatureDisabled      = "FEATURE_DISABLED"
+	ErrorReasonCommentNotOwnedByBot = "COMMENT_NOT_OWNED_BY_BOT"
+	ErrorReasonRepositoryOptedOut   = "REPOSITORY_OPTED_OUT"
+	ErrorReasonWorkflowNotAllowed   = "WORKFLOW_NOT_ALLOWED"
+
+	ErrorReasonInvalidIdempotencyKey    = "INVALID_IDEMPOTENCY_KEY"
+	ErrorReasonIdempotencyKeyReused     = "IDEMPOTENCY_KEY_REUSED"
+	ErrorReasonIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+	ErrorReasonPullRequestBusy          = "PULL_REQUEST_BUSY"
+	ErrorReasonLockUnavailable          = "LOCK_UNAVAILABLE"
+	ErrorReasonJobNotFound              = "JOB_NOT_FOUND"
+	ErrorReasonInvalidCheckName         = "INVALID_CHECK_NAME"
+	ErrorReasonCommitNotInPullRequest   = "COMMIT_NOT_IN_PULL_REQUEST"
+)
+
+// Error is a failure of the service with a code and a reason for the client.
+// The message is the message of the underlying error.
+type Error struct {
+	Code   ErrorCode
+	Reason string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError classifies the error unless it is already classified. Errors caused
+// by GitHub failing to serve a request are always classified as unavailable.
+func newError(code ErrorCode, reason string, err error) error {
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		return err
+	}
+
+	if isGitHubUnavailable(err) {
+		return &Error{Code: ErrorCodeUnavailable, Reason: ErrorReasonGitHubUnavailable, Err: err}
+	}
+
+	return &Error{Code: code, Reason: reason, Err: err}
+}
+
+// classifyError classifies the errors of GitHub failing to serve a request.
+// Other errors are returned unchanged.
+func classifyError(err error) error {
+	if isGitHubUnavailable(err) {
+		return newError(ErrorCodeUnavailable, ErrorReasonGitHubUnavailable, err)
+	}
+
+	return err
+}
+
+func isGitHubUnavailable(err error) bool {
+	// The rate limit of the credential does not allow the request yet
+	var waitErr *github.RateLimitWaitError
+	if errors.As(err, &waitErr) {
+		return true
+	}
+
+	var responseErr *ghapi.ErrorResponse
+	if errors.As(err, &responseErr) && responseErr.Response != nil {
+		return responseErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+
+	return false
+}
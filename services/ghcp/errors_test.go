@@ -0,0 +1,197 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewError(t *testing.T) {
+	unavailable := &ghapi.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}
+	notFound := &ghapi.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	closed := &Error{Code: ErrorCodeFailedPrecondition, Reason: ErrorReasonPullRequestClosed, Err: errors.New("closed")}
+
+	cases := []struct {
+		name   string
+		err    error
+		code   ErrorCode
+		reason string
+	}{
+		{
+			name:   "error is classified",
+			err:    errors.New("repository is not public"),
+			code:   ErrorCodePermissionDenied,
+			reason: ErrorReasonUnauthorized,
+		},
+		{
+			name:   "classification is retained",
+			err:    fmt.Errorf("failed to verify repository access: %w", closed),
+			code:   ErrorCodeFailedPrecondition,
+			reason: ErrorReasonPullRequestClosed,
+		},
+		{
+			name:   "github server error is unavailable",
+			err:    fmt.Errorf("failed to get repository: %w", unavailable),
+			code:   ErrorCodeUnavailable,
+			reason: ErrorReasonGitHubUnavailable,
+		},
+		{
+			name:   "github rate limit wait is unavailable",
+			err:    fmt.Errorf("failed to get repository: %w", &github.RateLimitWaitError{RetryAfter: time.Hour}),
+			code:   ErrorCodeUnavailable,
+			reason: ErrorReasonGitHubUnavailable,
+		},
+		{
+			name:   "github client error is classified",
+			err:    fmt.Errorf("failed to get repository: %w", notFound),
+			code:   ErrorCodePermissionDenied,
+			reason: ErrorReasonUnauthorized,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized, c.err)
+			assert.Equal(t, c.err.Error(), err.Error())
+
+			var serviceErr *Error
+			assert.True(t, errors.As(err, &serviceErr))
+			assert.Equal(t, c.code, serviceErr.Code)
+			assert.Equal(t, c.reason, serviceErr.Reason)
+		})
+	}
+
+	t.Run("unclassified errors are returned unchanged", func(t *testing.T) {
+		err := errors.New("failed to convert pr number to int")
+		assert.Equal(t, err, classifyError(err))
+	})
+}
+
+func TestCreatePullRequestCommentErrors(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		TokenType:    gh.TokenTypeAction,
+		Repositories: []gh.GitHubTokenRepository{{ID: "100", FullName: "safedep/ghcp"}},
+	}
+
+	repository := &ghapi.Repository{ID: ghapi.Ptr(int64(100)), Visibility: ghapi.Ptr("public")}
+	botComment := &ghapi.IssueComment{User: &ghapi.User{Login: ghapi.Ptr("safedep-bot")}}
+
+	cases := []struct {
+		name    string
+		tag     string
+		mock    func(*github.MockGitHubIssueAdapter, *github.MockGitHubRepositoryAdapter)
+		code    ErrorCode
+		reason  string
+		message string
+	}{
+		{
+			name: "private repository",
+			mock: func(_ *github.MockGitHubIssueAdapter, m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+					Return(&ghapi.Repository{ID: ghapi.Ptr(int64(100)), Visibility: ghapi.Ptr("private")}, nil)
+			},
+			code:    ErrorCodePermissionDenied,
+			reason:  ErrorReasonUnauthorized,
+			message: "repository is not public",
+		},
+		{
+			name: "closed pull request",
+			mock: func(_ *github.MockGitHubIssueAdapter, m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").Return(repository, nil)
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+					Return(&ghapi.PullRequest{State: ghapi.Ptr("closed")}, nil)
+			},
+			code:    ErrorCodeFailedPrecondition,
+			reason:  ErrorReasonPullRequestClosed,
+			message: "pull request is not open: closed",
+		},
+		{
+			name: "comment limit",
+			mock: func(i *github.MockGitHubIssueAdapter, m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").Return(repository, nil)
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+					Return(&ghapi.PullRequest{State: ghapi.Ptr("open")}, nil)
+				i.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
+					Return([]*ghapi.IssueComment{botComment}, nil)
+			},
+			code:    ErrorCodeResourceExhausted,
+			reason:  ErrorReasonCommentLimitReached,
+			message: "maximum number of comments (1) reached for PR",
+		},
+		{
+			name: "missing tag",
+			tag:  "test-tag",
+			mock: func(i *github.MockGitHubIssueAdapter, m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").Return(repository, nil)
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+					Return(&ghapi.PullRequest{State: ghapi.Ptr("open")}, nil)
+				expectWalkIssueComments(i, nil)
+			},
+			code:    ErrorCodeNotFound,
+			reason:  ErrorReasonTagNotFound,
+			message: "no comment found with Tag: test-tag",
+		},
+		{
+			name: "github unavailable during authorization",
+			mock: func(_ *github.MockGitHubIssueAdapter, m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+					Return(nil, &ghapi.ErrorResponse{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}})
+			},
+			code:   ErrorCodeUnavailable,
+			reason: ErrorReasonGitHubUnavailable,
+		},
+		{
+			name: "github unavailable when creating the comment",
+			mock: func(i *github.MockGitHubIssueAdapter, m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").Return(repository, nil)
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+					Return(&ghapi.PullRequest{State: ghapi.Ptr("open")}, nil)
+				i.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).Return(nil, nil)
+				i.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+					Return(nil, &ghapi.ErrorResponse{Response: &http.Response{StatusCode: http.StatusInternalServerError}})
+			},
+			code:   ErrorCodeUnavailable,
+			reason: ErrorReasonGitHubUnavailable,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+			c.mock(ghIssueAdapter, ghRepoAdapter)
+
+			service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+				AllowOnlyPublicRepositories: true,
+				BotUsername:                 "safedep-bot",
+				MaxCommentsPerPR:            1,
+			}, ghIssueAdapter, ghRepoAdapter, github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+			_, err = service.Execute(ctx, &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+				Tag:      c.tag,
+			})
+
+			var serviceErr *Error
+			assert.True(t, errors.As(err, &serviceErr))
+			assert.Equal(t, c.code, serviceErr.Code)
+			assert.Equal(t, c.reason, serviceErr.Reason)
+			assert.ErrorContains(t, err, c.message)
+		})
+	}
+}
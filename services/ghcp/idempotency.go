@@ -0,0 +1,213 @@
+package ghcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/idempotency"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// How long the response of a request is remembered by its idempotency key
+	DefaultIdempotencyKeyTTL = 24 * time.Hour
+
+	// Maximum length of an idempotency key
+	MaxIdempotencyKeyLength = 255
+
+	// How long a key is held by a request in progress. The key is extended while
+	// the request executes, this bounds how long a key is unusable when a replica
+	// fails while executing the request.
+	idempotencyPendingTTL = time.Minute
+
+	// How often the key of a request in progress is extended
+	idempotencyExtendInterval = idempotencyPendingTTL / 3
+)
+
+type idempotencyKeyContextKey struct{}
+
+// InjectIdempotencyKey returns a context carrying the idempotency key sent by the client
+func InjectIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// ExtractIdempotencyKey returns the idempotency key in the context, empty when there is none
+func ExtractIdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key
+}
+
+// idempotentCommentResult is the result of a comment request remembered by its key
+type idempotentCommentResult struct {
+	CommentId string        `json:"commentId"`
+	Action    CommentAction `json:"action"`
+	JobId     string        `json:"jobId,omitempty"`
+
+	// Receipt issued to the caller of the original request
+	Receipt string `json:"receipt,omitempty"`
+}
+
+// createPullRequestCommentOnce executes the request once for the idempotency key in the
+// context. A request with a key already used returns the result of the original request.
+// Requests without a key, or when the store is unavailable, are always executed.
+func (s *gitHubCommentProxyService) createPullRequestCommentOnce(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, request *ghcpv1.CreatePullRequestCommentRequest,
+	create func() (*PullRequestCommentResult, error)) (*PullRequestCommentResult, error) {
+	key := ExtractIdempotencyKey(ctx)
+	if key == "" || config.IdempotencyKeyTTL == 0 {
+		return create()
+	}
+
+	if len(key) > MaxIdempotencyKeyLength {
+		return nil, newError(ErrorCodeInvalidArgument, ErrorReasonInvalidIdempotencyKey,
+			fmt.Errorf("idempotency key must be at most %d characters", MaxIdempotencyKeyLength))
+	}
+
+	fingerprint, err := requestFingerprint(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are scoped to the pull request so that a key can not
+	// be used to read the result of a request on another one
+	storeKey := idempotencyStoreKey(request, key)
+
+	record, reserved, err := s.idempotencyStore.Reserve(ctx, storeKey,
+		idempotency.Record{Fingerprint: fingerprint}, idempotencyPendingTTL)
+	if err != nil {
+		log.Errorf("failed to reserve idempotency key, executing request: %s", err)
+		return create()
+	}
+
+	if !reserved {
+		return replayPullRequestComment(record, fingerprint)
+	}
+
+	// The key is released or completed even when the client has gone away
+	storeCtx := context.WithoutCancel(ctx)
+
+	// The request can wait for the lock of the pull request and for the rate limits
+	// of GitHub longer than the key is held. A retry must not execute it again.
+	stop := keepAlive(storeCtx, idempotencyExtendInterval, func(ctx context.Context) {
+		if err := s.idempotencyStore.Extend(ctx, storeKey, idempotencyPendingTTL); err != nil {
+			log.Errorf("failed to extend idempotency key: %s", err)
+		}
+	})
+
+	result, err := create()
+	stop()
+
+	if err != nil {
+		if releaseErr := s.idempotencyStore.Release(storeCtx, storeKey); releaseErr != nil {
+			log.Errorf("failed to release idempotency key: %s", releaseErr)
+		}
+
+		return nil, err
+	}
+
+	data, err := json.Marshal(idempotentCommentResult{
+		CommentId: result.Response.GetCommentId(),
+		Action:    result.Action,
+		JobId:     result.JobID,
+		Receipt:   result.Receipt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal idempotent result: %w", err)
+	}
+
+	err = s.idempotencyStore.Complete(storeCtx, storeKey, idempotency.Record{
+		Fingerprint: fingerprint,
+		Completed:   true,
+		Response:    data,
+	}, config.IdempotencyKeyTTL)
+	if err != nil {
+		log.Errorf("failed to store idempotency record: %s", err)
+	}
+
+	return result, nil
+}
+
+// keepAlive calls renew every interval until the returned function is called. The
+// returned function waits for a renewal in progress so that none happens after it.
+func keepAlive(ctx context.Context, interval time.Duration, renew func(context.Context)) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				renew(ctx)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func replayPullRequestComment(record idempotency.Record, fingerprint string) (*PullRequestCommentResult, error) {
+	if record.Fingerprint != fingerprint {
+		return nil, newError(ErrorCodeInvalidArgument, ErrorReasonIdempotencyKeyReused,
+			errors.New("idempotency key was used for a different request"))
+	}
+
+	if !record.Completed {
+		return nil, newError(ErrorCodeAborted, ErrorReasonIdempotencyKeyInProgress,
+			errors.New("request with the idempotency key is in progress"))
+	}
+
+	var result idempotentCommentResult
+	if err := json.Unmarshal(record.Response, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal idempotent result: %w", err)
+	}
+
+	idempotentReplayMetric.Inc()
+	log.Debugf("Replaying result of comment: %s", result.CommentId)
+
+	return &PullRequestCommentResult{
+		Response: &ghcpv1.CreatePullRequestCommentResponse{CommentId: result.CommentId},
+		Action:   result.Action,
+		JobID:    result.JobId,
+		Receipt:  result.Receipt,
+		Replayed: true,
+	}, nil
+}
+
+func requestFingerprint(request proto.Message) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func idempotencyStoreKey(target pullRequestTarget, key string) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		strings.ToLower(target.GetOwner()),
+		strings.ToLower(target.GetRepo()),
+		target.GetPrNumber(),
+		key,
+	}, "/")))
+
+	return hex.EncodeToString(hash[:])
+}
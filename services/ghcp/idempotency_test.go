@@ -0,0 +1,190 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreatePullRequestCommentWithIdempotencyKey(t *testing.T) {
+	config := GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		IdempotencyKeyTTL:         time.Hour,
+	}
+
+	request := func(body string) *ghcpv1.CreatePullRequestCommentRequest {
+		return &ghcpv1.CreatePullRequestCommentRequest{
+			Owner:    "safedep",
+			Repo:     "ghcp",
+			PrNumber: "1",
+			Body:     body,
+		}
+	}
+
+	newService := func(t *testing.T, ghIssueAdapter *github.MockGitHubIssueAdapter) *gitHubCommentProxyService {
+		service, err := NewGitHubCommentProxyService(config, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t),
+			github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+		assert.NoError(t, err)
+
+		return service
+	}
+
+	assertErrorReason := func(t *testing.T, err error, code ErrorCode, reason string) {
+		var serviceErr *Error
+		assert.True(t, errors.As(err, &serviceErr))
+		assert.Equal(t, code, serviceErr.Code)
+		assert.Equal(t, reason, serviceErr.Reason)
+	}
+
+	t.Run("retried request returns the original result", func(t *testing.T) {
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil).Once()
+
+		service := newService(t, ghIssueAdapter)
+		ctx := InjectIdempotencyKey(context.Background(), "key-1")
+
+		res, err := service.CreatePullRequestComment(ctx, request("test comment"))
+		assert.NoError(t, err)
+		assert.Equal(t, "10", res.Response.GetCommentId())
+		assert.False(t, res.Replayed)
+
+		res, err = service.CreatePullRequestComment(ctx, request("test comment"))
+		assert.NoError(t, err)
+		assert.Equal(t, "10", res.Response.GetCommentId())
+		assert.Equal(t, CommentActionCreated, res.Action)
+		assert.True(t, res.Replayed)
+	})
+
+	t.Run("requests without a key are not deduplicated", func(t *testing.T) {
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil).Twice()
+
+		service := newService(t, ghIssueAdapter)
+		for i := 0; i < 2; i++ {
+			_, err := service.CreatePullRequestComment(context.Background(), request("test comment"))
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("key reused for a different request", func(t *testing.T) {
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil).Once()
+
+		service := newService(t, ghIssueAdapter)
+		ctx := InjectIdempotencyKey(context.Background(), "key-1")
+
+		_, err := service.CreatePullRequestComment(ctx, request("test comment"))
+		assert.NoError(t, err)
+
+		_, err = service.CreatePullRequestComment(ctx, request("another comment"))
+		assertErrorReason(t, err, ErrorCodeInvalidArgument, ErrorReasonIdempotencyKeyReused)
+	})
+
+	t.Run("concurrent request with the same key", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			RunAndReturn(func(context.Context, string, string, int, string) (*ghapi.IssueComment, error) {
+				close(started)
+				<-release
+
+				return &ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil
+			}).Once()
+
+		service := newService(t, ghIssueAdapter)
+		ctx := InjectIdempotencyKey(context.Background(), "key-1")
+
+		done := make(chan error)
+		go func() {
+			_, err := service.CreatePullRequestComment(ctx, request("test comment"))
+			done <- err
+		}()
+
+		<-started
+		_, err := service.CreatePullRequestComment(ctx, request("test comment"))
+		assertErrorReason(t, err, ErrorCodeAborted, ErrorReasonIdempotencyKeyInProgress)
+
+		close(release)
+		assert.NoError(t, <-done)
+
+		res, err := service.CreatePullRequestComment(ctx, request("test comment"))
+		assert.NoError(t, err)
+		assert.True(t, res.Replayed)
+	})
+
+	t.Run("failed request can be retried", func(t *testing.T) {
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			Return(nil, errors.New("connection reset")).Once()
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil).Once()
+
+		service := newService(t, ghIssueAdapter)
+		ctx := InjectIdempotencyKey(context.Background(), "key-1")
+
+		_, err := service.CreatePullRequestComment(ctx, request("test comment"))
+		assert.ErrorContains(t, err, "connection reset")
+
+		res, err := service.CreatePullRequestComment(ctx, request("test comment"))
+		assert.NoError(t, err)
+		assert.False(t, res.Replayed)
+	})
+
+	t.Run("keys are scoped to the pull request", func(t *testing.T) {
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil).Once()
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 2, "test comment").
+			Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(20))}, nil).Once()
+
+		service := newService(t, ghIssueAdapter)
+		ctx := InjectIdempotencyKey(context.Background(), "key-1")
+
+		_, err := service.CreatePullRequestComment(ctx, request("test comment"))
+		assert.NoError(t, err)
+
+		other := request("test comment")
+		other.PrNumber = "2"
+
+		res, err := service.CreatePullRequestComment(ctx, other)
+		assert.NoError(t, err)
+		assert.Equal(t, "20", res.Response.GetCommentId())
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		service := newService(t, github.NewMockGitHubIssueAdapter(t))
+		ctx := InjectIdempotencyKey(context.Background(), strings.Repeat("k", MaxIdempotencyKeyLength+1))
+
+		_, err := service.CreatePullRequestComment(ctx, request("test comment"))
+		assertErrorReason(t, err, ErrorCodeInvalidArgument, ErrorReasonInvalidIdempotencyKey)
+	})
+}
+
+func TestKeepAlive(t *testing.T) {
+	var renewals atomic.Int32
+	stop := keepAlive(context.Background(), time.Millisecond, func(context.Context) {
+		renewals.Add(1)
+	})
+
+	assert.Eventually(t, func() bool { return renewals.Load() >= 3 }, time.Second, time.Millisecond)
+
+	stop()
+	stopped := renewals.Load()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, stopped, renewals.Load())
+}
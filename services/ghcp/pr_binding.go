@@ -0,0 +1,154 @@
+package ghcp
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/gh"
+)
+
+// PullRequestBindingRule decides how a request is bound to a pull request
+// when the workflow was not triggered by a pull request event
+type PullRequestBindingRule string
+
+const (
+	// Reject requests from the event
+	PullRequestBindingRuleDeny PullRequestBindingRule = "deny"
+
+	// Allow requests for any pull request in the repository
+	PullRequestBindingRuleAllow PullRequestBindingRule = "allow"
+
+	// Allow requests only for pull requests whose head branch is the
+	// ref the workflow was triggered for. Useful for push events.
+	PullRequestBindingRuleHeadRef PullRequestBindingRule = "head_ref"
+)
+
+func (r PullRequestBindingRule) valid() bool {
+	switch r {
+	case PullRequestBindingRuleDeny, PullRequestBindingRuleAllow, PullRequestBindingRuleHeadRef:
+		return true
+	default:
+		return false
+	}
+}
+
+const (
+	gitHubEventPullRequest       = "pull_request"
+	gitHubEventPullRequestTarget = "pull_request_target"
+)
+
+// refs/pull/<n>/merge or refs/pull/<n>/head
+var pullRequestRefRegexp = regexp.MustCompile(`^refs/pull/(\d+)/(merge|head)$`)
+
+// parsePullRequestRef returns the pull request number from a pull request ref
+func parsePullRequestRef(ref string) (int, bool) {
+	matches := pullRequestRefRegexp.FindStringSubmatch(ref)
+	if len(matches) != 3 {
+		return 0, false
+	}
+
+	number, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return number, true
+}
+
+// verifyPullRequestBinding verifies that the pull request in the request is the one
+// the workload identity token was issued for. This is to prevent a workflow from
+// commenting on arbitrary pull requests in its own repository.
+func (s *gitHubCommentProxyService) verifyPullRequestBinding(ctx context.Context, config GitHubCommentProxyServiceConfig,
+	tokenContext gh.GitHubTokenContext, owner, repo string, prNumber int) error {
+	switch tokenContext.EventName {
+	case gitHubEventPullRequest, gitHubEventPullRequestTarget:
+		// pull_request runs on the merge ref of the pull request
+		if number, ok := parsePullRequestRef(tokenContext.Ref); ok {
+			if number != prNumber {
+				return fmt.Errorf("pull request mismatch: %d != %d", number, prNumber)
+			}
+
+			return nil
+		}
+
+		// pull_request_target runs on the base branch, the pull request is
+		// identified by its head and base refs within the repository
+		return s.verifyPullRequestRefs(ctx, tokenContext, owner, repo, prNumber)
+	}
+
+	rule, ok := config.PullRequestBindingRules[tokenContext.EventName]
+	if !ok {
+		rule = config.DefaultPullRequestBindingRule
+	}
+
+	log.Debugf("Pull request binding rule for event: %s is %s", tokenContext.EventName, rule)
+
+	switch rule {
+	case PullRequestBindingRuleAllow:
+		return nil
+	case PullRequestBindingRuleHeadRef:
+		if tokenContext.RefType != "" && tokenContext.RefType != "branch" {
+			return fmt.Errorf("ref type is not a branch: %s", tokenContext.RefType)
+		}
+
+		pr, err := s.ghRepoAdapter.GetPullRequest(ctx, owner, repo, prNumber)
+		if err != nil {
+			return fmt.Errorf("failed to get pull request: %w", err)
+		}
+
+		branch := strings.TrimPrefix(tokenContext.Ref, "refs/heads/")
+		if pr.GetHead().GetRef() != branch {
+			return fmt.Errorf("pull request head ref mismatch: %s != %s", pr.GetHead().GetRef(), branch)
+		}
+
+		if !strings.EqualFold(pr.GetHead().GetRepo().GetFullName(), tokenContext.Repository) {
+			return fmt.Errorf("pull request head repository mismatch: %s != %s",
+				pr.GetHead().GetRepo().GetFullName(), tokenContext.Repository)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("pull request comments are not allowed for event: %s", tokenContext.EventName)
+	}
+}
+
+// verifyPullRequestRefs verifies the head and base refs of the pull request
+// against the claims in the token. Branch names do not identify a pull request
+// from a fork, any fork may have a branch of the same name, and the token carries
+// no claim of the head repository or commit. Such requests are denied.
+func (s *gitHubCommentProxyService) verifyPullRequestRefs(ctx context.Context,
+	tokenContext gh.GitHubTokenContext, owner, repo string, prNumber int) error {
+	if tokenContext.HeadRef == "" || tokenContext.BaseRef == "" {
+		return fmt.Errorf("token does not identify a pull request: %s", tokenContext.Ref)
+	}
+
+	pr, err := s.ghRepoAdapter.GetPullRequest(ctx, owner, repo, prNumber)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request: %w", err)
+	}
+
+	if pr.GetHead().GetRef() != tokenContext.HeadRef {
+		return fmt.Errorf("pull request head ref mismatch: %s != %s", pr.GetHead().GetRef(), tokenContext.HeadRef)
+	}
+
+	if pr.GetBase().GetRef() != tokenContext.BaseRef {
+		return fmt.Errorf("pull request base ref mismatch: %s != %s", pr.GetBase().GetRef(), tokenContext.BaseRef)
+	}
+
+	headRepo := pr.GetHead().GetRepo()
+	if !strings.EqualFold(headRepo.GetFullName(), tokenContext.Repository) {
+		return fmt.Errorf("pull request head repository mismatch: %s != %s",
+			headRepo.GetFullName(), tokenContext.Repository)
+	}
+
+	if tokenContext.RepositoryID != "" && strconv.FormatInt(headRepo.GetID(), 10) != tokenContext.RepositoryID {
+		return fmt.Errorf("pull request head repository id mismatch: %d != %s",
+			headRepo.GetID(), tokenContext.RepositoryID)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package ghcp
+
+import (
+	"context"
+	"testing"
+
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParsePullRequestRef(t *testing.T) {
+	cases := []struct {
+		ref    string
+		number int
+		ok     bool
+	}{
+		{"refs/pull/10/merge", 10, true},
+		{"refs/pull/10/head", 10, true},
+		{"refs/heads/main", 0, false},
+		{"refs/pull/abc/merge", 0, false},
+		{"refs/pull/10/merge/extra", 0, false},
+		{"", 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.ref, func(t *testing.T) {
+			number, ok := parsePullRequestRef(c.ref)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.number, number)
+		})
+	}
+}
+
+func TestVerifyPullRequestBinding(t *testing.T) {
+	cases := []struct {
+		name     string
+		rules    map[string]PullRequestBindingRule
+		token    gh.GitHubTokenContext
+		prNumber int
+		mock     func(*github.MockGitHubRepositoryAdapter)
+		err      string
+	}{
+		{
+			name:     "pull request event with matching merge ref",
+			token:    gh.GitHubTokenContext{EventName: "pull_request", Ref: "refs/pull/1/merge"},
+			prNumber: 1,
+		},
+		{
+			name:     "pull request event with different pull request",
+			token:    gh.GitHubTokenContext{EventName: "pull_request", Ref: "refs/pull/2/merge"},
+			prNumber: 1,
+			err:      "pull request mismatch",
+		},
+		{
+			name: "pull request target event with matching head and base ref",
+			token: gh.GitHubTokenContext{
+				EventName:    "pull_request_target",
+				Ref:          "refs/heads/main",
+				HeadRef:      "feature",
+				BaseRef:      "main",
+				Repository:   "safedep/ghcp",
+				RepositoryID: "10",
+			},
+			prNumber: 1,
+			mock: func(m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).Return(&ghapi.PullRequest{
+					Head: &ghapi.PullRequestBranch{
+						Ref:  proto.String("feature"),
+						Repo: &ghapi.Repository{ID: proto.Int64(10), FullName: proto.String("safedep/ghcp")},
+					},
+					Base: &ghapi.PullRequestBranch{Ref: proto.String("main")},
+				}, nil)
+			},
+		},
+		{
+			name: "pull request target event with pull request from a fork",
+			token: gh.GitHubTokenContext{
+				EventName:    "pull_request_target",
+				Ref:          "refs/heads/main",
+				HeadRef:      "patch-1",
+				BaseRef:      "main",
+				Repository:   "safedep/ghcp",
+				RepositoryID: "10",
+			},
+			prNumber: 1,
+			mock: func(m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).Return(&ghapi.PullRequest{
+					Head: &ghapi.PullRequestBranch{
+						Ref:  proto.String("patch-1"),
+						Repo: &ghapi.Repository{ID: proto.Int64(20), FullName: proto.String("someone/ghcp")},
+					},
+					Base: &ghapi.PullRequestBranch{Ref: proto.String("main")},
+				}, nil)
+			},
+			err: "pull request head repository mismatch",
+		},
+		{
+			name: "pull request target event with recreated head repository",
+			token: gh.GitHubTokenContext{
+				EventName:    "pull_request_target",
+				Ref:          "refs/heads/main",
+				HeadRef:      "feature",
+				BaseRef:      "main",
+				Repository:   "safedep/ghcp",
+				RepositoryID: "10",
+			},
+			prNumber: 1,
+			mock: func(m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).Return(&ghapi.PullRequest{
+					Head: &ghapi.PullRequestBranch{
+						Ref:  proto.String("feature"),
+						Repo: &ghapi.Repository{ID: proto.Int64(11), FullName: proto.String("safedep/ghcp")},
+					},
+					Base: &ghapi.PullRequestBranch{Ref: proto.String("main")},
+				}, nil)
+			},
+			err: "pull request head repository id mismatch",
+		},
+		{
+			name: "pull request target event with different head ref",
+			token: gh.GitHubTokenContext{
+				EventName: "pull_request_target",
+				Ref:       "refs/heads/main",
+				HeadRef:   "feature",
+				BaseRef:   "main",
+			},
+			prNumber: 1,
+			mock: func(m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).Return(&ghapi.PullRequest{
+					Head: &ghapi.PullRequestBranch{Ref: proto.String("other")},
+					Base: &ghapi.PullRequestBranch{Ref: proto.String("main")},
+				}, nil)
+			},
+			err: "pull request head ref mismatch",
+		},
+		{
+			name:     "pull request target event without head ref",
+			token:    gh.GitHubTokenContext{EventName: "pull_request_target", Ref: "refs/heads/main"},
+			prNumber: 1,
+			err:      "token does not identify a pull request",
+		},
+		{
+			name:     "event without rule is denied",
+			token:    gh.GitHubTokenContext{EventName: "schedule", Ref: "refs/heads/main"},
+			prNumber: 1,
+			err:      "pull request comments are not allowed for event: schedule",
+		},
+		{
+			name:     "event with allow rule",
+			rules:    map[string]PullRequestBindingRule{"workflow_dispatch": PullRequestBindingRuleAllow},
+			token:    gh.GitHubTokenContext{EventName: "workflow_dispatch", Ref: "refs/heads/main"},
+			prNumber: 1,
+		},
+		{
+			name:  "push event with head ref rule and matching branch",
+			rules: map[string]PullRequestBindingRule{"push": PullRequestBindingRuleHeadRef},
+			token: gh.GitHubTokenContext{
+				EventName:  "push",
+				Ref:        "refs/heads/feature",
+				RefType:    "branch",
+				Repository: "safedep/ghcp",
+			},
+			prNumber: 1,
+			mock: func(m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).Return(&ghapi.PullRequest{
+					Head: &ghapi.PullRequestBranch{
+						Ref:  proto.String("feature"),
+						Repo: &ghapi.Repository{FullName: proto.String("safedep/ghcp")},
+					},
+				}, nil)
+			},
+		},
+		{
+			name:  "push event with head ref rule and pull request from a fork",
+			rules: map[string]PullRequestBindingRule{"push": PullRequestBindingRuleHeadRef},
+			token: gh.GitHubTokenContext{
+				EventName:  "push",
+				Ref:        "refs/heads/feature",
+				RefType:    "branch",
+				Repository: "safedep/ghcp",
+			},
+			prNumber: 1,
+			mock: func(m *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).Return(&ghapi.PullRequest{
+					Head: &ghapi.PullRequestBranch{
+						Ref:  proto.String("feature"),
+						Repo: &ghapi.Repository{FullName: proto.String("someone/ghcp")},
+					},
+				}, nil)
+			},
+			err: "pull request head repository mismatch",
+		},
+		{
+			name:  "push event with head ref rule for a tag",
+			rules: map[string]PullRequestBindingRule{"push": PullRequestBindingRuleHeadRef},
+			token: gh.GitHubTokenContext{
+				EventName: "push",
+				Ref:       "refs/tags/v1.0.0",
+				RefType:   "tag",
+			},
+			prNumber: 1,
+			err:      "ref type is not a branch",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+			if c.mock != nil {
+				c.mock(ghRepoAdapter)
+			}
+
+			config := GitHubCommentProxyServiceConfig{
+				VerifyPullRequestBinding:      true,
+				PullRequestBindingRules:       c.rules,
+				DefaultPullRequestBindingRule: PullRequestBindingRuleDeny,
+			}
+
+			service, err := NewGitHubCommentProxyService(config, github.NewMockGitHubIssueAdapter(t), ghRepoAdapter,
+				github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			err = service.verifyPullRequestBinding(context.Background(), config, c.token, "safedep", "ghcp", c.prNumber)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/lock"
+)
+
+const (
+	// Longest a request waits for another request writing to the same pull request
+	DefaultPullRequestLockTimeout = 10 * time.Second
+
+	// How long the lock of a pull request is held without being extended. The lock
+	// is extended while the request executes, this bounds how long a pull request
+	// is locked when a replica fails while holding the lock.
+	pullRequestLockTTL = time.Minute
+
+	// How often the lock of a pull request is extended
+	pullRequestLockExtendInterval = pullRequestLockTTL / 3
+)
+
+// lockPullRequest serializes the requests writing to the pull request and returns
+// the function releasing the lock. Requests waiting longer than the lock timeout
+// are refused. When the locker is unavailable, requests are refused unless
+// PullRequestLockFailOpen is set.
+func (s *gitHubCommentProxyService) lockPullRequest(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, target pullRequestTarget) (func(), error) {
+	if config.PullRequestLockTimeout == 0 {
+		return func() {}, nil
+	}
+
+	key := fmt.Sprintf("%s/%s#%s", strings.ToLower(target.GetOwner()),
+		strings.ToLower(target.GetRepo()), target.GetPrNumber())
+
+	lockCtx, cancel := context.WithTimeout(ctx, config.PullRequestLockTimeout)
+	defer cancel()
+
+	start := time.Now()
+	lease, err := s.locker.Lock(lockCtx, key, pullRequestLockTTL)
+	pullRequestLockWaitMetric.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			pullRequestLockContendedMetric.Inc()
+			pullRequestLockTimeoutMetric.Inc()
+
+			return nil, newError(ErrorCodeAborted, ErrorReasonPullRequestBusy,
+				fmt.Errorf("timed out waiting for another request on the pull request: %w", err))
+		}
+
+		if !config.PullRequestLockFailOpen {
+			return nil, newError(ErrorCodeUnavailable, ErrorReasonLockUnavailable,
+				fmt.Errorf("failed to lock pull request: %w", err))
+		}
+
+		log.Errorf("failed to lock pull request, executing request: %s", err)
+		return func() {}, nil
+	}
+
+	if lease.Contended() {
+		pullRequestLockContendedMetric.Inc()
+		log.Debugf("Waited %s for lock of pull request: %s", time.Since(start), key)
+	}
+
+	// A request can make several calls to GitHub, each waiting for its rate limits,
+	// and take longer than the TTL. The lock is held until the request is done.
+	stop := keepAlive(context.WithoutCancel(ctx), pullRequestLockExtendInterval, func(ctx context.Context) {
+		if err := lease.Extend(ctx, pullRequestLockTTL); err != nil {
+			if errors.Is(err, lock.ErrLockLost) {
+				pullRequestLockLostMetric.Inc()
+			}
+
+			log.Errorf("failed to extend lock of pull request %s: %s", key, err)
+		}
+	})
+
+	return func() {
+		stop()
+
+		// The lock is released even when the client has gone away
+		if err := lease.Unlock(context.WithoutCancel(ctx)); err != nil {
+			log.Errorf("failed to unlock pull request: %s", err)
+		}
+	}, nil
+}
@@ -0,0 +1,175 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/lock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type failingLocker struct{}
+
+func (failingLocker) Lock(context.Context, string, time.Duration) (lock.Lease, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestCreatePullRequestCommentSerialized(t *testing.T) {
+	config := GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		BotUsername:               "test-bot",
+		MaxCommentsPerPR:          1,
+		PullRequestLockTimeout:    time.Second,
+	}
+
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+	}
+
+	// Comments on the PR as seen by GitHub. Listing is slow enough
+	// for concurrent requests to interleave without the lock.
+	newIssueAdapter := func(t *testing.T) *github.MockGitHubIssueAdapter {
+		var m sync.Mutex
+		var comments []*ghapi.IssueComment
+
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
+			RunAndReturn(func(context.Context, string, string, int) ([]*ghapi.IssueComment, error) {
+				m.Lock()
+				listed := append([]*ghapi.IssueComment(nil), comments...)
+				m.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+				return listed, nil
+			}).Maybe()
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			RunAndReturn(func(context.Context, string, string, int, string) (*ghapi.IssueComment, error) {
+				m.Lock()
+				defer m.Unlock()
+
+				comment := &ghapi.IssueComment{
+					ID:   ghapi.Ptr(int64(len(comments) + 1)),
+					User: &ghapi.User{Login: ghapi.Ptr("test-bot")},
+				}
+
+				comments = append(comments, comment)
+				return comment, nil
+			}).Maybe()
+
+		return ghIssueAdapter
+	}
+
+	newService := func(t *testing.T, config GitHubCommentProxyServiceConfig,
+		ghIssueAdapter *github.MockGitHubIssueAdapter) *gitHubCommentProxyService {
+		service, err := NewGitHubCommentProxyService(config, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t),
+			github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+		assert.NoError(t, err)
+
+		return service
+	}
+
+	t.Run("concurrent requests do not exceed the comment limit", func(t *testing.T) {
+		ghIssueAdapter := newIssueAdapter(t)
+		service := newService(t, config, ghIssueAdapter)
+
+		errs := make(chan error, 5)
+		for i := 0; i < 5; i++ {
+			go func() {
+				_, err := service.CreatePullRequestComment(context.Background(), request)
+				errs <- err
+			}()
+		}
+
+		succeeded := 0
+		for i := 0; i < 5; i++ {
+			err := <-errs
+			if err == nil {
+				succeeded++
+				continue
+			}
+
+			var serviceErr *Error
+			assert.True(t, errors.As(err, &serviceErr))
+			assert.Equal(t, ErrorReasonCommentLimitReached, serviceErr.Reason)
+		}
+
+		assert.Equal(t, 1, succeeded)
+		ghIssueAdapter.AssertNumberOfCalls(t, "CreateIssueComment", 1)
+	})
+
+	t.Run("request waiting longer than the timeout", func(t *testing.T) {
+		service := newService(t, config, github.NewMockGitHubIssueAdapter(t))
+
+		lease, err := service.locker.Lock(context.Background(), "safedep/ghcp#1", time.Minute)
+		assert.NoError(t, err)
+		defer lease.Unlock(context.Background())
+
+		config := config
+		config.PullRequestLockTimeout = 10 * time.Millisecond
+		assert.NoError(t, service.UpdateConfig(config))
+
+		_, err = service.CreatePullRequestComment(context.Background(), request)
+
+		var serviceErr *Error
+		assert.True(t, errors.As(err, &serviceErr))
+		assert.Equal(t, ErrorCodeAborted, serviceErr.Code)
+		assert.Equal(t, ErrorReasonPullRequestBusy, serviceErr.Reason)
+	})
+
+	t.Run("other pull requests are not blocked", func(t *testing.T) {
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 2).Return(nil, nil).Once()
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 2, "test comment").
+			Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(1))}, nil).Once()
+
+		service := newService(t, config, ghIssueAdapter)
+
+		lease, err := service.locker.Lock(context.Background(), "safedep/ghcp#1", time.Minute)
+		assert.NoError(t, err)
+		defer lease.Unlock(context.Background())
+
+		other := &ghcpv1.CreatePullRequestCommentRequest{
+			Owner:    "safedep",
+			Repo:     "ghcp",
+			PrNumber: "2",
+			Body:     "test comment",
+		}
+
+		_, err = service.CreatePullRequestComment(context.Background(), other)
+		assert.NoError(t, err)
+	})
+
+	t.Run("request refused when the locker is unavailable", func(t *testing.T) {
+		service := newService(t, config, github.NewMockGitHubIssueAdapter(t))
+		service.SetLocker(failingLocker{})
+
+		_, err := service.CreatePullRequestComment(context.Background(), request)
+
+		var serviceErr *Error
+		assert.True(t, errors.As(err, &serviceErr))
+		assert.Equal(t, ErrorCodeUnavailable, serviceErr.Code)
+		assert.Equal(t, ErrorReasonLockUnavailable, serviceErr.Reason)
+	})
+
+	t.Run("request executed when the locker is unavailable and fail open is set", func(t *testing.T) {
+		config := config
+		config.PullRequestLockFailOpen = true
+
+		ghIssueAdapter := newIssueAdapter(t)
+		service := newService(t, config, ghIssueAdapter)
+		service.SetLocker(failingLocker{})
+
+		_, err := service.CreatePullRequestComment(context.Background(), request)
+		assert.NoError(t, err)
+	})
+}
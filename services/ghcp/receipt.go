@@ -0,0 +1,51 @@
+package ghcp
+
+import (
+	"context"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/safedep/ghcp/pkg/receipt"
+)
+
+// issueReceipt returns the signed receipt of the comment. The comment is already
+// posted, the receipt is omitted when it can not be issued.
+func (s *gitHubCommentProxyService) issueReceipt(ctx context.Context,
+	request *ghcpv1.CreatePullRequestCommentRequest, result *PullRequestCommentResult) string {
+	// The token context is absent when authorization is skipped
+	tokenContext, _ := gh.ExtractGitHubTokenContext(ctx)
+
+	repositoryID, err := s.repositoryID(ctx, tokenContext, request.GetOwner(), request.GetRepo())
+	if err != nil {
+		receiptFailedMetric.Inc()
+		log.Errorf("failed to issue receipt: %s", err)
+		return ""
+	}
+
+	token, err := s.receiptSigner.Sign(receipt.Claims{
+		RepositoryID: repositoryID,
+		Repository:   request.GetOwner() + "/" + request.GetRepo(),
+		PrNumber:     request.GetPrNumber(),
+		CommentID:    result.Response.GetCommentId(),
+		Action:       string(result.Action),
+		BodySHA256:   bodyDigest(request.GetBody()),
+		Caller: receipt.Caller{
+			TokenType:   string(tokenContext.TokenType),
+			Issuer:      tokenContext.Issuer,
+			Subject:     tokenContext.Subject,
+			Actor:       tokenContext.Actor,
+			Repository:  tokenContext.Repository,
+			WorkflowRef: tokenContext.WorkflowRef,
+			RunID:       tokenContext.RunID,
+			RunAttempt:  tokenContext.RunAttempt,
+		},
+	})
+	if err != nil {
+		receiptFailedMetric.Inc()
+		log.Errorf("failed to issue receipt: %s", err)
+		return ""
+	}
+
+	return token
+}
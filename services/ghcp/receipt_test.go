@@ -0,0 +1,210 @@
+package ghcp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/safedep/ghcp/pkg/receipt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreatePullRequestCommentReceipt(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	signer, err := receipt.NewSigner("https://ghcp.example.com", key)
+	assert.NoError(t, err)
+
+	token := gh.GitHubTokenContext{
+		Issuer:       "https://token.actions.githubusercontent.com",
+		Subject:      "repo:safedep/ghcp:pull_request",
+		Repository:   "safedep/ghcp",
+		RepositoryID: "100",
+		Actor:        "octocat",
+		WorkflowRef:  "safedep/ghcp/.github/workflows/vet.yml@refs/pull/1/merge",
+		RunID:        "42",
+		RunAttempt:   "1",
+		TokenType:    gh.TokenTypeWorkloadIdentity,
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		BotUsername:               "test-bot",
+	}
+
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+	}
+
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		signer *receipt.Signer
+		mock   func(*github.MockGitHubIssueAdapter, *github.MockGitHubRepositoryAdapter)
+		assert func(*testing.T, *PullRequestCommentResult)
+	}{
+		{
+			name:   "receipt of the caller",
+			ctx:    gh.InjectGitHubTokenContext(context.Background(), token),
+			signer: signer,
+			mock: func(m *github.MockGitHubIssueAdapter, _ *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+					Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil)
+			},
+			assert: func(t *testing.T, result *PullRequestCommentResult) {
+				claims, err := receipt.Verify(result.Receipt, signer.JWKS())
+				assert.NoError(t, err)
+
+				assert.Equal(t, "https://ghcp.example.com", claims.Issuer)
+				assert.Equal(t, "100", claims.RepositoryID)
+				assert.Equal(t, "safedep/ghcp", claims.Repository)
+				assert.Equal(t, "1", claims.PrNumber)
+				assert.Equal(t, "10", claims.CommentID)
+				assert.Equal(t, "created", claims.Action)
+				assert.Equal(t, bodyDigest("test comment"), claims.BodySHA256)
+				assert.Equal(t, receipt.Caller{
+					TokenType:   "workload_identity",
+					Issuer:      "https://token.actions.githubusercontent.com",
+					Subject:     "repo:safedep/ghcp:pull_request",
+					Actor:       "octocat",
+					Repository:  "safedep/ghcp",
+					WorkflowRef: "safedep/ghcp/.github/workflows/vet.yml@refs/pull/1/merge",
+					RunID:       "42",
+					RunAttempt:  "1",
+				}, claims.Caller)
+			},
+		},
+		{
+			name:   "repository id from github",
+			ctx:    context.Background(),
+			signer: signer,
+			mock: func(m *github.MockGitHubIssueAdapter, r *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+					Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil)
+				r.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+					Return(&ghapi.Repository{ID: ghapi.Ptr(int64(200))}, nil)
+			},
+			assert: func(t *testing.T, result *PullRequestCommentResult) {
+				claims, err := receipt.Verify(result.Receipt, signer.JWKS())
+				assert.NoError(t, err)
+
+				assert.Equal(t, "200", claims.RepositoryID)
+				assert.Empty(t, claims.Caller)
+			},
+		},
+		{
+			name:   "no receipt when the repository id is unavailable",
+			ctx:    context.Background(),
+			signer: signer,
+			mock: func(m *github.MockGitHubIssueAdapter, r *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+					Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil)
+				r.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+					Return(nil, assert.AnError)
+			},
+			assert: func(t *testing.T, result *PullRequestCommentResult) {
+				assert.Equal(t, "10", result.Response.GetCommentId())
+				assert.Empty(t, result.Receipt)
+			},
+		},
+		{
+			name: "no receipt without a signer",
+			ctx:  gh.InjectGitHubTokenContext(context.Background(), token),
+			mock: func(m *github.MockGitHubIssueAdapter, _ *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+					Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil)
+			},
+			assert: func(t *testing.T, result *PullRequestCommentResult) {
+				assert.Empty(t, result.Receipt)
+			},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+			test.mock(ghIssueAdapter, ghRepoAdapter)
+
+			service, err := NewGitHubCommentProxyService(config, ghIssueAdapter, ghRepoAdapter,
+				github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			if test.signer != nil {
+				service.SetReceiptSigner(test.signer)
+			}
+
+			result, err := service.CreatePullRequestComment(test.ctx, request)
+			assert.NoError(t, err)
+
+			test.assert(t, result)
+		})
+	}
+}
+
+func TestCreatePullRequestCommentReceiptReplayed(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	signer, err := receipt.NewSigner("https://ghcp.example.com", key)
+	assert.NoError(t, err)
+
+	config := GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		BotUsername:               "test-bot",
+		IdempotencyKeyTTL:         time.Hour,
+	}
+
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+	}
+
+	ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+	ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+		Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil).Once()
+
+	service, err := NewGitHubCommentProxyService(config, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t),
+		github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+	assert.NoError(t, err)
+
+	service.SetReceiptSigner(signer)
+
+	caller := func(runID string) context.Context {
+		ctx := gh.InjectGitHubTokenContext(context.Background(), gh.GitHubTokenContext{
+			Repository:   "safedep/ghcp",
+			RepositoryID: "100",
+			RunID:        runID,
+			TokenType:    gh.TokenTypeWorkloadIdentity,
+		})
+
+		return InjectIdempotencyKey(ctx, "key")
+	}
+
+	first, err := service.CreatePullRequestComment(caller("42"), request)
+	assert.NoError(t, err)
+
+	// A replay by another run returns the receipt of the run that posted the comment
+	replayed, err := service.CreatePullRequestComment(caller("43"), request)
+	assert.NoError(t, err)
+	assert.True(t, replayed.Replayed)
+	assert.Equal(t, first.Receipt, replayed.Receipt)
+
+	claims, err := receipt.Verify(replayed.Receipt, signer.JWKS())
+	assert.NoError(t, err)
+	assert.Equal(t, "42", claims.Caller.RunID)
+}
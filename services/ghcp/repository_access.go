@@ -0,0 +1,91 @@
+package ghcp
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/safedep/dry/log"
+)
+
+// RepositoryAccessDenialReason identifies the access list that refused a repository
+type RepositoryAccessDenialReason string
+
+const (
+	RepositoryAccessDeniedRepository RepositoryAccessDenialReason = "repository_denied"
+	RepositoryAccessDeniedOwner      RepositoryAccessDenialReason = "owner_denied"
+	RepositoryAccessNotAllowed       RepositoryAccessDenialReason = "not_allowed"
+)
+
+// RepositoryAccessDeniedError is returned when a repository is refused by the
+// access lists. The reason and the IDs are retained for auditing.
+type RepositoryAccessDeniedError struct {
+	Reason            RepositoryAccessDenialReason
+	RepositoryID      string
+	RepositoryOwnerID string
+}
+
+func (e *RepositoryAccessDeniedError) Error() string {
+	switch e.Reason {
+	case RepositoryAccessDeniedRepository:
+		return fmt.Sprintf("repository is denied: %s", e.RepositoryID)
+	case RepositoryAccessDeniedOwner:
+		return fmt.Sprintf("repository owner is denied: %s", e.RepositoryOwnerID)
+	default:
+		return fmt.Sprintf("repository is not allowed: %s", e.RepositoryID)
+	}
+}
+
+// hasRepositoryAccessLists returns true when any of the access lists is set
+func (c GitHubCommentProxyServiceConfig) hasRepositoryAccessLists() bool {
+	return len(c.AllowedRepositoryIDs) > 0 || len(c.AllowedOwnerIDs) > 0 ||
+		len(c.DeniedRepositoryIDs) > 0 || len(c.DeniedOwnerIDs) > 0
+}
+
+// verifyRepositoryAccessLists verifies the repository against the access lists using
+// its immutable IDs. Denied IDs take precedence over allowed IDs.
+func verifyRepositoryAccessLists(config GitHubCommentProxyServiceConfig, repositoryID, ownerID string) error {
+	if !config.hasRepositoryAccessLists() {
+		return nil
+	}
+
+	var reason RepositoryAccessDenialReason
+	switch {
+	case containsID(config.DeniedRepositoryIDs, repositoryID):
+		reason = RepositoryAccessDeniedRepository
+	case containsID(config.DeniedOwnerIDs, ownerID):
+		reason = RepositoryAccessDeniedOwner
+	case len(config.AllowedRepositoryIDs) == 0 && len(config.AllowedOwnerIDs) == 0:
+		return nil
+	case containsID(config.AllowedRepositoryIDs, repositoryID) || containsID(config.AllowedOwnerIDs, ownerID):
+		return nil
+	default:
+		reason = RepositoryAccessNotAllowed
+	}
+
+	repositoryAccessDeniedMetric.WithLabels(map[string]string{"reason": string(reason)}).Inc()
+	log.Warnf("Repository access denied: reason=%s repository_id=%s repository_owner_id=%s",
+		reason, repositoryID, ownerID)
+
+	return &RepositoryAccessDeniedError{
+		Reason:            reason,
+		RepositoryID:      repositoryID,
+		RepositoryOwnerID: ownerID,
+	}
+}
+
+// containsID returns true when the ID is in the list. IDs that are missing
+// or not numeric never match.
+func containsID(ids []int64, id string) bool {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	for _, v := range ids {
+		if v == n {
+			return true
+		}
+	}
+
+	return false
+}
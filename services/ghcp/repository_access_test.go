@@ -0,0 +1,188 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVerifyRepositoryAccessLists(t *testing.T) {
+	cases := []struct {
+		name         string
+		config       GitHubCommentProxyServiceConfig
+		repositoryID string
+		ownerID      string
+		reason       RepositoryAccessDenialReason
+	}{
+		{
+			name:         "no access lists",
+			repositoryID: "100",
+			ownerID:      "10",
+		},
+		{
+			name:         "repository not denied",
+			config:       GitHubCommentProxyServiceConfig{DeniedRepositoryIDs: []int64{200}, DeniedOwnerIDs: []int64{20}},
+			repositoryID: "100",
+			ownerID:      "10",
+		},
+		{
+			name:         "repository denied",
+			config:       GitHubCommentProxyServiceConfig{DeniedRepositoryIDs: []int64{100}},
+			repositoryID: "100",
+			ownerID:      "10",
+			reason:       RepositoryAccessDeniedRepository,
+		},
+		{
+			name:         "owner denied",
+			config:       GitHubCommentProxyServiceConfig{DeniedOwnerIDs: []int64{10}},
+			repositoryID: "100",
+			ownerID:      "10",
+			reason:       RepositoryAccessDeniedOwner,
+		},
+		{
+			name:         "repository allowed",
+			config:       GitHubCommentProxyServiceConfig{AllowedRepositoryIDs: []int64{100}},
+			repositoryID: "100",
+			ownerID:      "10",
+		},
+		{
+			name:         "owner allowed",
+			config:       GitHubCommentProxyServiceConfig{AllowedOwnerIDs: []int64{10}},
+			repositoryID: "100",
+			ownerID:      "10",
+		},
+		{
+			name:         "repository not allowed",
+			config:       GitHubCommentProxyServiceConfig{AllowedRepositoryIDs: []int64{200}, AllowedOwnerIDs: []int64{20}},
+			repositoryID: "100",
+			ownerID:      "10",
+			reason:       RepositoryAccessNotAllowed,
+		},
+		{
+			name:         "denied repository of an allowed owner",
+			config:       GitHubCommentProxyServiceConfig{AllowedOwnerIDs: []int64{10}, DeniedRepositoryIDs: []int64{100}},
+			repositoryID: "100",
+			ownerID:      "10",
+			reason:       RepositoryAccessDeniedRepository,
+		},
+		{
+			name:   "missing ids are not allowed",
+			config: GitHubCommentProxyServiceConfig{AllowedOwnerIDs: []int64{10}},
+			reason: RepositoryAccessNotAllowed,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := verifyRepositoryAccessLists(c.config, c.repositoryID, c.ownerID)
+			if c.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var accessErr *RepositoryAccessDeniedError
+			assert.True(t, errors.As(err, &accessErr))
+			assert.Equal(t, c.reason, accessErr.Reason)
+			assert.Equal(t, c.repositoryID, accessErr.RepositoryID)
+			assert.Equal(t, c.ownerID, accessErr.RepositoryOwnerID)
+		})
+	}
+}
+
+func TestCreatePullRequestCommentWithRepositoryAccessLists(t *testing.T) {
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+	}
+
+	t.Run("workload identity token of a denied owner", func(t *testing.T) {
+		service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+			GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			DeniedOwnerIDs:       []int64{10},
+		}, github.NewMockGitHubIssueAdapter(t), github.NewMockGitHubRepositoryAdapter(t),
+			github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+		assert.NoError(t, err)
+
+		ctx := gh.InjectGitHubTokenContext(context.Background(), gh.GitHubTokenContext{
+			Repository:        "safedep/ghcp",
+			RepositoryOwner:   "safedep",
+			RepositoryID:      "100",
+			RepositoryOwnerID: "10",
+			Audience:          []string{GitHubTokenAudienceName},
+			TokenType:         gh.TokenTypeWorkloadIdentity,
+		})
+
+		res, err := service.Execute(ctx, request)
+		assert.ErrorContains(t, err, "repository owner is denied: 10")
+		assert.Nil(t, res)
+
+		var accessErr *RepositoryAccessDeniedError
+		assert.True(t, errors.As(err, &accessErr))
+		assert.Equal(t, RepositoryAccessDeniedOwner, accessErr.Reason)
+	})
+
+	t.Run("action token of a repository not allowed", func(t *testing.T) {
+		ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+		ghRepoAdapter.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+			Return(&ghapi.Repository{
+				ID:         ghapi.Ptr(int64(100)),
+				Owner:      &ghapi.User{ID: ghapi.Ptr(int64(10))},
+				Visibility: ghapi.Ptr("public"),
+			}, nil)
+
+		service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+			AllowedRepositoryIDs: []int64{200},
+		}, github.NewMockGitHubIssueAdapter(t), ghRepoAdapter,
+			github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+		assert.NoError(t, err)
+
+		ctx := gh.InjectGitHubTokenContext(context.Background(), gh.GitHubTokenContext{
+			TokenType:    gh.TokenTypeAction,
+			Repositories: []gh.GitHubTokenRepository{{ID: "100", FullName: "safedep/ghcp"}},
+		})
+
+		res, err := service.Execute(ctx, request)
+		assert.ErrorContains(t, err, "repository is not allowed: 100")
+		assert.Nil(t, res)
+	})
+
+	t.Run("action token of an allowed owner", func(t *testing.T) {
+		ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+		ghRepoAdapter.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+			Return(&ghapi.Repository{
+				ID:         ghapi.Ptr(int64(100)),
+				Owner:      &ghapi.User{ID: ghapi.Ptr(int64(10))},
+				Visibility: ghapi.Ptr("public"),
+			}, nil)
+		ghRepoAdapter.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+			Return(&ghapi.PullRequest{State: ghapi.Ptr("open")}, nil)
+
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(1))}, nil)
+
+		service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+			AllowedOwnerIDs: []int64{10},
+		}, ghIssueAdapter, ghRepoAdapter,
+			github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+		assert.NoError(t, err)
+
+		ctx := gh.InjectGitHubTokenContext(context.Background(), gh.GitHubTokenContext{
+			TokenType:    gh.TokenTypeAction,
+			Repositories: []gh.GitHubTokenRepository{{ID: "100", FullName: "safedep/ghcp"}},
+		})
+
+		res, err := service.Execute(ctx, request)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", res.GetCommentId())
+	})
+}
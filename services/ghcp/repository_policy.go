@@ -0,0 +1,222 @@
+package ghcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/gh"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Path of the policy file read from the default branch of the repository
+	DefaultRepositoryPolicyPath = ".github/ghcp.yml"
+
+	defaultRepositoryPolicyCacheTTL = 5 * time.Minute
+
+	workflowPathPrefix = ".github/workflows/"
+)
+
+// RepositoryPolicy is the policy of a repository owner for the bot. The policy
+// is applied on top of the service configuration and can only tighten it.
+//
+//	disabled: false
+//	allowed_workflows:
+//	  - .github/workflows/vet.yml
+//	max_comments_per_pr: 1
+//	max_review_comments_per_pr: 10
+//	allow_review_comments: true
+//	allow_checks: true
+type RepositoryPolicy struct {
+	// If true, the repository has opted out and all requests are refused
+	Disabled bool `yaml:"disabled"`
+
+	// Workflows of the repository allowed to use the service. Empty allows all.
+	AllowedWorkflows []string `yaml:"allowed_workflows"`
+
+	// Lower limits for comments by the bot. Zero keeps the service limit.
+	MaxCommentsPerPR       int `yaml:"max_comments_per_pr"`
+	MaxReviewCommentsPerPR int `yaml:"max_review_comments_per_pr"`
+
+	// Review comments are allowed unless set to false
+	AllowReviewComments *bool `yaml:"allow_review_comments"`
+
+	// Check runs and commit statuses are only allowed when set to true
+	AllowChecks bool `yaml:"allow_checks"`
+}
+
+// parseRepositoryPolicy parses the policy file. Unknown fields are rejected
+// so that a typo does not silently leave the repository unprotected.
+func parseRepositoryPolicy(data []byte) (*RepositoryPolicy, error) {
+	policy := &RepositoryPolicy{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse repository policy: %w", err)
+	}
+
+	if policy.MaxCommentsPerPR < 0 || policy.MaxReviewCommentsPerPR < 0 {
+		return nil, errors.New("repository policy limits must not be negative")
+	}
+
+	for _, workflow := range policy.AllowedWorkflows {
+		if !strings.HasPrefix(workflow, workflowPathPrefix) {
+			return nil, fmt.Errorf("repository policy workflow must be in %s: %s", workflowPathPrefix, workflow)
+		}
+	}
+
+	return policy, nil
+}
+
+// apply returns the configuration tightened by the policy
+func (p *RepositoryPolicy) apply(config GitHubCommentProxyServiceConfig) GitHubCommentProxyServiceConfig {
+	config.MaxCommentsPerPR = lowerLimit(config.MaxCommentsPerPR, p.MaxCommentsPerPR)
+	config.MaxReviewCommentsPerPR = lowerLimit(config.MaxReviewCommentsPerPR, p.MaxReviewCommentsPerPR)
+
+	if p.AllowReviewComments != nil && !*p.AllowReviewComments {
+		config.DisableReviewComments = true
+	}
+
+	if !p.AllowChecks {
+		config.EnableChecks = false
+	}
+
+	return config
+}
+
+// allowsWorkflow returns true if the workflow of the token is allowed by the policy.
+// The workflow is only known for GitHub Workload Identity Tokens.
+func (p *RepositoryPolicy) allowsWorkflow(tokenContext gh.GitHubTokenContext, owner, repo string) bool {
+	if len(p.AllowedWorkflows) == 0 {
+		return true
+	}
+
+	// The workflow ref is owner/repo/path@ref of the workflow that was triggered,
+	// reusable workflows it calls are governed by the calling workflow
+	workflow, _, _ := strings.Cut(tokenContext.WorkflowRef, "@")
+	prefix := strings.ToLower(fmt.Sprintf("%s/%s/", owner, repo))
+	if workflow == "" || !strings.HasPrefix(strings.ToLower(workflow), prefix) {
+		return false
+	}
+
+	workflow = workflow[len(prefix):]
+	for _, allowed := range p.AllowedWorkflows {
+		if workflow == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lowerLimit returns the lower of the limits where zero means no limit
+func lowerLimit(limit, policyLimit int) int {
+	if policyLimit > 0 && (limit == 0 || policyLimit < limit) {
+		return policyLimit
+	}
+
+	return limit
+}
+
+type cachedRepositoryPolicy struct {
+	policy    *RepositoryPolicy
+	err       error
+	fetchedAt time.Time
+}
+
+// repositoryPolicyCache caches the policies of repositories, including
+// the absence of a policy and invalid policies
+type repositoryPolicyCache struct {
+	m        sync.Mutex
+	policies map[string]cachedRepositoryPolicy
+}
+
+func newRepositoryPolicyCache() *repositoryPolicyCache {
+	return &repositoryPolicyCache{policies: make(map[string]cachedRepositoryPolicy)}
+}
+
+func (c *repositoryPolicyCache) get(key string, ttl time.Duration) (cachedRepositoryPolicy, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	cached, ok := c.policies[key]
+	if !ok || time.Since(cached.fetchedAt) >= ttl {
+		return cachedRepositoryPolicy{}, false
+	}
+
+	return cached, true
+}
+
+func (c *repositoryPolicyCache) put(key string, cached cachedRepositoryPolicy) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.policies[key] = cached
+}
+
+// repositoryPolicy returns the policy of the repository or nil when the repository
+// has no policy. Failures to read the policy are not cached.
+func (s *gitHubCommentProxyService) repositoryPolicy(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, owner, repo string) (*RepositoryPolicy, error) {
+	key := strings.ToLower(fmt.Sprintf("%s/%s", owner, repo))
+	if cached, ok := s.repositoryPolicies.get(key, config.RepositoryPolicyCacheTTL); ok {
+		return cached.policy, cached.err
+	}
+
+	cached := cachedRepositoryPolicy{fetchedAt: time.Now()}
+
+	content, err := s.ghRepoAdapter.GetFileContent(ctx, owner, repo, config.RepositoryPolicyPath)
+	switch {
+	case errors.Is(err, github.ErrNotFound):
+		log.Debugf("No repository policy found for %s", key)
+	case err != nil:
+		return nil, fmt.Errorf("failed to get repository policy: %w", err)
+	default:
+		cached.policy, cached.err = parseRepositoryPolicy(content)
+	}
+
+	s.repositoryPolicies.put(key, cached)
+	return cached.policy, cached.err
+}
+
+// applyRepositoryPolicy verifies the request against the policy of the repository
+// and returns the configuration tightened by the policy
+func (s *gitHubCommentProxyService) applyRepositoryPolicy(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, tokenContext gh.GitHubTokenContext,
+	target pullRequestTarget) (GitHubCommentProxyServiceConfig, error) {
+	policy, err := s.repositoryPolicy(ctx, config, target.GetOwner(), target.GetRepo())
+	if err != nil {
+		return config, err
+	}
+
+	// Checks must be allowed by the policy, a repository without a policy
+	// has not opted in
+	if policy == nil {
+		config.EnableChecks = false
+		return config, nil
+	}
+
+	if policy.Disabled {
+		repositoryPolicyDeniedMetric.Inc()
+		return config, newError(ErrorCodePermissionDenied, ErrorReasonRepositoryOptedOut,
+			errors.New("repository has opted out of the service"))
+	}
+
+	if !policy.allowsWorkflow(tokenContext, target.GetOwner(), target.GetRepo()) {
+		repositoryPolicyDeniedMetric.Inc()
+		return config, newError(ErrorCodePermissionDenied, ErrorReasonWorkflowNotAllowed,
+			fmt.Errorf("workflow is not allowed by repository policy: %s", tokenContext.WorkflowRef))
+	}
+
+	return policy.apply(config), nil
+}
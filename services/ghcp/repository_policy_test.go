@@ -0,0 +1,346 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseRepositoryPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		policy  *RepositoryPolicy
+		err     string
+	}{
+		{
+			name:    "empty policy",
+			content: "",
+			policy:  &RepositoryPolicy{},
+		},
+		{
+			name: "full policy",
+			content: `
+disabled: false
+allowed_workflows:
+  - .github/workflows/vet.yml
+max_comments_per_pr: 1
+max_review_comments_per_pr: 10
+allow_review_comments: true
+allow_checks: true
+`,
+			policy: &RepositoryPolicy{
+				AllowedWorkflows:       []string{".github/workflows/vet.yml"},
+				MaxCommentsPerPR:       1,
+				MaxReviewCommentsPerPR: 10,
+				AllowReviewComments:    ghapi.Ptr(true),
+				AllowChecks:            true,
+			},
+		},
+		{
+			name:    "unknown field",
+			content: "disable: true",
+			err:     "field disable not found",
+		},
+		{
+			name:    "negative limit",
+			content: "max_comments_per_pr: -1",
+			err:     "repository policy limits must not be negative",
+		},
+		{
+			name:    "workflow outside workflows directory",
+			content: "allowed_workflows: [vet.yml]",
+			err:     "repository policy workflow must be in .github/workflows/: vet.yml",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			policy, err := parseRepositoryPolicy([]byte(c.content))
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.policy, policy)
+		})
+	}
+}
+
+func TestRepositoryPolicyApply(t *testing.T) {
+	cases := []struct {
+		name   string
+		config GitHubCommentProxyServiceConfig
+		policy RepositoryPolicy
+		result GitHubCommentProxyServiceConfig
+	}{
+		{
+			name:   "lower limits are applied",
+			config: GitHubCommentProxyServiceConfig{MaxCommentsPerPR: 3, MaxReviewCommentsPerPR: 0},
+			policy: RepositoryPolicy{MaxCommentsPerPR: 1, MaxReviewCommentsPerPR: 5},
+			result: GitHubCommentProxyServiceConfig{MaxCommentsPerPR: 1, MaxReviewCommentsPerPR: 5},
+		},
+		{
+			name:   "higher limits are ignored",
+			config: GitHubCommentProxyServiceConfig{MaxCommentsPerPR: 3, MaxReviewCommentsPerPR: 50},
+			policy: RepositoryPolicy{MaxCommentsPerPR: 10, MaxReviewCommentsPerPR: 100},
+			result: GitHubCommentProxyServiceConfig{MaxCommentsPerPR: 3, MaxReviewCommentsPerPR: 50},
+		},
+		{
+			name:   "features are disabled",
+			config: GitHubCommentProxyServiceConfig{EnableChecks: true},
+			policy: RepositoryPolicy{AllowReviewComments: ghapi.Ptr(false), AllowChecks: false},
+			result: GitHubCommentProxyServiceConfig{DisableReviewComments: true},
+		},
+		{
+			name:   "checks are disabled unless allowed",
+			config: GitHubCommentProxyServiceConfig{EnableChecks: true},
+			policy: RepositoryPolicy{},
+			result: GitHubCommentProxyServiceConfig{},
+		},
+		{
+			name:   "checks are allowed",
+			config: GitHubCommentProxyServiceConfig{EnableChecks: true},
+			policy: RepositoryPolicy{AllowChecks: true},
+			result: GitHubCommentProxyServiceConfig{EnableChecks: true},
+		},
+		{
+			name:   "features are not enabled",
+			config: GitHubCommentProxyServiceConfig{DisableReviewComments: true},
+			policy: RepositoryPolicy{AllowReviewComments: ghapi.Ptr(true), AllowChecks: true},
+			result: GitHubCommentProxyServiceConfig{DisableReviewComments: true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.result, c.policy.apply(c.config))
+		})
+	}
+}
+
+func TestRepositoryPolicyAllowsWorkflow(t *testing.T) {
+	policy := RepositoryPolicy{AllowedWorkflows: []string{".github/workflows/vet.yml"}}
+
+	cases := []struct {
+		name        string
+		workflowRef string
+		allowed     bool
+	}{
+		{"allowed workflow", "safedep/ghcp/.github/workflows/vet.yml@refs/pull/1/merge", true},
+		{"allowed workflow with different case in repository", "SafeDep/GHCP/.github/workflows/vet.yml@refs/heads/main", true},
+		{"other workflow", "safedep/ghcp/.github/workflows/ci.yml@refs/heads/main", false},
+		{"workflow of another repository", "safedep/other/.github/workflows/vet.yml@refs/heads/main", false},
+		{"no workflow", "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tokenContext := gh.GitHubTokenContext{WorkflowRef: c.workflowRef}
+			assert.Equal(t, c.allowed, policy.allowsWorkflow(tokenContext, "safedep", "ghcp"))
+		})
+	}
+}
+
+func TestCreatePullRequestCommentWithRepositoryPolicy(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		Repository:           "safedep/ghcp",
+		RepositoryOwner:      "safedep",
+		RepositoryVisibility: "public",
+		WorkflowRef:          "safedep/ghcp/.github/workflows/vet.yml@refs/pull/1/merge",
+		Audience:             []string{GitHubTokenAudienceName},
+		TokenType:            gh.TokenTypeWorkloadIdentity,
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		BotUsername:              "safedep-bot",
+		MaxCommentsPerPR:         3,
+		GitHubTokenAudiences:     []string{GitHubTokenAudienceName},
+		RepositoryPolicyPath:     DefaultRepositoryPolicyPath,
+		RepositoryPolicyCacheTTL: time.Minute,
+	}
+
+	botComment := &ghapi.IssueComment{User: &ghapi.User{Login: ghapi.Ptr("safedep-bot")}}
+
+	cases := []struct {
+		name      string
+		policy    string
+		policyErr error
+		comments  []*ghapi.IssueComment
+		created   bool
+		err       string
+		reason    string
+	}{
+		{
+			name:      "comment without policy",
+			policyErr: fmt.Errorf("file: %w", github.ErrNotFound),
+			comments:  []*ghapi.IssueComment{botComment},
+			created:   true,
+		},
+		{
+			name:     "comment with allowed workflow",
+			policy:   "allowed_workflows: [.github/workflows/vet.yml]",
+			comments: []*ghapi.IssueComment{botComment},
+			created:  true,
+		},
+		{
+			name:     "comment limit lowered by policy",
+			policy:   "max_comments_per_pr: 1",
+			comments: []*ghapi.IssueComment{botComment},
+			err:      "maximum number of comments (1) reached for PR",
+		},
+		{
+			name:   "repository opted out",
+			policy: "disabled: true",
+			err:    "repository has opted out of the service",
+			reason: ErrorReasonRepositoryOptedOut,
+		},
+		{
+			name:   "workflow not allowed",
+			policy: "allowed_workflows: [.github/workflows/ci.yml]",
+			err:    "workflow is not allowed by repository policy",
+			reason: ErrorReasonWorkflowNotAllowed,
+		},
+		{
+			name:   "invalid policy",
+			policy: "disable: true",
+			err:    "failed to parse repository policy",
+			reason: ErrorReasonUnauthorized,
+		},
+		{
+			name:      "policy can not be read",
+			policyErr: errors.New("server error"),
+			err:       "failed to get repository policy: server error",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+
+			ghRepoAdapter.EXPECT().GetFileContent(mock.Anything, "safedep", "ghcp", DefaultRepositoryPolicyPath).
+				Return([]byte(c.policy), c.policyErr).Once()
+
+			if c.comments != nil {
+				ghIssueAdapter.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).Return(c.comments, nil)
+			}
+
+			if c.created {
+				ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+					Return(&ghapi.IssueComment{ID: ghapi.Ptr(int64(10))}, nil)
+			}
+
+			service, err := NewGitHubCommentProxyService(config, ghIssueAdapter, ghRepoAdapter,
+				github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+			res, err := service.Execute(ctx, &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+			})
+
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				assert.Nil(t, res)
+
+				var serviceErr *Error
+				if c.reason != "" && assert.True(t, errors.As(err, &serviceErr)) {
+					assert.Equal(t, ErrorCodePermissionDenied, serviceErr.Code)
+					assert.Equal(t, c.reason, serviceErr.Reason)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "10", res.GetCommentId())
+		})
+	}
+
+	t.Run("policy is cached", func(t *testing.T) {
+		ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+		ghRepoAdapter.EXPECT().GetFileContent(mock.Anything, "safedep", "ghcp", DefaultRepositoryPolicyPath).
+			Return([]byte("disabled: true"), nil).Once()
+
+		service, err := NewGitHubCommentProxyService(config, github.NewMockGitHubIssueAdapter(t), ghRepoAdapter,
+			github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+		assert.NoError(t, err)
+
+		ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+		for i := 0; i < 2; i++ {
+			_, err := service.Execute(ctx, &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+			})
+
+			assert.ErrorContains(t, err, "repository has opted out of the service")
+		}
+	})
+
+	t.Run("review comments disabled by policy", func(t *testing.T) {
+		ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+		ghRepoAdapter.EXPECT().GetFileContent(mock.Anything, "safedep", "ghcp", DefaultRepositoryPolicyPath).
+			Return([]byte("allow_review_comments: false"), nil).Once()
+
+		service, err := NewGitHubCommentProxyService(config, github.NewMockGitHubIssueAdapter(t), ghRepoAdapter,
+			github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+		assert.NoError(t, err)
+
+		ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+		_, err = service.CreatePullRequestReview(ctx, &CreatePullRequestReviewRequest{
+			Owner:    "safedep",
+			Repo:     "ghcp",
+			PrNumber: "1",
+			Comments: []*PullRequestReviewComment{{Path: "go.mod", Line: 3, Body: "vulnerable"}},
+		})
+
+		assert.ErrorContains(t, err, "review comments are disabled for the repository")
+	})
+}
+
+func TestCreateCommitStatusWithoutRepositoryPolicy(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		Repository:      "safedep/ghcp",
+		RepositoryOwner: "safedep",
+		Audience:        []string{GitHubTokenAudienceName},
+		TokenType:       gh.TokenTypeWorkloadIdentity,
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		BotUsername:          "safedep-bot",
+		GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+		EnableChecks:         true,
+		CheckNamespace:       DefaultCheckNamespace,
+		RepositoryPolicyPath: DefaultRepositoryPolicyPath,
+	}
+
+	ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+	ghRepoAdapter.EXPECT().GetFileContent(mock.Anything, "safedep", "ghcp", DefaultRepositoryPolicyPath).
+		Return(nil, fmt.Errorf("file: %w", github.ErrNotFound))
+
+	service, err := NewGitHubCommentProxyService(config, github.NewMockGitHubIssueAdapter(t), ghRepoAdapter,
+		github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+	assert.NoError(t, err)
+
+	ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+	_, err = service.CreateCommitStatus(ctx, &CreateCommitStatusRequest{
+		Owner: "safedep", Repo: "ghcp", PrNumber: "1", State: "success", Context: "ghcp/vet",
+	})
+
+	assert.ErrorContains(t, err, "checks are disabled for the repository")
+}
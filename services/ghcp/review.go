@@ -0,0 +1,330 @@
+package ghcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/dry/log"
+	"github.com/safedep/ghcp/pkg/audit"
+)
+
+const (
+	// Side of the diff a review comment is anchored to
+	ReviewCommentSideLeft  = "LEFT"
+	ReviewCommentSideRight = "RIGHT"
+
+	// Reviews are created as comments, they never approve or block a PR
+	reviewEventComment = "COMMENT"
+)
+
+// CreatePullRequestReviewRequest is the request to create a review with
+// comments anchored to lines of the pull request diff
+type CreatePullRequestReviewRequest struct {
+	Owner    string                      `json:"owner"`
+	Repo     string                      `json:"repo"`
+	PrNumber string                      `json:"prNumber"`
+	Body     string                      `json:"body,omitempty"`
+	Comments []*PullRequestReviewComment `json:"comments"`
+}
+
+// PullRequestReviewComment is a comment anchored to a line, or a range of
+// lines when StartLine is set, of a file in the pull request diff
+type PullRequestReviewComment struct {
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Side      string `json:"side,omitempty"`
+	StartLine int    `json:"startLine,omitempty"`
+	Body      string `json:"body,omitempty"`
+
+	// Replacement for the lines of the comment. An empty suggestion
+	// suggests removing the lines.
+	Suggestion *string `json:"suggestion,omitempty"`
+}
+
+func (r *CreatePullRequestReviewRequest) GetOwner() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Owner
+}
+
+func (r *CreatePullRequestReviewRequest) GetRepo() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Repo
+}
+
+func (r *CreatePullRequestReviewRequest) GetPrNumber() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.PrNumber
+}
+
+func (r *CreatePullRequestReviewRequest) GetBody() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Body
+}
+
+func (r *CreatePullRequestReviewRequest) GetComments() []*PullRequestReviewComment {
+	if r == nil {
+		return nil
+	}
+
+	return r.Comments
+}
+
+// Validate validates the request
+func (r *CreatePullRequestReviewRequest) Validate() error {
+	if r.GetOwner() == "" {
+		return errors.New("owner is required")
+	}
+
+	if r.GetRepo() == "" {
+		return errors.New("repo is required")
+	}
+
+	if n, err := strconv.Atoi(r.GetPrNumber()); err != nil || n <= 0 {
+		return errors.New("pr_number must be a positive number")
+	}
+
+	if len(r.GetComments()) == 0 {
+		return errors.New("at least one comment is required")
+	}
+
+	for i, comment := range r.GetComments() {
+		if err := comment.validate(); err != nil {
+			return fmt.Errorf("invalid comment %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *PullRequestReviewComment) validate() error {
+	if c == nil {
+		return errors.New("comment is required")
+	}
+
+	if c.Path == "" {
+		return errors.New("path is required")
+	}
+
+	if c.Line <= 0 {
+		return errors.New("line must be a positive number")
+	}
+
+	if c.StartLine < 0 || (c.StartLine > 0 && c.StartLine >= c.Line) {
+		return errors.New("start_line must be before line")
+	}
+
+	switch c.side() {
+	case ReviewCommentSideLeft:
+		if c.Suggestion != nil {
+			return errors.New("suggestion is only allowed on the RIGHT side")
+		}
+	case ReviewCommentSideRight:
+	default:
+		return fmt.Errorf("side must be %s or %s", ReviewCommentSideLeft, ReviewCommentSideRight)
+	}
+
+	if c.Body == "" && c.Suggestion == nil {
+		return errors.New("body or suggestion is required")
+	}
+
+	return nil
+}
+
+func (c *PullRequestReviewComment) side() string {
+	if c.Side == "" {
+		return ReviewCommentSideRight
+	}
+
+	return strings.ToUpper(c.Side)
+}
+
+// body returns the body of the comment with the suggestion block
+// https://docs.github.com/en/pull-requests/collaborating-with-pull-requests/reviewing-changes-in-pull-requests/incorporating-feedback-in-your-pull-request
+func (c *PullRequestReviewComment) body() string {
+	if c.Suggestion == nil {
+		return c.Body
+	}
+
+	// The fence must be longer than any backtick run in the suggestion
+	fence := "```"
+	for strings.Contains(*c.Suggestion, fence) {
+		fence += "`"
+	}
+
+	suggestion := fmt.Sprintf("%ssuggestion\n%s\n%s", fence, strings.TrimSuffix(*c.Suggestion, "\n"), fence)
+	if c.Body == "" {
+		return suggestion
+	}
+
+	return fmt.Sprintf("%s\n\n%s", c.Body, suggestion)
+}
+
+func (c *PullRequestReviewComment) draft() *ghapi.DraftReviewComment {
+	draft := &ghapi.DraftReviewComment{
+		Path: ghapi.Ptr(c.Path),
+		Body: ghapi.Ptr(c.body()),
+		Line: ghapi.Ptr(c.Line),
+		Side: ghapi.Ptr(c.side()),
+	}
+
+	if c.StartLine > 0 {
+		draft.StartLine = ghapi.Ptr(c.StartLine)
+		draft.StartSide = ghapi.Ptr(c.side())
+	}
+
+	return draft
+}
+
+// CreatePullRequestReviewResponse is the response with the ID of the created review
+type CreatePullRequestReviewResponse struct {
+	ReviewId string `json:"reviewId"`
+}
+
+func (r *CreatePullRequestReviewResponse) GetReviewId() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.ReviewId
+}
+
+// CreatePullRequestReview creates a review with line anchored comments on the head
+// commit of the pull request. The request is authorized the same way as creating a comment.
+func (s *gitHubCommentProxyService) CreatePullRequestReview(ctx context.Context,
+	request *CreatePullRequestReviewRequest) (*CreatePullRequestReviewResponse, error) {
+	r, err := func() (*CreatePullRequestReviewResponse, error) {
+		if err := request.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+
+		config, _, err := s.authorize(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		if config.DisableReviewComments {
+			return nil, newError(ErrorCodePermissionDenied, ErrorReasonFeatureDisabled,
+				errors.New("review comments are disabled for the repository"))
+		}
+
+		prNumber, err := strconv.Atoi(request.GetPrNumber())
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert pr number to int: %w", err)
+		}
+
+		unlock, err := s.lockPullRequest(ctx, config, request)
+		if err != nil {
+			return nil, err
+		}
+
+		defer unlock()
+
+		createReviewMetric.Inc()
+		log.Debugf("Creating review on PR: %s with %d comments", request.GetPrNumber(), len(request.GetComments()))
+
+		if config.MaxReviewCommentsPerPR > 0 {
+			if err := s.verifyReviewCommentLimit(ctx, config, prNumber, request); err != nil {
+				return nil, err
+			}
+		}
+
+		// Comments are anchored to the diff of the head commit. The review fails
+		// if the PR is updated in the meantime instead of misplacing comments.
+		pr, err := s.ghRepoAdapter.GetPullRequest(ctx, request.GetOwner(), request.GetRepo(), prNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pull request: %w", err)
+		}
+
+		if pr.GetState() != "open" {
+			return nil, newError(ErrorCodeFailedPrecondition, ErrorReasonPullRequestClosed,
+				fmt.Errorf("pull request is not open: %s", pr.GetState()))
+		}
+
+		review := &ghapi.PullRequestReviewRequest{
+			CommitID: ghapi.Ptr(pr.GetHead().GetSHA()),
+			Event:    ghapi.Ptr(reviewEventComment),
+		}
+
+		if request.GetBody() != "" {
+			review.Body = ghapi.Ptr(request.GetBody())
+		}
+
+		for _, comment := range request.GetComments() {
+			review.Comments = append(review.Comments, comment.draft())
+		}
+
+		res, err := s.ghPullRequestAdapter.CreatePullRequestReview(ctx, request.GetOwner(),
+			request.GetRepo(), prNumber, review)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pull request review: %w", err)
+		}
+
+		return &CreatePullRequestReviewResponse{
+			ReviewId: strconv.FormatInt(res.GetID(), 10),
+		}, nil
+	}()
+
+	record := audit.Record{BodySHA256: bodyDigest(request.GetBody())}
+	if r != nil {
+		record.Action = auditActionCreated
+		record.ResourceID = r.ReviewId
+	}
+
+	s.recordAudit(ctx, auditOperationCreateReview, request, record, err)
+
+	if err != nil {
+		log.Errorf("failed to execute service: %s", err)
+		failedServiceExecutionMetric.Inc()
+		return nil, classifyError(err)
+	}
+
+	successfulServiceExecutionMetric.Inc()
+	return r, nil
+}
+
+// verifyReviewCommentLimit verifies that the review comments by the bot on the PR along
+// with the comments in the request do not exceed the maximum review comments per PR
+func (s *gitHubCommentProxyService) verifyReviewCommentLimit(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, prNumber int, request *CreatePullRequestReviewRequest) error {
+	comments, err := s.ghPullRequestAdapter.ListPullRequestComments(ctx, request.GetOwner(),
+		request.GetRepo(), prNumber)
+	if err != nil {
+		return fmt.Errorf("failed to list pull request comments: %w", err)
+	}
+
+	bot, err := s.resolveBotIdentity(ctx, config, request.GetOwner(), request.GetRepo())
+	if err != nil {
+		return err
+	}
+
+	commentsByBot := 0
+	for _, comment := range comments {
+		if bot.isReviewCommentAuthorOf(comment) {
+			commentsByBot++
+		}
+	}
+
+	if commentsByBot+len(request.GetComments()) > config.MaxReviewCommentsPerPR {
+		return newError(ErrorCodeResourceExhausted, ErrorReasonReviewLimitReached,
+			fmt.Errorf("maximum number of review comments (%d) reached for PR, %d exist and %d requested",
+				config.MaxReviewCommentsPerPR, commentsByBot, len(request.GetComments())))
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package ghcp
+
+import (
+	"context"
+	"testing"
+
+	ghapi "github.com/google/go-github/v69/github"
+	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPullRequestReviewCommentBody(t *testing.T) {
+	cases := []struct {
+		name    string
+		comment PullRequestReviewComment
+		body    string
+	}{
+		{
+			name:    "body only",
+			comment: PullRequestReviewComment{Body: "vulnerable dependency"},
+			body:    "vulnerable dependency",
+		},
+		{
+			name:    "body with suggestion",
+			comment: PullRequestReviewComment{Body: "upgrade", Suggestion: ghapi.Ptr("lodash@4.17.21\n")},
+			body:    "upgrade\n\n```suggestion\nlodash@4.17.21\n```",
+		},
+		{
+			name:    "suggestion to remove lines",
+			comment: PullRequestReviewComment{Suggestion: ghapi.Ptr("")},
+			body:    "```suggestion\n\n```",
+		},
+		{
+			name:    "suggestion with a fence",
+			comment: PullRequestReviewComment{Suggestion: ghapi.Ptr("```go\n```")},
+			body:    "````suggestion\n```go\n```\n````",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.body, c.comment.body())
+		})
+	}
+}
+
+func TestCreatePullRequestReview(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		Repository:      "safedep/ghcp",
+		RepositoryOwner: "safedep",
+		Audience:        []string{GitHubTokenAudienceName},
+		TokenType:       gh.TokenTypeWorkloadIdentity,
+	}
+
+	config := GitHubCommentProxyServiceConfig{
+		BotUsername:            "safedep-bot",
+		MaxReviewCommentsPerPR: 3,
+		GitHubTokenAudiences:   []string{GitHubTokenAudienceName},
+	}
+
+	reviewComment := func(login string) *ghapi.PullRequestComment {
+		return &ghapi.PullRequestComment{User: &ghapi.User{Login: ghapi.Ptr(login)}}
+	}
+
+	request := func(owner string, comments ...*PullRequestReviewComment) *CreatePullRequestReviewRequest {
+		return &CreatePullRequestReviewRequest{
+			Owner:    owner,
+			Repo:     "ghcp",
+			PrNumber: "1",
+			Body:     "vet found issues",
+			Comments: comments,
+		}
+	}
+
+	cases := []struct {
+		name     string
+		request  *CreatePullRequestReviewRequest
+		existing []*ghapi.PullRequestComment
+		state    string
+		review   *ghapi.PullRequestReviewRequest
+		err      string
+	}{
+		{
+			name: "create review on the head commit",
+			request: request("safedep",
+				&PullRequestReviewComment{Path: "go.mod", Line: 3, Body: "vulnerable"},
+				&PullRequestReviewComment{Path: "go.mod", Line: 8, StartLine: 6, Side: "right", Suggestion: ghapi.Ptr("fixed")},
+			),
+			existing: []*ghapi.PullRequestComment{reviewComment("test-user"), reviewComment("test-user")},
+			state:    "open",
+			review: &ghapi.PullRequestReviewRequest{
+				CommitID: ghapi.Ptr("abc"),
+				Body:     ghapi.Ptr("vet found issues"),
+				Event:    ghapi.Ptr("COMMENT"),
+				Comments: []*ghapi.DraftReviewComment{
+					{Path: ghapi.Ptr("go.mod"), Body: ghapi.Ptr("vulnerable"), Line: ghapi.Ptr(3), Side: ghapi.Ptr("RIGHT")},
+					{
+						Path: ghapi.Ptr("go.mod"), Body: ghapi.Ptr("```suggestion\nfixed\n```"), Line: ghapi.Ptr(8),
+						Side: ghapi.Ptr("RIGHT"), StartLine: ghapi.Ptr(6), StartSide: ghapi.Ptr("RIGHT"),
+					},
+				},
+			},
+		},
+		{
+			name: "create review fails when max review comments per PR is reached",
+			request: request("safedep",
+				&PullRequestReviewComment{Path: "go.mod", Line: 3, Body: "vulnerable"},
+				&PullRequestReviewComment{Path: "go.mod", Line: 4, Body: "vulnerable"},
+			),
+			existing: []*ghapi.PullRequestComment{reviewComment("safedep-bot"), reviewComment("safedep-bot")},
+			err:      "maximum number of review comments (3) reached for PR, 2 exist and 2 requested",
+		},
+		{
+			name:     "create review fails when the pull request is not open",
+			request:  request("safedep", &PullRequestReviewComment{Path: "go.mod", Line: 3, Body: "vulnerable"}),
+			existing: []*ghapi.PullRequestComment{},
+			state:    "closed",
+			err:      "pull request is not open: closed",
+		},
+		{
+			name: "create review fails when suggestion is on the left side",
+			request: request("safedep",
+				&PullRequestReviewComment{Path: "go.mod", Line: 3, Side: "LEFT", Suggestion: ghapi.Ptr("fixed")}),
+			err: "suggestion is only allowed on the RIGHT side",
+		},
+		{
+			name:    "create review fails without comments",
+			request: request("safedep"),
+			err:     "at least one comment is required",
+		},
+		{
+			name:    "create review fails when the token is for another repository",
+			request: request("other", &PullRequestReviewComment{Path: "go.mod", Line: 3, Body: "vulnerable"}),
+			err:     "repository owner mismatch",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+			ghPullRequestAdapter := github.NewMockGitHubPullRequestAdapter(t)
+
+			if c.existing != nil {
+				ghPullRequestAdapter.EXPECT().ListPullRequestComments(mock.Anything, "safedep", "ghcp", 1).
+					Return(c.existing, nil)
+			}
+
+			if c.state != "" {
+				ghRepoAdapter.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+					Return(&ghapi.PullRequest{State: ghapi.Ptr(c.state), Head: &ghapi.PullRequestBranch{SHA: ghapi.Ptr("abc")}}, nil)
+			}
+
+			if c.review != nil {
+				ghPullRequestAdapter.EXPECT().CreatePullRequestReview(mock.Anything, "safedep", "ghcp", 1, c.review).
+					Return(&ghapi.PullRequestReview{ID: ghapi.Ptr(int64(10))}, nil)
+			}
+
+			service, err := NewGitHubCommentProxyService(config, github.NewMockGitHubIssueAdapter(t),
+				ghRepoAdapter, ghPullRequestAdapter, github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+			res, err := service.CreatePullRequestReview(ctx, c.request)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				assert.Nil(t, res)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "10", res.GetReviewId())
+		})
+	}
+}
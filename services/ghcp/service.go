@@ -2,16 +2,26 @@ package ghcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
+	ghapi "github.com/google/go-github/v69/github"
 	"github.com/safedep/dry/log"
 	"github.com/safedep/dry/obs"
 	"github.com/safedep/ghcp/pkg/adapters/github"
+	"github.com/safedep/ghcp/pkg/audit"
 	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/safedep/ghcp/pkg/idempotency"
+	"github.com/safedep/ghcp/pkg/lock"
+	"github.com/safedep/ghcp/pkg/queue"
+	"github.com/safedep/ghcp/pkg/ratelimit"
+	"github.com/safedep/ghcp/pkg/receipt"
 	"github.com/safedep/ghcp/services"
 )
 
@@ -23,8 +33,27 @@ const (
 var (
 	createCommentMetric              = obs.NewCounter("ghcp_create_comment_total", "Total number of comments created")
 	updateCommentMetric              = obs.NewCounter("ghcp_update_comment_total", "Total number of comments updated")
+	deleteCommentMetric              = obs.NewCounter("ghcp_delete_comment_total", "Total number of comments deleted")
+	createReviewMetric               = obs.NewCounter("ghcp_create_review_total", "Total number of reviews created")
+	createCheckRunMetric             = obs.NewCounter("ghcp_create_check_run_total", "Total number of check runs created or updated")
+	createCommitStatusMetric         = obs.NewCounter("ghcp_create_commit_status_total", "Total number of commit statuses created")
 	verifyInstallationMetric         = obs.NewCounter("ghcp_verify_installation_total", "Total number of installations verified")
 	verifyRepositoryAccessMetric     = obs.NewCounter("ghcp_verify_repository_access_total", "Total number of repository accesses verified")
+	repositoryPolicyDeniedMetric     = obs.NewCounter("ghcp_repository_policy_denied_total", "Total number of requests denied by repository policy")
+	idempotentReplayMetric           = obs.NewCounter("ghcp_idempotent_replay_total", "Total number of requests replayed by idempotency key")
+	pullRequestLockContendedMetric   = obs.NewCounter("ghcp_pr_lock_contended_total", "Total number of requests waiting for the lock of a pull request")
+	pullRequestLockTimeoutMetric     = obs.NewCounter("ghcp_pr_lock_timeout_total", "Total number of requests failing to acquire the lock of a pull request in time")
+	pullRequestLockLostMetric        = obs.NewCounter("ghcp_pr_lock_lost_total", "Total number of pull request locks lost while held")
+	pullRequestLockWaitMetric        = obs.NewHistogram("ghcp_pr_lock_wait_seconds", "Time spent waiting for the lock of a pull request")
+	rateLimitedMetric                = obs.NewCounterVec("ghcp_rate_limited_total", "Total number of requests over a rate limit", []string{"scope"})
+	repositoryAccessDeniedMetric     = obs.NewCounterVec("ghcp_repository_access_denied_total", "Total number of requests denied by repository access lists", []string{"reason"})
+	auditRecordMetric                = obs.NewCounterVec("ghcp_audit_record_total", "Total number of requests recorded in the audit log", []string{"decision"})
+	auditWriteFailedMetric           = obs.NewCounter("ghcp_audit_write_failed_total", "Total number of audit records failed to be written")
+	receiptFailedMetric              = obs.NewCounter("ghcp_receipt_failed_total", "Total number of receipts failed to be issued")
+	deliveryEnqueuedMetric           = obs.NewCounter("ghcp_delivery_enqueued_total", "Total number of comments queued for asynchronous delivery")
+	deliveryAttemptMetric            = obs.NewCounterVec("ghcp_delivery_attempt_total", "Total number of attempts to deliver queued comments", []string{"result"})
+	deliveryLatencyMetric            = obs.NewHistogram("ghcp_delivery_latency_seconds", "Time from queueing a comment to its delivery")
+	deliveryQueueDepthMetric         = obs.NewGauge("ghcp_delivery_queue_depth", "Number of queued comments not yet delivered or failed")
 	successfulServiceExecutionMetric = obs.NewCounter("ghcp_successful_service_execution_total", "Total number of successful service executions")
 	failedServiceExecutionMetric     = obs.NewCounter("ghcp_failed_service_execution_total", "Total number of failed service executions")
 )
@@ -37,6 +66,16 @@ type GitHubCommentsProxyInstallationVerifier struct {
 	Action *regexp.Regexp
 }
 
+// GitHubTokenAudiencePolicy holds the settings applied to requests authenticated
+// with a GitHub Workload Identity Token issued for a specific audience. These
+// replace the corresponding settings in GitHubCommentProxyServiceConfig.
+type GitHubTokenAudiencePolicy struct {
+	AllowOnlyPublicRepositories bool
+	MaxCommentsPerPR            int
+	VerifyInstallation          bool
+	InstallationVerifiers       []GitHubCommentsProxyInstallationVerifier
+}
+
 type GitHubCommentProxyServiceConfig struct {
 	// If true, the service will only comment on public repositories.
 	AllowOnlyPublicRepositories bool
@@ -49,8 +88,16 @@ type GitHubCommentProxyServiceConfig struct {
 	// This is usually the username associated with the GITHUB_TOKEN
 	BotUsername string
 
-	// Audience name to verify against the GitHub Workload Identity Token
-	GitHubTokenAudienceName string
+	// If true, comments are identified by the GitHub App identity on repositories
+	// where the app is installed. BotUsername is used for other repositories.
+	UseGitHubAppIdentity bool
+
+	// Audience names accepted in the GitHub Workload Identity Token
+	GitHubTokenAudiences []string
+
+	// Policies for tokens issued for a specific audience. This allows a single
+	// deployment to serve multiple products with their own guardrails.
+	GitHubTokenAudiencePolicies map[string]GitHubTokenAudiencePolicy
 
 	// Verify installation by checking the existence of a file
 	VerifyInstallation bool
@@ -63,6 +110,84 @@ type GitHubCommentProxyServiceConfig struct {
 
 	// Max comment in a single PR. This is a guardrail to prevent abuse of the service.
 	MaxCommentsPerPR int
+
+	// Max review comments by the bot in a single PR, including the comments of
+	// the review being created. Zero means no limit.
+	MaxReviewCommentsPerPR int
+
+	// If true, a comment is created when no comment is found with the tag
+	// in the request. The comment is subject to MaxCommentsPerPR.
+	UpsertTaggedComments bool
+
+	// If true, comments without a tag marker are matched when their body contains
+	// the tag. This is to update comments created before tag markers were introduced,
+	// which would otherwise be duplicated by UpsertTaggedComments. Matched comments
+	// gain a marker, it can be disabled once the comments of open PRs were updated.
+	LegacyTagMatching bool
+
+	// Key used to sign the tag markers. When set, the marker covers the tag, the
+	// repository and the workflow creating the comment, and only comments with a
+	// valid signature are updated. Must be at least 32 bytes.
+	CommentSigningKey []byte
+
+	// If true, a comment is only updated by the workflow that created it. This
+	// prevents workflows from overwriting each other's comments in the same PR.
+	// Requires CommentSigningKey.
+	RequireMatchingWorkflowIdentity bool
+
+	// Verify that the pull request in the request is the one the
+	// GitHub Workload Identity Token was issued for
+	VerifyPullRequestBinding bool
+
+	// Rules for binding requests to a pull request by the event that triggered
+	// the workflow. Pull request events are always bound to their pull request.
+	PullRequestBindingRules map[string]PullRequestBindingRule
+
+	// Rule for events without an explicit rule
+	DefaultPullRequestBindingRule PullRequestBindingRule
+
+	// If true, review comments are refused
+	DisableReviewComments bool
+
+	// If true, check runs and commit statuses are allowed. A passing status can
+	// satisfy branch protection, so checks are refused unless enabled.
+	EnableChecks bool
+
+	// Prefix required of check run names and commit status contexts, so that a
+	// workflow can not report under a required check of the repository
+	CheckNamespace string
+
+	// Path of the policy file read from the default branch of the repository. The
+	// policy lets repository owners restrict the bot. Empty disables repository policies.
+	RepositoryPolicyPath string
+
+	// How long repository policies are cached. Zero disables caching.
+	RepositoryPolicyCacheTTL time.Duration
+
+	// Repositories and owners are identified by their IDs since they can be renamed.
+	// Denied IDs are always refused. When an allow list is set, only the repositories
+	// in it or owned by an owner in it are served.
+	AllowedRepositoryIDs []int64
+	AllowedOwnerIDs      []int64
+	DeniedRepositoryIDs  []int64
+	DeniedOwnerIDs       []int64
+
+	// Rate limits applied to requests after they are authorized. Rules are
+	// checked in order, a request over any of the limits is refused.
+	RateLimits []ratelimit.Rule
+
+	// How long the result of a comment request is remembered by the idempotency
+	// key sent by the client. Zero disables idempotency keys.
+	IdempotencyKeyTTL time.Duration
+
+	// Requests writing to a pull request are serialized so that concurrent requests
+	// can not exceed the comment limits or duplicate tagged comments. This is the
+	// longest a request waits for another one. Zero disables serialization.
+	PullRequestLockTimeout time.Duration
+
+	// If true, requests are executed without serialization when the locker is
+	// unavailable. Otherwise they are refused.
+	PullRequestLockFailOpen bool
 }
 
 // Secure defaults for the GitHubCommentProxyServiceConfig
@@ -71,8 +196,23 @@ func DefaultGitHubCommentProxyServiceConfig() GitHubCommentProxyServiceConfig {
 		AllowOnlyPublicRepositories: true,
 		AllowOnlyOwnCommentUpdates:  true,
 		MaxCommentsPerPR:            3,
+		MaxReviewCommentsPerPR:      50,
+		UpsertTaggedComments:        true,
+		LegacyTagMatching:           true,
 		BotUsername:                 BotUsername,
-		GitHubTokenAudienceName:     GitHubTokenAudienceName,
+		GitHubTokenAudiences:        []string{GitHubTokenAudienceName},
+		VerifyPullRequestBinding:    true,
+		PullRequestBindingRules: map[string]PullRequestBindingRule{
+			"push":              PullRequestBindingRuleHeadRef,
+			"schedule":          PullRequestBindingRuleDeny,
+			"workflow_dispatch": PullRequestBindingRuleDeny,
+		},
+		DefaultPullRequestBindingRule: PullRequestBindingRuleDeny,
+		CheckNamespace:                DefaultCheckNamespace,
+		RepositoryPolicyPath:          DefaultRepositoryPolicyPath,
+		RepositoryPolicyCacheTTL:      defaultRepositoryPolicyCacheTTL,
+		IdempotencyKeyTTL:             DefaultIdempotencyKeyTTL,
+		PullRequestLockTimeout:        DefaultPullRequestLockTimeout,
 		InstallationVerifiers: []GitHubCommentsProxyInstallationVerifier{
 			{
 				Path:   ".github/workflows/vet.yml",
@@ -86,10 +226,174 @@ func DefaultGitHubCommentProxyServiceConfig() GitHubCommentProxyServiceConfig {
 	}
 }
 
+// Validate verifies that the configuration is consistent
+func (c GitHubCommentProxyServiceConfig) Validate() error {
+	if c.AllowOnlyOwnCommentUpdates && c.BotUsername == "" {
+		return fmt.Errorf("bot username is required when AllowOnlyOwnCommentUpdates is true")
+	}
+
+	if c.MaxCommentsPerPR < 0 {
+		return fmt.Errorf("max comments per PR must be greater than 0")
+	}
+
+	if c.MaxCommentsPerPR > 0 && c.BotUsername == "" {
+		return fmt.Errorf("bot username is required when MaxCommentsPerPR is greater than 0")
+	}
+
+	if c.MaxReviewCommentsPerPR < 0 {
+		return fmt.Errorf("max review comments per PR must be greater than 0")
+	}
+
+	if c.MaxReviewCommentsPerPR > 0 && c.BotUsername == "" {
+		return fmt.Errorf("bot username is required when MaxReviewCommentsPerPR is greater than 0")
+	}
+
+	if len(c.CommentSigningKey) > 0 && len(c.CommentSigningKey) < minCommentSigningKeyLength {
+		return fmt.Errorf("comment signing key must be at least %d bytes", minCommentSigningKeyLength)
+	}
+
+	if c.RequireMatchingWorkflowIdentity && len(c.CommentSigningKey) == 0 {
+		return fmt.Errorf("comment signing key is required when RequireMatchingWorkflowIdentity is true")
+	}
+
+	if c.EnableChecks && c.CheckNamespace == "" {
+		return fmt.Errorf("check namespace is required when EnableChecks is true")
+	}
+
+	// Repository policies can lower the limits, which are enforced by counting
+	// the comments of the bot
+	if c.RepositoryPolicyPath != "" && c.BotUsername == "" {
+		return fmt.Errorf("bot username is required when RepositoryPolicyPath is set")
+	}
+
+	if c.RepositoryPolicyCacheTTL < 0 {
+		return fmt.Errorf("repository policy cache TTL must not be negative")
+	}
+
+	if c.IdempotencyKeyTTL < 0 {
+		return fmt.Errorf("idempotency key TTL must not be negative")
+	}
+
+	if c.PullRequestLockTimeout < 0 {
+		return fmt.Errorf("pull request lock timeout must not be negative")
+	}
+
+	for name, ids := range map[string][]int64{
+		"allowed repository":       c.AllowedRepositoryIDs,
+		"allowed repository owner": c.AllowedOwnerIDs,
+		"denied repository":        c.DeniedRepositoryIDs,
+		"denied repository owner":  c.DeniedOwnerIDs,
+	} {
+		for _, id := range ids {
+			if id <= 0 {
+				return fmt.Errorf("invalid %s id: %d", name, id)
+			}
+		}
+	}
+
+	for _, rule := range c.RateLimits {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for audience, policy := range c.GitHubTokenAudiencePolicies {
+		if _, ok := acceptedAudience(c.GitHubTokenAudiences, []string{audience}); !ok {
+			return fmt.Errorf("audience policy for %s is not an accepted audience", audience)
+		}
+
+		if policy.MaxCommentsPerPR < 0 {
+			return fmt.Errorf("max comments per PR must be greater than 0 for audience %s", audience)
+		}
+
+		if policy.MaxCommentsPerPR > 0 && c.BotUsername == "" {
+			return fmt.Errorf("bot username is required when MaxCommentsPerPR is greater than 0 for audience %s", audience)
+		}
+	}
+
+	for event, rule := range c.PullRequestBindingRules {
+		if !rule.valid() {
+			return fmt.Errorf("invalid pull request binding rule for event %s: %s", event, rule)
+		}
+	}
+
+	if c.DefaultPullRequestBindingRule != "" && !c.DefaultPullRequestBindingRule.valid() {
+		return fmt.Errorf("invalid default pull request binding rule: %s", c.DefaultPullRequestBindingRule)
+	}
+
+	if err := validateInstallationVerifiers(c.VerifyInstallation, c.InstallationVerifiers); err != nil {
+		return err
+	}
+
+	for audience, policy := range c.GitHubTokenAudiencePolicies {
+		if err := validateInstallationVerifiers(policy.VerifyInstallation, policy.InstallationVerifiers); err != nil {
+			return fmt.Errorf("%w for audience %s", err, audience)
+		}
+	}
+
+	return nil
+}
+
+// validateInstallationVerifiers verifies that installations can be verified
+// when required. Without verifiers every request would be refused.
+func validateInstallationVerifiers(verifyInstallation bool,
+	verifiers []GitHubCommentsProxyInstallationVerifier) error {
+	if verifyInstallation && len(verifiers) == 0 {
+		return fmt.Errorf("installation verifiers are required when VerifyInstallation is true")
+	}
+
+	for _, verifier := range verifiers {
+		if verifier.Path == "" || verifier.Action == nil {
+			return fmt.Errorf("installation verifier requires a path and an action")
+		}
+	}
+
+	return nil
+}
+
+// CommentAction is the action performed on a pull request comment
+type CommentAction string
+
+const (
+	CommentActionCreated CommentAction = "created"
+	CommentActionUpdated CommentAction = "updated"
+
+	// The comment is queued for asynchronous delivery
+	CommentActionQueued CommentAction = "queued"
+)
+
+// PullRequestCommentResult is the result of creating or updating a pull request comment
+type PullRequestCommentResult struct {
+	Response *ghcpv1.CreatePullRequestCommentResponse
+	Action   CommentAction
+
+	// Replayed is true when the result is of an earlier request
+	// with the same idempotency key
+	Replayed bool
+
+	// Signed receipt of the comment, empty when receipts are disabled
+	Receipt string
+
+	// Job delivering the comment when it is queued
+	JobID string
+}
+
 type gitHubCommentProxyService struct {
-	config         GitHubCommentProxyServiceConfig
-	ghIssueAdapter github.GitHubIssueAdapter
-	ghRepoAdapter  github.GitHubRepositoryAdapter
+	// Replaced when the configuration is updated. Requests use
+	// the configuration current when they were received.
+	config atomic.Pointer[GitHubCommentProxyServiceConfig]
+
+	ghIssueAdapter       github.GitHubIssueAdapter
+	ghRepoAdapter        github.GitHubRepositoryAdapter
+	ghPullRequestAdapter github.GitHubPullRequestAdapter
+	ghCheckAdapter       github.GitHubCheckAdapter
+	repositoryPolicies   *repositoryPolicyCache
+	rateLimitStore       ratelimit.Store
+	idempotencyStore     idempotency.Store
+	locker               lock.Locker
+	auditSink            audit.Sink
+	receiptSigner        *receipt.Signer
+	deliveryQueue        queue.Queue
 }
 
 var _ services.Service[*ghcpv1.CreatePullRequestCommentRequest,
@@ -97,25 +401,68 @@ var _ services.Service[*ghcpv1.CreatePullRequestCommentRequest,
 
 func NewGitHubCommentProxyService(config GitHubCommentProxyServiceConfig,
 	ghIssueAdapter github.GitHubIssueAdapter,
-	ghRepoAdapter github.GitHubRepositoryAdapter) (*gitHubCommentProxyService, error) {
+	ghRepoAdapter github.GitHubRepositoryAdapter,
+	ghPullRequestAdapter github.GitHubPullRequestAdapter,
+	ghCheckAdapter github.GitHubCheckAdapter) (*gitHubCommentProxyService, error) {
 
-	if config.AllowOnlyOwnCommentUpdates && config.BotUsername == "" {
-		return nil, fmt.Errorf("bot username is required when AllowOnlyOwnCommentUpdates is true")
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
-	if config.MaxCommentsPerPR < 0 {
-		return nil, fmt.Errorf("max comments per PR must be greater than 0")
+	service := &gitHubCommentProxyService{
+		ghIssueAdapter:       ghIssueAdapter,
+		ghRepoAdapter:        ghRepoAdapter,
+		ghPullRequestAdapter: ghPullRequestAdapter,
+		ghCheckAdapter:       ghCheckAdapter,
+		repositoryPolicies:   newRepositoryPolicyCache(),
+		rateLimitStore:       ratelimit.NewMemoryStore(),
+		idempotencyStore:     idempotency.NewMemoryStore(),
+		locker:               lock.NewMemoryLocker(),
 	}
 
-	if config.MaxCommentsPerPR > 0 && config.BotUsername == "" {
-		return nil, fmt.Errorf("bot username is required when MaxCommentsPerPR is greater than 0")
+	service.config.Store(&config)
+	return service, nil
+}
+
+// UpdateConfig replaces the configuration of the service. The configuration
+// is left unchanged on error. In-flight requests are not affected.
+func (s *gitHubCommentProxyService) UpdateConfig(config GitHubCommentProxyServiceConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
 	}
 
-	return &gitHubCommentProxyService{
-		config:         config,
-		ghIssueAdapter: ghIssueAdapter,
-		ghRepoAdapter:  ghRepoAdapter,
-	}, nil
+	s.config.Store(&config)
+	return nil
+}
+
+// SetRateLimitStore replaces the store of the rate limits, which holds them in
+// memory by default. It must be called before the service handles requests.
+func (s *gitHubCommentProxyService) SetRateLimitStore(store ratelimit.Store) {
+	s.rateLimitStore = store
+}
+
+// SetIdempotencyStore replaces the store of the idempotency keys, which holds them
+// in memory by default. It must be called before the service handles requests.
+func (s *gitHubCommentProxyService) SetIdempotencyStore(store idempotency.Store) {
+	s.idempotencyStore = store
+}
+
+// SetLocker replaces the locker of the pull requests, which holds the locks
+// in memory by default. It must be called before the service handles requests.
+func (s *gitHubCommentProxyService) SetLocker(locker lock.Locker) {
+	s.locker = locker
+}
+
+// SetAuditSink sets the sink of the audit log, which is disabled by default.
+// It must be called before the service handles requests.
+func (s *gitHubCommentProxyService) SetAuditSink(sink audit.Sink) {
+	s.auditSink = sink
+}
+
+// SetReceiptSigner sets the signer of the receipts of the comments, which are not
+// issued by default. It must be called before the service handles requests.
+func (s *gitHubCommentProxyService) SetReceiptSigner(signer *receipt.Signer) {
+	s.receiptSigner = signer
 }
 
 func (s *gitHubCommentProxyService) Name() string {
@@ -128,22 +475,22 @@ func (s *gitHubCommentProxyService) Config() services.ServiceConfiguration {
 
 func (s *gitHubCommentProxyService) Execute(ctx context.Context,
 	request *ghcpv1.CreatePullRequestCommentRequest) (*ghcpv1.CreatePullRequestCommentResponse, error) {
-	r, err := func() (*ghcpv1.CreatePullRequestCommentResponse, error) {
-		if !s.config.InsecureSkipAuthorization {
-			tokenContext, err := gh.ExtractGitHubTokenContext(ctx)
-			if err != nil {
-				return nil, fmt.Errorf("failed to extract GitHub Workload Identity Token context: %w", err)
-			}
+	result, err := s.CreatePullRequestComment(ctx, request)
+	if err != nil {
+		return nil, err
+	}
 
-			if err := s.verifyRepositoryAccess(ctx, tokenContext, request); err != nil {
-				return nil, fmt.Errorf("failed to verify repository access: %w", err)
-			}
-		}
+	return result.Response, nil
+}
 
-		if s.config.VerifyInstallation {
-			if err := s.verifyInstallation(ctx, request.GetOwner(), request.GetRepo()); err != nil {
-				return nil, fmt.Errorf("failed to verify installation: %w", err)
-			}
+// CreatePullRequestComment creates or updates a comment on the pull request and
+// returns the result along with the action performed
+func (s *gitHubCommentProxyService) CreatePullRequestComment(ctx context.Context,
+	request *ghcpv1.CreatePullRequestCommentRequest) (*PullRequestCommentResult, error) {
+	r, err := func() (*PullRequestCommentResult, error) {
+		config, tokenContext, err := s.authorize(ctx, request)
+		if err != nil {
+			return nil, err
 		}
 
 		prNumber, err := strconv.Atoi(request.GetPrNumber())
@@ -151,128 +498,514 @@ func (s *gitHubCommentProxyService) Execute(ctx context.Context,
 			return nil, fmt.Errorf("failed to convert pr number to int: %w", err)
 		}
 
-		if request.GetTag() == "" {
-			return s.createNewComment(ctx, prNumber, request)
-		}
+		return s.createPullRequestCommentOnce(ctx, config, request, func() (*PullRequestCommentResult, error) {
+			// The lock is taken by the worker delivering the comment
+			if s.deliveryQueue != nil && AsyncDeliveryRequested(ctx) {
+				return s.enqueuePullRequestComment(ctx, request)
+			}
+
+			unlock, err := s.lockPullRequest(ctx, config, request)
+			if err != nil {
+				return nil, err
+			}
+
+			defer unlock()
 
-		return s.updateExistingComment(ctx, prNumber, request)
+			var r *PullRequestCommentResult
+			if request.GetTag() == "" {
+				r, err = s.createNewComment(ctx, config, tokenContext, prNumber, request)
+			} else {
+				r, err = s.updateExistingComment(ctx, config, tokenContext, prNumber, request)
+			}
+
+			// The receipt is remembered with the idempotency key, a replay returns
+			// the receipt of the caller that posted the comment. Receipts of queued
+			// comments are issued on delivery.
+			if err == nil && s.receiptSigner != nil {
+				r.Receipt = s.issueReceipt(ctx, request, r)
+			}
+
+			return r, err
+		})
 	}()
 
+	record := audit.Record{Tag: request.GetTag(), BodySHA256: bodyDigest(request.GetBody())}
+	if r != nil {
+		record.Action = string(r.Action)
+		record.ResourceID = r.Response.GetCommentId()
+		record.Replayed = r.Replayed
+		record.JobID = r.JobID
+	}
+
+	s.recordAudit(ctx, auditOperationCreateComment, request, record, err)
+
 	if err != nil {
 		log.Errorf("failed to execute service: %s", err)
 		failedServiceExecutionMetric.Inc()
-		return nil, err
+		return nil, classifyError(err)
 	}
 
 	successfulServiceExecutionMetric.Inc()
 	return r, nil
 }
 
-func (s *gitHubCommentProxyService) createNewComment(ctx context.Context, prNumber int,
-	request *ghcpv1.CreatePullRequestCommentRequest) (*ghcpv1.CreatePullRequestCommentResponse, error) {
+// pullRequestTarget is the pull request a request acts on
+type pullRequestTarget interface {
+	GetOwner() string
+	GetRepo() string
+	GetPrNumber() string
+}
+
+// authorize verifies that the caller can act on the pull request and returns the
+// configuration applicable for the caller along with its token context
+func (s *gitHubCommentProxyService) authorize(ctx context.Context,
+	target pullRequestTarget) (GitHubCommentProxyServiceConfig, gh.GitHubTokenContext, error) {
+	config := *s.config.Load()
+
+	var tokenContext gh.GitHubTokenContext
+	if !config.InsecureSkipAuthorization {
+		var err error
+		tokenContext, err = gh.ExtractGitHubTokenContext(ctx)
+		if err != nil {
+			return config, tokenContext, newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+				fmt.Errorf("failed to extract GitHub Workload Identity Token context: %w", err))
+		}
+
+		config, err = s.configForCaller(ctx, config, tokenContext, target)
+		if err != nil {
+			return config, tokenContext, err
+		}
+	}
+
+	if err := s.checkRateLimits(ctx, config, tokenContext, target); err != nil {
+		return config, tokenContext, err
+	}
+
+	if config.VerifyInstallation {
+		if err := s.verifyInstallation(ctx, config, target.GetOwner(), target.GetRepo()); err != nil {
+			return config, tokenContext, newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+				fmt.Errorf("failed to verify installation: %w", err))
+		}
+	}
+
+	return config, tokenContext, nil
+}
+
+// configForCaller verifies that the caller can access the repository and returns
+// the configuration applicable for the caller on the repository
+func (s *gitHubCommentProxyService) configForCaller(ctx context.Context, config GitHubCommentProxyServiceConfig,
+	tokenContext gh.GitHubTokenContext, target pullRequestTarget) (GitHubCommentProxyServiceConfig, error) {
+	config = s.configForToken(config, tokenContext)
+	if err := s.verifyRepositoryAccess(ctx, config, tokenContext, target); err != nil {
+		return config, newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+			fmt.Errorf("failed to verify repository access: %w", err))
+	}
+
+	// Denials of the policy keep their reason, other failures to read the
+	// policy are unauthorized
+	if config.RepositoryPolicyPath != "" {
+		var err error
+		config, err = s.applyRepositoryPolicy(ctx, config, tokenContext, target)
+		if err != nil {
+			return config, newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+				fmt.Errorf("failed to verify repository policy: %w", err))
+		}
+	}
+
+	return config, nil
+}
+
+// checkRateLimits takes a token from the rate limits applicable to the request. Requests
+// are allowed when the store is unavailable, the other guardrails continue to apply.
+func (s *gitHubCommentProxyService) checkRateLimits(ctx context.Context, config GitHubCommentProxyServiceConfig,
+	tokenContext gh.GitHubTokenContext, target pullRequestTarget) error {
+	if len(config.RateLimits) == 0 {
+		return nil
+	}
+
+	err := ratelimit.Check(ctx, s.rateLimitStore, config.RateLimits, ratelimit.Subject{
+		Repository: fmt.Sprintf("%s/%s", target.GetOwner(), target.GetRepo()),
+		Owner:      target.GetOwner(),
+		Actor:      tokenContext.Actor,
+		TokenType:  string(tokenContext.TokenType),
+	})
+
+	var limitErr *ratelimit.LimitExceededError
+	if errors.As(err, &limitErr) {
+		rateLimitedMetric.WithLabels(map[string]string{"scope": string(limitErr.Scope)}).Inc()
+		return newError(ErrorCodeResourceExhausted, ErrorReasonRateLimited, err)
+	}
+
+	if err != nil {
+		log.Errorf("failed to check rate limits, allowing request: %s", err)
+	}
+
+	return nil
+}
+
+func (s *gitHubCommentProxyService) createNewComment(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, tokenContext gh.GitHubTokenContext, prNumber int,
+	request *ghcpv1.CreatePullRequestCommentRequest) (*PullRequestCommentResult, error) {
 
 	createCommentMetric.Inc()
 	log.Debugf("Creating comment on PR: %s", request.GetPrNumber())
 
 	// If max comments per PR is set, we need to check if we have reached the limit
-	if s.config.MaxCommentsPerPR > 0 {
+	if config.MaxCommentsPerPR > 0 {
 		comments, err := s.ghIssueAdapter.ListIssueComments(ctx, request.GetOwner(),
 			request.GetRepo(), prNumber)
 		if err != nil {
 			return nil, fmt.Errorf("failed to list issue comments: %w", err)
 		}
 
-		commentsByBot := 0
-		for _, comment := range comments {
-			if comment.GetUser().GetLogin() == s.config.BotUsername {
-				commentsByBot++
-			}
+		bot, err := s.resolveBotIdentity(ctx, config, request.GetOwner(), request.GetRepo())
+		if err != nil {
+			return nil, err
 		}
 
-		if commentsByBot >= s.config.MaxCommentsPerPR {
-			return nil, fmt.Errorf("maximum number of comments (%d) reached for PR", s.config.MaxCommentsPerPR)
+		if err := s.verifyCommentLimit(config, bot, comments); err != nil {
+			return nil, err
 		}
 	}
 
-	comment, err := s.ghIssueAdapter.CreateIssueComment(ctx, request.GetOwner(),
-		request.GetRepo(), prNumber, request.GetBody())
-	if err != nil {
-		return nil, fmt.Errorf("failed to create issue comment: %w", err)
+	// Comments without a tag carry a signed marker identifying the
+	// workflow that created them, e.g. for deletes by the workflow
+	body := request.GetBody()
+	if len(config.CommentSigningKey) > 0 {
+		marker, err := s.newTagMarker(ctx, config, tokenContext, request.GetOwner(), request.GetRepo(), prNumber, "")
+		if err != nil {
+			return nil, err
+		}
+
+		body = marker.withMarker(body)
 	}
 
-	return &ghcpv1.CreatePullRequestCommentResponse{
-		CommentId: fmt.Sprintf("%d", comment.GetID()),
-	}, nil
+	return s.postComment(ctx, prNumber, request, body)
 }
 
-func (s *gitHubCommentProxyService) updateExistingComment(ctx context.Context, prNumber int,
-	request *ghcpv1.CreatePullRequestCommentRequest) (*ghcpv1.CreatePullRequestCommentResponse, error) {
+func (s *gitHubCommentProxyService) updateExistingComment(ctx context.Context,
+	config GitHubCommentProxyServiceConfig, tokenContext gh.GitHubTokenContext, prNumber int,
+	request *ghcpv1.CreatePullRequestCommentRequest) (*PullRequestCommentResult, error) {
 
 	updateCommentMetric.Inc()
 	log.Debugf("Updating comment on PR: %s with Tag: %s", request.GetPrNumber(), request.GetTag())
 
-	comments, err := s.ghIssueAdapter.ListIssueComments(ctx, request.GetOwner(),
-		request.GetRepo(), prNumber)
+	bot, err := s.resolveBotIdentity(ctx, config, request.GetOwner(), request.GetRepo())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyWorkflowIdentity(config, tokenContext); err != nil {
+		return nil, err
+	}
+
+	marker, err := s.newTagMarker(ctx, config, tokenContext, request.GetOwner(), request.GetRepo(),
+		prNumber, request.GetTag())
+	if err != nil {
+		return nil, err
+	}
+
+	// Comments are visited most recently created first. We stop at the first
+	// comment with a matching marker, otherwise all comments are visited and
+	// retained for legacy matching and the comment limit.
+	var comment *ghapi.IssueComment
+	var comments []*ghapi.IssueComment
+	err = s.ghIssueAdapter.WalkIssueComments(ctx, request.GetOwner(), request.GetRepo(), prNumber,
+		func(c *ghapi.IssueComment) bool {
+			if s.isTaggedComment(config, bot, c, marker) {
+				comment = c
+				return false
+			}
+
+			comments = append(comments, c)
+			return true
+		})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list issue comments: %w", err)
 	}
 
+	if comment == nil && config.LegacyTagMatching {
+		comment, err = s.findLegacyTaggedComment(config, bot, comments, marker)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if comment != nil {
+		log.Debugf("Updating commentId: %d", comment.GetID())
+
+		// The body is replaced, the marker must be retained for subsequent
+		// updates. This also migrates comments matched by legacy matching.
+		updatedComment, err := s.ghIssueAdapter.UpdateIssueComment(ctx, request.GetOwner(),
+			request.GetRepo(), int(comment.GetID()), marker.withMarker(request.GetBody()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to update issue comment: %w", err)
+		}
+
+		return &PullRequestCommentResult{
+			Response: &ghcpv1.CreatePullRequestCommentResponse{
+				CommentId: fmt.Sprintf("%d", updatedComment.GetID()),
+			},
+			Action: CommentActionUpdated,
+		}, nil
+	}
+
+	log.Debugf("No comment found with Tag: %s", request.GetTag())
+
+	if !config.UpsertTaggedComments {
+		return nil, newError(ErrorCodeNotFound, ErrorReasonTagNotFound,
+			fmt.Errorf("no comment found with Tag: %s", request.GetTag()))
+	}
+
+	// Create the comment instead of making the caller retry without a tag. We
+	// re-use the comments we already have to enforce the limit.
+	createCommentMetric.Inc()
+	log.Debugf("Creating comment on PR: %s with Tag: %s", request.GetPrNumber(), request.GetTag())
+
+	if config.MaxCommentsPerPR > 0 {
+		if err := s.verifyCommentLimit(config, bot, comments); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.postComment(ctx, prNumber, request, marker.withMarker(request.GetBody()))
+}
+
+// newTagMarker returns the marker to embed in the comment with the tag on the
+// pull request. The marker is signed when a signing key is configured.
+func (s *gitHubCommentProxyService) newTagMarker(ctx context.Context, config GitHubCommentProxyServiceConfig,
+	tokenContext gh.GitHubTokenContext, owner, repo string, prNumber int, tag string) (tagMarker, error) {
+	marker := tagMarkerFor(tag)
+	if len(config.CommentSigningKey) == 0 {
+		return marker, nil
+	}
+
+	repositoryId, err := s.repositoryID(ctx, tokenContext, owner, repo)
+	if err != nil {
+		return tagMarker{}, err
+	}
+
+	marker.RepositoryID = repositoryId
+	marker.PullRequest = strconv.Itoa(prNumber)
+	marker.Workflow = workflowIdentity(tokenContext)
+
+	return tagMarkerSigner{key: config.CommentSigningKey}.sign(marker), nil
+}
+
+// verifyWorkflowIdentity verifies that the token identifies the workflow when
+// comments may only be changed by the workflow that created them. GITHUB_TOKEN
+// does not identify a workflow, every workflow of the repository would match.
+func verifyWorkflowIdentity(config GitHubCommentProxyServiceConfig, tokenContext gh.GitHubTokenContext) error {
+	if config.RequireMatchingWorkflowIdentity && workflowIdentity(tokenContext) == "" {
+		return newError(ErrorCodePermissionDenied, ErrorReasonUnauthorized,
+			errors.New("workflow identity is required to change a comment, the token does not identify a workflow"))
+	}
+
+	return nil
+}
+
+// repositoryID returns the ID of the repository from the token when available
+// and from GitHub otherwise
+func (s *gitHubCommentProxyService) repositoryID(ctx context.Context,
+	tokenContext gh.GitHubTokenContext, owner, repo string) (string, error) {
+	fullName := fmt.Sprintf("%s/%s", owner, repo)
+
+	if tokenRepository, ok := tokenContext.FindRepository(fullName); ok && tokenRepository.ID != "" {
+		return tokenRepository.ID, nil
+	}
+
+	if tokenContext.RepositoryID != "" && strings.EqualFold(tokenContext.Repository, fullName) {
+		return tokenContext.RepositoryID, nil
+	}
+
+	repository, err := s.ghRepoAdapter.GetRepository(ctx, owner, repo)
+	if err != nil {
+		return "", fmt.Errorf("failed to get repository: %w", err)
+	}
+
+	return strconv.FormatInt(repository.GetID(), 10), nil
+}
+
+// isTaggedComment returns true if the comment is by the bot and has a marker
+// matching the expected marker
+func (s *gitHubCommentProxyService) isTaggedComment(config GitHubCommentProxyServiceConfig,
+	bot botIdentity, comment *ghapi.IssueComment, expected tagMarker) bool {
+	if !bot.isAuthorOf(comment) {
+		return false
+	}
+
+	for _, marker := range parseTagMarkers(comment.GetBody()) {
+		if s.matchesTagMarker(config, marker, expected) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findLegacyTaggedComment returns the comment created before markers were introduced, or
+// before they were signed, for the tag. Returns nil when no comment is found.
+func (s *gitHubCommentProxyService) findLegacyTaggedComment(config GitHubCommentProxyServiceConfig,
+	bot botIdentity, comments []*ghapi.IssueComment, expected tagMarker) (*ghapi.IssueComment, error) {
+	signed := len(config.CommentSigningKey) > 0
 	for _, comment := range comments {
-		if strings.Contains(comment.GetBody(), request.GetTag()) {
-			if s.config.AllowOnlyOwnCommentUpdates {
-				if comment.GetUser().GetLogin() != s.config.BotUsername {
-					return nil, fmt.Errorf("refusing to update comment created by another user")
-				}
-			}
+		// Comments created before markers were signed, or before signed
+		// markers covered the pull request
+		if signed && bot.isAuthorOf(comment) && s.hasLegacyTagMarker(config, comment.GetBody(), expected) {
+			log.Debugf("Matched unsigned comment: %d with Tag: %s", comment.GetID(), expected.Tag)
+			return comment, nil
+		}
 
-			log.Debugf("Updating commentId: %d", comment.GetID())
+		// Comments created before markers were introduced. Comments with a
+		// marker are not legacy comments even when they contain the tag.
+		if hasAnyTagMarker(comment.GetBody()) {
+			continue
+		}
 
-			updatedComment, err := s.ghIssueAdapter.UpdateIssueComment(ctx, request.GetOwner(),
-				request.GetRepo(), int(comment.GetID()), request.GetBody())
-			if err != nil {
-				return nil, fmt.Errorf("failed to update issue comment: %w", err)
+		if strings.Contains(comment.GetBody(), expected.Tag) {
+			if config.AllowOnlyOwnCommentUpdates && !bot.isAuthorOf(comment) {
+				return nil, fmt.Errorf("refusing to update comment created by another user")
 			}
 
-			return &ghcpv1.CreatePullRequestCommentResponse{
-				CommentId: fmt.Sprintf("%d", updatedComment.GetID()),
-			}, nil
+			log.Debugf("Matched legacy comment: %d with Tag: %s", comment.GetID(), expected.Tag)
+			return comment, nil
 		}
 	}
 
-	log.Debugf("No comment found with Tag: %s", request.GetTag())
-	return nil, fmt.Errorf("no comment found with Tag: %s", request.GetTag())
+	return nil, nil
+}
+
+// matchesTagMarker returns true if the marker in a comment matches the expected marker.
+// When a signing key is configured, the marker must have a valid signature for the same
+// repository and, when required, the same workflow.
+func (s *gitHubCommentProxyService) matchesTagMarker(config GitHubCommentProxyServiceConfig,
+	marker, expected tagMarker) bool {
+	if marker.Tag != expected.Tag {
+		return false
+	}
+
+	if len(config.CommentSigningKey) == 0 {
+		return true
+	}
+
+	if !marker.isSigned() || !(tagMarkerSigner{key: config.CommentSigningKey}).verify(marker) {
+		return false
+	}
+
+	if marker.RepositoryID != expected.RepositoryID || marker.PullRequest != expected.PullRequest {
+		return false
+	}
+
+	if config.RequireMatchingWorkflowIdentity && marker.Workflow != expected.Workflow {
+		return false
+	}
+
+	return true
+}
+
+// hasLegacyTagMarker returns true if the body has a marker for the tag that is
+// unsigned, or signed before markers covered the pull request
+func (s *gitHubCommentProxyService) hasLegacyTagMarker(config GitHubCommentProxyServiceConfig,
+	body string, expected tagMarker) bool {
+	if hasTagMarker(body, expected.Tag) {
+		return true
+	}
+
+	unbound := expected
+	unbound.PullRequest = ""
+
+	for _, marker := range parseTagMarkers(body) {
+		if s.matchesTagMarker(config, marker, unbound) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyCommentLimit verifies that the bot has not reached the maximum number of comments on the PR
+func (s *gitHubCommentProxyService) verifyCommentLimit(config GitHubCommentProxyServiceConfig,
+	bot botIdentity, comments []*ghapi.IssueComment) error {
+	commentsByBot := 0
+	for _, comment := range comments {
+		if bot.isAuthorOf(comment) {
+			commentsByBot++
+		}
+	}
+
+	if commentsByBot >= config.MaxCommentsPerPR {
+		return newError(ErrorCodeResourceExhausted, ErrorReasonCommentLimitReached,
+			fmt.Errorf("maximum number of comments (%d) reached for PR", config.MaxCommentsPerPR))
+	}
+
+	return nil
+}
+
+func (s *gitHubCommentProxyService) postComment(ctx context.Context, prNumber int,
+	request *ghcpv1.CreatePullRequestCommentRequest, body string) (*PullRequestCommentResult, error) {
+	comment, err := s.ghIssueAdapter.CreateIssueComment(ctx, request.GetOwner(),
+		request.GetRepo(), prNumber, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create issue comment: %w", err)
+	}
+
+	return &PullRequestCommentResult{
+		Response: &ghcpv1.CreatePullRequestCommentResponse{
+			CommentId: fmt.Sprintf("%d", comment.GetID()),
+		},
+		Action: CommentActionCreated,
+	}, nil
 }
 
 // verifyRepositoryAccess verifies that the token context matches the requested repository
 // This is to prevent the service from being misused to spam comments to various repositories
-func (s *gitHubCommentProxyService) verifyRepositoryAccess(ctx context.Context, tokenContext gh.GitHubTokenContext,
-	req *ghcpv1.CreatePullRequestCommentRequest) error {
+func (s *gitHubCommentProxyService) verifyRepositoryAccess(ctx context.Context, config GitHubCommentProxyServiceConfig,
+	tokenContext gh.GitHubTokenContext, req pullRequestTarget) error {
 	verifyRepositoryAccessMetric.Inc()
 
 	if tokenContext.IsWorkloadIdentityToken() {
-		return s.verifyWorkloadIdentityToken(tokenContext, req)
+		return s.verifyWorkloadIdentityToken(ctx, config, tokenContext, req)
 	}
 
 	if tokenContext.IsActionToken() {
-		return s.verifyActionToken(ctx, tokenContext, req)
+		return s.verifyActionToken(ctx, config, tokenContext, req)
 	}
 
 	return fmt.Errorf("failed to verify repository access for token context")
 }
 
-func (s *gitHubCommentProxyService) verifyActionToken(ctx context.Context, _ gh.GitHubTokenContext,
-	req *ghcpv1.CreatePullRequestCommentRequest) error {
+func (s *gitHubCommentProxyService) verifyActionToken(ctx context.Context, config GitHubCommentProxyServiceConfig,
+	tokenContext gh.GitHubTokenContext, req pullRequestTarget) error {
 	prNumber, err := strconv.Atoi(req.GetPrNumber())
 	if err != nil {
 		return fmt.Errorf("failed to convert pr number to int: %w", err)
 	}
 
+	// The token must be issued for the requested repository. This is to
+	// prevent a GITHUB_TOKEN from one repository being used to comment on another.
+	expectedRepository := fmt.Sprintf("%s/%s", req.GetOwner(), req.GetRepo())
+	tokenRepository, ok := tokenContext.FindRepository(expectedRepository)
+	if !ok {
+		return fmt.Errorf("token does not have access to repository: %s", expectedRepository)
+	}
+
 	repo, err := s.ghRepoAdapter.GetRepository(ctx, req.GetOwner(), req.GetRepo())
 	if err != nil {
 		return fmt.Errorf("failed to get repository: %w", err)
 	}
 
-	if s.config.AllowOnlyPublicRepositories && repo.GetVisibility() != "public" {
+	// Repositories can be renamed, the ID is what we trust
+	if tokenRepository.ID != strconv.FormatInt(repo.GetID(), 10) {
+		return fmt.Errorf("repository id mismatch: %s != %d", tokenRepository.ID, repo.GetID())
+	}
+
+	err = verifyRepositoryAccessLists(config, strconv.FormatInt(repo.GetID(), 10),
+		strconv.FormatInt(repo.GetOwner().GetID(), 10))
+	if err != nil {
+		return err
+	}
+
+	if config.AllowOnlyPublicRepositories && repo.GetVisibility() != "public" {
 		return fmt.Errorf("repository is not public")
 	}
 
@@ -282,16 +1015,17 @@ func (s *gitHubCommentProxyService) verifyActionToken(ctx context.Context, _ gh.
 	}
 
 	if pr.GetState() != "open" {
-		return fmt.Errorf("pull request is not open: %s", pr.GetState())
+		return newError(ErrorCodeFailedPrecondition, ErrorReasonPullRequestClosed,
+			fmt.Errorf("pull request is not open: %s", pr.GetState()))
 	}
 
 	return nil
 }
 
-func (s *gitHubCommentProxyService) verifyWorkloadIdentityToken(tokenContext gh.GitHubTokenContext,
-	req *ghcpv1.CreatePullRequestCommentRequest) error {
-	if !strings.EqualFold(tokenContext.Audience, s.config.GitHubTokenAudienceName) {
-		return fmt.Errorf("audience mismatch: %s != %s", tokenContext.Audience, s.config.GitHubTokenAudienceName)
+func (s *gitHubCommentProxyService) verifyWorkloadIdentityToken(ctx context.Context, config GitHubCommentProxyServiceConfig,
+	tokenContext gh.GitHubTokenContext, req pullRequestTarget) error {
+	if _, ok := acceptedAudience(config.GitHubTokenAudiences, tokenContext.Audience); !ok {
+		return fmt.Errorf("audience mismatch: %v not in %v", tokenContext.Audience, config.GitHubTokenAudiences)
 	}
 
 	if !strings.EqualFold(tokenContext.RepositoryOwner, req.GetOwner()) {
@@ -303,17 +1037,34 @@ func (s *gitHubCommentProxyService) verifyWorkloadIdentityToken(tokenContext gh.
 		return fmt.Errorf("repository mismatch: %s != %s", tokenContext.Repository, expectedRepository)
 	}
 
-	if s.config.AllowOnlyPublicRepositories && tokenContext.RepositoryVisibility != "public" {
+	err := verifyRepositoryAccessLists(config, tokenContext.RepositoryID, tokenContext.RepositoryOwnerID)
+	if err != nil {
+		return err
+	}
+
+	if config.AllowOnlyPublicRepositories && tokenContext.RepositoryVisibility != "public" {
 		return fmt.Errorf("repository is not public: %s", tokenContext.RepositoryVisibility)
 	}
 
+	if config.VerifyPullRequestBinding {
+		prNumber, err := strconv.Atoi(req.GetPrNumber())
+		if err != nil {
+			return fmt.Errorf("failed to convert pr number to int: %w", err)
+		}
+
+		if err := s.verifyPullRequestBinding(ctx, config, tokenContext, req.GetOwner(), req.GetRepo(), prNumber); err != nil {
+			return fmt.Errorf("failed to verify pull request binding: %w", err)
+		}
+	}
+
 	return nil
 }
 
-func (s *gitHubCommentProxyService) verifyInstallation(ctx context.Context, owner, repo string) error {
+func (s *gitHubCommentProxyService) verifyInstallation(ctx context.Context, config GitHubCommentProxyServiceConfig,
+	owner, repo string) error {
 	verifyInstallationMetric.Inc()
 
-	for _, verifier := range s.config.InstallationVerifiers {
+	for _, verifier := range config.InstallationVerifiers {
 		content, err := s.ghRepoAdapter.GetFileContent(ctx, owner, repo, verifier.Path)
 		if err != nil {
 			log.Debugf("verifyInstallation: %s/%s: failed to get file content: %s", owner, repo, err)
@@ -327,3 +1078,47 @@ func (s *gitHubCommentProxyService) verifyInstallation(ctx context.Context, owne
 
 	return fmt.Errorf("no installation verifier matched")
 }
+
+// configForToken returns the configuration applicable for the token. Workload Identity
+// Tokens issued for an audience with a policy use the settings of the policy.
+func (s *gitHubCommentProxyService) configForToken(config GitHubCommentProxyServiceConfig,
+	tokenContext gh.GitHubTokenContext) GitHubCommentProxyServiceConfig {
+	if !tokenContext.IsWorkloadIdentityToken() {
+		return config
+	}
+
+	audience, ok := acceptedAudience(config.GitHubTokenAudiences, tokenContext.Audience)
+	if !ok {
+		return config
+	}
+
+	for name, policy := range config.GitHubTokenAudiencePolicies {
+		if !strings.EqualFold(name, audience) {
+			continue
+		}
+
+		log.Debugf("Using policy for audience: %s", name)
+
+		config.AllowOnlyPublicRepositories = policy.AllowOnlyPublicRepositories
+		config.MaxCommentsPerPR = policy.MaxCommentsPerPR
+		config.VerifyInstallation = policy.VerifyInstallation
+		config.InstallationVerifiers = policy.InstallationVerifiers
+
+		break
+	}
+
+	return config
+}
+
+// acceptedAudience returns the first audience of the token that is accepted
+func acceptedAudience(accepted []string, audiences []string) (string, bool) {
+	for _, audience := range audiences {
+		for _, name := range accepted {
+			if strings.EqualFold(audience, name) {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
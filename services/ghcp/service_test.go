@@ -2,13 +2,16 @@ package ghcp
 
 import (
 	"context"
+	"errors"
 	"regexp"
 	"testing"
+	"time"
 
 	ghcpv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/ghcp/v1"
 	ghapi "github.com/google/go-github/v69/github"
 	"github.com/safedep/ghcp/pkg/adapters/github"
 	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/safedep/ghcp/pkg/ratelimit"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"google.golang.org/protobuf/proto"
@@ -27,12 +30,12 @@ func TestGitHubCommentProxyService(t *testing.T) {
 		{
 			name: "create new comment",
 			config: GitHubCommentProxyServiceConfig{
-				GitHubTokenAudienceName: GitHubTokenAudienceName,
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
 			},
 			token: &gh.GitHubTokenContext{
 				Repository:      "safedep/ghcp",
 				RepositoryOwner: "safedep",
-				Audience:        GitHubTokenAudienceName,
+				Audience:        []string{GitHubTokenAudienceName},
 				TokenType:       gh.TokenTypeWorkloadIdentity,
 			},
 			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
@@ -66,12 +69,12 @@ func TestGitHubCommentProxyService(t *testing.T) {
 		{
 			name: "create comment fails when audience in request does not match token context",
 			config: GitHubCommentProxyServiceConfig{
-				GitHubTokenAudienceName: GitHubTokenAudienceName,
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
 			},
 			token: &gh.GitHubTokenContext{
 				Repository:      "safedep/ghcp",
 				RepositoryOwner: "safedep",
-				Audience:        "safedep-ghcp-test",
+				Audience:        []string{"safedep-ghcp-test"},
 			},
 			request: &ghcpv1.CreatePullRequestCommentRequest{
 				Owner:    "safedep",
@@ -89,7 +92,7 @@ func TestGitHubCommentProxyService(t *testing.T) {
 			token: &gh.GitHubTokenContext{
 				Repository:      "safedep/ghcp",
 				RepositoryOwner: "safedep",
-				Audience:        GitHubTokenAudienceName,
+				Audience:        []string{GitHubTokenAudienceName},
 			},
 			request: &ghcpv1.CreatePullRequestCommentRequest{
 				Owner:    "safedep-test",
@@ -107,7 +110,7 @@ func TestGitHubCommentProxyService(t *testing.T) {
 			token: &gh.GitHubTokenContext{
 				Repository:      "safedep/ghcp-test",
 				RepositoryOwner: "safedep",
-				Audience:        GitHubTokenAudienceName,
+				Audience:        []string{GitHubTokenAudienceName},
 			},
 			request: &ghcpv1.CreatePullRequestCommentRequest{
 				Owner:    "safedep",
@@ -128,7 +131,7 @@ func TestGitHubCommentProxyService(t *testing.T) {
 				Repository:           "safedep/ghcp",
 				RepositoryOwner:      "safedep",
 				RepositoryVisibility: "private",
-				Audience:             GitHubTokenAudienceName,
+				Audience:             []string{GitHubTokenAudienceName},
 			},
 			request: &ghcpv1.CreatePullRequestCommentRequest{
 				Owner: "safedep",
@@ -142,21 +145,114 @@ func TestGitHubCommentProxyService(t *testing.T) {
 		{
 			name: "update comment is successful when tag is provided and comment exists",
 			config: GitHubCommentProxyServiceConfig{
-				GitHubTokenAudienceName: GitHubTokenAudienceName,
+				BotUsername:          "safedep-bot",
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
 			},
 			token: &gh.GitHubTokenContext{
 				Repository:      "safedep/ghcp",
 				RepositoryOwner: "safedep",
-				Audience:        GitHubTokenAudienceName,
+				Audience:        []string{GitHubTokenAudienceName},
 				TokenType:       gh.TokenTypeWorkloadIdentity,
 			},
 			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
-				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
-					Return([]*ghapi.IssueComment{
-						{ID: proto.Int64(1), Body: proto.String("test comment with tag: test-tag")},
-					}, nil)
+				expectWalkIssueComments(m, []*ghapi.IssueComment{
+					{ID: proto.Int64(1), Body: proto.String(withTagMarker("old comment", "test-tag")), User: &ghapi.User{Login: proto.String("safedep-bot")}},
+				})
 				m.EXPECT().UpdateIssueComment(mock.Anything, "safedep", "ghcp", 1,
-					"test comment").Return(&ghapi.IssueComment{ID: proto.Int64(1)}, nil)
+					withTagMarker("test comment", "test-tag")).Return(&ghapi.IssueComment{ID: proto.Int64(1)}, nil)
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+				Tag:      "test-tag",
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, res.GetCommentId())
+			},
+		},
+		{
+			name: "update comment does not match tag as substring of the comment",
+			config: GitHubCommentProxyServiceConfig{
+				BotUsername:          "safedep-bot",
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			},
+			token: &gh.GitHubTokenContext{
+				Repository:      "safedep/ghcp",
+				RepositoryOwner: "safedep",
+				Audience:        []string{GitHubTokenAudienceName},
+				TokenType:       gh.TokenTypeWorkloadIdentity,
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				expectWalkIssueComments(m, []*ghapi.IssueComment{
+					{ID: proto.Int64(1), Body: proto.String("test comment with tag: test-tag"), User: &ghapi.User{Login: proto.String("safedep-bot")}},
+					{ID: proto.Int64(2), Body: proto.String(withTagMarker("test comment", "test-tag-2")), User: &ghapi.User{Login: proto.String("safedep-bot")}},
+				})
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+				Tag:      "test-tag",
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.ErrorContains(t, err, "no comment found with Tag")
+				assert.Nil(t, res)
+			},
+		},
+		{
+			name: "update comment ignores tag marker in comments by other users",
+			config: GitHubCommentProxyServiceConfig{
+				UpsertTaggedComments: true,
+				BotUsername:          "safedep-bot",
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			},
+			token: &gh.GitHubTokenContext{
+				Repository:      "safedep/ghcp",
+				RepositoryOwner: "safedep",
+				Audience:        []string{GitHubTokenAudienceName},
+				TokenType:       gh.TokenTypeWorkloadIdentity,
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				expectWalkIssueComments(m, []*ghapi.IssueComment{
+					{ID: proto.Int64(1), Body: proto.String(withTagMarker("spoofed", "test-tag")), User: &ghapi.User{Login: proto.String("test-user")}},
+				})
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+					withTagMarker("test comment", "test-tag")).Return(&ghapi.IssueComment{ID: proto.Int64(2)}, nil)
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+				Tag:      "test-tag",
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.NoError(t, err)
+				assert.Equal(t, "2", res.GetCommentId())
+			},
+		},
+		{
+			name: "update comment matches comment without tag marker in legacy mode",
+			config: GitHubCommentProxyServiceConfig{
+				LegacyTagMatching:    true,
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			},
+			token: &gh.GitHubTokenContext{
+				Repository:      "safedep/ghcp",
+				RepositoryOwner: "safedep",
+				Audience:        []string{GitHubTokenAudienceName},
+				TokenType:       gh.TokenTypeWorkloadIdentity,
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				expectWalkIssueComments(m, []*ghapi.IssueComment{
+					{ID: proto.Int64(1), Body: proto.String("test comment with tag: test-tag")},
+				})
+				m.EXPECT().UpdateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+					withTagMarker("test comment", "test-tag")).Return(&ghapi.IssueComment{ID: proto.Int64(1)}, nil)
 			},
 			request: &ghcpv1.CreatePullRequestCommentRequest{
 				Owner:    "safedep",
@@ -173,12 +269,12 @@ func TestGitHubCommentProxyService(t *testing.T) {
 		{
 			name: "update comment fails when when no comment found with tag",
 			config: GitHubCommentProxyServiceConfig{
-				GitHubTokenAudienceName: GitHubTokenAudienceName,
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
 			},
 			token: &gh.GitHubTokenContext{
 				Repository:      "safedep/ghcp",
 				RepositoryOwner: "safedep",
-				Audience:        GitHubTokenAudienceName,
+				Audience:        []string{GitHubTokenAudienceName},
 				TokenType:       gh.TokenTypeWorkloadIdentity,
 			},
 			request: &ghcpv1.CreatePullRequestCommentRequest{
@@ -189,36 +285,95 @@ func TestGitHubCommentProxyService(t *testing.T) {
 				Tag:      "test-tag",
 			},
 			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
-				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
-					Return([]*ghapi.IssueComment{}, nil)
+				expectWalkIssueComments(m, []*ghapi.IssueComment{})
 			},
 			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
 				assert.Error(t, err)
 				assert.Nil(t, res)
 			},
 		},
+		{
+			name: "update comment creates the comment when no comment found with tag in upsert mode",
+			config: GitHubCommentProxyServiceConfig{
+				UpsertTaggedComments: true,
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			},
+			token: &gh.GitHubTokenContext{
+				Repository:      "safedep/ghcp",
+				RepositoryOwner: "safedep",
+				Audience:        []string{GitHubTokenAudienceName},
+				TokenType:       gh.TokenTypeWorkloadIdentity,
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+				Tag:      "test-tag",
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				expectWalkIssueComments(m, []*ghapi.IssueComment{})
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+					withTagMarker("test comment", "test-tag")).Return(&ghapi.IssueComment{ID: proto.Int64(2)}, nil)
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.NoError(t, err)
+				assert.Equal(t, "2", res.GetCommentId())
+			},
+		},
+		{
+			name: "update comment fails when max comments per PR is reached in upsert mode",
+			config: GitHubCommentProxyServiceConfig{
+				UpsertTaggedComments: true,
+				MaxCommentsPerPR:     1,
+				BotUsername:          "safedep-bot",
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			},
+			token: &gh.GitHubTokenContext{
+				Repository:      "safedep/ghcp",
+				RepositoryOwner: "safedep",
+				Audience:        []string{GitHubTokenAudienceName},
+				TokenType:       gh.TokenTypeWorkloadIdentity,
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+				Tag:      "test-tag",
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				expectWalkIssueComments(m, []*ghapi.IssueComment{
+					{ID: proto.Int64(1), Body: proto.String("another comment"), User: &ghapi.User{Login: proto.String("safedep-bot")}},
+				})
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.ErrorContains(t, err, "maximum number of comments (1) reached")
+				assert.Nil(t, res)
+			},
+		},
 		{
 			name: "update comment fails when the comment user is not same as the bot user",
 			config: GitHubCommentProxyServiceConfig{
 				AllowOnlyOwnCommentUpdates: true,
+				LegacyTagMatching:          true,
 				BotUsername:                "safedep-bot",
-				GitHubTokenAudienceName:    GitHubTokenAudienceName,
+				GitHubTokenAudiences:       []string{GitHubTokenAudienceName},
 			},
 			token: &gh.GitHubTokenContext{
 				Repository:      "safedep/ghcp",
 				RepositoryOwner: "safedep",
-				Audience:        GitHubTokenAudienceName,
+				Audience:        []string{GitHubTokenAudienceName},
 				TokenType:       gh.TokenTypeWorkloadIdentity,
 			},
 			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
-				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
-					Return([]*ghapi.IssueComment{
-						{
-							ID:   proto.Int64(1),
-							User: &ghapi.User{Login: proto.String("test-user")},
-							Body: proto.String("test comment with tag: test-tag"),
-						},
-					}, nil)
+				expectWalkIssueComments(m, []*ghapi.IssueComment{
+					{
+						ID:   proto.Int64(1),
+						User: &ghapi.User{Login: proto.String("test-user")},
+						Body: proto.String("test comment with tag: test-tag"),
+					},
+				})
 
 				// We do not expect any calls to UpdateIssueComment because the user is not the same
 				// as the bot user. The service is expected to fail fast.
@@ -267,7 +422,7 @@ func TestGitHubCommentProxyService(t *testing.T) {
 		{
 			name: "create comment fails when user token is provided",
 			config: GitHubCommentProxyServiceConfig{
-				GitHubTokenAudienceName: GitHubTokenAudienceName,
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
 			},
 			token: &gh.GitHubTokenContext{
 				TokenType: gh.TokenTypeUser,
@@ -283,17 +438,218 @@ func TestGitHubCommentProxyService(t *testing.T) {
 				assert.Nil(t, res)
 			},
 		},
+		{
+			name:   "create comment is successful when action token has access to the repository",
+			config: GitHubCommentProxyServiceConfig{},
+			token: &gh.GitHubTokenContext{
+				TokenType: gh.TokenTypeAction,
+				Repositories: []gh.GitHubTokenRepository{
+					{ID: "100", FullName: "safedep/ghcp"},
+				},
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				m2.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+					Return(&ghapi.Repository{ID: proto.Int64(100), Visibility: proto.String("public")}, nil)
+				m2.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+					Return(&ghapi.PullRequest{State: proto.String("open")}, nil)
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+					"test comment").Return(&ghapi.IssueComment{ID: proto.Int64(1)}, nil)
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, res.GetCommentId())
+			},
+		},
+		{
+			name:   "create comment fails when action token does not have access to the repository",
+			config: GitHubCommentProxyServiceConfig{},
+			token: &gh.GitHubTokenContext{
+				TokenType: gh.TokenTypeAction,
+				Repositories: []gh.GitHubTokenRepository{
+					{ID: "100", FullName: "safedep/vet"},
+				},
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.ErrorContains(t, err, "token does not have access to repository")
+				assert.Nil(t, res)
+			},
+		},
+		{
+			name:   "create comment fails when action token repository id does not match",
+			config: GitHubCommentProxyServiceConfig{},
+			token: &gh.GitHubTokenContext{
+				TokenType: gh.TokenTypeAction,
+				Repositories: []gh.GitHubTokenRepository{
+					{ID: "100", FullName: "safedep/ghcp"},
+				},
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				m2.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+					Return(&ghapi.Repository{ID: proto.Int64(200), Visibility: proto.String("public")}, nil)
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.ErrorContains(t, err, "repository id mismatch")
+				assert.Nil(t, res)
+			},
+		},
+		{
+			name: "create comment uses the policy of the token audience",
+			config: GitHubCommentProxyServiceConfig{
+				MaxCommentsPerPR:     2,
+				BotUsername:          "safedep-bot",
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName, "safedep-other"},
+				GitHubTokenAudiencePolicies: map[string]GitHubTokenAudiencePolicy{
+					"safedep-other": {MaxCommentsPerPR: 1},
+				},
+			},
+			token: &gh.GitHubTokenContext{
+				Repository:      "safedep/ghcp",
+				RepositoryOwner: "safedep",
+				Audience:        []string{"safedep-other"},
+				TokenType:       gh.TokenTypeWorkloadIdentity,
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
+					Return([]*ghapi.IssueComment{
+						{ID: proto.Int64(1), Body: proto.String("test comment 1"), User: &ghapi.User{Login: proto.String("safedep-bot")}},
+					}, nil)
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.ErrorContains(t, err, "maximum number of comments (1) reached")
+				assert.Nil(t, res)
+			},
+		},
+		{
+			name: "create comment fails when audience policy is not for an accepted audience",
+			config: GitHubCommentProxyServiceConfig{
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+				GitHubTokenAudiencePolicies: map[string]GitHubTokenAudiencePolicy{
+					"safedep-other": {},
+				},
+			},
+			serviceInitError: errors.New("audience policy for safedep-other is not an accepted audience"),
+		},
+		{
+			name: "service init fails when comment signing key is too short",
+			config: GitHubCommentProxyServiceConfig{
+				CommentSigningKey:    []byte("short"),
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			},
+			serviceInitError: errors.New("comment signing key must be at least 32 bytes"),
+		},
+		{
+			name: "service init fails when workflow identity is required without signing key",
+			config: GitHubCommentProxyServiceConfig{
+				RequireMatchingWorkflowIdentity: true,
+				GitHubTokenAudiences:            []string{GitHubTokenAudienceName},
+			},
+			serviceInitError: errors.New("comment signing key is required when RequireMatchingWorkflowIdentity is true"),
+		},
+		{
+			name: "create comment counts only comments by the app when app is installed",
+			config: GitHubCommentProxyServiceConfig{
+				MaxCommentsPerPR:     2,
+				BotUsername:          "safedep-bot",
+				UseGitHubAppIdentity: true,
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			},
+			token: &gh.GitHubTokenContext{
+				Repository:      "safedep/ghcp",
+				RepositoryOwner: "safedep",
+				Audience:        []string{GitHubTokenAudienceName},
+				TokenType:       gh.TokenTypeWorkloadIdentity,
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				m.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
+					Return([]*ghapi.IssueComment{
+						{ID: proto.Int64(1), Body: proto.String("test comment 1"), User: &ghapi.User{Login: proto.String("safedep-ghcp[bot]")}},
+						{ID: proto.Int64(2), Body: proto.String("test comment 2"), User: &ghapi.User{Login: proto.String("safedep-bot")}},
+					}, nil)
+				m.EXPECT().GetAppIdentity(mock.Anything, "safedep", "ghcp").
+					Return(&github.GitHubAppIdentity{AppID: 1, Slug: "safedep-ghcp"}, nil)
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+					"test comment").Return(&ghapi.IssueComment{ID: proto.Int64(3)}, nil)
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.NoError(t, err)
+				assert.Equal(t, "3", res.GetCommentId())
+			},
+		},
+		{
+			name: "update comment fails when the comment is not by the app when app is installed",
+			config: GitHubCommentProxyServiceConfig{
+				AllowOnlyOwnCommentUpdates: true,
+				LegacyTagMatching:          true,
+				BotUsername:                "safedep-bot",
+				UseGitHubAppIdentity:       true,
+				GitHubTokenAudiences:       []string{GitHubTokenAudienceName},
+			},
+			token: &gh.GitHubTokenContext{
+				Repository:      "safedep/ghcp",
+				RepositoryOwner: "safedep",
+				Audience:        []string{GitHubTokenAudienceName},
+				TokenType:       gh.TokenTypeWorkloadIdentity,
+			},
+			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
+				expectWalkIssueComments(m, []*ghapi.IssueComment{
+					{ID: proto.Int64(1), Body: proto.String("test comment with tag: test-tag"), User: &ghapi.User{Login: proto.String("safedep-bot")}},
+				})
+				m.EXPECT().GetAppIdentity(mock.Anything, "safedep", "ghcp").
+					Return(&github.GitHubAppIdentity{AppID: 1, Slug: "safedep-ghcp"}, nil)
+			},
+			request: &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+				Tag:      "test-tag",
+			},
+			assert: func(t *testing.T, err error, res *ghcpv1.CreatePullRequestCommentResponse) {
+				assert.ErrorContains(t, err, "refusing to update comment created by another user")
+				assert.Nil(t, res)
+			},
+		},
 		{
 			name: "create comment fails when max comments per PR is reached",
 			config: GitHubCommentProxyServiceConfig{
-				MaxCommentsPerPR:        2,
-				BotUsername:             "safedep-bot",
-				GitHubTokenAudienceName: GitHubTokenAudienceName,
+				MaxCommentsPerPR:     2,
+				BotUsername:          "safedep-bot",
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
 			},
 			token: &gh.GitHubTokenContext{
 				Repository:      "safedep/ghcp",
 				RepositoryOwner: "safedep",
-				Audience:        GitHubTokenAudienceName,
+				Audience:        []string{GitHubTokenAudienceName},
 				TokenType:       gh.TokenTypeWorkloadIdentity,
 			},
 			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
@@ -318,14 +674,14 @@ func TestGitHubCommentProxyService(t *testing.T) {
 		{
 			name: "create comment is successful when max comments per PR is not met for the bot user",
 			config: GitHubCommentProxyServiceConfig{
-				MaxCommentsPerPR:        2,
-				BotUsername:             "safedep-bot",
-				GitHubTokenAudienceName: GitHubTokenAudienceName,
+				MaxCommentsPerPR:     2,
+				BotUsername:          "safedep-bot",
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
 			},
 			token: &gh.GitHubTokenContext{
 				Repository:      "safedep/ghcp",
 				RepositoryOwner: "safedep",
-				Audience:        GitHubTokenAudienceName,
+				Audience:        []string{GitHubTokenAudienceName},
 				TokenType:       gh.TokenTypeWorkloadIdentity,
 			},
 			mock: func(m *github.MockGitHubIssueAdapter, m2 *github.MockGitHubRepositoryAdapter) {
@@ -355,7 +711,8 @@ func TestGitHubCommentProxyService(t *testing.T) {
 			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
 			ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
 
-			service, err := NewGitHubCommentProxyService(c.config, ghIssueAdapter, ghRepoAdapter)
+			service, err := NewGitHubCommentProxyService(c.config, ghIssueAdapter, ghRepoAdapter,
+				github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
 			if c.serviceInitError != nil {
 				assert.Error(t, err)
 				assert.Nil(t, service)
@@ -379,3 +736,514 @@ func TestGitHubCommentProxyService(t *testing.T) {
 		})
 	}
 }
+
+func TestCreatePullRequestCommentAction(t *testing.T) {
+	token := gh.GitHubTokenContext{
+		Repository:      "safedep/ghcp",
+		RepositoryOwner: "safedep",
+		Audience:        []string{GitHubTokenAudienceName},
+		TokenType:       gh.TokenTypeWorkloadIdentity,
+	}
+
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+		Tag:      "test-tag",
+	}
+
+	cases := []struct {
+		name     string
+		comments []*ghapi.IssueComment
+		mock     func(*github.MockGitHubIssueAdapter)
+		action   CommentAction
+	}{
+		{
+			name: "updated when comment with tag exists",
+			comments: []*ghapi.IssueComment{
+				{ID: proto.Int64(1), Body: proto.String(withTagMarker("old comment", "test-tag"))},
+			},
+			mock: func(m *github.MockGitHubIssueAdapter) {
+				m.EXPECT().UpdateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+					withTagMarker("test comment", "test-tag")).Return(&ghapi.IssueComment{ID: proto.Int64(1)}, nil)
+			},
+			action: CommentActionUpdated,
+		},
+		{
+			name:     "created when comment with tag does not exist",
+			comments: []*ghapi.IssueComment{},
+			mock: func(m *github.MockGitHubIssueAdapter) {
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+					withTagMarker("test comment", "test-tag")).Return(&ghapi.IssueComment{ID: proto.Int64(2)}, nil)
+			},
+			action: CommentActionCreated,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			expectWalkIssueComments(ghIssueAdapter, c.comments)
+			c.mock(ghIssueAdapter)
+
+			service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+				UpsertTaggedComments: true,
+				GitHubTokenAudiences: []string{GitHubTokenAudienceName},
+			}, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t), github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+			result, err := service.CreatePullRequestComment(ctx, request)
+			assert.NoError(t, err)
+			assert.Equal(t, c.action, result.Action)
+		})
+	}
+}
+
+func TestSignedTagMarkers(t *testing.T) {
+	signingKey := []byte("0123456789abcdef0123456789abcdef")
+	signer := tagMarkerSigner{key: signingKey}
+
+	token := gh.GitHubTokenContext{
+		Repository:      "safedep/ghcp",
+		RepositoryID:    "100",
+		RepositoryOwner: "safedep",
+		Audience:        []string{GitHubTokenAudienceName},
+		TokenType:       gh.TokenTypeWorkloadIdentity,
+		WorkflowRef:     "safedep/ghcp/.github/workflows/vet.yml@refs/pull/1/merge",
+		JobWorkflowRef:  "safedep/ghcp/.github/workflows/vet.yml@refs/pull/1/merge",
+	}
+
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+		Tag:      "test-tag",
+	}
+
+	expectedMarker := signer.sign(tagMarker{
+		Tag:          "test-tag",
+		RepositoryID: "100",
+		PullRequest:  "1",
+		Workflow:     "safedep/ghcp/.github/workflows/vet.yml",
+	})
+
+	otherWorkflowMarker := signer.sign(tagMarker{
+		Tag:          "test-tag",
+		RepositoryID: "100",
+		PullRequest:  "1",
+		Workflow:     "safedep/ghcp/.github/workflows/other.yml",
+	})
+
+	// Markers signed before they covered the pull request
+	unboundMarker := signer.sign(tagMarker{
+		Tag:          "test-tag",
+		RepositoryID: "100",
+		Workflow:     "safedep/ghcp/.github/workflows/vet.yml",
+	})
+
+	botComment := func(id int64, body string) *ghapi.IssueComment {
+		return &ghapi.IssueComment{ID: proto.Int64(id), Body: proto.String(body),
+			User: &ghapi.User{Login: proto.String("safedep-bot")}}
+	}
+
+	cases := []struct {
+		name                    string
+		requireMatchingWorkflow bool
+		legacyTagMatching       bool
+		comments                []*ghapi.IssueComment
+		action                  CommentAction
+		commentId               int
+	}{
+		{
+			name:      "comment with valid signature is updated",
+			comments:  []*ghapi.IssueComment{botComment(1, expectedMarker.withMarker("old comment"))},
+			action:    CommentActionUpdated,
+			commentId: 1,
+		},
+		{
+			name:     "comment with unsigned marker is not updated",
+			comments: []*ghapi.IssueComment{botComment(1, withTagMarker("old comment", "test-tag"))},
+			action:   CommentActionCreated,
+		},
+		{
+			name:              "comment with unsigned marker is updated in legacy mode",
+			legacyTagMatching: true,
+			comments:          []*ghapi.IssueComment{botComment(1, withTagMarker("old comment", "test-tag"))},
+			action:            CommentActionUpdated,
+			commentId:         1,
+		},
+		{
+			name: "comment with forged signature is not updated",
+			comments: []*ghapi.IssueComment{botComment(1, tagMarker{
+				Tag:          "test-tag",
+				RepositoryID: "100",
+				PullRequest:  "1",
+				Workflow:     "safedep/ghcp/.github/workflows/vet.yml",
+				Signature:    "0000",
+			}.withMarker("old comment"))},
+			action: CommentActionCreated,
+		},
+		{
+			name: "comment with signature for another repository is not updated",
+			comments: []*ghapi.IssueComment{botComment(1, signer.sign(tagMarker{
+				Tag:          "test-tag",
+				RepositoryID: "200",
+				PullRequest:  "1",
+				Workflow:     "safedep/ghcp/.github/workflows/vet.yml",
+			}).withMarker("old comment"))},
+			action: CommentActionCreated,
+		},
+		{
+			name: "comment with signature for another pull request is not updated",
+			comments: []*ghapi.IssueComment{botComment(1, signer.sign(tagMarker{
+				Tag:          "test-tag",
+				RepositoryID: "100",
+				PullRequest:  "2",
+				Workflow:     "safedep/ghcp/.github/workflows/vet.yml",
+			}).withMarker("old comment"))},
+			action: CommentActionCreated,
+		},
+		{
+			name:     "comment signed without the pull request is not updated",
+			comments: []*ghapi.IssueComment{botComment(1, unboundMarker.withMarker("old comment"))},
+			action:   CommentActionCreated,
+		},
+		{
+			name:              "comment signed without the pull request is updated in legacy mode",
+			legacyTagMatching: true,
+			comments:          []*ghapi.IssueComment{botComment(1, unboundMarker.withMarker("old comment"))},
+			action:            CommentActionUpdated,
+			commentId:         1,
+		},
+		{
+			name: "comment with valid signature by another user is not updated",
+			comments: []*ghapi.IssueComment{{ID: proto.Int64(1), Body: proto.String(expectedMarker.withMarker("old comment")),
+				User: &ghapi.User{Login: proto.String("test-user")}}},
+			action: CommentActionCreated,
+		},
+		{
+			name:      "comment by another workflow is updated when workflow identity is not required",
+			comments:  []*ghapi.IssueComment{botComment(1, otherWorkflowMarker.withMarker("old comment"))},
+			action:    CommentActionUpdated,
+			commentId: 1,
+		},
+		{
+			name:                    "comment by another workflow is not updated when workflow identity is required",
+			requireMatchingWorkflow: true,
+			legacyTagMatching:       true,
+			comments:                []*ghapi.IssueComment{botComment(1, otherWorkflowMarker.withMarker("old comment"))},
+			action:                  CommentActionCreated,
+		},
+		{
+			name:                    "comment by the same workflow is updated when workflow identity is required",
+			requireMatchingWorkflow: true,
+			comments: []*ghapi.IssueComment{
+				botComment(1, otherWorkflowMarker.withMarker("old comment")),
+				botComment(2, expectedMarker.withMarker("old comment")),
+			},
+			action:    CommentActionUpdated,
+			commentId: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			expectWalkIssueComments(ghIssueAdapter, c.comments)
+
+			expectedBody := expectedMarker.withMarker("test comment")
+			if c.action == CommentActionUpdated {
+				ghIssueAdapter.EXPECT().UpdateIssueComment(mock.Anything, "safedep", "ghcp", c.commentId,
+					expectedBody).Return(&ghapi.IssueComment{ID: proto.Int64(int64(c.commentId))}, nil)
+			} else {
+				ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+					expectedBody).Return(&ghapi.IssueComment{ID: proto.Int64(3)}, nil)
+			}
+
+			service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+				BotUsername:                     "safedep-bot",
+				UpsertTaggedComments:            true,
+				LegacyTagMatching:               c.legacyTagMatching,
+				CommentSigningKey:               signingKey,
+				RequireMatchingWorkflowIdentity: c.requireMatchingWorkflow,
+				GitHubTokenAudiences:            []string{GitHubTokenAudienceName},
+			}, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t), github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+			result, err := service.CreatePullRequestComment(ctx, request)
+			assert.NoError(t, err)
+			assert.Equal(t, c.action, result.Action)
+		})
+	}
+}
+
+func TestSignedTagMarkerRepositoryLookup(t *testing.T) {
+	signingKey := []byte("0123456789abcdef0123456789abcdef")
+
+	ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+	expectWalkIssueComments(ghIssueAdapter, []*ghapi.IssueComment{})
+	ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+		tagMarkerSigner{key: signingKey}.sign(tagMarker{Tag: "test-tag", RepositoryID: "100", PullRequest: "1"}).
+			withMarker("test comment")).
+		Return(&ghapi.IssueComment{ID: proto.Int64(1)}, nil)
+
+	// The repository ID is not available in a user token
+	ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+	ghRepoAdapter.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+		Return(&ghapi.Repository{ID: proto.Int64(100)}, nil)
+
+	service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+		UpsertTaggedComments:      true,
+		CommentSigningKey:         signingKey,
+		InsecureSkipAuthorization: true,
+	}, ghIssueAdapter, ghRepoAdapter, github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+	assert.NoError(t, err)
+
+	result, err := service.CreatePullRequestComment(context.Background(), &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+		Tag:      "test-tag",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, CommentActionCreated, result.Action)
+}
+
+func TestWorkflowIdentityOfActionTokens(t *testing.T) {
+	signingKey := []byte("0123456789abcdef0123456789abcdef")
+
+	// GITHUB_TOKEN does not identify the workflow
+	token := gh.GitHubTokenContext{
+		TokenType:    gh.TokenTypeAction,
+		Repositories: []gh.GitHubTokenRepository{{ID: "100", FullName: "safedep/ghcp"}},
+	}
+
+	cases := []struct {
+		name string
+		tag  string
+		mock func(*github.MockGitHubIssueAdapter)
+		err  string
+	}{
+		{
+			name: "tagged comment is not updated",
+			tag:  "test-tag",
+			err:  "workflow identity is required to change a comment",
+		},
+		{
+			name: "comment without tag is created with a signed marker",
+			mock: func(m *github.MockGitHubIssueAdapter) {
+				m.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1,
+					tagMarkerSigner{key: signingKey}.sign(tagMarker{RepositoryID: "100", PullRequest: "1"}).
+						withMarker("test comment")).
+					Return(&ghapi.IssueComment{ID: proto.Int64(1)}, nil)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+			if c.mock != nil {
+				c.mock(ghIssueAdapter)
+			}
+
+			ghRepoAdapter := github.NewMockGitHubRepositoryAdapter(t)
+			ghRepoAdapter.EXPECT().GetRepository(mock.Anything, "safedep", "ghcp").
+				Return(&ghapi.Repository{ID: proto.Int64(100), Visibility: proto.String("public")}, nil).Maybe()
+			ghRepoAdapter.EXPECT().GetPullRequest(mock.Anything, "safedep", "ghcp", 1).
+				Return(&ghapi.PullRequest{State: proto.String("open")}, nil).Maybe()
+
+			service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+				BotUsername:                     "safedep-bot",
+				CommentSigningKey:               signingKey,
+				RequireMatchingWorkflowIdentity: true,
+			}, ghIssueAdapter, ghRepoAdapter, github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+			assert.NoError(t, err)
+
+			ctx := gh.InjectGitHubTokenContext(context.Background(), token)
+			_, err = service.CreatePullRequestComment(ctx, &ghcpv1.CreatePullRequestCommentRequest{
+				Owner:    "safedep",
+				Repo:     "ghcp",
+				PrNumber: "1",
+				Body:     "test comment",
+				Tag:      c.tag,
+			})
+
+			if c.err != "" {
+				var serviceErr *Error
+				assert.True(t, errors.As(err, &serviceErr))
+				assert.Equal(t, ErrorCodePermissionDenied, serviceErr.Code)
+				assert.ErrorContains(t, err, c.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTaggedCommentLookupStopsAtMatch(t *testing.T) {
+	comments := []*ghapi.IssueComment{
+		{ID: proto.Int64(1), Body: proto.String("test comment 1")},
+		{ID: proto.Int64(2), Body: proto.String(withTagMarker("test comment 2", "test-tag"))},
+		{ID: proto.Int64(3), Body: proto.String(withTagMarker("test comment 3", "test-tag"))},
+		{ID: proto.Int64(4), Body: proto.String("test comment 4")},
+	}
+
+	visited := 0
+
+	ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+	ghIssueAdapter.EXPECT().WalkIssueComments(mock.Anything, "safedep", "ghcp", 1, mock.Anything).
+		RunAndReturn(func(_ context.Context, _, _ string, _ int, fn func(*ghapi.IssueComment) bool) error {
+			for _, comment := range comments {
+				visited++
+				if !fn(comment) {
+					break
+				}
+			}
+
+			return nil
+		})
+	ghIssueAdapter.EXPECT().UpdateIssueComment(mock.Anything, "safedep", "ghcp", 2,
+		withTagMarker("test comment", "test-tag")).Return(&ghapi.IssueComment{ID: proto.Int64(2)}, nil)
+
+	service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+	}, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t), github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+	assert.NoError(t, err)
+
+	result, err := service.CreatePullRequestComment(context.Background(), &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+		Tag:      "test-tag",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2", result.Response.GetCommentId())
+	assert.Equal(t, 2, visited)
+}
+
+// expectWalkIssueComments sets up the mock to walk the comments on PR 1 of safedep/ghcp
+func expectWalkIssueComments(m *github.MockGitHubIssueAdapter, comments []*ghapi.IssueComment) {
+	m.EXPECT().WalkIssueComments(mock.Anything, "safedep", "ghcp", 1, mock.Anything).
+		RunAndReturn(func(_ context.Context, _, _ string, _ int, fn func(*ghapi.IssueComment) bool) error {
+			for _, comment := range comments {
+				if !fn(comment) {
+					break
+				}
+			}
+
+			return nil
+		})
+}
+
+func TestUpdateConfig(t *testing.T) {
+	ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+	ghIssueAdapter.EXPECT().ListIssueComments(mock.Anything, "safedep", "ghcp", 1).
+		Return([]*ghapi.IssueComment{
+			{ID: proto.Int64(1), Body: proto.String("test comment 1"), User: &ghapi.User{Login: proto.String("safedep-bot")}},
+		}, nil)
+	ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+		Return(&ghapi.IssueComment{ID: proto.Int64(2)}, nil).Once()
+
+	service, err := NewGitHubCommentProxyService(GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		BotUsername:               "safedep-bot",
+		MaxCommentsPerPR:          2,
+	}, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t), github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+	assert.NoError(t, err)
+
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+	}
+
+	_, err = service.CreatePullRequestComment(context.Background(), request)
+	assert.NoError(t, err)
+
+	err = service.UpdateConfig(GitHubCommentProxyServiceConfig{
+		RequireMatchingWorkflowIdentity: true,
+	})
+	assert.ErrorContains(t, err, "comment signing key is required")
+
+	err = service.UpdateConfig(GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		BotUsername:               "safedep-bot",
+		MaxCommentsPerPR:          1,
+	})
+	assert.NoError(t, err)
+
+	_, err = service.CreatePullRequestComment(context.Background(), request)
+	assert.ErrorContains(t, err, "maximum number of comments")
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, ratelimit.Rule) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func (failingRateLimitStore) Refund(context.Context, string, ratelimit.Rule) error {
+	return errors.New("connection refused")
+}
+
+func TestCreatePullRequestCommentWithRateLimits(t *testing.T) {
+	config := GitHubCommentProxyServiceConfig{
+		InsecureSkipAuthorization: true,
+		RateLimits: []ratelimit.Rule{
+			{Scope: ratelimit.ScopeRepository, Requests: 1, Per: time.Hour},
+		},
+	}
+
+	request := &ghcpv1.CreatePullRequestCommentRequest{
+		Owner:    "safedep",
+		Repo:     "ghcp",
+		PrNumber: "1",
+		Body:     "test comment",
+	}
+
+	t.Run("requests over the limit are refused", func(t *testing.T) {
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			Return(&ghapi.IssueComment{ID: proto.Int64(1)}, nil).Once()
+
+		service, err := NewGitHubCommentProxyService(config, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t),
+			github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+		assert.NoError(t, err)
+
+		_, err = service.Execute(context.Background(), request)
+		assert.NoError(t, err)
+
+		_, err = service.Execute(context.Background(), request)
+
+		var limitErr *ratelimit.LimitExceededError
+		assert.True(t, errors.As(err, &limitErr))
+		assert.Equal(t, ratelimit.ScopeRepository, limitErr.Scope)
+		assert.Equal(t, "safedep/ghcp", limitErr.Key)
+	})
+
+	t.Run("requests are allowed when the store is unavailable", func(t *testing.T) {
+		ghIssueAdapter := github.NewMockGitHubIssueAdapter(t)
+		ghIssueAdapter.EXPECT().CreateIssueComment(mock.Anything, "safedep", "ghcp", 1, "test comment").
+			Return(&ghapi.IssueComment{ID: proto.Int64(1)}, nil).Twice()
+
+		service, err := NewGitHubCommentProxyService(config, ghIssueAdapter, github.NewMockGitHubRepositoryAdapter(t),
+			github.NewMockGitHubPullRequestAdapter(t), github.NewMockGitHubCheckAdapter(t))
+		assert.NoError(t, err)
+
+		service.SetRateLimitStore(failingRateLimitStore{})
+		for i := 0; i < 2; i++ {
+			_, err = service.Execute(context.Background(), request)
+			assert.NoError(t, err)
+		}
+	})
+}
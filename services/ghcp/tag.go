@@ -0,0 +1,198 @@
+package ghcp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/safedep/ghcp/pkg/gh"
+)
+
+// Minimum length of the key used to sign tag markers
+const minCommentSigningKeyLength = 32
+
+// Hidden marker embedded in tagged comments. Values are URL encoded
+// so that they can not terminate the HTML comment.
+var tagMarkerRegexp = regexp.MustCompile(`<!-- ghcp:(\S+(?: \S+)*) -->`)
+
+// tagMarker identifies a comment created through the service. The tag is
+// empty for comments created without one. The repository, pull request and
+// workflow are only set when the marker is signed.
+type tagMarker struct {
+	Tag          string
+	RepositoryID string
+	PullRequest  string
+	Workflow     string
+	Signature    string
+}
+
+func (m tagMarker) String() string {
+	fields := []string{"tag=" + url.QueryEscape(m.Tag)}
+	if m.RepositoryID != "" {
+		fields = append(fields, "repo="+url.QueryEscape(m.RepositoryID))
+	}
+
+	if m.PullRequest != "" {
+		fields = append(fields, "pr="+url.QueryEscape(m.PullRequest))
+	}
+
+	if m.Workflow != "" {
+		fields = append(fields, "workflow="+url.QueryEscape(m.Workflow))
+	}
+
+	if m.Signature != "" {
+		fields = append(fields, "sig="+m.Signature)
+	}
+
+	return fmt.Sprintf("<!-- ghcp:%s -->", strings.Join(fields, " "))
+}
+
+func (m tagMarker) isSigned() bool {
+	return m.Signature != ""
+}
+
+// withMarker returns the body with the hidden marker
+func (m tagMarker) withMarker(body string) string {
+	return fmt.Sprintf("%s\n\n%s", strings.TrimRight(body, "\n"), m.String())
+}
+
+// tagMarkerFor returns the unsigned marker for the tag
+func tagMarkerFor(tag string) tagMarker {
+	return tagMarker{Tag: tag}
+}
+
+// withTagMarker returns the body with the unsigned marker for the tag
+func withTagMarker(body, tag string) string {
+	return tagMarkerFor(tag).withMarker(body)
+}
+
+// parseTagMarkers returns the markers in the body. Malformed markers are ignored.
+func parseTagMarkers(body string) []tagMarker {
+	var markers []tagMarker
+	for _, match := range tagMarkerRegexp.FindAllStringSubmatch(body, -1) {
+		marker, ok := parseTagMarker(match[1])
+		if ok {
+			markers = append(markers, marker)
+		}
+	}
+
+	return markers
+}
+
+func parseTagMarker(s string) (tagMarker, bool) {
+	var marker tagMarker
+	var hasTag bool
+
+	for _, field := range strings.Split(s, " ") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return tagMarker{}, false
+		}
+
+		value, err := url.QueryUnescape(value)
+		if err != nil {
+			return tagMarker{}, false
+		}
+
+		switch key {
+		case "tag":
+			marker.Tag = value
+			hasTag = true
+		case "repo":
+			marker.RepositoryID = value
+		case "pr":
+			marker.PullRequest = value
+		case "workflow":
+			marker.Workflow = value
+		case "sig":
+			marker.Signature = value
+		default:
+			return tagMarker{}, false
+		}
+	}
+
+	return marker, hasTag
+}
+
+// hasTagMarker returns true if the body has an unsigned marker for exactly the tag
+func hasTagMarker(body, tag string) bool {
+	for _, marker := range parseTagMarkers(body) {
+		if !marker.isSigned() && marker.Tag == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasAnyTagMarker returns true if the body has a marker for any tag
+func hasAnyTagMarker(body string) bool {
+	return len(parseTagMarkers(body)) > 0
+}
+
+// tagMarkerSigner signs markers with a key held by the service so that a
+// marker can not be forged by pasting it into a comment
+type tagMarkerSigner struct {
+	key []byte
+}
+
+func (s tagMarkerSigner) sign(marker tagMarker) tagMarker {
+	marker.Signature = hex.EncodeToString(s.mac(marker))
+	return marker
+}
+
+func (s tagMarkerSigner) verify(marker tagMarker) bool {
+	signature, err := hex.DecodeString(marker.Signature)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(signature, s.mac(marker))
+}
+
+func (s tagMarkerSigner) mac(marker tagMarker) []byte {
+	// Values are escaped, the separator can not appear in them
+	fields := []string{
+		"ghcp:v2",
+		url.QueryEscape(marker.Tag),
+		url.QueryEscape(marker.RepositoryID),
+		url.QueryEscape(marker.PullRequest),
+		url.QueryEscape(marker.Workflow),
+	}
+
+	// Markers signed before the pull request was covered. Such markers
+	// are only matched by legacy matching.
+	if marker.PullRequest == "" {
+		fields = []string{
+			"ghcp:v1",
+			url.QueryEscape(marker.Tag),
+			url.QueryEscape(marker.RepositoryID),
+			url.QueryEscape(marker.Workflow),
+		}
+	}
+
+	message := strings.Join(fields, "\n")
+
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(message))
+
+	return h.Sum(nil)
+}
+
+// workflowIdentity returns the identity of the workflow the token was issued
+// to. This is the reusable workflow when the job uses one. The ref is removed
+// so that the identity is stable across the branches the workflow runs on.
+// GITHUB_TOKEN does not identify a workflow, the identity is empty.
+func workflowIdentity(tokenContext gh.GitHubTokenContext) string {
+	ref := tokenContext.JobWorkflowRef
+	if ref == "" {
+		ref = tokenContext.WorkflowRef
+	}
+
+	identity, _, _ := strings.Cut(ref, "@")
+	return identity
+}
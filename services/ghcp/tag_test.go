@@ -0,0 +1,98 @@
+package ghcp
+
+import (
+	"testing"
+
+	"github.com/safedep/ghcp/pkg/gh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasTagMarker(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		tag  string
+		want bool
+	}{
+		{"marker for the tag", withTagMarker("comment", "test-tag"), "test-tag", true},
+		{"marker for another tag", withTagMarker("comment", "test-tag-2"), "test-tag", false},
+		{"tag without marker", "comment with test-tag", "test-tag", false},
+		{"tag with special characters", withTagMarker("comment", "a tag -->"), "a tag -->", true},
+		{"marker not at the end", tagMarkerFor("test-tag").String() + "\ncomment", "test-tag", true},
+		{"signed marker", tagMarker{Tag: "test-tag", Signature: "00"}.withMarker("comment"), "test-tag", false},
+		{"no marker", "comment", "test-tag", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, hasTagMarker(c.body, c.tag))
+		})
+	}
+}
+
+func TestWithTagMarker(t *testing.T) {
+	assert.Equal(t, "comment\n\n<!-- ghcp:tag=a+tag+--%3E -->", withTagMarker("comment\n", "a tag -->"))
+}
+
+func TestParseTagMarkers(t *testing.T) {
+	marker := tagMarker{
+		Tag:          "test tag",
+		RepositoryID: "1",
+		Workflow:     "safedep/ghcp/.github/workflows/ci.yml",
+		Signature:    "abcd",
+	}
+
+	assert.Equal(t, []tagMarker{marker}, parseTagMarkers(marker.withMarker("comment")))
+	assert.Empty(t, parseTagMarkers("comment <!-- ghcp:repo=1 -->"))
+	assert.Empty(t, parseTagMarkers("comment <!-- ghcp:tag=a unknown=1 -->"))
+	assert.Empty(t, parseTagMarkers("comment <!-- ghcp:tag=%zz -->"))
+}
+
+func TestTagMarkerSigner(t *testing.T) {
+	signer := tagMarkerSigner{key: []byte("0123456789abcdef0123456789abcdef")}
+	marker := signer.sign(tagMarker{
+		Tag:          "test-tag",
+		RepositoryID: "1",
+		PullRequest:  "10",
+		Workflow:     "safedep/ghcp/.github/workflows/ci.yml",
+	})
+
+	assert.True(t, marker.isSigned())
+	assert.True(t, signer.verify(marker))
+
+	parsed := parseTagMarkers(marker.withMarker("comment"))
+	assert.Len(t, parsed, 1)
+	assert.True(t, signer.verify(parsed[0]))
+
+	tampered := marker
+	tampered.RepositoryID = "2"
+	assert.False(t, signer.verify(tampered))
+
+	tampered = marker
+	tampered.PullRequest = "2"
+	assert.False(t, signer.verify(tampered))
+
+	tampered = marker
+	tampered.Workflow = "safedep/ghcp/.github/workflows/other.yml"
+	assert.False(t, signer.verify(tampered))
+
+	tampered = marker
+	tampered.Signature = "not-hex"
+	assert.False(t, signer.verify(tampered))
+
+	otherSigner := tagMarkerSigner{key: []byte("fedcba9876543210fedcba9876543210")}
+	assert.False(t, otherSigner.verify(marker))
+}
+
+func TestWorkflowIdentity(t *testing.T) {
+	assert.Equal(t, "safedep/ghcp/.github/workflows/ci.yml", workflowIdentity(gh.GitHubTokenContext{
+		WorkflowRef: "safedep/ghcp/.github/workflows/ci.yml@refs/pull/1/merge",
+	}))
+
+	assert.Equal(t, "safedep/shared/.github/workflows/vet.yml", workflowIdentity(gh.GitHubTokenContext{
+		WorkflowRef:    "safedep/ghcp/.github/workflows/ci.yml@refs/heads/main",
+		JobWorkflowRef: "safedep/shared/.github/workflows/vet.yml@refs/tags/v1",
+	}))
+
+	assert.Empty(t, workflowIdentity(gh.GitHubTokenContext{}))
+}